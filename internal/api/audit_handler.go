@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type AuditHandler struct {
+	auditStore store.AuditStore
+	logger     *log.Logger
+}
+
+// NewAuditHandler creates a new instance of AuditHandler
+func NewAuditHandler(auditStore store.AuditStore, logger *log.Logger) *AuditHandler {
+	return &AuditHandler{
+		auditStore: auditStore,
+		logger:     logger,
+	}
+}
+
+/*
+	List audit events, most recent first. Admins only. Every query parameter is optional:
+	- actor_id, action, resource, resource_id: only events matching these
+	- since, until: RFC 3339 times, e.g. 2025-03-14T00:00:00Z
+	- before_id: for paging, pass the id of the last event of the previous page
+	- limit: how many events, 100 by default and 1000 at most
+*/
+
+func (h *AuditHandler) HandleListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := store.AuditFilter{
+		Action:     query.Get("action"),
+		Resource:   query.Get("resource"),
+		ResourceID: query.Get("resource_id"),
+		Limit:      defaultAuditLimit,
+	}
+
+	if actorID := query.Get("actor_id"); actorID != "" {
+		id, err := strconv.Atoi(actorID)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "actor_id must be a user ID"}) // 400
+			return
+		}
+		filter.ActorID = &id
+	}
+	for param, dest := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": param + " must be an RFC 3339 time, e.g. 2025-03-14T00:00:00Z"}) // 400
+			return
+		}
+		*dest = &t
+	}
+	if beforeID := query.Get("before_id"); beforeID != "" {
+		id, err := strconv.ParseInt(beforeID, 10, 64)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "before_id must be an event ID"}) // 400
+			return
+		}
+		filter.BeforeID = id
+	}
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxAuditLimit {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit)}) // 400
+			return
+		}
+		filter.Limit = l
+	}
+
+	events, err := h.auditStore.ListAuditEvents(filter)
+	if err != nil {
+		h.logger.Printf("Error listing audit events: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to list audit events"}) // 500
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"events": events}) // 200
+}
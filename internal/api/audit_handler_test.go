@@ -0,0 +1,48 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditEndpoint(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	admin, owner := s.register(), s.register()
+	users := map[string]*testUser{"admin": admin, "owner": owner}
+
+	// Admins are only made in the database
+	_, err := s.db.Exec(`UPDATE users SET is_admin = TRUE WHERE id = ?`, admin.ID)
+	require.NoError(t, err)
+	s.createWorkout(owner, "Legs")
+
+	s.run([]endpointTest{
+		{"list", http.MethodGet, "/v1/admin/audit", "admin", nil, http.StatusOK},
+		{"list anonymously", http.MethodGet, "/v1/admin/audit", "anonymous", nil, http.StatusUnauthorized},
+		{"list as a user", http.MethodGet, "/v1/admin/audit", "owner", nil, http.StatusForbidden},
+		{"list with invalid actor", http.MethodGet, "/v1/admin/audit?actor_id=someone", "admin", nil, http.StatusBadRequest},
+		{"list with invalid time", http.MethodGet, "/v1/admin/audit?since=yesterday", "admin", nil, http.StatusBadRequest},
+		{"list too many", http.MethodGet, "/v1/admin/audit?limit=100000", "admin", nil, http.StatusBadRequest},
+	}, users)
+
+	// The audit log may be written in the background
+	target := fmt.Sprintf("/v1/admin/audit?actor_id=%d&action=workout.created", owner.ID)
+	require.Eventually(t, func() bool {
+		rec := s.request(http.MethodGet, target, admin, nil)
+		var listed struct {
+			Events []store.AuditEvent `json:"events"`
+		}
+		decode(t, rec, &listed)
+		return len(listed.Events) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	rec := s.request(http.MethodGet, fmt.Sprintf("/v1/admin/audit?actor_id=%d&action=workout.created", admin.ID), admin, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"events": []}`, rec.Body.String())
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/calendar"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/tokens"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+/*
+	Calendar apps can't send an Authorization header when they refresh a subscription, so the feed URL itself carries a token.
+	That token has its own "calendar" scope: it only unlocks the read-only feed, and can't be used as a bearer token on the rest of the API.
+*/
+
+// How long a calendar subscription URL stays valid before the user has to generate a new one
+const calendarTokenTTL = 365 * 24 * time.Hour
+
+type CalendarHandler struct {
+	workoutStore store.WorkoutStore
+	userStore    store.UserStore
+	tokenStore   store.TokenStore
+	logger       *log.Logger
+}
+
+// NewCalendarHandler creates a new instance of CalendarHandler
+func NewCalendarHandler(workoutStore store.WorkoutStore, userStore store.UserStore, tokenStore store.TokenStore, logger *log.Logger) *CalendarHandler {
+	return &CalendarHandler{
+		workoutStore: workoutStore,
+		userStore:    userStore,
+		tokenStore:   tokenStore,
+		logger:       logger,
+	}
+}
+
+// Create (or rotate) the calendar feed URL of the current user.
+// Any previous calendar token is deleted, so old subscription URLs stop working.
+func (h *CalendarHandler) HandleCreateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	err := h.tokenStore.DeleteAllTokensForUser(tokens.ScopeCalendar, currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error deleting old calendar tokens: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal Server Error"})
+		return
+	}
+
+	token, err := h.tokenStore.CreateNewToken(currentUser.ID, calendarTokenTTL, tokens.ScopeCalendar)
+	if err != nil {
+		h.logger.Printf("Error creating calendar token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal Server Error"})
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	// Under the version the request came in with, so the URL outlives the unversioned routes
+	prefix := ""
+	if version := middleware.GetAPIVersion(r); version != "" {
+		prefix = "/" + version
+	}
+	feedURL := fmt.Sprintf("%s://%s%s/calendar/%s.ics", scheme, r.Host, prefix, token.Plaintext)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"calendar_token": token.Plaintext,
+		"calendar_url":   feedURL,
+		"expiry":         token.Expiry,
+	}) // 201
+}
+
+// Serve the iCalendar feed of scheduled workouts for the user owning the token in the URL.
+func (h *CalendarHandler) HandleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	user, err := h.userStore.GetUserToken(tokens.ScopeCalendar, token)
+	if err != nil {
+		h.logger.Printf("Error fetching calendar token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal Server Error"})
+		return
+	}
+	if user == nil {
+		// Same answer for unknown and expired tokens, so the URL doesn't leak anything
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Calendar not found"}) // 404
+		return
+	}
+
+	workouts, err := h.workoutStore.GetScheduledWorkouts(user.ID)
+	if err != nil {
+		h.logger.Printf("Error fetching scheduled workouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch workouts"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="workouts.ics"`)
+	err = calendar.WriteFeed(w, user.Username+"'s workouts", workouts, time.Now())
+	if err != nil {
+		// Headers are already sent at this point, all we can do is log
+		h.logger.Printf("Error writing calendar feed: %v", err)
+	}
+}
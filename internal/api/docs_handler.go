@@ -0,0 +1,45 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// The docs page is Swagger UI (loaded from a CDN) pointed at the openapi.json next to it (e.g. /v1/openapi.json), so "Try it out" calls this server
+//
+//go:embed docs.html
+var docsPage []byte
+
+type DocsHandler struct {
+	spec   []byte // The OpenAPI document, encoded once
+	logger *log.Logger
+}
+
+// NewDocsHandler creates a new instance of DocsHandler
+func NewDocsHandler(logger *log.Logger) *DocsHandler {
+	spec, err := json.MarshalIndent(OpenAPISpec(), "", "  ")
+	if err != nil {
+		// The document only holds plain values, so this is a bug
+		panic(err)
+	}
+	return &DocsHandler{
+		spec:   spec,
+		logger: logger,
+	}
+}
+
+// Serve the OpenAPI document of the API, see OpenAPISpec
+func (h *DocsHandler) HandleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(h.spec)
+}
+
+// Serve the browsable documentation
+func (h *DocsHandler) HandleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(docsPage)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/export"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+)
+
+// defaultExportWriteTimeout is how long each workout of an export gets to be written when the server has no write timeout
+const defaultExportWriteTimeout = 30 * time.Second
+
+type ExportHandler struct {
+	workoutStore store.WorkoutStore
+	logger       *log.Logger
+}
+
+// NewExportHandler creates a new instance of ExportHandler
+func NewExportHandler(workoutStore store.WorkoutStore, logger *log.Logger) *ExportHandler {
+	return &ExportHandler{
+		workoutStore: workoutStore,
+		logger:       logger,
+	}
+}
+
+// Download all of the current user's workouts. The format is picked with ?format=csv|json|ndjson (json by default).
+func (h *ExportHandler) HandleExportWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatJSON
+	}
+
+	writer, err := export.NewWriter(format, w)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
+		return
+	}
+
+	/*
+		A large export takes longer than the server's write timeout, which is meant for regular requests, so the deadline
+		is pushed back before each workout instead: the export as a whole can take as long as it needs, but a client that
+		stops reading is dropped after one timeout, along with the database cursor (and transaction) the export holds.
+	*/
+	controller := http.NewResponseController(w)
+	timeout := exportWriteTimeout(r)
+	write := writer.Write
+	err = controller.SetWriteDeadline(time.Now().Add(timeout))
+	if err != nil {
+		h.logger.Printf("Cannot extend the write timeout of the export: %v", err)
+	} else {
+		write = func(workout *store.Workout) error {
+			err := controller.SetWriteDeadline(time.Now().Add(timeout))
+			if err != nil {
+				return err
+			}
+			return writer.Write(workout)
+		}
+	}
+
+	// Content-Disposition: attachment tells browsers to download the response as a file instead of displaying it
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, export.Filename(format, time.Now())))
+
+	/*
+		The export is streamed: workouts are written to the response as they're read from the database.
+		The flip side is that once the first bytes are out, the status code (200) can't be changed anymore,
+		so errors past that point can only be logged. The client will see a truncated file.
+	*/
+	err = h.workoutStore.StreamWorkouts(currentUser.ID, write)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		h.logger.Printf("Error exporting workouts for user %d: %v", currentUser.ID, err)
+	}
+}
+
+// exportWriteTimeout is the write timeout of the server, the time a regular response gets
+func exportWriteTimeout(r *http.Request) time.Duration {
+	server, ok := r.Context().Value(http.ServerContextKey).(*http.Server)
+	if ok && server.WriteTimeout > 0 {
+		return server.WriteTimeout
+	}
+	return defaultExportWriteTimeout
+}
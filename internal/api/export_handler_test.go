@@ -0,0 +1,135 @@
+package api_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportEndpoint(t *testing.T) {
+	t.Parallel()
+	s := newTestServerWith(t, store.NewMemoryStores())
+	owner, other := s.register(), s.register()
+	users := map[string]*testUser{"owner": owner, "other": other}
+	s.createWorkout(owner, "Legs")
+	s.createWorkout(owner, "Arms")
+	s.createWorkout(other, "Not theirs")
+
+	s.run([]endpointTest{
+		{"json", http.MethodGet, "/v1/users/me/export", "owner", nil, http.StatusOK},
+		{"csv", http.MethodGet, "/v1/users/me/export?format=csv", "owner", nil, http.StatusOK},
+		{"ndjson", http.MethodGet, "/v1/users/me/export?format=ndjson", "owner", nil, http.StatusOK},
+		{"anonymously", http.MethodGet, "/v1/users/me/export", "anonymous", nil, http.StatusUnauthorized},
+		{"unknown format", http.MethodGet, "/v1/users/me/export?format=xml", "owner", nil, http.StatusBadRequest},
+	}, users)
+
+	// Only the current user's workouts are exported
+	rec := s.request(http.MethodGet, "/v1/users/me/export?format=ndjson", owner, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var titles []string
+	scanner := bufio.NewScanner(strings.NewReader(rec.Body.String()))
+	for scanner.Scan() {
+		var workout store.Workout
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &workout), scanner.Text())
+		assert.Equal(t, owner.ID, workout.UserID)
+		titles = append(titles, workout.Title)
+	}
+	assert.ElementsMatch(t, []string{"Legs", "Arms"}, titles)
+}
+
+// slowWorkoutStore takes its time to stream each workout, like a large export would
+type slowWorkoutStore struct {
+	store.WorkoutStore
+	delay time.Duration
+}
+
+func (s slowWorkoutStore) StreamWorkouts(userID int, fn func(*store.Workout) error) error {
+	return s.WorkoutStore.StreamWorkouts(userID, func(workout *store.Workout) error {
+		time.Sleep(s.delay)
+		return fn(workout)
+	})
+}
+
+// The server's write timeout is meant for regular requests: exports outlast it instead of being cut off
+func TestExportOutlastsWriteTimeout(t *testing.T) {
+	t.Parallel()
+	stores := store.NewMemoryStores()
+	stores.Workouts = slowWorkoutStore{WorkoutStore: stores.Workouts, delay: 100 * time.Millisecond}
+	s := newTestServerWith(t, stores)
+	owner := s.register()
+	for _, title := range []string{"Legs", "Arms", "Back"} {
+		s.createWorkout(owner, title)
+	}
+	server := httptest.NewUnstartedServer(s.router)
+	server.Config.WriteTimeout = 150 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/users/me/export?format=ndjson", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+owner.Token)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(body)), "\n"), 3)
+}
+
+// endlessWorkoutStore streams large workouts until it can't write any more, and reports why it stopped
+type endlessWorkoutStore struct {
+	store.WorkoutStore
+	stopped chan error
+}
+
+func (s endlessWorkoutStore) StreamWorkouts(userID int, fn func(*store.Workout) error) error {
+	workout := &store.Workout{UserID: userID, Title: "Legs", Description: strings.Repeat("squats ", 10_000), Entries: []store.WorkoutEntry{}}
+	for {
+		err := fn(workout)
+		if err != nil {
+			s.stopped <- err
+			return err
+		}
+	}
+}
+
+// A client that stops reading doesn't hold the export (and the database cursor behind it) open forever
+func TestExportDropsClientsThatStopReading(t *testing.T) {
+	t.Parallel()
+	stores := store.NewMemoryStores()
+	stopped := make(chan error, 1)
+	stores.Workouts = endlessWorkoutStore{WorkoutStore: stores.Workouts, stopped: stopped}
+	s := newTestServerWith(t, stores)
+	owner := s.register()
+	server := httptest.NewUnstartedServer(s.router)
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/users/me/export?format=ndjson", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+owner.Token)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// The body is never read
+	select {
+	case err := <-stopped:
+		assert.Error(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the export is still going")
+	}
+}
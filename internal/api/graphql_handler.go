@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/dataloader"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+	"github.com/graph-gophers/graphql-go"
+)
+
+/*
+	GraphQL, for clients that want to fetch related data in one round trip, e.g. the current user with their latest
+	workouts, the entries of those, and their records:
+		POST /graphql {"query": "{ me { username workouts(limit: 5) { title entries { exerciseName weight } } records { exerciseName weight } } }"}
+	The schema is in schema.graphql. Resolvers (graphql_resolvers.go) go through the same stores as the REST handlers,
+	with the same ownership checks and audit log, and the current user comes from the same authentication middleware.
+*/
+
+//go:embed schema.graphql
+var graphqlSchema string
+
+/*
+	Limits on what a single request can ask for, so it can't cost an unbounded amount of work:
+	- maxGraphQLDepth: deepest nesting a query can have
+	- maxGraphQLQueryLength: longest query, in bytes, which bounds how many fields (and aliases of them) it can select
+	- maxGraphQLCost: how much the resolvers of a request may read from the store, see graphqlContext.spend
+*/
+
+const (
+	maxGraphQLDepth       = 10
+	maxGraphQLQueryLength = 10_000
+	maxGraphQLCost        = 500
+)
+
+type GraphQLHandler struct {
+	schema       *graphql.Schema
+	workoutStore store.WorkoutStore
+	logger       *log.Logger
+}
+
+// NewGraphQLHandler creates a new instance of GraphQLHandler. It panics if the schema doesn't match the resolvers.
+func NewGraphQLHandler(workoutStore store.WorkoutStore, auditLogger *audit.Logger, logger *log.Logger) *GraphQLHandler {
+	resolver := &graphqlResolver{
+		workoutStore: workoutStore,
+		audit:        auditLogger,
+		logger:       logger,
+	}
+	return &GraphQLHandler{
+		schema:       graphql.MustParseSchema(graphqlSchema, resolver, graphql.MaxDepth(maxGraphQLDepth), graphql.MaxQueryLength(maxGraphQLQueryLength)),
+		workoutStore: workoutStore,
+		logger:       logger,
+	}
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+/*
+	Per-request state the resolvers need, found in the context: the HTTP request (for the audit log), the loaders,
+	which batch what resolvers load for each item of a list, and what the request has cost so far. They only live as
+	long as the request, so nothing is cached across requests.
+*/
+
+type graphqlContext struct {
+	request *http.Request
+	entries *dataloader.Loader[int64, []store.WorkoutEntry] // Entries of workouts, by workout ID
+	cost    atomic.Int64                                    // Resolvers run concurrently
+}
+
+var errGraphQLTooComplex = fmt.Errorf("query is too complex, it can read at most %d rows", maxGraphQLCost)
+
+// spend adds cost (roughly, the number of rows a resolver reads) to the request's, and fails once it's over maxGraphQLCost.
+// Every resolver that reads from the store spends before it does, so a query asking for the same fields many times over
+// (e.g. with aliases) is cut short.
+func (c *graphqlContext) spend(cost int) error {
+	if c.cost.Add(int64(cost)) > maxGraphQLCost {
+		return errGraphQLTooComplex
+	}
+	return nil
+}
+
+type graphqlContextKey struct{}
+
+func getGraphQLContext(ctx context.Context) *graphqlContext {
+	return ctx.Value(graphqlContextKey{}).(*graphqlContext)
+}
+
+func (h *GraphQLHandler) HandleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Query == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload, expected {\"query\": ...}"}) // 400
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), graphqlContextKey{}, &graphqlContext{
+		request: r,
+		entries: dataloader.New(func(workoutIDs []int64) (map[int64][]store.WorkoutEntry, error) {
+			entries, err := h.workoutStore.GetEntriesForWorkouts(workoutIDs)
+			if err != nil {
+				h.logger.Printf("GraphQL: failed to fetch workout entries: %v", err)
+			}
+			return entries, err
+		}),
+	})
+	response := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+	// Like most GraphQL servers, errors in resolving the query are reported in the body, with a 200
+	body := utils.Envelope{"data": response.Data}
+	if len(response.Errors) > 0 {
+		body["errors"] = response.Errors
+	}
+	utils.WriteJSON(w, http.StatusOK, body) // 200
+}
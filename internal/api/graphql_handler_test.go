@@ -0,0 +1,93 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphQLEndpoint(t *testing.T) {
+	t.Parallel()
+	s := newTestServerWith(t, store.NewMemoryStores())
+	owner, other := s.register(), s.register()
+	users := map[string]*testUser{"owner": owner, "other": other}
+	workout := s.createWorkout(owner, "Legs")
+	query := func(query string) map[string]string { return map[string]string{"query": query} }
+	byID := fmt.Sprintf(`{ workout(id: "%d") { title entries { exerciseName } } }`, workout.ID)
+
+	s.run([]endpointTest{
+		{"query", http.MethodPost, "/v1/graphql", "owner", query(byID), http.StatusOK},
+		{"query anonymously", http.MethodPost, "/v1/graphql", "anonymous", query(byID), http.StatusUnauthorized},
+		{"without query", http.MethodPost, "/v1/graphql", "owner", map[string]string{}, http.StatusBadRequest},
+		{"invalid JSON", http.MethodPost, "/v1/graphql", "owner", "{", http.StatusBadRequest},
+	}, users)
+
+	// Errors and missing data are in the body, with a 200
+	type response struct {
+		Data struct {
+			Workout *struct {
+				Title   string `json:"title"`
+				Entries []struct {
+					ExerciseName string `json:"exerciseName"`
+				} `json:"entries"`
+			} `json:"workout"`
+		} `json:"data"`
+		Errors []interface{} `json:"errors"`
+	}
+
+	var found response
+	decode(t, s.request(http.MethodPost, "/v1/graphql", owner, query(byID)), &found)
+	require.NotNil(t, found.Data.Workout)
+	assert.Equal(t, "Legs", found.Data.Workout.Title)
+	assert.Len(t, found.Data.Workout.Entries, 2)
+
+	var notFound response
+	decode(t, s.request(http.MethodPost, "/v1/graphql", other, query(byID)), &notFound)
+	assert.Nil(t, notFound.Data.Workout, "other users' workouts don't exist for them")
+
+	var deleted response
+	mutation := fmt.Sprintf(`mutation { deleteWorkout(id: "%d") }`, workout.ID)
+	decode(t, s.request(http.MethodPost, "/v1/graphql", other, query(mutation)), &deleted)
+	assert.NotEmpty(t, deleted.Errors)
+	_, stillThere := s.getWorkout(owner, workout.ID)
+	assert.True(t, stillThere)
+}
+
+// Asking for the same fields over and over, with aliases, is cut short instead of reading the store each time
+func TestGraphQLLimitsCost(t *testing.T) {
+	t.Parallel()
+	s := newTestServerWith(t, store.NewMemoryStores())
+	owner := s.register()
+	s.createWorkout(owner, "Legs")
+	type response struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	aliases := func(n int) string {
+		query := "{ me {"
+		for i := range n {
+			query += fmt.Sprintf(" w%d: workouts(limit: 100) { title }", i)
+		}
+		return query + " } }"
+	}
+
+	var cheap response
+	decode(t, s.request(http.MethodPost, "/v1/graphql", owner, map[string]string{"query": aliases(5)}), &cheap)
+	assert.Empty(t, cheap.Errors)
+
+	var expensive response
+	decode(t, s.request(http.MethodPost, "/v1/graphql", owner, map[string]string{"query": aliases(6)}), &expensive)
+	require.NotEmpty(t, expensive.Errors)
+	assert.Contains(t, expensive.Errors[0].Message, "too complex")
+
+	var tooLong response
+	decode(t, s.request(http.MethodPost, "/v1/graphql", owner, map[string]string{"query": aliases(1000)}), &tooLong)
+	assert.NotEmpty(t, tooLong.Errors)
+	assert.Nil(t, tooLong.Data["me"])
+}
@@ -0,0 +1,503 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/graph-gophers/graphql-go"
+)
+
+/*
+	Resolvers of schema.graphql. graphql-go matches each field of the schema to the method of the same name
+	(e.g. exerciseName to ExerciseName). GraphQL's Int is an int32 and nullable values are pointers.
+	Errors returned by resolvers are shown to the client, so unexpected ones are logged and replaced with a generic message.
+*/
+
+// Largest number of workouts a single field returns
+const maxGraphQLWorkouts = 100
+
+// What records cost (see graphqlContext.spend): they're computed from every entry of the user, like a full page of workouts
+const graphqlRecordsCost = maxGraphQLWorkouts
+
+var (
+	errGraphQLNotFound = errors.New("workout not found")
+	errGraphQLInternal = errors.New("internal error")
+)
+
+type graphqlResolver struct {
+	workoutStore store.WorkoutStore
+	audit        *audit.Logger
+	logger       *log.Logger
+}
+
+// internalError logs an unexpected error and returns the one the client sees
+func (r *graphqlResolver) internalError(action string, err error) error {
+	r.logger.Printf("GraphQL: failed to %s: %v", action, err)
+	return errGraphQLInternal
+}
+
+// parseID turns a GraphQL ID back into the ID of a row
+func parseID(id graphql.ID) (int64, error) {
+	parsed, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid ID " + string(id))
+	}
+	return parsed, nil
+}
+
+func toID(id int) graphql.ID {
+	return graphql.ID(strconv.Itoa(id))
+}
+
+// int32Ptr and intPtr convert between the store's optional ints and GraphQL's
+func int32Ptr(value *int) *int32 {
+	if value == nil {
+		return nil
+	}
+	converted := int32(*value)
+	return &converted
+}
+
+func intPtr(value *int32) *int {
+	if value == nil {
+		return nil
+	}
+	converted := int(*value)
+	return &converted
+}
+
+// ownWorkout returns a workout of the current user, or errGraphQLNotFound. Someone else's workout is simply not found.
+func (r *graphqlResolver) ownWorkout(ctx context.Context, id graphql.ID) (*store.Workout, error) {
+	workoutID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	err = getGraphQLContext(ctx).spend(1)
+	if err != nil {
+		return nil, err
+	}
+	workout, err := r.workoutStore.GetWorkoutByID(workoutID)
+	if err != nil {
+		return nil, r.internalError("fetch workout", err)
+	}
+	if workout == nil || workout.UserID != middleware.GetUserFromContext(ctx).ID {
+		return nil, errGraphQLNotFound
+	}
+	return workout, nil
+}
+
+// Queries
+
+func (r *graphqlResolver) Me(ctx context.Context) *userResolver {
+	return &userResolver{root: r, user: middleware.GetUserFromContext(ctx)}
+}
+
+func (r *graphqlResolver) Workout(ctx context.Context, args struct{ ID graphql.ID }) (*workoutResolver, error) {
+	workout, err := r.ownWorkout(ctx, args.ID)
+	if errors.Is(err, errGraphQLNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &workoutResolver{workout: workout, withEntries: true}, nil
+}
+
+// Mutations
+
+type workoutEntryInput struct {
+	ExerciseName    string
+	Sets            int32
+	Reps            *int32
+	DurationSeconds *int32
+	Weight          *float64
+	Notes           *string
+	OrderIndex      *int32
+}
+
+func (input *workoutEntryInput) entry() store.WorkoutEntry {
+	entry := store.WorkoutEntry{
+		ExerciseName:    input.ExerciseName,
+		Sets:            int(input.Sets),
+		Reps:            intPtr(input.Reps),
+		DurationSeconds: intPtr(input.DurationSeconds),
+		Weight:          input.Weight,
+	}
+	if input.Notes != nil {
+		entry.Notes = *input.Notes
+	}
+	if input.OrderIndex != nil {
+		entry.OrderIndex = int(*input.OrderIndex)
+	}
+	return entry
+}
+
+// entries converts and validates the entries of a workout input, like the REST routes do
+func entriesInput(inputs []workoutEntryInput) ([]store.WorkoutEntry, error) {
+	entries := make([]store.WorkoutEntry, len(inputs))
+	for i := range inputs {
+		entries[i] = inputs[i].entry()
+		err := validateEntry(&entries[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+type workoutInput struct {
+	Title          string
+	Description    *string
+	Duration       *int32
+	CaloriesBurned *int32
+	PlannedFor     *graphql.Time
+	Status         *string
+	Entries        *[]workoutEntryInput
+}
+
+// A new workout is a blank one updated with every field of the input
+func (input *workoutInput) update() *workoutUpdateInput {
+	return &workoutUpdateInput{
+		Title:          &input.Title,
+		Description:    input.Description,
+		Duration:       input.Duration,
+		CaloriesBurned: input.CaloriesBurned,
+		PlannedFor:     input.PlannedFor,
+		Status:         input.Status,
+		Entries:        input.Entries,
+	}
+}
+
+type workoutUpdateInput struct {
+	Title          *string
+	Description    *string
+	Duration       *int32
+	CaloriesBurned *int32
+	PlannedFor     *graphql.Time
+	Status         *string
+	Entries        *[]workoutEntryInput
+}
+
+// apply sets the fields given in the input, like updateWorkoutRequest.apply does for PATCH /workouts/{id}
+func (input *workoutUpdateInput) apply(workout *store.Workout) error {
+	req := updateWorkoutRequest{
+		Title:           input.Title,
+		Description:     input.Description,
+		DurationMinutes: intPtr(input.Duration),
+		CaloriesBurned:  intPtr(input.CaloriesBurned),
+		Status:          input.Status,
+	}
+	if input.PlannedFor != nil {
+		req.PlannedFor = &input.PlannedFor.Time
+	}
+	if input.Entries != nil {
+		entries, err := entriesInput(*input.Entries)
+		if err != nil {
+			return err
+		}
+		req.Entries = &entries
+	}
+	return req.apply(workout)
+}
+
+func (r *graphqlResolver) CreateWorkout(ctx context.Context, args struct{ Input workoutInput }) (*workoutResolver, error) {
+	currentUser := middleware.GetUserFromContext(ctx)
+	workout := &store.Workout{UserID: currentUser.ID, Entries: []store.WorkoutEntry{}}
+	err := args.Input.update().apply(workout)
+	if err != nil {
+		return nil, err
+	}
+	if workout.Title == "" {
+		return nil, errors.New("title is required")
+	}
+	err = getGraphQLContext(ctx).spend(1)
+	if err != nil {
+		return nil, err
+	}
+
+	createdWorkout, err := r.workoutStore.CreateWorkout(workout)
+	if errors.Is(err, store.ErrInvalidUUID) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, r.internalError("create workout", err)
+	}
+
+	r.audit.Record(getGraphQLContext(ctx).request, audit.Event{
+		ActorID:    currentUser.ID,
+		Action:     audit.ActionWorkoutCreated,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: createdWorkout.ID,
+		After:      createdWorkout,
+	})
+	return &workoutResolver{workout: createdWorkout, withEntries: true}, nil
+}
+
+type updateWorkoutArgs struct {
+	ID      graphql.ID
+	Input   workoutUpdateInput
+	Version *int32
+}
+
+func (r *graphqlResolver) UpdateWorkout(ctx context.Context, args updateWorkoutArgs) (*workoutResolver, error) {
+	workout, err := r.ownWorkout(ctx, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Like If-Match on PATCH /workouts/{id}
+	if args.Version != nil && int(*args.Version) != workout.Version {
+		return nil, store.ErrVersionConflict
+	}
+
+	before := snapshotWorkout(workout)
+	err = args.Input.apply(workout)
+	if err != nil {
+		return nil, err
+	}
+	err = r.workoutStore.UpdateWorkout(workout)
+	if errors.Is(err, store.ErrVersionConflict) || errors.Is(err, store.ErrInvalidUUID) || errors.Is(err, store.ErrInvalidEntries) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, r.internalError("update workout", err)
+	}
+
+	r.audit.Record(getGraphQLContext(ctx).request, audit.Event{
+		ActorID:    workout.UserID,
+		Action:     audit.ActionWorkoutUpdated,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: workout.ID,
+		Before:     before,
+		After:      workout,
+	})
+	return &workoutResolver{workout: workout, withEntries: true}, nil
+}
+
+func (r *graphqlResolver) DeleteWorkout(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	workout, err := r.ownWorkout(ctx, args.ID)
+	if err != nil {
+		return false, err
+	}
+	err = r.workoutStore.DeleteWorkout(int64(workout.ID), workout.Version)
+	if errors.Is(err, store.ErrVersionConflict) {
+		return false, err
+	}
+	if err != nil {
+		return false, r.internalError("delete workout", err)
+	}
+
+	r.audit.Record(getGraphQLContext(ctx).request, audit.Event{
+		ActorID:    workout.UserID,
+		Action:     audit.ActionWorkoutDeleted,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: workout.ID,
+		Before:     workout,
+	})
+	return true, nil
+}
+
+type addWorkoutEntryArgs struct {
+	WorkoutID graphql.ID
+	Input     workoutEntryInput
+}
+
+func (r *graphqlResolver) AddWorkoutEntry(ctx context.Context, args addWorkoutEntryArgs) (*entryResolver, error) {
+	workout, err := r.ownWorkout(ctx, args.WorkoutID)
+	if err != nil {
+		return nil, err
+	}
+	entry := args.Input.entry()
+	err = validateEntry(&entry)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.workoutStore.AddWorkoutEntry(int64(workout.ID), workout.Version, &entry)
+	if errors.Is(err, store.ErrInvalidUUID) || errors.Is(err, store.ErrVersionConflict) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, r.internalError("add workout entry", err)
+	}
+
+	r.audit.Record(getGraphQLContext(ctx).request, audit.Event{
+		ActorID:    workout.UserID,
+		Action:     audit.ActionEntryCreated,
+		Resource:   audit.ResourceEntry,
+		ResourceID: entry.ID,
+		After:      &entry,
+		Metadata:   map[string]interface{}{"workout_id": workout.ID},
+	})
+	return &entryResolver{entry: entry}, nil
+}
+
+type deleteWorkoutEntryArgs struct {
+	WorkoutID graphql.ID
+	EntryID   graphql.ID
+}
+
+func (r *graphqlResolver) DeleteWorkoutEntry(ctx context.Context, args deleteWorkoutEntryArgs) (bool, error) {
+	workout, err := r.ownWorkout(ctx, args.WorkoutID)
+	if err != nil {
+		return false, err
+	}
+	entryID, err := parseID(args.EntryID)
+	if err != nil {
+		return false, err
+	}
+
+	var entry *store.WorkoutEntry
+	for i := range workout.Entries {
+		if int64(workout.Entries[i].ID) == entryID {
+			entry = &workout.Entries[i]
+			break
+		}
+	}
+	if entry == nil {
+		return false, errors.New("entry not found")
+	}
+
+	_, err = r.workoutStore.DeleteWorkoutEntry(int64(workout.ID), workout.Version, entryID)
+	if errors.Is(err, store.ErrInvalidEntries) {
+		return false, errors.New("entry not found")
+	}
+	if errors.Is(err, store.ErrVersionConflict) {
+		return false, err
+	}
+	if err != nil {
+		return false, r.internalError("delete workout entry", err)
+	}
+
+	r.audit.Record(getGraphQLContext(ctx).request, audit.Event{
+		ActorID:    workout.UserID,
+		Action:     audit.ActionEntryDeleted,
+		Resource:   audit.ResourceEntry,
+		ResourceID: entry.ID,
+		Before:     entry,
+		Metadata:   map[string]interface{}{"workout_id": workout.ID},
+	})
+	return true, nil
+}
+
+// Types
+
+type userResolver struct {
+	root *graphqlResolver
+	user *store.User
+}
+
+func (u *userResolver) ID() graphql.ID          { return toID(u.user.ID) }
+func (u *userResolver) Username() string        { return u.user.Username }
+func (u *userResolver) Email() string           { return u.user.Email }
+func (u *userResolver) Bio() string             { return u.user.Bio }
+func (u *userResolver) CreatedAt() graphql.Time { return graphql.Time{Time: u.user.CreatedAt} }
+
+// Workouts come without their entries: the entries of all of them are loaded in one query, if asked for
+func (u *userResolver) Workouts(ctx context.Context, args struct{ Limit int32 }) ([]*workoutResolver, error) {
+	if args.Limit < 1 || args.Limit > maxGraphQLWorkouts {
+		return nil, errors.New("limit must be between 1 and 100")
+	}
+	err := getGraphQLContext(ctx).spend(int(args.Limit))
+	if err != nil {
+		return nil, err
+	}
+	workouts, err := u.root.workoutStore.GetRecentWorkouts(u.user.ID, int(args.Limit))
+	if err != nil {
+		return nil, u.root.internalError("fetch workouts", err)
+	}
+
+	loader := getGraphQLContext(ctx).entries
+	resolvers := make([]*workoutResolver, len(workouts))
+	for i := range workouts {
+		loader.Want(int64(workouts[i].ID))
+		resolvers[i] = &workoutResolver{workout: &workouts[i]}
+	}
+	return resolvers, nil
+}
+
+func (u *userResolver) Records(ctx context.Context) ([]*recordResolver, error) {
+	err := getGraphQLContext(ctx).spend(graphqlRecordsCost)
+	if err != nil {
+		return nil, err
+	}
+	records, err := u.root.workoutStore.GetPersonalRecords(u.user.ID)
+	if err != nil {
+		return nil, u.root.internalError("fetch records", err)
+	}
+	resolvers := make([]*recordResolver, len(records))
+	for i := range records {
+		resolvers[i] = &recordResolver{record: records[i]}
+	}
+	return resolvers, nil
+}
+
+type workoutResolver struct {
+	workout     *store.Workout
+	withEntries bool // Whether workout.Entries is loaded, otherwise they come from the entries loader
+}
+
+func (w *workoutResolver) ID() graphql.ID        { return toID(w.workout.ID) }
+func (w *workoutResolver) UUID() string          { return w.workout.UUID }
+func (w *workoutResolver) Title() string         { return w.workout.Title }
+func (w *workoutResolver) Description() string   { return w.workout.Description }
+func (w *workoutResolver) Duration() int32       { return int32(w.workout.DurationMinutes) }
+func (w *workoutResolver) CaloriesBurned() int32 { return int32(w.workout.CaloriesBurned) }
+func (w *workoutResolver) Status() string        { return w.workout.Status }
+func (w *workoutResolver) Version() int32        { return int32(w.workout.Version) }
+func (w *workoutResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: w.workout.UpdatedAt}
+}
+
+func (w *workoutResolver) PlannedFor() *graphql.Time {
+	if w.workout.PlannedFor == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *w.workout.PlannedFor}
+}
+
+func (w *workoutResolver) Entries(ctx context.Context) ([]*entryResolver, error) {
+	entries := w.workout.Entries
+	if !w.withEntries {
+		var err error
+		entries, err = getGraphQLContext(ctx).entries.Load(int64(w.workout.ID))
+		if err != nil {
+			return nil, errGraphQLInternal // Logged by the loader, see HandleGraphQL
+		}
+	}
+	resolvers := make([]*entryResolver, len(entries))
+	for i := range entries {
+		resolvers[i] = &entryResolver{entry: entries[i]}
+	}
+	return resolvers, nil
+}
+
+type entryResolver struct {
+	entry store.WorkoutEntry
+}
+
+func (e *entryResolver) ID() graphql.ID          { return toID(e.entry.ID) }
+func (e *entryResolver) UUID() string            { return e.entry.UUID }
+func (e *entryResolver) ExerciseName() string    { return e.entry.ExerciseName }
+func (e *entryResolver) Sets() int32             { return int32(e.entry.Sets) }
+func (e *entryResolver) Reps() *int32            { return int32Ptr(e.entry.Reps) }
+func (e *entryResolver) DurationSeconds() *int32 { return int32Ptr(e.entry.DurationSeconds) }
+func (e *entryResolver) Weight() *float64        { return e.entry.Weight }
+func (e *entryResolver) Notes() string           { return e.entry.Notes }
+func (e *entryResolver) OrderIndex() int32       { return int32(e.entry.OrderIndex) }
+
+type recordResolver struct {
+	record store.PersonalRecord
+}
+
+func (r *recordResolver) ExerciseName() string  { return r.record.ExerciseName }
+func (r *recordResolver) Weight() float64       { return r.record.Weight }
+func (r *recordResolver) WorkoutID() graphql.ID { return toID(r.record.WorkoutID) }
+func (r *recordResolver) EntryID() graphql.ID   { return toID(r.record.EntryID) }
+func (r *recordResolver) AchievedAt() graphql.Time {
+	return graphql.Time{Time: r.record.AchievedAt}
+}
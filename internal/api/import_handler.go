@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/importer"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+)
+
+// Largest CSV file accepted by the import endpoint (10 MB)
+const maxImportSize = 10 << 20
+
+type ImportHandler struct {
+	workoutStore store.WorkoutStore
+	audit        *audit.Logger
+	logger       *log.Logger
+}
+
+// NewImportHandler creates a new instance of ImportHandler
+func NewImportHandler(workoutStore store.WorkoutStore, auditLogger *audit.Logger, logger *log.Logger) *ImportHandler {
+	return &ImportHandler{
+		workoutStore: workoutStore,
+		audit:        auditLogger,
+		logger:       logger,
+	}
+}
+
+/*
+	Import workouts from a CSV file, sent as multipart/form-data with these fields:
+	- file: the CSV file
+	- format: csv (generic, needs a mapping), strong or hevy
+	- mapping: JSON column mapping, only for the csv format. e.g. {"columns": {"title": "Name", "exercise_name": "Exercise", "reps": "Reps"}}
+	- dry_run: "true" to only validate the file and report what would be imported, without saving anything
+
+	Rows with errors are reported (with their row number) and the workouts they belong to are left out. Everything else is imported.
+	Workouts with an external ID the user already has are skipped, so re-running an import is safe.
+*/
+
+func (h *ImportHandler) HandleImportWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		h.logger.Printf("Error parsing import form: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Expected a multipart form with a CSV file of at most 10 MB"}) // 400
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = importer.FormatCSV
+	}
+
+	dryRun := false
+	if raw := r.FormValue("dry_run"); raw != "" {
+		dryRun, err = strconv.ParseBool(raw)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "dry_run must be true or false"}) // 400
+			return
+		}
+	}
+
+	var mapping *importer.Mapping
+	if raw := r.FormValue("mapping"); raw != "" {
+		mapping = &importer.Mapping{}
+		err = json.Unmarshal([]byte(raw), mapping)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid mapping: " + err.Error()}) // 400
+			return
+		}
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Missing CSV file in the file field"}) // 400
+		return
+	}
+	defer file.Close()
+
+	result, err := importer.Parse(file, format, mapping, currentUser.ID)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
+		return
+	}
+
+	report := utils.Envelope{
+		"dry_run":  dryRun,
+		"workouts": len(result.Workouts), // Valid workouts found in the file
+		"errors":   result.Errors,
+	}
+
+	if dryRun {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"import": report}) // 200
+		return
+	}
+
+	created, err := h.workoutStore.ImportWorkouts(result.Workouts)
+	// One event for the whole import rather than one per workout, recorded even if it stopped halfway
+	if created > 0 {
+		h.audit.Record(r, audit.Event{
+			ActorID:  currentUser.ID,
+			Action:   audit.ActionWorkoutImported,
+			Resource: audit.ResourceWorkout,
+			Metadata: map[string]interface{}{"format": format, "created": created},
+		})
+	}
+	if err != nil {
+		h.logger.Printf("Error importing workouts: %v", err)
+		// Batches before the failing one are committed, so tell the client how far we got
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to import workouts", "created": created}) // 500
+		return
+	}
+
+	report["created"] = created
+	report["skipped_duplicates"] = len(result.Workouts) - created
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"import": report}) // 201
+}
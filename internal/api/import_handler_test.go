@@ -0,0 +1,121 @@
+package api_test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const strongExport = `Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+2023-01-15 08:30:00,Leg day,1h 5m,Squat (Barbell),1,100,5,0,0,,Felt strong,
+2023-01-15 08:30:00,Leg day,1h 5m,Squat (Barbell),2,100,5,0,0,,Felt strong,
+2023-01-17 18:00:00,Push day,45m,Bench Press (Barbell),1,80,8,0,0,,,
+`
+
+// importForm is a multipart import request. A field with an empty value is left out.
+func importForm(t *testing.T, fields map[string]string, file string) (string, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if value != "" {
+			require.NoError(t, form.WriteField(name, value))
+		}
+	}
+	if file != "" {
+		part, err := form.CreateFormFile("file", "export.csv")
+		require.NoError(t, err)
+		_, err = part.Write([]byte(file))
+		require.NoError(t, err)
+	}
+	require.NoError(t, form.Close())
+	return body.String(), form.FormDataContentType()
+}
+
+func TestImportEndpoint(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner := s.register()
+	users := map[string]*testUser{"owner": owner}
+
+	tests := []struct {
+		name   string
+		as     string
+		fields map[string]string
+		file   string
+		status int
+	}{
+		{"dry run", "owner", map[string]string{"format": "strong", "dry_run": "true"}, strongExport, http.StatusOK},
+		{"anonymously", "anonymous", map[string]string{"format": "strong"}, strongExport, http.StatusUnauthorized},
+		{"without file", "owner", map[string]string{"format": "strong"}, "", http.StatusBadRequest},
+		{"unknown format", "owner", map[string]string{"format": "fitbit"}, strongExport, http.StatusBadRequest},
+		{"csv without mapping", "owner", map[string]string{"format": "csv"}, strongExport, http.StatusBadRequest},
+		{"invalid mapping", "owner", map[string]string{"format": "csv", "mapping": "{"}, strongExport, http.StatusBadRequest},
+		{"invalid dry run", "owner", map[string]string{"format": "strong", "dry_run": "maybe"}, strongExport, http.StatusBadRequest},
+		{"import", "owner", map[string]string{"format": "strong"}, strongExport, http.StatusCreated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, contentType := importForm(t, test.fields, test.file)
+			rec := s.requestWithHeaders(http.MethodPost, "/v1/workouts/import", users[test.as], body, map[string]string{"Content-Type": contentType})
+			require.Equal(t, test.status, rec.Code, rec.Body.String())
+		})
+	}
+
+	s.run([]endpointTest{
+		{"not a form", http.MethodPost, "/v1/workouts/import", "owner", map[string]string{"format": "strong"}, http.StatusBadRequest},
+	}, users)
+
+	// Importing the same file again skips what's already there
+	body, contentType := importForm(t, map[string]string{"format": "strong"}, strongExport)
+	rec := s.requestWithHeaders(http.MethodPost, "/v1/workouts/import", owner, body, map[string]string{"Content-Type": contentType})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var report struct {
+		Import struct {
+			Created           int `json:"created"`
+			SkippedDuplicates int `json:"skipped_duplicates"`
+		} `json:"import"`
+	}
+	decode(t, rec, &report)
+	assert.Equal(t, 0, report.Import.Created)
+	assert.Equal(t, 2, report.Import.SkippedDuplicates)
+}
+
+// Timed exercises (a plank in seconds) make it from the file to the database, not just through the parser
+func TestImportTimedExercises(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner := s.register()
+
+	strong := `Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+2023-01-15 08:30:00,Core,20m,Plank,1,0,0,0,60,,,
+2023-01-15 08:30:00,Core,20m,Crunch,1,0,20,0,0,,,
+`
+	hevy := `title,start_time,end_time,description,exercise_title,superset_id,exercise_notes,set_index,set_type,weight_kg,reps,distance_km,duration_seconds,rpe
+Cardio,"16 Jan 2023, 07:00","16 Jan 2023, 07:40",,Rowing,,,0,normal,,,,1800,
+`
+	for format, file := range map[string]string{"strong": strong, "hevy": hevy} {
+		body, contentType := importForm(t, map[string]string{"format": format}, file)
+		rec := s.requestWithHeaders(http.MethodPost, "/v1/workouts/import", owner, body, map[string]string{"Content-Type": contentType})
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	durations := map[string]*int{}
+	err := s.stores.Workouts.StreamWorkouts(owner.ID, func(workout *store.Workout) error {
+		for _, entry := range workout.Entries {
+			if entry.Reps == nil {
+				durations[entry.ExerciseName] = entry.DurationSeconds
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, durations, 2)
+	assert.Equal(t, 60, *durations["Plank"])
+	assert.Equal(t, 1800, *durations["Rowing"])
+}
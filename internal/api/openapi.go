@@ -0,0 +1,572 @@
+package api
+
+import (
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/OlivierCoq/go_api_template/internal/importer"
+	"github.com/OlivierCoq/go_api_template/internal/openapi"
+	"github.com/OlivierCoq/go_api_template/internal/realtime"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+)
+
+/*
+	The OpenAPI description of the REST API, served at /openapi.json (see DocsHandler).
+	Every route of routes.SetupRoutes has an entry in apiOperations below: its summary, parameters, body and responses.
+	Bodies and responses are described with the same types the handlers use, so the schemas follow the code. What has
+	to be kept up to date by hand is the list itself, and a test in the routes package fails when a route is missing.
+
+	Responses are Envelopes, e.g. {"workout": {...}}, and errors are {"error": "what went wrong"} (the Error schema).
+	Requests are checked against this document before reaching the handlers, see middleware.RequestValidator.
+*/
+
+const (
+	tagAuth     = "Authentication"
+	tagUsers    = "Users"
+	tagWorkouts = "Workouts"
+	tagEntries  = "Workout entries"
+	tagSessions = "Workout sessions"
+	tagSync     = "Sync"
+	tagWebhooks = "Webhooks"
+	tagCalendar = "Calendar"
+	tagLive     = "Live updates"
+	tagAdmin    = "Admin"
+	tagMeta     = "Meta"
+
+	// Who can call an operation
+	authNone  = ""
+	authUser  = "user"
+	authAdmin = "admin"
+)
+
+// apiOperation is a route of the API and what it takes and returns
+type apiOperation struct {
+	method    string
+	path      string
+	id        string
+	summary   string
+	tag       string
+	auth      string
+	params    []*openapi.Parameter
+	body      *openapi.RequestBody
+	responses map[int]*openapi.Response
+}
+
+// OpenAPISpec returns the OpenAPI document of the API. It's built once, callers must not change it.
+func OpenAPISpec() *openapi.Document {
+	return openAPISpec()
+}
+
+var openAPISpec = sync.OnceValue(buildOpenAPISpec)
+
+func buildOpenAPISpec() *openapi.Document {
+	g := openapi.NewGenerator()
+	g.Schemas["Error"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"error":   {Type: "string"},
+			"details": {Type: "array", Items: g.SchemaFor(openapi.ValidationError{}), Description: "What's wrong with each invalid field, for requests rejected by the validation middleware"},
+		},
+		Required: []string{"error"},
+	}
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Workouts API",
+			Version:     "1.0.0",
+			Description: "Workouts, their entries and live sessions of the current user. Authenticate with a token from POST /tokens/authentication, sent as Authorization: Bearer <token>. This describes v1; v2 is the same except that workouts have duration_minutes instead of duration.",
+		},
+		// The unversioned paths still work, but are deprecated
+		Servers: []openapi.Server{
+			{URL: "/v1", Description: "Version 1"},
+		},
+		Paths: make(map[string]*openapi.PathItem),
+		Components: openapi.Components{
+			Schemas: g.Schemas,
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", Description: "Token from POST /tokens/authentication"},
+			},
+		},
+	}
+
+	for _, op := range apiOperations(g) {
+		operation := &openapi.Operation{
+			OperationID: op.id,
+			Summary:     op.summary,
+			Tags:        []string{op.tag},
+			Parameters:  op.params,
+			RequestBody: op.body,
+			Responses:   make(map[string]*openapi.Response),
+		}
+		for status, response := range op.responses {
+			operation.Responses[strconv.Itoa(status)] = response
+		}
+		// What the authentication middleware answers
+		if op.auth != authNone {
+			operation.Security = []map[string][]string{{"bearerAuth": {}}}
+			operation.Responses["401"] = errorResponse(http.StatusUnauthorized)
+		}
+		if op.auth == authAdmin {
+			operation.Responses["403"] = errorResponse(http.StatusForbidden)
+		}
+		// What the validation middleware answers, see middleware.RequestValidator
+		if len(op.params) > 0 || op.body != nil {
+			operation.Responses["400"] = errorResponse(http.StatusBadRequest)
+		}
+		if op.body != nil && op.body.Content["application/json"].Schema != nil {
+			operation.Responses["413"] = errorResponse(http.StatusRequestEntityTooLarge)
+		}
+
+		item := doc.Paths[op.path]
+		if item == nil {
+			item = &openapi.PathItem{}
+			doc.Paths[op.path] = item
+		}
+		(*item)[strings.ToLower(op.method)] = operation
+	}
+	return doc
+}
+
+// Building blocks of apiOperations
+
+func jsonBody(schema *openapi.Schema) *openapi.RequestBody {
+	return &openapi.RequestBody{
+		Required: true,
+		Content:  map[string]openapi.MediaType{"application/json": {Schema: schema}},
+	}
+}
+
+func jsonResponse(description string, schema *openapi.Schema) *openapi.Response {
+	return &openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"application/json": {Schema: schema}},
+	}
+}
+
+// envelope is a response wrapping a single value, e.g. envelope("The workout", "workout", g.SchemaFor(store.Workout{}))
+func envelope(description, key string, schema *openapi.Schema) *openapi.Response {
+	return jsonResponse(description, openapi.Object(map[string]*openapi.Schema{key: schema}))
+}
+
+func listOf(schema *openapi.Schema) *openapi.Schema {
+	return &openapi.Schema{Type: "array", Items: schema}
+}
+
+func errorResponse(status int) *openapi.Response {
+	return jsonResponse(http.StatusText(status), &openapi.Schema{Ref: "#/components/schemas/Error"})
+}
+
+// withErrors adds an error response for each status to responses
+func withErrors(responses map[int]*openapi.Response, statuses ...int) map[int]*openapi.Response {
+	for _, status := range statuses {
+		responses[status] = errorResponse(status)
+	}
+	return responses
+}
+
+func noContent(description string) *openapi.Response {
+	return &openapi.Response{Description: description}
+}
+
+func pathID(name, description string) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "path", Required: true, Description: description, Schema: &openapi.Schema{Type: "integer", Format: "int64"}}
+}
+
+func queryParam(name, description string, schema *openapi.Schema) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func ifMatch() *openapi.Parameter {
+	return &openapi.Parameter{Name: "If-Match", In: "header", Description: "ETag of the workout, to only apply the change if nobody changed it since", Schema: &openapi.Schema{Type: "string"}}
+}
+
+func etag() map[string]*openapi.Header {
+	return map[string]*openapi.Header{"ETag": {Description: "Version of the workout, for If-Match", Schema: &openapi.Schema{Type: "string"}}}
+}
+
+func withETag(response *openapi.Response) *openapi.Response {
+	response.Headers = etag()
+	return response
+}
+
+func enum(values ...interface{}) *openapi.Schema {
+	return &openapi.Schema{Type: "string", Enum: values}
+}
+
+// syncChange is the schema of a change of the sync feed. Its workouts come without their entries, which are changes of their own.
+func syncChange(g *openapi.Generator) *openapi.Schema {
+	change := g.SchemaFor(store.SyncChange{})
+	workout := *g.Schemas["Workout"]
+	workout.Properties = maps.Clone(workout.Properties)
+	entries := openapi.Nullable(workout.Properties["entries"])
+	entries.Description = "Never filled in: entries are synced as changes of type entry"
+	workout.Properties["entries"] = entries
+	g.Schemas["SyncWorkout"] = &workout
+	g.Schemas["SyncChange"].Properties["workout"] = &openapi.Schema{Ref: "#/components/schemas/SyncWorkout"}
+	return change
+}
+
+// apiOperations lists every route of the API, in the order of routes.SetupRoutes
+func apiOperations(g *openapi.Generator) []apiOperation {
+	workout := g.SchemaFor(store.Workout{})
+	entry := g.SchemaFor(store.WorkoutEntry{})
+	session := g.SchemaFor(store.WorkoutSession{})
+	user := g.SchemaFor(store.User{})
+	webhook := g.SchemaFor(store.WebhookSubscription{})
+	workoutID := pathID("id", "Workout ID")
+	sessionID := pathID("id", "Session ID")
+	entryID := pathID("entryID", "Entry ID")
+	limit := func(max int) *openapi.Schema {
+		min, maximum := 1.0, float64(max)
+		return &openapi.Schema{Type: "integer", Format: "int32", Minimum: &min, Maximum: &maximum}
+	}
+
+	workouts := func(path, id, summary, description string) apiOperation {
+		return apiOperation{method: http.MethodGet, path: path, id: id, summary: summary, tag: tagWorkouts, auth: authUser,
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope(description, "workouts", listOf(workout))}, http.StatusInternalServerError)}
+	}
+	sessionChange := func(method, path, id, summary string, body *openapi.RequestBody) apiOperation {
+		return apiOperation{method: method, path: path, id: id, summary: summary, tag: tagSessions, auth: authUser,
+			params: []*openapi.Parameter{sessionID}, body: body,
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope("The session", "session", session)},
+				http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError)}
+	}
+
+	// Logging a set creates it, so it's a 201 rather than the 200 of other changes
+	logSet := sessionChange(http.MethodPost, "/sessions/{id}/sets", "logSessionSet", "Log a set, optionally starting a rest timer",
+		jsonBody(openapi.Require(g.SchemaFor(logSetRequest{}), "exercise_name")))
+	logSet.responses[http.StatusCreated] = logSet.responses[http.StatusOK]
+	delete(logSet.responses, http.StatusOK)
+
+	return []apiOperation{
+		// Workouts
+		workouts("/workouts/upcoming", "getUpcomingWorkouts", "Scheduled workouts that are still planned", "Planned workouts, soonest first"),
+		workouts("/workouts/overdue", "getOverdueWorkouts", "Planned workouts whose date has passed", "Overdue workouts"),
+		workouts("/workouts/trash", "getTrash", "Deleted workouts, which can still be restored", "Workouts in the trash"),
+		{
+			method: http.MethodGet, path: "/workouts/{id}", id: "getWorkout", summary: "A workout of the current user, with its entries",
+			tag: tagWorkouts, auth: authUser, params: []*openapi.Parameter{workoutID},
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: withETag(envelope("The workout", "workout", workout))},
+				http.StatusNotFound, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPost, path: "/workouts", id: "createWorkout", summary: "Create a workout",
+			tag: tagWorkouts, auth: authUser, body: jsonBody(openapi.Require(workout, "title")),
+			responses: withErrors(map[int]*openapi.Response{http.StatusCreated: envelope("The created workout", "workout", workout)},
+				http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPost, path: "/workouts/batch", id: "batchWorkouts", summary: "Create, update and delete many workouts at once",
+			tag: tagWorkouts, auth: authUser, body: jsonBody(openapi.Require(g.SchemaFor(batchRequest{}), "operations")),
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope("The result of each operation, in order", "results", listOf(g.SchemaFor(batchResult{})))},
+				// An atomic batch that fails has the status of the failing operation
+				http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed,
+				http.StatusFailedDependency, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPost, path: "/workouts/import", id: "importWorkouts", summary: "Import workouts from a CSV file",
+			tag: tagWorkouts, auth: authUser,
+			body: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{"multipart/form-data": {Schema: openapi.Require(&openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"file":    {Type: "string", Format: "binary", Description: "The CSV file, 10 MB at most"},
+					"format":  enum(importer.FormatCSV, importer.FormatStrong, importer.FormatHevy),
+					"mapping": {Type: "string", Description: `JSON column mapping, for the csv format, e.g. {"columns": {"title": "Name"}}`},
+					"dry_run": {Type: "boolean", Description: "Only validate the file, without saving anything"},
+				},
+			}, "file")}}},
+			responses: withErrors(map[int]*openapi.Response{
+				http.StatusOK: envelope("What would be imported (dry run)", "import", openapi.Object(map[string]*openapi.Schema{
+					"dry_run": {Type: "boolean"}, "workouts": {Type: "integer"}, "errors": listOf(g.SchemaFor(importer.RowError{})),
+				})),
+				http.StatusCreated: envelope("What was imported", "import", openapi.Object(map[string]*openapi.Schema{
+					"dry_run": {Type: "boolean"}, "workouts": {Type: "integer"}, "errors": listOf(g.SchemaFor(importer.RowError{})),
+					"created": {Type: "integer"}, "skipped_duplicates": {Type: "integer"},
+				})),
+			}, http.StatusBadRequest, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPatch, path: "/workouts/{id}", id: "updateWorkout", summary: "Change some fields of a workout. Entries, if given, replace the existing ones",
+			tag: tagWorkouts, auth: authUser, params: []*openapi.Parameter{workoutID, ifMatch()}, body: jsonBody(g.SchemaFor(updateWorkoutRequest{})),
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: withETag(envelope("The updated workout", "workout", workout))},
+				http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodDelete, path: "/workouts/{id}", id: "deleteWorkout", summary: "Move a workout to the trash",
+			tag: tagWorkouts, auth: authUser, params: []*openapi.Parameter{workoutID, ifMatch()},
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: noContent("Moved to the trash")},
+				http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPost, path: "/workouts/{id}/restore", id: "restoreWorkout", summary: "Take a workout out of the trash",
+			tag: tagWorkouts, auth: authUser, params: []*openapi.Parameter{workoutID},
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: withETag(envelope("The restored workout", "workout", workout))},
+				http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+		},
+
+		// Entries
+		{
+			method: http.MethodPost, path: "/workouts/{id}/entries", id: "addWorkoutEntry", summary: "Add an entry to a workout",
+			tag: tagEntries, auth: authUser, params: []*openapi.Parameter{workoutID, ifMatch()}, body: jsonBody(openapi.Require(entry, "exercise_name")),
+			responses: withErrors(map[int]*openapi.Response{http.StatusCreated: withETag(envelope("The added entry", "entry", entry))},
+				http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPut, path: "/workouts/{id}/entries/order", id: "reorderWorkoutEntries", summary: "Put the entries of a workout in a new order",
+			tag: tagEntries, auth: authUser, params: []*openapi.Parameter{workoutID, ifMatch()}, body: jsonBody(openapi.Require(g.SchemaFor(reorderEntriesRequest{}), "entry_ids")),
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: withETag(envelope("The workout, with its entries in the new order", "workout", workout))},
+				http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPatch, path: "/workouts/{id}/entries/{entryID}", id: "updateWorkoutEntry", summary: "Change some fields of an entry",
+			tag: tagEntries, auth: authUser, params: []*openapi.Parameter{workoutID, entryID, ifMatch()}, body: jsonBody(g.SchemaFor(updateEntryRequest{})),
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: withETag(envelope("The updated entry", "entry", entry))},
+				http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodDelete, path: "/workouts/{id}/entries/{entryID}", id: "deleteWorkoutEntry", summary: "Remove an entry from a workout",
+			tag: tagEntries, auth: authUser, params: []*openapi.Parameter{workoutID, entryID, ifMatch()},
+			responses: withErrors(map[int]*openapi.Response{http.StatusNoContent: {Description: "Removed", Headers: etag()}},
+				http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusInternalServerError),
+		},
+
+		// Sessions
+		{
+			method: http.MethodPost, path: "/sessions", id: "createSession", summary: "Start a live workout session, optionally from a workout as a template",
+			tag: tagSessions, auth: authUser, body: jsonBody(g.SchemaFor(createSessionRequest{})),
+			responses: withErrors(map[int]*openapi.Response{http.StatusCreated: envelope("The started session", "session", session)},
+				http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodGet, path: "/sessions/current", id: "getCurrentSession", summary: "The session in progress, if any",
+			tag: tagSessions, auth: authUser,
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope("The session in progress", "session", session)},
+				http.StatusNotFound, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodGet, path: "/sessions/{id}", id: "getSession", summary: "A session of the current user",
+			tag: tagSessions, auth: authUser, params: []*openapi.Parameter{sessionID},
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope("The session", "session", session)},
+				http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodDelete, path: "/sessions/{id}", id: "discardSession", summary: "Stop a session without saving it",
+			tag: tagSessions, auth: authUser, params: []*openapi.Parameter{sessionID},
+			responses: withErrors(map[int]*openapi.Response{http.StatusNoContent: noContent("Discarded")},
+				http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError),
+		},
+		logSet,
+		sessionChange(http.MethodPost, "/sessions/{id}/rest", "startSessionRest", "Start a rest timer", jsonBody(openapi.Require(g.SchemaFor(restRequest{}), "seconds"))),
+		sessionChange(http.MethodDelete, "/sessions/{id}/rest", "stopSessionRest", "Stop the rest timer", nil),
+		sessionChange(http.MethodPost, "/sessions/{id}/pause", "pauseSession", "Pause a session", nil),
+		sessionChange(http.MethodPost, "/sessions/{id}/resume", "resumeSession", "Resume a paused session", nil),
+		{
+			method: http.MethodPost, path: "/sessions/{id}/finish", id: "finishSession", summary: "Finish a session and save it as a completed workout",
+			tag: tagSessions, auth: authUser, params: []*openapi.Parameter{sessionID},
+			responses: withErrors(map[int]*openapi.Response{http.StatusCreated: envelope("The saved workout", "workout", workout)},
+				http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError),
+		},
+
+		// Sync
+		{
+			method: http.MethodGet, path: "/sync", id: "getChanges", summary: "Changes to the current user's workouts since a cursor",
+			tag: tagSync, auth: authUser,
+			params: []*openapi.Parameter{
+				queryParam("since", "Cursor returned by the previous pull, 0 to start", &openapi.Schema{Type: "string"}),
+				queryParam("limit", "How many changes, 500 by default", limit(maxSyncLimit)),
+			},
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: jsonResponse("A page of changes", openapi.Object(map[string]*openapi.Schema{
+				"changes":  listOf(syncChange(g)),
+				"cursor":   {Type: "string", Description: "Send it as since in the next pull"},
+				"has_more": {Type: "boolean"},
+			}))}, http.StatusBadRequest, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPost, path: "/sync", id: "pushChanges", summary: "Push changes made offline. Conflicts are resolved with last-writer-wins",
+			tag: tagSync, auth: authUser, body: jsonBody(openapi.Require(g.SchemaFor(syncPushRequest{}), "changes")),
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope("The result of each change, in order", "results", listOf(g.SchemaFor(syncPushResult{})))},
+				http.StatusBadRequest, http.StatusInternalServerError),
+		},
+
+		// Users
+		{
+			method: http.MethodGet, path: "/users/me/export", id: "exportWorkouts", summary: "Download all of the current user's workouts",
+			tag: tagUsers, auth: authUser,
+			params: []*openapi.Parameter{queryParam("format", "json by default", enum("csv", "json", "ndjson"))},
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: {
+				Description: "The workouts, as an attachment",
+				Content: map[string]openapi.MediaType{
+					"application/json":     {Schema: openapi.Object(map[string]*openapi.Schema{"workouts": listOf(workout)})},
+					"application/x-ndjson": {Schema: &openapi.Schema{Type: "string"}},
+					"text/csv":             {Schema: &openapi.Schema{Type: "string"}},
+				},
+			}}, http.StatusBadRequest, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPatch, path: "/users/me", id: "updateCurrentUser", summary: "Change the profile of the current user",
+			tag: tagUsers, auth: authUser, body: jsonBody(g.SchemaFor(updateUserRequest{})),
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope("The updated user", "user", user)},
+				http.StatusBadRequest, http.StatusInternalServerError),
+		},
+
+		// Webhooks
+		{
+			method: http.MethodGet, path: "/webhooks", id: "getWebhooks", summary: "Webhook subscriptions of the current user",
+			tag: tagWebhooks, auth: authUser,
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope("The subscriptions", "webhooks", listOf(webhook))}, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPost, path: "/webhooks", id: "createWebhook", summary: "Subscribe a URL to workout events. The signing secret is only returned this once",
+			tag: tagWebhooks, auth: authUser, body: jsonBody(openapi.Require(g.SchemaFor(createWebhookRequest{}), "url", "event_types")),
+			responses: withErrors(map[int]*openapi.Response{http.StatusCreated: envelope("The subscription, with its secret", "webhook", webhook)},
+				http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodGet, path: "/webhooks/dead-letters", id: "getDeadLetters", summary: "Deliveries that failed for good",
+			tag: tagWebhooks, auth: authUser,
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope("The failed deliveries", "deliveries", listOf(g.SchemaFor(store.WebhookDelivery{})))}, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPost, path: "/webhooks/dead-letters/{id}/retry", id: "retryDeadLetter", summary: "Try a failed delivery again",
+			tag: tagWebhooks, auth: authUser, params: []*openapi.Parameter{pathID("id", "Delivery ID")},
+			responses: withErrors(map[int]*openapi.Response{http.StatusAccepted: noContent("Queued for delivery")},
+				http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodDelete, path: "/webhooks/{id}", id: "deleteWebhook", summary: "Unsubscribe",
+			tag: tagWebhooks, auth: authUser, params: []*openapi.Parameter{pathID("id", "Subscription ID")},
+			responses: withErrors(map[int]*openapi.Response{http.StatusNoContent: noContent("Deleted")},
+				http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+		},
+
+		// GraphQL
+		{
+			method: http.MethodPost, path: "/graphql", id: "graphql", summary: "GraphQL queries and mutations over the current user's data, see schema.graphql",
+			tag: tagWorkouts, auth: authUser, body: jsonBody(openapi.Require(&openapi.Schema{
+				// Written out rather than generated from graphqlRequest, since GraphQL clients send null for what they leave out
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"query":         {Type: "string"},
+					"operationName": {Type: []string{"string", "null"}},
+					"variables":     {Type: []string{"object", "null"}},
+				},
+			}, "query")),
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: jsonResponse("The GraphQL result. Errors are reported in errors, still with a 200", &openapi.Schema{
+				Type:       "object",
+				Properties: map[string]*openapi.Schema{"data": {}, "errors": listOf(&openapi.Schema{Type: "object"})},
+			})}, http.StatusBadRequest),
+		},
+
+		// Admin
+		{
+			method: http.MethodGet, path: "/admin/audit", id: "listAuditEvents", summary: "The audit log, most recent first",
+			tag: tagAdmin, auth: authAdmin,
+			params: []*openapi.Parameter{
+				queryParam("actor_id", "Only events done by this user", &openapi.Schema{Type: "integer"}),
+				queryParam("action", "e.g. workout.deleted", &openapi.Schema{Type: "string"}),
+				queryParam("resource", "e.g. workout", &openapi.Schema{Type: "string"}),
+				queryParam("resource_id", "", &openapi.Schema{Type: "string"}),
+				queryParam("since", "", &openapi.Schema{Type: "string", Format: "date-time"}),
+				queryParam("until", "", &openapi.Schema{Type: "string", Format: "date-time"}),
+				queryParam("before_id", "For paging: the ID of the last event of the previous page", &openapi.Schema{Type: "integer", Format: "int64"}),
+				queryParam("limit", "100 by default", limit(maxAuditLimit)),
+			},
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope("The events", "events", listOf(g.SchemaFor(store.AuditEvent{})))},
+				http.StatusBadRequest, http.StatusInternalServerError),
+		},
+
+		// Calendar
+		{
+			method: http.MethodPost, path: "/tokens/calendar", id: "createCalendarToken", summary: "Create (or rotate) the calendar feed URL of the current user",
+			tag: tagCalendar, auth: authUser,
+			responses: withErrors(map[int]*openapi.Response{http.StatusCreated: jsonResponse("The feed URL", openapi.Object(map[string]*openapi.Schema{
+				"calendar_token": {Type: "string"},
+				"calendar_url":   {Type: "string", Format: "uri"},
+				"expiry":         {Type: "string", Format: "date-time"},
+			}))}, http.StatusInternalServerError),
+		},
+
+		// Live updates
+		{
+			method: http.MethodPost, path: "/tokens/realtime", id: "createRealtimeToken", summary: "Create a token to open live update connections with, valid for a minute",
+			tag: tagLive, auth: authUser,
+			responses: withErrors(map[int]*openapi.Response{http.StatusCreated: jsonResponse("The token, to pass as ?access_token=", openapi.Object(map[string]*openapi.Schema{
+				"realtime_token": {Type: "string"},
+				"expiry":         {Type: "string", Format: "date-time"},
+			}))}, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodGet, path: "/events", id: "streamEvents", summary: "Live updates of the current user's workouts, as Server-Sent Events",
+			tag: tagLive, auth: authUser, params: []*openapi.Parameter{accessToken()},
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: {
+				Description: "One event per change, named after its type",
+				Content:     map[string]openapi.MediaType{"text/event-stream": {Schema: g.SchemaFor(realtime.Notification{})}},
+			}}, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodGet, path: "/ws", id: "webSocket", summary: "The same live updates, over a WebSocket",
+			tag: tagLive, auth: authUser, params: []*openapi.Parameter{accessToken()},
+			responses: withErrors(map[int]*openapi.Response{http.StatusSwitchingProtocols: noContent("Upgraded to a WebSocket, sending notifications as text messages")},
+				http.StatusBadRequest),
+		},
+
+		// Public routes
+		{
+			method: http.MethodGet, path: "/health", id: "healthCheck", summary: "Whether the server is up",
+			tag: tagMeta,
+			responses: map[int]*openapi.Response{http.StatusOK: {
+				Description: "It is",
+				Content:     map[string]openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}},
+			}},
+		},
+		{
+			method: http.MethodGet, path: "/openapi.json", id: "getOpenAPISpec", summary: "This document",
+			tag:       tagMeta,
+			responses: map[int]*openapi.Response{http.StatusOK: jsonResponse("The OpenAPI document", &openapi.Schema{Type: "object"})},
+		},
+		{
+			method: http.MethodGet, path: "/docs", id: "getDocs", summary: "Browsable documentation of this API",
+			tag: tagMeta,
+			responses: map[int]*openapi.Response{http.StatusOK: {
+				Description: "An HTML page",
+				Content:     map[string]openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}},
+			}},
+		},
+		{
+			method: http.MethodPost, path: "/users/register", id: "registerUser", summary: "Create an account",
+			tag: tagUsers, body: jsonBody(openapi.Require(g.SchemaFor(RegisterUserRequest{}), "username", "email", "password")),
+			responses: withErrors(map[int]*openapi.Response{http.StatusCreated: envelope("The created user", "user", user)},
+				http.StatusBadRequest, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodPost, path: "/tokens/authentication", id: "createToken", summary: "Log in: trade a username and password for a token, valid for 24 hours",
+			tag: tagAuth, body: jsonBody(openapi.Require(g.SchemaFor(createTokenRequest{}), "username", "password")),
+			responses: withErrors(map[int]*openapi.Response{http.StatusCreated: envelope("The token", "auth_token", &openapi.Schema{Type: "string"})},
+				http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodGet, path: "/calendar/{token}.ics", id: "getCalendarFeed", summary: "iCalendar feed of the scheduled workouts of the token's user",
+			tag:    tagCalendar,
+			params: []*openapi.Parameter{{Name: "token", In: "path", Required: true, Description: "Calendar token, from POST /tokens/calendar", Schema: &openapi.Schema{Type: "string"}}},
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: {
+				Description: "The feed",
+				Content:     map[string]openapi.MediaType{"text/calendar": {Schema: &openapi.Schema{Type: "string"}}},
+			}}, http.StatusNotFound, http.StatusInternalServerError),
+		},
+		{
+			method: http.MethodDelete, path: "/tokens/authentication", id: "revokeToken", summary: "Log out: revoke the token of the request",
+			tag: tagAuth, auth: authUser,
+			responses: withErrors(map[int]*openapi.Response{http.StatusOK: envelope("Revoked", "message", &openapi.Schema{Type: "string"})},
+				http.StatusInternalServerError),
+		},
+	}
+}
+
+// accessToken is the token parameter of routes behind middleware.AuthenticateRealtime
+func accessToken() *openapi.Parameter {
+	return queryParam("access_token", "A realtime token from POST /tokens/realtime, for clients that can't set headers (EventSource, WebSocket)", &openapi.Schema{Type: "string"})
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/realtime"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/tokens"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+	"github.com/coder/websocket"
+)
+
+const (
+	// How often an idle stream sends something, so proxies and load balancers don't close it
+	keepAliveInterval = 25 * time.Second
+
+	// How long a WebSocket client gets to take a message or answer a ping
+	webSocketTimeout = 10 * time.Second
+
+	// How long a realtime token can be used to open a connection. Connections outlive it.
+	realtimeTokenTTL = time.Minute
+)
+
+type RealtimeHandler struct {
+	hub        *realtime.Hub
+	tokenStore store.TokenStore
+	logger     *log.Logger
+}
+
+// NewRealtimeHandler creates a new instance of RealtimeHandler
+func NewRealtimeHandler(hub *realtime.Hub, tokenStore store.TokenStore, logger *log.Logger) *RealtimeHandler {
+	return &RealtimeHandler{
+		hub:        hub,
+		tokenStore: tokenStore,
+		logger:     logger,
+	}
+}
+
+/*
+	Live updates of the current user's workouts, as Server-Sent Events:
+		event: workout.updated
+		data: {"type": "workout.updated", "workout_id": 12, "uuid": "...", "version": 4}
+	The stream stays open until the client disconnects. Browsers' EventSource can't send an Authorization header,
+	so a realtime token (see HandleCreateRealtimeToken) can be passed as ?access_token=... instead
+*/
+
+func (h *RealtimeHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	// The stream outlives the server's write timeout, which is meant for regular requests
+	controller := http.NewResponseController(w)
+	err := controller.SetWriteDeadline(time.Time{})
+	if err != nil {
+		h.logger.Printf("Cannot stream events: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Streaming is not supported"}) // 500
+		return
+	}
+
+	notifications, unsubscribe := h.hub.Subscribe(currentUser.ID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stops nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return // The client went away
+		case <-keepAlive.C:
+			// Lines starting with a colon are comments, ignored by clients
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case notification := <-notifications:
+			var data []byte
+			data, err = json.Marshal(notification)
+			if err == nil {
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", notification.Type, data)
+			}
+		}
+		if err == nil {
+			err = controller.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+/*
+	The same notifications as HandleEvents, as WebSocket text messages. The client isn't expected to send anything:
+	a message from it closes the connection. It's pinged every keepAliveInterval, and dropped if it doesn't answer.
+*/
+
+func (h *RealtimeHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "not a websocket handshake"}) // 400
+		return
+	}
+	// Subscribed before the handshake completes, so nothing is missed once the client sees the connection open
+	notifications, unsubscribe := h.hub.Subscribe(currentUser.ID)
+	defer unsubscribe()
+
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		// Connections are authenticated with a token from an Authorization header or the URL, never with cookies, so a
+		// page of another origin can't open one on behalf of a user: any origin can connect, as with the rest of the API.
+		OriginPatterns: []string{"*"},
+	})
+	if err != nil {
+		// Accept already answered the request
+		h.logger.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	// Reading answers pings and pongs, closes the connection if a message comes (without reading it), and tells us the
+	// client left: ctx is done once the connection is closed
+	ctx := conn.CloseRead(r.Context())
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			err = withTimeout(ctx, conn.Ping)
+		case notification := <-notifications:
+			var data []byte
+			data, err = json.Marshal(notification)
+			if err == nil {
+				err = withTimeout(ctx, func(ctx context.Context) error {
+					return conn.Write(ctx, websocket.MessageText, data)
+				})
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// withTimeout calls fn, giving up after webSocketTimeout: a client that doesn't read or answer pings is gone
+func withTimeout(ctx context.Context, fn func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, webSocketTimeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// HandleCreateRealtimeToken creates the token to open live update connections with, from browsers that can only pass
+// it in the URL (see middleware.AuthenticateRealtime). It's only good for a minute, and only for that.
+func (h *RealtimeHandler) HandleCreateRealtimeToken(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	token, err := h.tokenStore.CreateNewToken(currentUser.ID, realtimeTokenTTL, tokens.ScopeRealtime)
+	if err != nil {
+		h.logger.Printf("Error creating realtime token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal Server Error"}) // 500
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"realtime_token": token.Plaintext, "expiry": token.Expiry}) // 201
+}
@@ -0,0 +1,129 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealtimeEndpoints(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner := s.register()
+	users := map[string]*testUser{"owner": owner, "bogus": {Token: "NOTAREALTOKENNOTAREALTOKEN"}}
+
+	s.run([]endpointTest{
+		{"events anonymously", http.MethodGet, "/v1/events", "anonymous", nil, http.StatusUnauthorized},
+		{"events with invalid token", http.MethodGet, "/v1/events", "bogus", nil, http.StatusUnauthorized},
+		{"events with invalid token in the URL", http.MethodGet, "/v1/events?access_token=NOTAREALTOKENNOTAREALTOKEN", "anonymous", nil, http.StatusUnauthorized},
+		{"events with a bearer token in the URL", http.MethodGet, "/v1/events?access_token=" + owner.Token, "anonymous", nil, http.StatusUnauthorized},
+		{"realtime token", http.MethodPost, "/v1/tokens/realtime", "owner", nil, http.StatusCreated},
+		{"realtime token anonymously", http.MethodPost, "/v1/tokens/realtime", "anonymous", nil, http.StatusUnauthorized},
+		{"websocket anonymously", http.MethodGet, "/v1/ws", "anonymous", nil, http.StatusUnauthorized},
+		{"websocket without upgrade", http.MethodGet, "/v1/ws", "owner", nil, http.StatusBadRequest},
+	}, users)
+}
+
+// Streaming needs a real connection, which the recorder of the other tests isn't
+func TestRealtimeEvents(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner, other := s.register(), s.register()
+	server := httptest.NewServer(s.router)
+	t.Cleanup(server.Close)
+
+	// Browsers pass a realtime token in the URL, as EventSource can't set headers
+	res, err := http.Get(server.URL + "/v1/events?access_token=" + s.realtimeToken(owner))
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	// Only the owner's own changes reach them
+	s.createWorkout(other, "Not theirs")
+	workout := s.createWorkout(owner, "Legs")
+	_, err = s.app.Events.RunOnce()
+	require.NoError(t, err)
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-t.Context().Done():
+				return
+			}
+		}
+		close(lines)
+	}()
+	for {
+		select {
+		case line, ok := <-lines:
+			require.True(t, ok, "the stream ended before any event")
+			if data, found := strings.CutPrefix(line, "data: "); found {
+				assert.Contains(t, data, fmt.Sprintf(`"workout_id":%d,`, workout.ID))
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event within 5s")
+		}
+	}
+}
+
+// realtimeToken returns a token for the URL of live update connections
+func (s *testServer) realtimeToken(user *testUser) string {
+	s.t.Helper()
+	rec := s.request(http.MethodPost, "/v1/tokens/realtime", user, nil)
+	require.Equal(s.t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		Token string `json:"realtime_token"`
+	}
+	decode(s.t, rec, &created)
+	return created.Token
+}
+
+func TestRealtimeWebSocket(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner, other := s.register(), s.register()
+	server := httptest.NewServer(s.router)
+	t.Cleanup(server.Close)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/ws?access_token="
+
+	// Realtime tokens are the only ones accepted in the URL
+	_, res, err := websocket.Dial(t.Context(), wsURL+owner.Token, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	conn, _, err := websocket.Dial(t.Context(), wsURL+s.realtimeToken(owner), nil)
+	require.NoError(t, err)
+	defer conn.CloseNow()
+
+	// Only the owner's own changes reach them
+	s.createWorkout(other, "Not theirs")
+	workout := s.createWorkout(owner, "Legs")
+	_, err = s.app.Events.RunOnce()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	messageType, data, err := conn.Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, websocket.MessageText, messageType)
+	assert.Contains(t, string(data), fmt.Sprintf(`"workout_id":%d,`, workout.ID))
+
+	// Clients aren't expected to send messages, the server hangs up on those that do
+	require.NoError(t, conn.Write(ctx, websocket.MessageText, []byte("hello")))
+	_, _, err = conn.Read(ctx)
+	assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+}
@@ -0,0 +1,192 @@
+package api_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/app"
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/routes"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/migrations"
+	"github.com/stretchr/testify/require"
+)
+
+/*
+	Handler tests run the whole API, as built by routes.SetupRoutes, against real stores: a fresh in-memory SQLite database
+	per test by default, or whichever stores the test brings (e.g. store.NewMemoryStores()).
+	Every response is also checked against the OpenAPI document, so a handler drifting from it fails the test it runs in.
+	Servers share nothing, so tests run in parallel: most of their time is spent hashing the passwords of the users they register.
+*/
+
+// testServer is the API of one test, with its own stores
+type testServer struct {
+	t      *testing.T
+	app    *app.Application
+	router http.Handler
+	stores store.Stores
+	db     *sql.DB // The SQLite database of newTestServer, nil for other stores
+	users  int     // How many users were registered, to give each a unique name
+}
+
+// testUser is a registered user, with a token to make requests as them
+type testUser struct {
+	ID       int
+	Username string
+	Password string
+	Token    string
+}
+
+// newTestServer starts an API on top of a migrated in-memory SQLite database, which has every store
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	db, err := store.Open(store.Config{Driver: store.DriverSQLite, DSN: ":memory:"})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, store.MigrateFS(db, migrations.FS, "."))
+
+	s := newTestServerWith(t, store.NewStores(store.DriverSQLite, db))
+	s.db = db
+	return s
+}
+
+// newTestServerWith starts an API on top of the given stores. Handlers whose store is nil must not be called.
+func newTestServerWith(t *testing.T, stores store.Stores) *testServer {
+	t.Helper()
+	deps := app.Dependencies{
+		Stores: stores,
+		Logger: log.New(io.Discard, "", 0),
+	}
+	if stores.Audit != nil {
+		deps.AuditSinks = []audit.Sink{audit.NewStoreSink(stores.Audit)}
+	}
+	application := app.NewApplicationWith(deps)
+	application.Validator.ResponseDrift = func(r *http.Request, err error) {
+		t.Errorf("response doesn't match the OpenAPI document: %v", err)
+	}
+
+	return &testServer{t: t, app: application, router: routes.SetupRoutes(application), stores: stores}
+}
+
+// request sends a request to the API as user (nil for none). body is sent as is if it's a string, as JSON otherwise.
+func (s *testServer) request(method, target string, user *testUser, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.requestWithHeaders(method, target, user, body, nil)
+}
+
+// requestWithHeaders is request, with extra headers
+func (s *testServer) requestWithHeaders(method, target string, user *testUser, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(body)
+	default:
+		payload, err := json.Marshal(body)
+		require.NoError(s.t, err)
+		reader = bytes.NewReader(payload)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if user != nil {
+		req.Header.Set("Authorization", "Bearer "+user.Token)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// register creates a user through the API and logs them in
+func (s *testServer) register() *testUser {
+	s.t.Helper()
+	s.users++
+	user := &testUser{Username: fmt.Sprintf("athlete%d", s.users), Password: "Secret123"}
+
+	rec := s.request(http.MethodPost, "/v1/users/register", nil, map[string]string{
+		"username": user.Username,
+		"email":    user.Username + "@example.com",
+		"password": user.Password,
+	})
+	require.Equal(s.t, http.StatusCreated, rec.Code, rec.Body.String())
+	var registered struct {
+		User store.User `json:"user"`
+	}
+	decode(s.t, rec, &registered)
+	user.ID = registered.User.ID
+
+	user.Token = s.login(user.Username, user.Password)
+	return user
+}
+
+// login returns a new authentication token for the user
+func (s *testServer) login(username, password string) string {
+	s.t.Helper()
+	rec := s.request(http.MethodPost, "/v1/tokens/authentication", nil, map[string]string{"username": username, "password": password})
+	require.Equal(s.t, http.StatusCreated, rec.Code, rec.Body.String())
+	var login struct {
+		Token string `json:"auth_token"`
+	}
+	decode(s.t, rec, &login)
+	return login.Token
+}
+
+// createWorkout creates a workout with two entries through the API
+func (s *testServer) createWorkout(user *testUser, title string) store.Workout {
+	s.t.Helper()
+	rec := s.request(http.MethodPost, "/v1/workouts", user, map[string]interface{}{
+		"title":           title,
+		"description":     "Test workout",
+		"duration":        45,
+		"calories_burned": 300,
+		"entries": []map[string]interface{}{
+			{"exercise_name": "Squat", "sets": 3, "reps": 10, "weight": 60, "order_index": 1},
+			{"exercise_name": "Lunge", "sets": 2, "reps": 12, "order_index": 2},
+		},
+	})
+	require.Equal(s.t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		Workout store.Workout `json:"workout"`
+	}
+	decode(s.t, rec, &created)
+	return created.Workout
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), rec.Body.String())
+}
+
+// endpointTest is a request and the status it must get. as picks who sends it, among the users of the test.
+type endpointTest struct {
+	name   string
+	method string
+	target string
+	as     string // owner, other or anonymous
+	body   interface{}
+	status int
+}
+
+// run sends each request as the user it names, and checks its status
+func (s *testServer) run(tests []endpointTest, users map[string]*testUser) {
+	s.t.Helper()
+	for _, test := range tests {
+		s.t.Run(test.name, func(t *testing.T) {
+			rec := s.request(test.method, test.target, users[test.as], test.body)
+			require.Equal(t, test.status, rec.Code, "%s %s as %s: %s", test.method, test.target, test.as, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+)
+
+/*
+	Live workout sessions, for logging a workout while doing it:
+		POST   /sessions               start one, from scratch or from a workout used as a template
+		GET    /sessions/current       the session going on, if any
+		GET    /sessions/{id}          a session with its sets and timers
+		POST   /sessions/{id}/sets     log a set, optionally starting a rest timer: {"exercise_name": "Squat", "reps": 10, "weight": 60, "rest_seconds": 90}
+		POST   /sessions/{id}/rest     start a rest timer: {"seconds": 90}
+		DELETE /sessions/{id}/rest     stop it
+		POST   /sessions/{id}/pause    stop the clock
+		POST   /sessions/{id}/resume   start it again
+		POST   /sessions/{id}/finish   save the session as a completed workout
+		DELETE /sessions/{id}          discard it
+
+	Times come from the server: sessions include server_time, so clients can show timers without trusting their own clock.
+*/
+
+// Longest rest timer, an hour
+const maxRestSeconds = 3600
+
+type SessionHandler struct {
+	sessionStore store.SessionStore
+	workoutStore store.WorkoutStore // For the templates sessions start from
+	audit        *audit.Logger
+	logger       *log.Logger
+}
+
+// NewSessionHandler creates a new instance of SessionHandler
+func NewSessionHandler(sessionStore store.SessionStore, workoutStore store.WorkoutStore, auditLogger *audit.Logger, logger *log.Logger) *SessionHandler {
+	return &SessionHandler{
+		sessionStore: sessionStore,
+		workoutStore: workoutStore,
+		audit:        auditLogger,
+		logger:       logger,
+	}
+}
+
+type createSessionRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	TemplateID  *int64 `json:"template_id"` // A workout of the user, whose title, description and entries are the plan
+}
+
+type logSetRequest struct {
+	store.SessionSet
+	RestSeconds int `json:"rest_seconds"`
+}
+
+type restRequest struct {
+	Seconds int `json:"seconds"`
+}
+
+func (h *SessionHandler) HandleCreateSession(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	var req createSessionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"}) // 400
+		return
+	}
+
+	session := &store.WorkoutSession{
+		UserID:      currentUser.ID,
+		TemplateID:  req.TemplateID,
+		Title:       req.Title,
+		Description: req.Description,
+	}
+	if req.TemplateID != nil {
+		template, err := h.workoutStore.GetWorkoutByID(*req.TemplateID)
+		if err != nil {
+			h.logger.Printf("Error fetching session template: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to start session"}) // 500
+			return
+		}
+		if template == nil || template.UserID != currentUser.ID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "template_id is not one of your workouts"}) // 400
+			return
+		}
+		if session.Title == "" {
+			session.Title = template.Title
+		}
+		if session.Description == "" {
+			session.Description = template.Description
+		}
+		// The plan is a copy, the entries aren't tied to the template's
+		for _, entry := range template.Entries {
+			entry.ID = 0
+			entry.UUID = ""
+			session.Plan = append(session.Plan, entry)
+		}
+	}
+	if session.Title == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "title is required"}) // 400
+		return
+	}
+
+	createdSession, err := h.sessionStore.CreateSession(session)
+	if errors.Is(err, store.ErrSessionInProgress) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()}) // 409
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error starting session: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to start session"}) // 500
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"session": createdSession}) // 201
+}
+
+func (h *SessionHandler) HandleGetCurrentSession(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	session, err := h.sessionStore.GetOpenSession(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error fetching current session: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch session"}) // 500
+		return
+	}
+	if session == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "No session in progress"}) // 404
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"session": session}) // 200
+}
+
+func (h *SessionHandler) HandleGetSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := utils.ReadIDParam(r, "id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid session ID"}) // 400
+		return
+	}
+	h.writeSession(w, r, sessionID, http.StatusOK)
+}
+
+func (h *SessionHandler) HandleLogSet(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	sessionID, err := utils.ReadIDParam(r, "id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid session ID"}) // 400
+		return
+	}
+
+	var req logSetRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"}) // 400
+		return
+	}
+	// A set is validated like an entry of one set
+	err = validateEntry(&store.WorkoutEntry{ExerciseName: req.ExerciseName, Reps: req.Reps, DurationSeconds: req.DurationSeconds})
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
+		return
+	}
+	if req.RestSeconds < 0 || req.RestSeconds > maxRestSeconds {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "rest_seconds must be between 0 and 3600"}) // 400
+		return
+	}
+
+	set := req.SessionSet
+	ok, err := h.sessionStore.LogSessionSet(currentUser.ID, sessionID, &set, req.RestSeconds)
+	if err != nil {
+		h.logger.Printf("Error logging session set: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to log set"}) // 500
+		return
+	}
+	if !ok {
+		h.writeNotActive(w, r, sessionID)
+		return
+	}
+	h.writeSession(w, r, sessionID, http.StatusCreated)
+}
+
+func (h *SessionHandler) HandleStartRest(w http.ResponseWriter, r *http.Request) {
+	var req restRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"}) // 400
+		return
+	}
+	if req.Seconds <= 0 || req.Seconds > maxRestSeconds {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "seconds must be between 1 and 3600"}) // 400
+		return
+	}
+	h.changeSession(w, r, func(userID int, sessionID int64) (bool, error) {
+		return h.sessionStore.StartSessionRest(userID, sessionID, req.Seconds)
+	})
+}
+
+func (h *SessionHandler) HandleStopRest(w http.ResponseWriter, r *http.Request) {
+	h.changeSession(w, r, func(userID int, sessionID int64) (bool, error) {
+		return h.sessionStore.StartSessionRest(userID, sessionID, 0)
+	})
+}
+
+func (h *SessionHandler) HandlePauseSession(w http.ResponseWriter, r *http.Request) {
+	h.changeSession(w, r, h.sessionStore.PauseSession)
+}
+
+func (h *SessionHandler) HandleResumeSession(w http.ResponseWriter, r *http.Request) {
+	h.changeSession(w, r, h.sessionStore.ResumeSession)
+}
+
+// Finishing responds with the workout the session was saved as
+func (h *SessionHandler) HandleFinishSession(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	sessionID, err := utils.ReadIDParam(r, "id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid session ID"}) // 400
+		return
+	}
+
+	workout, err := h.sessionStore.FinishSession(currentUser.ID, sessionID)
+	if err != nil {
+		h.logger.Printf("Error finishing session: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to finish session"}) // 500
+		return
+	}
+	if workout == nil {
+		h.writeNotActive(w, r, sessionID)
+		return
+	}
+
+	h.audit.Record(r, audit.Event{
+		ActorID:    currentUser.ID,
+		Action:     audit.ActionWorkoutCreated,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: workout.ID,
+		After:      workout,
+	})
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": workout}) // 201
+}
+
+func (h *SessionHandler) HandleDiscardSession(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	sessionID, err := utils.ReadIDParam(r, "id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid session ID"}) // 400
+		return
+	}
+
+	ok, err := h.sessionStore.DiscardSession(currentUser.ID, sessionID)
+	if err != nil {
+		h.logger.Printf("Error discarding session: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to discard session"}) // 500
+		return
+	}
+	if !ok {
+		h.writeNotActive(w, r, sessionID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// changeSession applies a change to the session in the URL and responds with the session as it is now
+func (h *SessionHandler) changeSession(w http.ResponseWriter, r *http.Request, change func(userID int, sessionID int64) (bool, error)) {
+	currentUser := middleware.GetUser(r)
+	sessionID, err := utils.ReadIDParam(r, "id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid session ID"}) // 400
+		return
+	}
+
+	ok, err := change(currentUser.ID, sessionID)
+	if err != nil {
+		h.logger.Printf("Error changing session: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update session"}) // 500
+		return
+	}
+	if !ok {
+		h.writeNotActive(w, r, sessionID)
+		return
+	}
+	h.writeSession(w, r, sessionID, http.StatusOK)
+}
+
+func (h *SessionHandler) writeSession(w http.ResponseWriter, r *http.Request, sessionID int64, status int) {
+	currentUser := middleware.GetUser(r)
+	session, err := h.sessionStore.GetSession(currentUser.ID, sessionID)
+	if err != nil {
+		h.logger.Printf("Error fetching session: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch session"}) // 500
+		return
+	}
+	if session == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Session not found"}) // 404
+		return
+	}
+	utils.WriteJSON(w, status, utils.Envelope{"session": session})
+}
+
+// writeNotActive explains why a change wasn't made: the session doesn't exist, or it's not in a state that allows it
+func (h *SessionHandler) writeNotActive(w http.ResponseWriter, r *http.Request, sessionID int64) {
+	currentUser := middleware.GetUser(r)
+	session, err := h.sessionStore.GetSession(currentUser.ID, sessionID)
+	if err != nil {
+		h.logger.Printf("Error fetching session: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch session"}) // 500
+		return
+	}
+	if session == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Session not found"}) // 404
+		return
+	}
+	utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Session is " + session.Status}) // 409
+}
@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionEndpoints(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner, other := s.register(), s.register()
+	users := map[string]*testUser{"owner": owner, "other": other}
+	template := s.createWorkout(owner, "Legs")
+
+	rec := s.request(http.MethodPost, "/v1/sessions", owner, map[string]interface{}{"template_id": template.ID})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		Session store.WorkoutSession `json:"session"`
+	}
+	decode(t, rec, &created)
+	session := func(action string) string { return fmt.Sprintf("/v1/sessions/%d%s", created.Session.ID, action) }
+	squat := map[string]interface{}{"exercise_name": "Squat", "reps": 5, "weight": 100, "rest_seconds": 90}
+
+	// Sessions of other users are not found, like workouts
+	s.run([]endpointTest{
+		{"start anonymously", http.MethodPost, "/v1/sessions", "anonymous", map[string]string{"title": "Run"}, http.StatusUnauthorized},
+		{"start a second one", http.MethodPost, "/v1/sessions", "owner", map[string]string{"title": "Run"}, http.StatusConflict},
+		{"start without title", http.MethodPost, "/v1/sessions", "other", map[string]string{}, http.StatusBadRequest},
+		{"start from someone else's workout", http.MethodPost, "/v1/sessions", "other", map[string]interface{}{"template_id": template.ID}, http.StatusBadRequest},
+
+		{"current", http.MethodGet, "/v1/sessions/current", "owner", nil, http.StatusOK},
+		{"current anonymously", http.MethodGet, "/v1/sessions/current", "anonymous", nil, http.StatusUnauthorized},
+		{"current without one", http.MethodGet, "/v1/sessions/current", "other", nil, http.StatusNotFound},
+		{"get", http.MethodGet, session(""), "owner", nil, http.StatusOK},
+		{"get anonymously", http.MethodGet, session(""), "anonymous", nil, http.StatusUnauthorized},
+		{"get someone else's", http.MethodGet, session(""), "other", nil, http.StatusNotFound},
+		{"get with invalid ID", http.MethodGet, "/v1/sessions/abc", "owner", nil, http.StatusBadRequest},
+
+		{"log a set", http.MethodPost, session("/sets"), "owner", squat, http.StatusCreated},
+		{"log a set anonymously", http.MethodPost, session("/sets"), "anonymous", squat, http.StatusUnauthorized},
+		{"log a set in someone else's", http.MethodPost, session("/sets"), "other", squat, http.StatusNotFound},
+		{"log a set without exercise", http.MethodPost, session("/sets"), "owner", map[string]interface{}{"reps": 5}, http.StatusBadRequest},
+		{"log a set with too long a rest", http.MethodPost, session("/sets"), "owner", map[string]interface{}{"exercise_name": "Squat", "reps": 5, "rest_seconds": 7200}, http.StatusBadRequest},
+
+		{"start rest", http.MethodPost, session("/rest"), "owner", map[string]int{"seconds": 60}, http.StatusOK},
+		{"start rest in someone else's", http.MethodPost, session("/rest"), "other", map[string]int{"seconds": 60}, http.StatusNotFound},
+		{"start rest of no time", http.MethodPost, session("/rest"), "owner", map[string]int{"seconds": 0}, http.StatusBadRequest},
+		{"stop rest", http.MethodDelete, session("/rest"), "owner", nil, http.StatusOK},
+
+		{"pause", http.MethodPost, session("/pause"), "owner", nil, http.StatusOK},
+		{"pause again", http.MethodPost, session("/pause"), "owner", nil, http.StatusConflict},
+		{"resume someone else's", http.MethodPost, session("/resume"), "other", nil, http.StatusNotFound},
+		{"resume", http.MethodPost, session("/resume"), "owner", nil, http.StatusOK},
+
+		{"finish anonymously", http.MethodPost, session("/finish"), "anonymous", nil, http.StatusUnauthorized},
+		{"finish someone else's", http.MethodPost, session("/finish"), "other", nil, http.StatusNotFound},
+		{"finish", http.MethodPost, session("/finish"), "owner", nil, http.StatusCreated},
+		{"finish again", http.MethodPost, session("/finish"), "owner", nil, http.StatusConflict},
+		{"discard once finished", http.MethodDelete, session(""), "owner", nil, http.StatusConflict},
+		{"log a set once finished", http.MethodPost, session("/sets"), "owner", squat, http.StatusConflict},
+	}, users)
+
+	// Discarding leaves no workout behind, and frees the user to start another session
+	rec = s.request(http.MethodPost, "/v1/sessions", other, map[string]string{"title": "Run"})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	decode(t, rec, &created)
+	s.run([]endpointTest{
+		{"discard someone else's", http.MethodDelete, session(""), "owner", nil, http.StatusNotFound},
+		{"discard", http.MethodDelete, session(""), "other", nil, http.StatusNoContent},
+		{"start after discarding", http.MethodPost, "/v1/sessions", "other", map[string]string{"title": "Run"}, http.StatusCreated},
+	}, users)
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+)
+
+/*
+	Offline sync for offline-first clients. The client owns the UUIDs of its workouts and entries, so it can create
+	them while offline and still refer to them once they reach the server.
+
+	Pull: GET /sync?since=<cursor>
+		Returns every workout and entry change since the cursor (upserts with the current state, deletes as tombstones),
+		and the cursor to send next time. Start with since=0, and keep going while has_more is true.
+
+	Push: POST /sync
+		{
+			"changes": [
+				{"type": "workout", "op": "upsert", "uuid": "...", "workout": {..., "updated_at": "2025-03-14T10:00:00Z"}},
+				{"type": "workout", "op": "delete", "uuid": "...", "deleted_at": "2025-03-14T11:00:00Z"}
+			]
+		}
+
+		Conflicts are resolved with last-writer-wins: a change is applied only if it happened after the last change the
+		server has for that workout. Otherwise it's reported as a conflict along with the server's copy, which the client keeps.
+		This holds for deletes too: an upsert made after the workout was deleted brings it back from the trash.
+		Entries are pushed as part of their workout (the whole list of entries is replaced).
+*/
+
+const (
+	defaultSyncLimit  = 500
+	maxSyncLimit      = 1000
+	maxSyncPushChange = 100
+
+	syncStatusApplied  = "applied"
+	syncStatusConflict = "conflict"
+	syncStatusRejected = "rejected"
+)
+
+type SyncHandler struct {
+	workoutStore store.WorkoutStore
+	audit        *audit.Logger
+	logger       *log.Logger
+}
+
+func NewSyncHandler(workoutStore store.WorkoutStore, auditLogger *audit.Logger, logger *log.Logger) *SyncHandler {
+	return &SyncHandler{
+		workoutStore: workoutStore,
+		audit:        auditLogger,
+		logger:       logger,
+	}
+}
+
+type syncPushChange struct {
+	Entity    string         `json:"type"`
+	Op        string         `json:"op"`
+	UUID      string         `json:"uuid"`
+	Workout   *store.Workout `json:"workout"`    // Upserts only
+	DeletedAt *time.Time     `json:"deleted_at"` // Deletes only
+}
+
+type syncPushRequest struct {
+	Changes []syncPushChange `json:"changes"`
+}
+
+type syncPushResult struct {
+	UUID    string         `json:"uuid"`
+	Status  string         `json:"status"` // applied, conflict or rejected
+	Error   string         `json:"error,omitempty"`
+	Workout *store.Workout `json:"workout,omitempty"` // The server's copy, for conflicts
+}
+
+// Pull the changes of the current user since a cursor
+func (sh *SyncHandler) HandleGetChanges(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	var cursor int64
+	if since := r.URL.Query().Get("since"); since != "" {
+		parsed, err := strconv.ParseInt(since, 10, 64)
+		if err != nil || parsed < 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "since must be a cursor returned by a previous sync"}) // 400
+			return
+		}
+		cursor = parsed
+	}
+
+	limit := defaultSyncLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > maxSyncLimit {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("limit must be between 1 and %d", maxSyncLimit)}) // 400
+			return
+		}
+		limit = parsed
+	}
+
+	page, err := sh.workoutStore.GetChangesSince(currentUser.ID, cursor, limit)
+	if err != nil {
+		sh.logger.Printf("Error fetching sync changes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch changes"}) // 500
+		return
+	}
+
+	// The cursor is sent as a string: it's opaque to clients, and JavaScript can't hold every int64
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"changes":  page.Changes,
+		"cursor":   strconv.FormatInt(page.Cursor, 10),
+		"has_more": page.HasMore,
+	}) // 200
+}
+
+// Push changes made offline by the current user
+func (sh *SyncHandler) HandlePushChanges(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	var req syncPushRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sh.logger.Printf("Invalid sync payload: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"}) // 400
+		return
+	}
+	if len(req.Changes) == 0 || len(req.Changes) > maxSyncPushChange {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("a push must contain between 1 and %d changes", maxSyncPushChange)}) // 400
+		return
+	}
+
+	// Each change is applied in its own transaction, so a conflict on one workout doesn't hold back the others
+	now := time.Now()
+	results := make([]syncPushResult, len(req.Changes))
+	for i, change := range req.Changes {
+		results[i] = syncPushResult{UUID: change.UUID}
+		err = sh.workoutStore.WithTransaction(func(tx store.WorkoutTx) error {
+			return applySyncChange(tx, currentUser, change, now, &results[i])
+		})
+		if err != nil && !errors.Is(err, errSyncChangeRejected) {
+			sh.logger.Printf("Failed to apply sync change %s: %v", change.UUID, err)
+			results[i] = syncPushResult{UUID: change.UUID, Status: syncStatusRejected, Error: "failed to apply change"}
+		}
+		if results[i].Status == syncStatusApplied {
+			sh.audit.Record(r, audit.Event{
+				ActorID:    currentUser.ID,
+				Action:     audit.ActionWorkoutSynced,
+				Resource:   audit.ResourceWorkout,
+				ResourceID: change.UUID,
+				Metadata:   map[string]interface{}{"op": change.Op},
+			})
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"results": results}) // 200
+}
+
+// errSyncChangeRejected rolls back what a rejected change had already written (e.g. the restore of its workout)
+var errSyncChangeRejected = errors.New("sync change rejected")
+
+// applySyncChange applies one pushed change and fills in its result.
+// Errors other than errSyncChangeRejected are only returned for unexpected failures.
+func applySyncChange(tx store.WorkoutTx, currentUser *store.User, change syncPushChange, now time.Time, result *syncPushResult) error {
+	reject := func(message string) error {
+		result.Status = syncStatusRejected
+		result.Error = message
+		return errSyncChangeRejected
+	}
+
+	if change.Entity != store.SyncEntityWorkout {
+		return reject("type must be workout (entries are pushed along with their workout)")
+	}
+	if change.UUID == "" {
+		return reject("uuid is required")
+	}
+
+	existing, err := tx.GetWorkoutByUUID(change.UUID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.UserID != currentUser.ID {
+		return reject("you do not have permission to modify this workout")
+	}
+
+	switch change.Op {
+	case store.SyncOpUpsert:
+		incoming := change.Workout
+		if incoming == nil || incoming.UpdatedAt.IsZero() {
+			return reject("workout with updated_at is required")
+		}
+		if incoming.Status != "" && !store.IsValidWorkoutStatus(incoming.Status) {
+			return reject(errInvalidStatus.Error())
+		}
+		// A client clock running ahead would win every future conflict, so it can't claim a time past ours
+		if incoming.UpdatedAt.After(now) {
+			incoming.UpdatedAt = now
+		}
+		incoming.UUID = change.UUID
+		incoming.UserID = currentUser.ID
+
+		if existing == nil {
+			// Don't let an old offline edit bring back a workout that was deleted after it
+			deletedAt, err := tx.GetWorkoutDeletedAt(currentUser.ID, change.UUID)
+			if err != nil {
+				return err
+			}
+			if deletedAt != nil && deletedAt.After(incoming.UpdatedAt) {
+				result.Status = syncStatusConflict
+				result.Error = "workout was deleted"
+				return nil
+			}
+
+			// The edit came after the delete, so it wins: a workout still in the trash is brought back and updated,
+			// since its UUID can't be created again
+			existing, err = tx.RestoreWorkoutByUUID(currentUser.ID, change.UUID)
+			if err != nil {
+				return err
+			}
+			if existing == nil {
+				incoming.ID = 0
+				_, err = tx.CreateWorkout(incoming)
+				if errors.Is(err, store.ErrInvalidUUID) || errors.Is(err, store.ErrDuplicateExternalID) {
+					return reject(err.Error())
+				}
+				if err != nil {
+					return err
+				}
+				result.Status = syncStatusApplied
+				return nil
+			}
+		} else if !incoming.UpdatedAt.After(existing.UpdatedAt) {
+			result.Status = syncStatusConflict
+			result.Workout = existing
+			return nil
+		}
+		incoming.ID = existing.ID
+		incoming.Version = existing.Version
+		err = tx.UpdateWorkout(incoming)
+		if errors.Is(err, store.ErrVersionConflict) {
+			// Someone saved the workout between our read and our write: the client will get it on its next pull
+			result.Status = syncStatusConflict
+			result.Error = err.Error()
+			return nil
+		}
+		if errors.Is(err, store.ErrInvalidUUID) || errors.Is(err, store.ErrInvalidEntries) {
+			return reject(err.Error())
+		}
+		if err != nil {
+			return err
+		}
+		result.Status = syncStatusApplied
+		return nil
+
+	case store.SyncOpDelete:
+		if change.DeletedAt == nil {
+			return reject("deleted_at is required")
+		}
+		if existing == nil {
+			// Already gone, which is what the client wanted
+			result.Status = syncStatusApplied
+			return nil
+		}
+		if existing.UpdatedAt.After(*change.DeletedAt) {
+			result.Status = syncStatusConflict
+			result.Workout = existing
+			return nil
+		}
+		err = tx.DeleteWorkout(int64(existing.ID), existing.Version)
+		if err != nil {
+			return err
+		}
+		result.Status = syncStatusApplied
+		return nil
+	}
+	return reject("op must be upsert or delete")
+}
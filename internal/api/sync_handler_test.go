@@ -0,0 +1,127 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncEndpoints(t *testing.T) {
+	t.Parallel()
+	t.Run("sqlite", func(t *testing.T) { testSyncEndpoints(t, newTestServer(t)) })
+	t.Run("memory", func(t *testing.T) { testSyncEndpoints(t, newTestServerWith(t, store.NewMemoryStores())) })
+}
+
+func testSyncEndpoints(t *testing.T, s *testServer) {
+	owner, other := s.register(), s.register()
+	users := map[string]*testUser{"owner": owner, "other": other}
+	workout := s.createWorkout(owner, "Legs")
+
+	upsert := func(id string, title string) map[string]interface{} {
+		return map[string]interface{}{"type": "workout", "op": "upsert", "uuid": id, "workout": map[string]interface{}{
+			"title": title, "updated_at": time.Now().UTC().Format(time.RFC3339Nano),
+		}}
+	}
+	push := func(changes ...map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"changes": changes}
+	}
+
+	s.run([]endpointTest{
+		{"pull", http.MethodGet, "/v1/sync", "owner", nil, http.StatusOK},
+		{"pull anonymously", http.MethodGet, "/v1/sync", "anonymous", nil, http.StatusUnauthorized},
+		{"pull with invalid cursor", http.MethodGet, "/v1/sync?since=abc", "owner", nil, http.StatusBadRequest},
+		{"pull too many", http.MethodGet, "/v1/sync?limit=100000", "owner", nil, http.StatusBadRequest},
+
+		{"push anonymously", http.MethodPost, "/v1/sync", "anonymous", push(upsert(uuid.NewString(), "Offline")), http.StatusUnauthorized},
+		{"push nothing", http.MethodPost, "/v1/sync", "owner", push(), http.StatusBadRequest},
+		{"push invalid JSON", http.MethodPost, "/v1/sync", "owner", "{", http.StatusBadRequest},
+	}, users)
+
+	// Changes are judged one by one: pushing over someone else's workout is rejected, not an error of the whole push
+	rec := s.request(http.MethodPost, "/v1/sync", other, push(upsert(uuid.NewString(), "Offline"), upsert(workout.UUID, "Mine now")))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var pushed struct {
+		Results []struct {
+			Status string `json:"status"`
+		} `json:"results"`
+	}
+	decode(t, rec, &pushed)
+	require.Len(t, pushed.Results, 2)
+	assert.Equal(t, "applied", pushed.Results[0].Status)
+	assert.Equal(t, "rejected", pushed.Results[1].Status)
+
+	// Each user only pulls their own changes
+	for _, user := range []*testUser{owner, other} {
+		rec = s.request(http.MethodGet, "/v1/sync", user, nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var page struct {
+			Changes []struct {
+				Entity  string         `json:"type"`
+				Workout *store.Workout `json:"workout"`
+			} `json:"changes"`
+		}
+		decode(t, rec, &page)
+		var workouts []*store.Workout
+		for _, change := range page.Changes {
+			if change.Entity == store.SyncEntityWorkout {
+				workouts = append(workouts, change.Workout)
+			}
+		}
+		require.Len(t, workouts, 1)
+		require.NotNil(t, workouts[0])
+		assert.Equal(t, user.ID, workouts[0].UserID)
+	}
+}
+
+// An upsert pushed for a workout in the trash wins over the delete if it happened after it, like any other change
+func TestSyncUpsertOfTrashedWorkout(t *testing.T) {
+	t.Parallel()
+	t.Run("sqlite", func(t *testing.T) { testSyncUpsertOfTrashedWorkout(t, newTestServer(t)) })
+	t.Run("memory", func(t *testing.T) { testSyncUpsertOfTrashedWorkout(t, newTestServerWith(t, store.NewMemoryStores())) })
+}
+
+func testSyncUpsertOfTrashedWorkout(t *testing.T, s *testServer) {
+	owner := s.register()
+	workout := s.createWorkout(owner, "Legs")
+	path := fmt.Sprintf("/v1/workouts/%d", workout.ID)
+	editedBefore := time.Now().Add(-time.Minute)
+	require.Equal(t, http.StatusOK, s.request(http.MethodDelete, path, owner, nil).Code)
+
+	push := func(workout map[string]interface{}) string {
+		rec := s.request(http.MethodPost, "/v1/sync", owner, map[string]interface{}{"changes": []interface{}{
+			map[string]interface{}{"type": "workout", "op": "upsert", "uuid": workout["uuid"], "workout": workout},
+		}})
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var pushed struct {
+			Results []struct {
+				Status string `json:"status"`
+			} `json:"results"`
+		}
+		decode(t, rec, &pushed)
+		require.Len(t, pushed.Results, 1)
+		return pushed.Results[0].Status
+	}
+	edit := func(title string, updatedAt time.Time) map[string]interface{} {
+		return map[string]interface{}{"uuid": workout.UUID, "title": title, "updated_at": updatedAt.UTC().Format(time.RFC3339Nano)}
+	}
+
+	// An edit made before the delete loses, and so does one that can't be saved: the workout stays in the trash
+	assert.Equal(t, "conflict", push(edit("Old edit", editedBefore)))
+	invalid := edit("Invalid", time.Now())
+	invalid["entries"] = []map[string]interface{}{{"uuid": "not-a-uuid", "exercise_name": "Squat", "sets": 1, "reps": 5}}
+	assert.Equal(t, "rejected", push(invalid))
+	assert.Equal(t, http.StatusNotFound, s.request(http.MethodGet, path, owner, nil).Code)
+
+	// An edit made after the delete brings the workout back, with the edit
+	assert.Equal(t, "applied", push(edit("Leg day", time.Now())))
+	restored, ok := s.getWorkout(owner, workout.ID)
+	require.True(t, ok)
+	assert.Equal(t, "Leg day", restored.Title)
+	assert.Equal(t, workout.UUID, restored.UUID)
+}
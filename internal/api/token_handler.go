@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/OlivierCoq/go_api_template/internal/audit"
 	"github.com/OlivierCoq/go_api_template/internal/middleware"
 	"github.com/OlivierCoq/go_api_template/internal/store"
 	"github.com/OlivierCoq/go_api_template/internal/tokens"
@@ -16,6 +17,7 @@ import (
 type TokenHandler struct {
 	tokenStore store.TokenStore
 	userStore  store.UserStore
+	audit      *audit.Logger
 	logger     *log.Logger
 }
 
@@ -27,10 +29,11 @@ type createTokenRequest struct {
 
 // NewTokenHandler creates a new instance of TokenHandler
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, auditLogger *audit.Logger, logger *log.Logger) *TokenHandler {
 	return &TokenHandler{
 		tokenStore: tokenStore,
 		userStore:  userStore,
+		audit:      auditLogger,
 		logger:     logger,
 	}
 }
@@ -53,9 +56,18 @@ func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Unknown usernames get the same answer as wrong passwords, so the endpoint can't be used to find out who has an account
+	if user == nil {
+		h.logger.Printf("Invalid credentials for user %s", req.Username)
+		h.recordLoginFailure(r, req.Username, nil, "unknown username")
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Invalid credentials"})
+		return
+	}
+
 	passwordsDoMatch, err := user.PasswordHash.Matches(req.Password)
 	if err != nil || !passwordsDoMatch {
 		h.logger.Printf("Invalid credentials for user %s", req.Username)
+		h.recordLoginFailure(r, req.Username, user, "wrong password")
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Invalid credentials"})
 		return
 	}
@@ -64,6 +76,13 @@ func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request)
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Invalid credentials"})
 		return
 	}
+	// Disabled users get the same answer too, only the audit log tells why
+	if user.IsDisabled() {
+		h.logger.Printf("Login of disabled user %s", req.Username)
+		h.recordLoginFailure(r, req.Username, user, "user disabled")
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Invalid credentials"})
+		return
+	}
 
 	token, err := h.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeAuth)
 	if err != nil {
@@ -72,9 +91,28 @@ func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	h.audit.Record(r, audit.Event{
+		ActorID:    user.ID,
+		Action:     audit.ActionLoginSucceeded,
+		Resource:   audit.ResourceUser,
+		ResourceID: user.ID,
+	})
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token": token.Plaintext})
 }
 
+// recordLoginFailure adds a failed login to the audit log. user is nil when the username doesn't exist.
+func (h *TokenHandler) recordLoginFailure(r *http.Request, username string, user *store.User, reason string) {
+	event := audit.Event{
+		Action:   audit.ActionLoginFailed,
+		Resource: audit.ResourceUser,
+		Metadata: map[string]interface{}{"username": username, "reason": reason},
+	}
+	if user != nil {
+		event.ResourceID = user.ID
+	}
+	h.audit.Record(r, event)
+}
+
 // Logging out:
 func (h *TokenHandler) HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
 	// Implementation for revoking a token (logging out)
@@ -98,6 +136,16 @@ func (h *TokenHandler) HandleRevokeToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The token itself is never recorded, only who revoked theirs
+	currentUser := middleware.GetUser(r)
+	h.audit.Record(r, audit.Event{
+		ActorID:    currentUser.ID,
+		Action:     audit.ActionTokenRevoked,
+		Resource:   audit.ResourceToken,
+		ResourceID: currentUser.ID,
+		Metadata:   map[string]interface{}{"scope": tokens.ScopeAuth},
+	})
+
 	// remove Authorization header from response and future http context:
 	w.Header().Del("Authorization")
 	// Middleware will set the user to anonymous user.
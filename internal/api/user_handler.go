@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"regexp"
 
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
 	"github.com/OlivierCoq/go_api_template/internal/store"
 	"github.com/OlivierCoq/go_api_template/internal/utils"
 )
@@ -22,19 +24,30 @@ type RegisterUserRequest struct {
 type UserHandler struct {
 	// Add fields as necessary, e.g., a reference to the application or database
 	userStore store.UserStore // Interface to interact with user data. This promotes db decoupling and easier testing.
+	audit     *audit.Logger
 	logger    *log.Logger
 }
 
 // NewUserHandler creates a new instance of UserHandler
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, auditLogger *audit.Logger, logger *log.Logger) *UserHandler {
 	return &UserHandler{
 		userStore: userStore,
+		audit:     auditLogger,
 		logger:    logger,
 	}
 }
 
-// Validation:
-func (h *UserHandler) validateRegisterUserRequest(req *RegisterUserRequest) error {
+// Profile changes. Pointers tell missing fields apart from empty ones, like updateWorkoutRequest.
+type updateUserRequest struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	Bio      *string `json:"bio"`
+}
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// ValidateRegisterUserRequest checks a new account, for registration and the `user create` command
+func ValidateRegisterUserRequest(req *RegisterUserRequest) error {
 	if req.Username == "" || req.Email == "" || req.Password == "" {
 		return errors.New("username, email, and password are required")
 	}
@@ -45,24 +58,23 @@ func (h *UserHandler) validateRegisterUserRequest(req *RegisterUserRequest) erro
 	if len(req.Email) > 100 {
 		return errors.New("email must be less than 100 characters")
 	}
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 	if !emailRegex.MatchString(req.Email) {
 		return errors.New("invalid email format")
 	}
-	if !emailRegex.MatchString(req.Email) {
-		return errors.New("invalid email format")
-	}
-	// Password
-	if len(req.Password) < 8 {
+	return ValidatePassword(req.Password)
+}
+
+// ValidatePassword checks that a password is strong enough
+func ValidatePassword(password string) error {
+	if len(password) < 8 {
 		return errors.New("password must be at least 8 characters long")
 	}
-	hasLower := regexp.MustCompile(`[a-z]`).MatchString(req.Password)
-	hasUpper := regexp.MustCompile(`[A-Z]`).MatchString(req.Password)
-	hasDigit := regexp.MustCompile(`\d`).MatchString(req.Password)
+	hasLower := regexp.MustCompile(`[a-z]`).MatchString(password)
+	hasUpper := regexp.MustCompile(`[A-Z]`).MatchString(password)
+	hasDigit := regexp.MustCompile(`\d`).MatchString(password)
 	if !(hasLower && hasUpper && hasDigit) {
 		return errors.New("password must contain at least one uppercase letter, one lowercase letter, and one number")
 	}
-
 	return nil
 }
 
@@ -80,7 +92,7 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Validate the request
-	err = h.validateRegisterUserRequest(&req)
+	err = ValidateRegisterUserRequest(&req)
 	if err != nil {
 		h.logger.Printf("Validation error: %v", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
@@ -111,7 +123,64 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	h.audit.Record(r, audit.Event{
+		ActorID:    createdUser.ID,
+		Action:     audit.ActionUserRegistered,
+		Resource:   audit.ResourceUser,
+		ResourceID: createdUser.ID,
+		After:      createdUser,
+	})
+
 	// Respond with the created user (excluding password hash) as JSON to the frontend:
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"user": createdUser}) // 201
 
 }
+
+// Update the profile of the current user
+func (h *UserHandler) HandleUpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var req updateUserRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("Invalid request payload: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"}) // 400
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	before := *currentUser
+	user := *currentUser
+	if req.Username != nil {
+		if *req.Username == "" || len(*req.Username) > 50 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "username must be between 1 and 50 characters"}) // 400
+			return
+		}
+		user.Username = *req.Username
+	}
+	if req.Email != nil {
+		if len(*req.Email) > 100 || !emailRegex.MatchString(*req.Email) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid email format"}) // 400
+			return
+		}
+		user.Email = *req.Email
+	}
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+
+	err = h.userStore.UpdateUser(&user)
+	if err != nil {
+		h.logger.Printf("Error updating user: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update user"}) // 500
+		return
+	}
+
+	h.audit.Record(r, audit.Event{
+		ActorID:    user.ID,
+		Action:     audit.ActionUserUpdated,
+		Resource:   audit.ResourceUser,
+		ResourceID: user.ID,
+		Before:     &before,
+		After:      &user,
+	})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user}) // 200
+}
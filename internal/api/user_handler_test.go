@@ -0,0 +1,106 @@
+package api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserEndpoints(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner, other := s.register(), s.register()
+	users := map[string]*testUser{"owner": owner, "other": other}
+
+	register := func(username, email, password string) map[string]string {
+		return map[string]string{"username": username, "email": email, "password": password}
+	}
+
+	s.run([]endpointTest{
+		{"register", http.MethodPost, "/v1/users/register", "anonymous", register("newcomer", "newcomer@example.com", "Secret123"), http.StatusCreated},
+		{"register without username", http.MethodPost, "/v1/users/register", "anonymous", register("", "nobody@example.com", "Secret123"), http.StatusBadRequest},
+		{"register with invalid email", http.MethodPost, "/v1/users/register", "anonymous", register("bademail", "not-an-email", "Secret123"), http.StatusBadRequest},
+		{"register with weak password", http.MethodPost, "/v1/users/register", "anonymous", register("weakling", "weakling@example.com", "secret"), http.StatusBadRequest},
+		{"register with invalid JSON", http.MethodPost, "/v1/users/register", "anonymous", "{", http.StatusBadRequest},
+
+		{"log in", http.MethodPost, "/v1/tokens/authentication", "anonymous", map[string]string{"username": owner.Username, "password": owner.Password}, http.StatusCreated},
+		{"log in with wrong password", http.MethodPost, "/v1/tokens/authentication", "anonymous", map[string]string{"username": owner.Username, "password": "Wrong1234"}, http.StatusUnauthorized},
+		{"log in as nobody", http.MethodPost, "/v1/tokens/authentication", "anonymous", map[string]string{"username": "nobody", "password": "Secret123"}, http.StatusUnauthorized},
+		{"log in with invalid JSON", http.MethodPost, "/v1/tokens/authentication", "anonymous", "{", http.StatusBadRequest},
+
+		{"update profile", http.MethodPatch, "/v1/users/me", "owner", map[string]string{"bio": "Lifts things"}, http.StatusOK},
+		{"update profile anonymously", http.MethodPatch, "/v1/users/me", "anonymous", map[string]string{"bio": "Lifts things"}, http.StatusUnauthorized},
+		{"update profile with invalid email", http.MethodPatch, "/v1/users/me", "owner", map[string]string{"email": "not-an-email"}, http.StatusBadRequest},
+		{"update profile with empty username", http.MethodPatch, "/v1/users/me", "owner", map[string]string{"username": ""}, http.StatusBadRequest},
+	}, users)
+
+	// The profile change is only the current user's
+	rec := s.request(http.MethodPatch, "/v1/users/me", other, map[string]string{"bio": "Runs"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var updated struct {
+		User store.User `json:"user"`
+	}
+	decode(t, rec, &updated)
+	assert.Equal(t, other.ID, updated.User.ID)
+	assert.Equal(t, "Runs", updated.User.Bio)
+}
+
+func TestRevokeToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServerWith(t, store.NewMemoryStores())
+	owner := s.register()
+	second := *owner
+	second.Token = s.login(owner.Username, owner.Password)
+
+	assert.Equal(t, http.StatusUnauthorized, s.request(http.MethodDelete, "/v1/tokens/authentication", nil, nil).Code)
+
+	// Revoking logs out the token used, not the user's other sessions
+	require.Equal(t, http.StatusOK, s.request(http.MethodDelete, "/v1/tokens/authentication", owner, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, s.request(http.MethodGet, "/v1/workouts/trash", owner, nil).Code)
+	assert.Equal(t, http.StatusOK, s.request(http.MethodGet, "/v1/workouts/trash", &second, nil).Code)
+}
+
+func TestDisabledUser(t *testing.T) {
+	t.Parallel()
+	s := newTestServerWith(t, store.NewMemoryStores())
+	owner := s.register()
+	require.NoError(t, s.stores.Users.SetUserDisabled(owner.ID, true))
+
+	// Their token stops working, and logging in fails like with a wrong password
+	assert.Equal(t, http.StatusUnauthorized, s.request(http.MethodGet, "/v1/workouts/trash", owner, nil).Code)
+	login := map[string]string{"username": owner.Username, "password": owner.Password}
+	assert.Equal(t, http.StatusUnauthorized, s.request(http.MethodPost, "/v1/tokens/authentication", nil, login).Code)
+
+	require.NoError(t, s.stores.Users.SetUserDisabled(owner.ID, false))
+	assert.Equal(t, http.StatusCreated, s.request(http.MethodPost, "/v1/tokens/authentication", nil, login).Code)
+}
+
+func TestCalendarEndpoints(t *testing.T) {
+	t.Parallel()
+	s := newTestServerWith(t, store.NewMemoryStores())
+	owner := s.register()
+	users := map[string]*testUser{"owner": owner}
+
+	s.run([]endpointTest{
+		{"create token", http.MethodPost, "/v1/tokens/calendar", "owner", nil, http.StatusCreated},
+		{"create token anonymously", http.MethodPost, "/v1/tokens/calendar", "anonymous", nil, http.StatusUnauthorized},
+		{"feed of unknown token", http.MethodGet, "/v1/calendar/UNKNOWNTOKENUNKNOWNTOKENUN.ics", "anonymous", nil, http.StatusNotFound},
+	}, users)
+
+	rec := s.request(http.MethodPost, "/v1/tokens/calendar", owner, nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created struct {
+		URL string `json:"calendar_url"`
+	}
+	decode(t, rec, &created)
+	require.True(t, strings.HasPrefix(created.URL, "http://example.com/v1/calendar/"), created.URL)
+
+	// The feed needs no login: the token in the URL is the credential
+	rec = s.request(http.MethodGet, strings.TrimPrefix(created.URL, "http://example.com"), nil, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "BEGIN:VCALENDAR")
+}
@@ -0,0 +1,87 @@
+package api
+
+import "github.com/OlivierCoq/go_api_template/internal/middleware"
+
+/*
+	Versions of the REST API, mounted by routes.SetupRoutes under /v1, /v2...
+	The handlers speak v1. Later versions are adapters around them, see middleware.APIVersion:
+	- v2 calls the duration of workouts duration_minutes, like the CSV export does, since "duration" alone didn't say
+	  in what unit (entries have duration_seconds).
+	To change the shape of a response, add a version with adapters rather than changing the handlers' JSON.
+*/
+
+var (
+	APIv1 = middleware.APIVersion{Name: "v1"}
+
+	APIv2 = middleware.APIVersion{
+		Name:          "v2",
+		AdaptRequest:  unlessGraphQL(renameField("duration_minutes", "duration", isWorkoutRequest)),
+		AdaptResponse: renameField("duration", "duration_minutes", isWorkout),
+	}
+
+	// Every version, oldest first
+	APIVersions = []middleware.APIVersion{APIv1, APIv2}
+)
+
+/*
+	renameField returns an adapter renaming a field of the objects of a JSON body that match, however deep they are (in
+	envelopes, batch results, sync changes...).
+*/
+
+func renameField(from, to string, matches func(object map[string]interface{}) bool) func(body interface{}) interface{} {
+	var rename func(value interface{}) interface{}
+	rename = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, field := range v {
+				v[key] = rename(field)
+			}
+			if field, ok := v[from]; ok && matches(v) {
+				delete(v, from)
+				v[to] = field
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = rename(item)
+			}
+		}
+		return value
+	}
+	return rename
+}
+
+// Fields workouts are sent with, in any version
+var workoutRequestFields = map[string]bool{
+	"id": true, "uuid": true, "user_id": true, "title": true, "description": true, "duration": true, "duration_minutes": true,
+	"calories_burned": true, "planned_for": true, "status": true, "external_id": true, "updated_at": true, "version": true,
+	"deleted_at": true, "entries": true,
+}
+
+// isWorkoutRequest tells workouts apart from other objects of requests. They can have any subset of their fields
+// (e.g. PATCH), but nothing else: an object with another field isn't a workout, even if it has a duration_minutes.
+func isWorkoutRequest(object map[string]interface{}) bool {
+	for field := range object {
+		if !workoutRequestFields[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// unlessGraphQL leaves GraphQL requests alone: their schema is the same in every version, and their variables are
+// named by the client
+func unlessGraphQL(adapt func(body interface{}) interface{}) func(body interface{}) interface{} {
+	return func(body interface{}) interface{} {
+		if object, ok := body.(map[string]interface{}); ok && object["query"] != nil {
+			return body
+		}
+		return adapt(body)
+	}
+}
+
+// isWorkout tells workouts apart from other objects by their calories_burned field, which nothing else has.
+// GraphQL responses use camelCase (caloriesBurned), so they are left alone.
+func isWorkout(object map[string]interface{}) bool {
+	_, ok := object["calories_burned"]
+	return ok
+}
@@ -0,0 +1,45 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestV2RenamesDurationOfWorkoutsOnly(t *testing.T) {
+	t.Parallel()
+	s := newTestServerWith(t, store.NewMemoryStores())
+	owner := s.register()
+
+	rec := s.request(http.MethodPost, "/v2/workouts", owner, map[string]interface{}{
+		"title":            "Legs",
+		"duration_minutes": 45,
+		"entries":          []map[string]interface{}{{"exercise_name": "Squat", "sets": 3, "reps": 10, "order_index": 1}},
+	})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		Workout map[string]interface{} `json:"workout"`
+	}
+	decode(t, rec, &created)
+	assert.EqualValues(t, 45, created.Workout["duration_minutes"])
+	assert.NotContains(t, created.Workout, "duration")
+
+	// GraphQL variables are the client's own names, not workout fields
+	rec = s.request(http.MethodPost, "/v2/graphql", owner, map[string]interface{}{
+		"query":     `mutation($duration_minutes: Int) { createWorkout(input: {title: "Arms", duration: $duration_minutes}) { duration } }`,
+		"variables": map[string]interface{}{"duration_minutes": 30},
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var response struct {
+		Data struct {
+			CreateWorkout struct {
+				Duration int `json:"duration"`
+			} `json:"createWorkout"`
+		} `json:"data"`
+	}
+	decode(t, rec, &response)
+	assert.Equal(t, 30, response.Data.CreateWorkout.Duration)
+}
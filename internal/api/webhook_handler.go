@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+	"github.com/OlivierCoq/go_api_template/internal/webhooks"
+)
+
+// How many webhooks a user can have
+const maxWebhookSubscriptions = 10
+
+type WebhookHandler struct {
+	webhookStore store.WebhookStore
+	audit        *audit.Logger
+	logger       *log.Logger
+}
+
+// NewWebhookHandler creates a new instance of WebhookHandler
+func NewWebhookHandler(webhookStore store.WebhookStore, auditLogger *audit.Logger, logger *log.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		webhookStore: webhookStore,
+		audit:        auditLogger,
+		logger:       logger,
+	}
+}
+
+type createWebhookRequest struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"` // Optional, one is generated if empty
+	EventTypes []string `json:"event_types"`
+}
+
+/*
+	Subscribe to events of the current user's workouts:
+		{"url": "https://coach.example.com/hooks", "event_types": ["workout.created", "record.achieved"]}
+	The response includes the secret payloads are signed with (see the webhooks package). It's only shown this once.
+*/
+
+func (h *WebhookHandler) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	var req createWebhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"}) // 400
+		return
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "url must be an absolute http(s) URL"}) // 400
+		return
+	}
+	// Host names are checked again when webhooks are sent, once resolved (see the webhooks package)
+	if !webhooks.IsPublicHost(target.Hostname()) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "url must point to a public address"}) // 400
+		return
+	}
+	if len(req.EventTypes) == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "event_types is required"}) // 400
+		return
+	}
+	for _, eventType := range req.EventTypes {
+		if !store.IsValidWebhookEvent(eventType) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unknown event type " + eventType}) // 400
+			return
+		}
+	}
+
+	existing, err := h.webhookStore.GetWebhookSubscriptions(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error fetching webhooks: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create webhook"}) // 500
+		return
+	}
+	if len(existing) >= maxWebhookSubscriptions {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "too many webhooks, delete one first"}) // 409
+		return
+	}
+
+	if req.Secret == "" {
+		req.Secret, err = webhooks.GenerateSecret()
+		if err != nil {
+			h.logger.Printf("Error generating webhook secret: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create webhook"}) // 500
+			return
+		}
+	}
+
+	subscription := &store.WebhookSubscription{
+		UserID:     currentUser.ID,
+		URL:        req.URL,
+		Secret:     req.Secret,
+		EventTypes: req.EventTypes,
+	}
+	err = h.webhookStore.CreateWebhookSubscription(subscription)
+	if err != nil {
+		h.logger.Printf("Error creating webhook: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create webhook"}) // 500
+		return
+	}
+
+	// The secret is left out of the audit log
+	h.audit.Record(r, audit.Event{
+		ActorID:    currentUser.ID,
+		Action:     audit.ActionWebhookCreated,
+		Resource:   audit.ResourceWebhook,
+		ResourceID: subscription.ID,
+		Metadata:   map[string]interface{}{"url": subscription.URL, "event_types": subscription.EventTypes},
+	})
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"webhook": subscription}) // 201
+}
+
+func (h *WebhookHandler) HandleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	subscriptions, err := h.webhookStore.GetWebhookSubscriptions(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error fetching webhooks: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch webhooks"}) // 500
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"webhooks": subscriptions}) // 200
+}
+
+// Delete a webhook. Its deliveries that haven't been sent yet are dropped.
+func (h *WebhookHandler) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	id, err := utils.ReadIDParam(r, "id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid webhook ID"}) // 400
+		return
+	}
+
+	deleted, err := h.webhookStore.DeleteWebhookSubscription(currentUser.ID, id)
+	if err != nil {
+		h.logger.Printf("Error deleting webhook: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete webhook"}) // 500
+		return
+	}
+	if !deleted {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Webhook not found"}) // 404
+		return
+	}
+
+	h.audit.Record(r, audit.Event{
+		ActorID:    currentUser.ID,
+		Action:     audit.ActionWebhookDeleted,
+		Resource:   audit.ResourceWebhook,
+		ResourceID: id,
+	})
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// Dead letters: deliveries to the current user's webhooks that failed too many times and won't be retried on their own
+func (h *WebhookHandler) HandleGetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	deliveries, err := h.webhookStore.GetDeadLetters(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("Error fetching dead letters: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch dead letters"}) // 500
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"deliveries": deliveries}) // 200
+}
+
+// Send a dead letter again, e.g. once the receiver is fixed. It gets a fresh set of attempts.
+func (h *WebhookHandler) HandleRetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	id, err := utils.ReadIDParam(r, "id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid delivery ID"}) // 400
+		return
+	}
+
+	retried, err := h.webhookStore.RetryDeadLetter(currentUser.ID, id)
+	if err != nil {
+		h.logger.Printf("Error retrying dead letter: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retry delivery"}) // 500
+		return
+	}
+	if !retried {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Dead letter not found"}) // 404
+		return
+	}
+	w.WriteHeader(http.StatusAccepted) // 202
+}
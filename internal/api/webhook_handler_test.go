@@ -0,0 +1,144 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookEndpoints(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner, other := s.register(), s.register()
+	users := map[string]*testUser{"owner": owner, "other": other}
+	hook := func(url string, eventTypes ...string) map[string]interface{} {
+		return map[string]interface{}{"url": url, "event_types": eventTypes}
+	}
+
+	rec := s.request(http.MethodPost, "/v1/webhooks", owner, hook("https://coach.example.com/hooks", "workout.created"))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created struct {
+		Webhook store.WebhookSubscription `json:"webhook"`
+	}
+	decode(t, rec, &created)
+	assert.NotEmpty(t, created.Webhook.Secret, "the secret is shown once, on creation")
+	path := fmt.Sprintf("/v1/webhooks/%d", created.Webhook.ID)
+
+	s.run([]endpointTest{
+		{"create anonymously", http.MethodPost, "/v1/webhooks", "anonymous", hook("https://coach.example.com/hooks", "workout.created"), http.StatusUnauthorized},
+		{"create with relative URL", http.MethodPost, "/v1/webhooks", "owner", hook("/hooks", "workout.created"), http.StatusBadRequest},
+		{"create with loopback URL", http.MethodPost, "/v1/webhooks", "owner", hook("http://localhost:8080/admin", "workout.created"), http.StatusBadRequest},
+		{"create with metadata URL", http.MethodPost, "/v1/webhooks", "owner", hook("http://169.254.169.254/latest/meta-data", "workout.created"), http.StatusBadRequest},
+		{"create with private URL", http.MethodPost, "/v1/webhooks", "owner", hook("http://[fd00:ec2::254]/", "workout.created"), http.StatusBadRequest},
+		{"create without event types", http.MethodPost, "/v1/webhooks", "owner", hook("https://coach.example.com/hooks"), http.StatusBadRequest},
+		{"create with unknown event type", http.MethodPost, "/v1/webhooks", "owner", hook("https://coach.example.com/hooks", "workout.exploded"), http.StatusBadRequest},
+
+		{"list", http.MethodGet, "/v1/webhooks", "owner", nil, http.StatusOK},
+		{"list anonymously", http.MethodGet, "/v1/webhooks", "anonymous", nil, http.StatusUnauthorized},
+
+		{"dead letters", http.MethodGet, "/v1/webhooks/dead-letters", "owner", nil, http.StatusOK},
+		{"dead letters anonymously", http.MethodGet, "/v1/webhooks/dead-letters", "anonymous", nil, http.StatusUnauthorized},
+		{"retry unknown dead letter", http.MethodPost, "/v1/webhooks/dead-letters/999999/retry", "owner", nil, http.StatusNotFound},
+		{"retry with invalid ID", http.MethodPost, "/v1/webhooks/dead-letters/abc/retry", "owner", nil, http.StatusBadRequest},
+
+		{"delete anonymously", http.MethodDelete, path, "anonymous", nil, http.StatusUnauthorized},
+		{"delete someone else's", http.MethodDelete, path, "other", nil, http.StatusNotFound},
+		{"delete with invalid ID", http.MethodDelete, "/v1/webhooks/abc", "owner", nil, http.StatusBadRequest},
+	}, users)
+
+	// Someone else's webhooks aren't listed either
+	rec = s.request(http.MethodGet, "/v1/webhooks", other, nil)
+	var listed struct {
+		Webhooks []store.WebhookSubscription `json:"webhooks"`
+	}
+	decode(t, rec, &listed)
+	assert.Empty(t, listed.Webhooks)
+
+	s.run([]endpointTest{
+		{"delete", http.MethodDelete, path, "owner", nil, http.StatusNoContent},
+		{"delete again", http.MethodDelete, path, "owner", nil, http.StatusNotFound},
+	}, users)
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner, other := s.register(), s.register()
+	users := map[string]*testUser{"owner": owner, "other": other}
+
+	rec := s.request(http.MethodPost, "/v1/webhooks", owner, map[string]interface{}{"url": "https://coach.example.com/hooks", "event_types": []string{"workout.created"}})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	s.createWorkout(owner, "Legs")
+
+	// Fail the delivery for good, as the worker does once it runs out of attempts
+	_, err := s.app.Events.RunOnce()
+	require.NoError(t, err)
+	deliveries, err := s.stores.Webhooks.ClaimWebhookDeliveries(10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.NoError(t, s.stores.Webhooks.MarkWebhookFailed(deliveries[0].ID, http.StatusBadGateway, "bad gateway", nil))
+
+	retry := fmt.Sprintf("/v1/webhooks/dead-letters/%d/retry", deliveries[0].ID)
+	s.run([]endpointTest{
+		{"retry anonymously", http.MethodPost, retry, "anonymous", nil, http.StatusUnauthorized},
+		{"retry someone else's", http.MethodPost, retry, "other", nil, http.StatusNotFound},
+		{"retry", http.MethodPost, retry, "owner", nil, http.StatusAccepted},
+		{"retry again", http.MethodPost, retry, "owner", nil, http.StatusNotFound},
+	}, users)
+}
+
+func TestWebhookDeliveriesComeFromEvents(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner := s.register()
+
+	rec := s.request(http.MethodPost, "/v1/webhooks", owner, map[string]interface{}{"url": "https://coach.example.com/hooks", "event_types": []string{"workout.created", "record.achieved"}})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	s.createWorkout(owner, "Legs") // Squats at 60, the first ones: not a record
+	rec = s.request(http.MethodPost, "/v1/workouts", owner, map[string]interface{}{
+		"title":   "Heavy legs",
+		"entries": []map[string]interface{}{{"exercise_name": "squat", "sets": 1, "reps": 3, "weight": 80, "order_index": 1}},
+	})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	// Nothing is enqueued until the domain events are dispatched
+	deliveries, err := s.stores.Webhooks.ClaimWebhookDeliveries(10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	_, err = s.app.Events.RunOnce()
+	require.NoError(t, err)
+	deliveries, err = s.stores.Webhooks.ClaimWebhookDeliveries(10, time.Minute)
+	require.NoError(t, err)
+	var eventTypes []string
+	for _, delivery := range deliveries {
+		eventTypes = append(eventTypes, delivery.EventType)
+	}
+	assert.ElementsMatch(t, []string{"workout.created", "workout.created", "record.achieved"}, eventTypes)
+
+	for _, delivery := range deliveries {
+		if delivery.EventType != "record.achieved" {
+			continue
+		}
+		var event struct {
+			ID   string                 `json:"id"`
+			Data map[string]interface{} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(delivery.Payload, &event))
+		assert.Equal(t, delivery.EventID, event.ID)
+		assert.EqualValues(t, 80, event.Data["weight"])
+		assert.EqualValues(t, 60, event.Data["previous_weight"])
+	}
+
+	// An event dispatched again isn't delivered twice
+	require.NoError(t, s.stores.Webhooks.EnqueueWebhookEvent(owner.ID, store.WebhookEvent{ID: deliveries[0].EventID, Type: deliveries[0].EventType, Data: map[string]interface{}{}}))
+	deliveries, err = s.stores.Webhooks.ClaimWebhookDeliveries(10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
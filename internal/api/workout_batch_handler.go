@@ -0,0 +1,308 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+)
+
+/*
+	Batch endpoint: apply many workout changes in one request, e.g. when the mobile app syncs after being offline.
+
+	Request body:
+		{
+			"mode": "atomic",  // or "partial"
+			"operations": [
+				{"op": "create", "workout": {...}},
+				{"op": "update", "id": 12, "workout": {"title": "New title"}},  // same partial fields as PATCH /workouts/{id}
+				{"op": "delete", "id": 13, "version": 4}  // optional, like If-Match: fails with 412 if the workout moved on
+			]
+		}
+
+	- atomic (default): everything runs in a single transaction. The first failing operation rolls back all of them.
+	- partial: each operation is applied on its own, so the ones that succeed are kept even if others fail.
+
+	Every operation gets a result with its own HTTP-like status code, in the same order as the request.
+*/
+
+const (
+	batchModeAtomic  = "atomic"
+	batchModePartial = "partial"
+
+	maxBatchOperations = 100
+)
+
+type batchOperation struct {
+	Op      string          `json:"op"`      // create, update or delete
+	ID      int64           `json:"id"`      // Workout ID, for update and delete
+	Version int             `json:"version"` // Expected version of the workout, for update and delete. 0 skips the check
+	Workout json.RawMessage `json:"workout"`
+}
+
+type batchRequest struct {
+	Mode       string           `json:"mode"`
+	Operations []batchOperation `json:"operations"`
+}
+
+type batchResult struct {
+	Index   int            `json:"index"`
+	Op      string         `json:"op"`
+	ID      int64          `json:"id,omitempty"`
+	Status  int            `json:"status"`
+	Workout *store.Workout `json:"workout,omitempty"`
+	Error   string         `json:"error,omitempty"`
+
+	event *audit.Event // What to add to the audit log, once the operation is saved for good
+}
+
+// batchOpError is a failure of a single operation that should be reported to the client (not found, forbidden, validation...)
+type batchOpError struct {
+	status  int
+	message string
+}
+
+func (e *batchOpError) Error() string {
+	return e.message
+}
+
+// Apply a list of create/update/delete operations
+func (wh *WorkoutHandler) HandleBatchWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	var req batchRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Printf("Invalid batch payload: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"}) // 400
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = batchModeAtomic
+	}
+	if req.Mode != batchModeAtomic && req.Mode != batchModePartial {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mode must be atomic or partial"}) // 400
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOperations {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("a batch must contain between 1 and %d operations", maxBatchOperations)}) // 400
+		return
+	}
+
+	results := make([]batchResult, len(req.Operations))
+	for i, op := range req.Operations {
+		results[i] = batchResult{Index: i, Op: op.Op, ID: op.ID}
+	}
+
+	if req.Mode == batchModePartial {
+		// Each store call is its own transaction, so one failing operation doesn't affect the others
+		for i, op := range req.Operations {
+			wh.runBatchOperation(wh.workoutStore, currentUser, op, &results[i])
+		}
+		wh.recordBatch(r, results)
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"results": results}) // 200
+		return
+	}
+
+	// Atomic mode: stop at the first failure, which rolls back the whole transaction
+	failed := -1
+	err = wh.workoutStore.WithTransaction(func(tx store.WorkoutTx) error {
+		for i, op := range req.Operations {
+			if !wh.runBatchOperation(tx, currentUser, op, &results[i]) {
+				failed = i
+				return errors.New(results[i].Error)
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		wh.recordBatch(r, results)
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"results": results}) // 200
+		return
+	}
+
+	if failed == -1 {
+		// The operations went fine but the commit itself failed
+		wh.logger.Printf("Failed to commit workout batch: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to apply batch"}) // 500
+		return
+	}
+
+	// Nothing was saved. The other operations are marked 424 (Failed Dependency): they were fine but got rolled back along with the failing one.
+	for i := range results {
+		if i != failed {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Workout = nil
+			results[i].Error = "rolled back"
+		}
+	}
+	utils.WriteJSON(w, results[failed].Status, utils.Envelope{
+		"error":   fmt.Sprintf("operation %d failed: %s", failed, results[failed].Error),
+		"results": results,
+	})
+}
+
+// recordBatch adds the operations that went through to the audit log. Rolled back ones have no event.
+func (wh *WorkoutHandler) recordBatch(r *http.Request, results []batchResult) {
+	for _, result := range results {
+		if result.event != nil {
+			wh.audit.Record(r, *result.event)
+		}
+	}
+}
+
+// runBatchOperation applies one operation through ws (the store itself, or a transaction) and fills in its result.
+// It returns false if the operation failed.
+func (wh *WorkoutHandler) runBatchOperation(ws store.WorkoutTx, currentUser *store.User, op batchOperation, result *batchResult) bool {
+	var workout, before *store.Workout
+	var err error
+	event := &audit.Event{ActorID: currentUser.ID, Resource: audit.ResourceWorkout, Metadata: map[string]interface{}{"batch": true}}
+
+	switch op.Op {
+	case "create":
+		workout, err = batchCreate(ws, currentUser, op)
+		result.Status = http.StatusCreated
+		event.Action = audit.ActionWorkoutCreated
+	case "update":
+		workout, before, err = batchUpdate(ws, currentUser, op)
+		result.Status = http.StatusOK
+		event.Action = audit.ActionWorkoutUpdated
+	case "delete":
+		before, err = batchDelete(ws, currentUser, op)
+		result.Status = http.StatusNoContent
+		event.Action = audit.ActionWorkoutDeleted
+	default:
+		err = &batchOpError{status: http.StatusBadRequest, message: "op must be create, update or delete"}
+	}
+
+	if err != nil {
+		var opErr *batchOpError
+		if errors.As(err, &opErr) {
+			result.Status = opErr.status
+			result.Error = opErr.message
+		} else {
+			wh.logger.Printf("Batch %s operation failed: %v", op.Op, err)
+			result.Status = http.StatusInternalServerError
+			result.Error = fmt.Sprintf("failed to %s workout", op.Op)
+		}
+		return false
+	}
+
+	result.Workout = workout
+	if workout != nil {
+		result.ID = int64(workout.ID)
+	}
+	// Only set non-nil workouts: a nil *store.Workout in an interface{} isn't nil, and would be recorded as null
+	event.ResourceID = result.ID
+	if before != nil {
+		event.Before = before
+	}
+	if workout != nil {
+		event.After = workout
+	}
+	result.event = event
+	return true
+}
+
+func batchCreate(ws store.WorkoutTx, currentUser *store.User, op batchOperation) (*store.Workout, error) {
+	var workout store.Workout
+	err := json.Unmarshal(op.Workout, &workout)
+	if err != nil {
+		return nil, &batchOpError{status: http.StatusBadRequest, message: "invalid workout payload"}
+	}
+	if workout.Status != "" && !store.IsValidWorkoutStatus(workout.Status) {
+		return nil, &batchOpError{status: http.StatusBadRequest, message: errInvalidStatus.Error()}
+	}
+	workout.ID = 0
+	workout.UserID = currentUser.ID
+
+	created, err := ws.CreateWorkout(&workout)
+	if errors.Is(err, store.ErrDuplicateExternalID) {
+		return nil, &batchOpError{status: http.StatusConflict, message: err.Error()}
+	}
+	if errors.Is(err, store.ErrInvalidUUID) {
+		return nil, &batchOpError{status: http.StatusBadRequest, message: err.Error()}
+	}
+	return created, err
+}
+
+// batchUpdate returns the updated workout, and what it was before for the audit log
+func batchUpdate(ws store.WorkoutTx, currentUser *store.User, op batchOperation) (*store.Workout, *store.Workout, error) {
+	workout, err := batchOwnedWorkout(ws, currentUser, op.ID, op.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var req updateWorkoutRequest
+	err = json.Unmarshal(op.Workout, &req)
+	if err != nil {
+		return nil, nil, &batchOpError{status: http.StatusBadRequest, message: "invalid workout payload"}
+	}
+	before := snapshotWorkout(workout)
+	err = req.apply(workout)
+	if err != nil {
+		return nil, nil, &batchOpError{status: http.StatusBadRequest, message: err.Error()}
+	}
+
+	err = ws.UpdateWorkout(workout)
+	if errors.Is(err, store.ErrVersionConflict) {
+		return nil, nil, &batchOpError{status: http.StatusConflict, message: err.Error()}
+	}
+	if errors.Is(err, store.ErrInvalidUUID) || errors.Is(err, store.ErrInvalidEntries) {
+		return nil, nil, &batchOpError{status: http.StatusBadRequest, message: err.Error()}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return workout, before, nil
+}
+
+// batchDelete returns the deleted workout, for the audit log
+func batchDelete(ws store.WorkoutTx, currentUser *store.User, op batchOperation) (*store.Workout, error) {
+	workout, err := batchOwnedWorkout(ws, currentUser, op.ID, op.Version)
+	if err != nil {
+		return nil, err
+	}
+	err = ws.DeleteWorkout(op.ID, workout.Version)
+	if errors.Is(err, store.ErrVersionConflict) {
+		return nil, &batchOpError{status: http.StatusConflict, message: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+// batchOwnedWorkout fetches a workout and checks that it belongs to the current user and has the expected version,
+// like HandleUpdateWorkout and HandleDeleteWorkout do.
+func batchOwnedWorkout(ws store.WorkoutTx, currentUser *store.User, id int64, version int) (*store.Workout, error) {
+	if id <= 0 {
+		return nil, &batchOpError{status: http.StatusBadRequest, message: "id is required"}
+	}
+
+	workout, err := ws.GetWorkoutByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if workout == nil {
+		return nil, &batchOpError{status: http.StatusNotFound, message: "workout not found"}
+	}
+
+	// Ownership first, so that the versions of other users' workouts can't be guessed from 412s
+	workoutOwner, err := ws.GetWorkoutOwner(id)
+	if err != nil {
+		return nil, err
+	}
+	if workoutOwner != currentUser.ID {
+		return nil, &batchOpError{status: http.StatusForbidden, message: "you do not have permission to modify this workout"}
+	}
+	if version != 0 && version != workout.Version {
+		return nil, &batchOpError{status: http.StatusPreconditionFailed, message: store.ErrVersionConflict.Error()}
+	}
+	return workout, nil
+}
@@ -0,0 +1,327 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+)
+
+/*
+	Entry-level endpoints, to change one exercise line without sending the whole workout:
+		POST   /workouts/{id}/entries            add an entry (at the end, unless order_index is given)
+		PATCH  /workouts/{id}/entries/{entryID}  change some fields of an entry
+		DELETE /workouts/{id}/entries/{entryID}  remove an entry
+		PUT    /workouts/{id}/entries/order      {"entry_ids": [3, 1, 2]} reorder all the entries
+
+	Entries keep their IDs through all of these. Each change bumps the version of the workout, so the ETag
+	returned is the workout's, and If-Match (with the workout's ETag) is honored like on PATCH /workouts/{id}.
+	Like there, a change that loses the race with another one on the same workout gets a 412 (or a 409 without If-Match).
+*/
+
+// Partial update of an entry. Like updateWorkoutRequest, pointers tell missing fields apart from zero values.
+type updateEntryRequest struct {
+	ExerciseName    *string  `json:"exercise_name"`
+	Sets            *int     `json:"sets"`
+	Reps            *int     `json:"reps"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	Weight          *float64 `json:"weight"`
+	Notes           *string  `json:"notes"`
+	OrderIndex      *int     `json:"order_index"`
+}
+
+func (req *updateEntryRequest) apply(entry *store.WorkoutEntry) {
+	if req.ExerciseName != nil {
+		entry.ExerciseName = *req.ExerciseName
+	}
+	if req.Sets != nil {
+		entry.Sets = *req.Sets
+	}
+	// An entry is counted either in reps or in seconds, so setting one clears the other
+	if req.Reps != nil {
+		entry.Reps = req.Reps
+		entry.DurationSeconds = nil
+	}
+	if req.DurationSeconds != nil {
+		entry.DurationSeconds = req.DurationSeconds
+		entry.Reps = nil
+	}
+	if req.Weight != nil {
+		entry.Weight = req.Weight
+	}
+	if req.Notes != nil {
+		entry.Notes = *req.Notes
+	}
+	if req.OrderIndex != nil {
+		entry.OrderIndex = *req.OrderIndex
+	}
+}
+
+type reorderEntriesRequest struct {
+	EntryIDs []int64 `json:"entry_ids"`
+}
+
+// validateEntry checks what the database would otherwise reject with a less helpful error
+func validateEntry(entry *store.WorkoutEntry) error {
+	if entry.ExerciseName == "" {
+		return errors.New("exercise_name is required")
+	}
+	if entry.Sets < 0 {
+		return errors.New("sets cannot be negative")
+	}
+	if (entry.Reps == nil) == (entry.DurationSeconds == nil) {
+		return errors.New("an entry needs either reps or duration_seconds")
+	}
+	return nil
+}
+
+// Add an entry to a workout
+func (wh *WorkoutHandler) HandleAddWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.entryWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	var entry store.WorkoutEntry
+	err := json.NewDecoder(r.Body).Decode(&entry)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"}) // 400
+		return
+	}
+	err = validateEntry(&entry)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
+		return
+	}
+
+	version, err := wh.workoutStore.AddWorkoutEntry(int64(workout.ID), workout.Version, &entry)
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.writeVersionConflict(w, r, int64(workout.ID))
+		return
+	}
+	if errors.Is(err, store.ErrInvalidUUID) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("Failed to add workout entry: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to add entry"}) // 500
+		return
+	}
+
+	wh.recordEntryChange(r, audit.ActionEntryCreated, workout, nil, &entry)
+	workout.Version = version
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"entry": entry}) // 201
+}
+
+// Change some fields of an entry
+func (wh *WorkoutHandler) HandleUpdateWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.entryWorkout(w, r)
+	if !ok {
+		return
+	}
+	entry, ok := findEntry(w, r, workout)
+	if !ok {
+		return
+	}
+
+	var req updateEntryRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"}) // 400
+		return
+	}
+	before := *entry
+	req.apply(entry)
+	err = validateEntry(entry)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
+		return
+	}
+
+	version, err := wh.workoutStore.UpdateWorkoutEntry(int64(workout.ID), workout.Version, entry)
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.writeVersionConflict(w, r, int64(workout.ID))
+		return
+	}
+	if errors.Is(err, store.ErrInvalidEntries) {
+		// The entry was deleted since we read the workout
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Entry not found"}) // 404
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("Failed to update workout entry: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update entry"}) // 500
+		return
+	}
+
+	wh.recordEntryChange(r, audit.ActionEntryUpdated, workout, &before, entry)
+	workout.Version = version
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entry": entry}) // 200
+}
+
+// Remove an entry from a workout
+func (wh *WorkoutHandler) HandleDeleteWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.entryWorkout(w, r)
+	if !ok {
+		return
+	}
+	entry, ok := findEntry(w, r, workout)
+	if !ok {
+		return
+	}
+
+	version, err := wh.workoutStore.DeleteWorkoutEntry(int64(workout.ID), workout.Version, int64(entry.ID))
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.writeVersionConflict(w, r, int64(workout.ID))
+		return
+	}
+	if errors.Is(err, store.ErrInvalidEntries) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Entry not found"}) // 404
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("Failed to delete workout entry: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete entry"}) // 500
+		return
+	}
+
+	wh.recordEntryChange(r, audit.ActionEntryDeleted, workout, entry, nil)
+	workout.Version = version
+	w.Header().Set("ETag", workoutETag(workout))
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// Put the entries of a workout in a new order
+func (wh *WorkoutHandler) HandleReorderWorkoutEntries(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.entryWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	var req reorderEntriesRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"}) // 400
+		return
+	}
+
+	before := entryOrder(workout)
+	_, err = wh.workoutStore.ReorderWorkoutEntries(int64(workout.ID), workout.Version, req.EntryIDs)
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.writeVersionConflict(w, r, int64(workout.ID))
+		return
+	}
+	if errors.Is(err, store.ErrInvalidEntries) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("Failed to reorder workout entries: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to reorder entries"}) // 500
+		return
+	}
+
+	// Respond with the whole workout, so the client gets the entries with their new order_index
+	workout, err = wh.workoutStore.GetWorkoutByID(int64(workout.ID))
+	if err != nil || workout == nil {
+		wh.logger.Printf("Failed to fetch reordered workout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch workout"}) // 500
+		return
+	}
+
+	wh.audit.Record(r, audit.Event{
+		ActorID:    workout.UserID, // entryWorkout made sure the current user owns the workout
+		Action:     audit.ActionEntriesReordered,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: workout.ID,
+		Before:     before,
+		After:      entryOrder(workout),
+	})
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout}) // 200
+}
+
+// entryOrder lists the IDs of the entries of a workout in their order, for the audit log
+func entryOrder(workout *store.Workout) map[string]interface{} {
+	ids := make([]int, len(workout.Entries))
+	for i, entry := range workout.Entries {
+		ids[i] = entry.ID
+	}
+	return map[string]interface{}{"entry_ids": ids}
+}
+
+// entryWorkout fetches the workout of an entry route and checks that the current user owns it and that If-Match matches.
+// If anything is wrong, the error response is already written and ok is false.
+func (wh *WorkoutHandler) entryWorkout(w http.ResponseWriter, r *http.Request) (*store.Workout, bool) {
+	workoutID, err := utils.ReadIDParam(r, "id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID"}) // 400
+		return nil, false
+	}
+
+	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
+	if err != nil {
+		wh.logger.Printf("Error fetching workout %d: %v", workoutID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch workout"}) // 500
+		return nil, false
+	}
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"}) // 404
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if workout.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You do not have permission to modify this workout"}) // 403
+		return nil, false
+	}
+
+	if ifMatchFails(r, workout) {
+		writePreconditionFailed(w, workout)
+		return nil, false
+	}
+	return workout, true
+}
+
+// findEntry returns the entry of the workout named by the entryID route parameter
+func findEntry(w http.ResponseWriter, r *http.Request, workout *store.Workout) (*store.WorkoutEntry, bool) {
+	entryID, err := utils.ReadIDParam(r, "entryID")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid entry ID"}) // 400
+		return nil, false
+	}
+
+	for i := range workout.Entries {
+		if int64(workout.Entries[i].ID) == entryID {
+			return &workout.Entries[i], true
+		}
+	}
+	utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Entry not found"}) // 404
+	return nil, false
+}
+
+// recordEntryChange adds a change to an entry to the audit log. before is nil for new entries, after for deleted ones.
+func (wh *WorkoutHandler) recordEntryChange(r *http.Request, action string, workout *store.Workout, before, after *store.WorkoutEntry) {
+	event := audit.Event{
+		ActorID:  workout.UserID, // entryWorkout made sure the current user owns the workout
+		Action:   action,
+		Resource: audit.ResourceEntry,
+		Metadata: map[string]interface{}{"workout_id": workout.ID},
+	}
+	if before != nil {
+		event.ResourceID = before.ID
+		event.Before = before
+	}
+	if after != nil {
+		event.ResourceID = after.ID
+		event.After = after
+	}
+	wh.audit.Record(r, event)
+}
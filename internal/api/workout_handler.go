@@ -2,9 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/OlivierCoq/go_api_template/internal/audit"
 	"github.com/OlivierCoq/go_api_template/internal/middleware"
 	"github.com/OlivierCoq/go_api_template/internal/store"
 	"github.com/OlivierCoq/go_api_template/internal/utils"
@@ -13,17 +18,132 @@ import (
 type WorkoutHandler struct {
 	// Add fields as necessary, e.g., a reference to the application or database
 	workoutStore store.WorkoutStore // Interface to interact with workout data. This promotes db decoupling and easier testing.
+	audit        *audit.Logger
 	logger       *log.Logger
 }
 
 // NewWorkoutHandler creates a new instance of WorkoutHandler
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, auditLogger *audit.Logger, logger *log.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
 		workoutStore: workoutStore,
+		audit:        auditLogger,
 		logger:       logger,
 	}
 }
 
+// snapshotWorkout copies a workout before it gets changed, so the audit log can show what it was
+func snapshotWorkout(workout *store.Workout) *store.Workout {
+	before := *workout
+	before.Entries = append([]store.WorkoutEntry(nil), workout.Entries...)
+	return &before
+}
+
+// We use json tags here for parsing purposes. We use pointers to differentiate between zero values and missing fields.
+type updateWorkoutRequest struct {
+	Title           *string               `json:"title"`
+	Description     *string               `json:"description"`
+	DurationMinutes *int                  `json:"duration"`
+	CaloriesBurned  *int                  `json:"calories_burned"`
+	PlannedFor      *time.Time            `json:"planned_for"`
+	Status          *string               `json:"status"`
+	Entries         *[]store.WorkoutEntry `json:"entries"`
+}
+
+// errInvalidStatus is returned when a request sets a workout status we don't know about
+var errInvalidStatus = errors.New("status must be one of planned, completed or skipped")
+
+/*
+	- What's happening here is that we're checking if each field in the updateWorkoutRequest struct is non-nil (meaning it was provided in the request).
+	- If it's non-nil, we dereference the pointer to get the actual value and update the corresponding field in the workout struct.
+	- This way, only the fields that were provided in the request will be updated, while others will remain unchanged.
+*/
+
+func (req *updateWorkoutRequest) apply(workout *store.Workout) error {
+	if req.Title != nil {
+		workout.Title = *req.Title
+	}
+	if req.Description != nil {
+		workout.Description = *req.Description
+	}
+	if req.DurationMinutes != nil {
+		workout.DurationMinutes = *req.DurationMinutes
+	}
+	if req.CaloriesBurned != nil {
+		workout.CaloriesBurned = *req.CaloriesBurned
+	}
+	if req.PlannedFor != nil {
+		workout.PlannedFor = req.PlannedFor
+	}
+	if req.Status != nil {
+		if !store.IsValidWorkoutStatus(*req.Status) {
+			return errInvalidStatus
+		}
+		workout.Status = *req.Status
+	}
+	if req.Entries != nil {
+		workout.Entries = *req.Entries
+	}
+	// Let the store stamp the time of this edit, instead of keeping the previous one
+	workout.UpdatedAt = time.Time{}
+	return nil
+}
+
+/*
+	Optimistic concurrency. Every workout has a version, incremented by each update, which we send as its ETag.
+	A client that sends it back in If-Match on PATCH or DELETE only changes the workout if nobody else did in the
+	meantime, and gets a 412 (Precondition Failed) otherwise: it should then fetch the workout again and retry.
+	If-Match is optional, requests without it behave like before.
+*/
+
+// workoutETag returns the ETag of a workout. ETags are quoted strings.
+func workoutETag(workout *store.Workout) string {
+	return fmt.Sprintf(`"%d"`, workout.Version)
+}
+
+// ifMatchFails reports whether the request has an If-Match header that doesn't match the workout's current ETag.
+// If-Match can list several ETags, or be "*" to match any existing workout.
+func ifMatchFails(r *http.Request, workout *store.Workout) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return false
+	}
+	etag := workoutETag(workout)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return false
+		}
+	}
+	return true
+}
+
+// writePreconditionFailed answers a request whose If-Match didn't match, with the current ETag so the client knows where things are at
+func writePreconditionFailed(w http.ResponseWriter, workout *store.Workout) {
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusPreconditionFailed, utils.Envelope{"error": "The workout was modified since you last fetched it"}) // 412
+}
+
+/*
+	writeVersionConflict answers a request that passed the If-Match check, but lost the race to save the workout to another
+	request (the store returned ErrVersionConflict): 412 if it had If-Match, 409 otherwise.
+	The ETag is the one of the version saved in the meantime, so the client can retry without fetching the workout again.
+*/
+
+func (wh *WorkoutHandler) writeVersionConflict(w http.ResponseWriter, r *http.Request, workoutID int64) {
+	current, err := wh.workoutStore.GetWorkoutByID(workoutID)
+	if err != nil {
+		wh.logger.Printf("Error fetching the current version of workout %d: %v", workoutID, err)
+	}
+	if current != nil {
+		w.Header().Set("ETag", workoutETag(current))
+	}
+	if r.Header.Get("If-Match") != "" {
+		utils.WriteJSON(w, http.StatusPreconditionFailed, utils.Envelope{"error": "The workout was modified since you last fetched it"}) // 412
+		return
+	}
+	utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "The workout was modified by another request, please retry"}) // 409
+}
+
 // Define methods for WorkoutHandler to handle workout-related requests. CRUD operations, etc.
 
 // Create
@@ -48,13 +168,35 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 
 	workout.UserID = currentUser.ID // Associate the workout with the current user's ID
 
+	// An empty status is allowed, the store picks planned or completed depending on whether a date was given:
+	if workout.Status != "" && !store.IsValidWorkoutStatus(workout.Status) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": errInvalidStatus.Error()}) // 400
+		return
+	}
+
 	// Feedback from the store
 	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
+	if errors.Is(err, store.ErrDuplicateExternalID) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()}) // 409
+		return
+	}
+	if errors.Is(err, store.ErrInvalidUUID) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to create workout", http.StatusInternalServerError)
 		return
 	}
 
+	wh.audit.Record(r, audit.Event{
+		ActorID:    currentUser.ID,
+		Action:     audit.ActionWorkoutCreated,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: createdWorkout.ID,
+		After:      createdWorkout,
+	})
+
 	// Respond with the created workout as JSON to the frontend:
 	// w.Header().Set("Content-Type", "application/json")
 	// json.NewEncoder(w).Encode(createdWorkout)
@@ -78,8 +220,14 @@ func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Re
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
 		return
 	}
+	// Other users' workouts don't exist as far as the current user is concerned
+	if workout == nil || workout.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"}) // 404
+		return
+	}
 	// w.Header().Set("Content-Type", "application/json")
 	// json.NewEncoder(w).Encode(workout)
+	w.Header().Set("ETag", workoutETag(workout))
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout}) // 200
 }
 
@@ -108,40 +256,23 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// We use json tags here for parsing purposes. We use pointers to differentiate between zero values and missing fields.
-	var updateWorkoutRequest struct {
-		Title           *string               `json:"title"`
-		Description     *string               `json:"description"`
-		DurationMinutes *int                  `json:"duration"`
-		CaloriesBurned  *int                  `json:"calories_burned"`
-		Entries         *[]store.WorkoutEntry `json:"entries"`
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"}) // 404
+		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&updateWorkoutRequest)
+	var req updateWorkoutRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	/*
-			- What's happening here is that we're checking if each field in the updateWorkoutRequest struct is non-nil (meaning it was provided in the request).
-		- If it's non-nil, we dereference the pointer to get the actual value and update the corresponding field in the workout struct.
-		- This way, only the fields that were provided in the request will be updated, while others will remain unchanged.
-	*/
-	if updateWorkoutRequest.Title != nil {
-		workout.Title = *updateWorkoutRequest.Title
-	}
-	if updateWorkoutRequest.Description != nil {
-		workout.Description = *updateWorkoutRequest.Description
-	}
-	if updateWorkoutRequest.DurationMinutes != nil {
-		workout.DurationMinutes = *updateWorkoutRequest.DurationMinutes
-	}
-	if updateWorkoutRequest.CaloriesBurned != nil {
-		workout.CaloriesBurned = *updateWorkoutRequest.CaloriesBurned
-	}
-	if updateWorkoutRequest.Entries != nil {
-		workout.Entries = *updateWorkoutRequest.Entries
+	before := snapshotWorkout(workout)
+	err = req.apply(workout)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
+		return
 	}
 
 	// Associate the workout with the current user's ID
@@ -160,19 +291,44 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 	if workoutOwner != currentUser.ID {
-		http.Error(w, "You do not have permission to update this workout", http.StatusForbidden)
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You do not have permission to update this workout"}) // 403
+		return
+	}
+
+	// The workout's version is the one we just read, unchanged by apply
+	if ifMatchFails(r, workout) {
+		writePreconditionFailed(w, workout)
 		return
 	}
 
-	// Update workout in the store
+	// Update workout in the store. The store checks the version again inside its transaction,
+	// in case someone else saved the workout between our read and this write.
 	err = wh.workoutStore.UpdateWorkout(workout)
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.writeVersionConflict(w, r, paramsWorkoutID)
+		return
+	}
+	if errors.Is(err, store.ErrInvalidUUID) || errors.Is(err, store.ErrInvalidEntries) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()}) // 400
+		return
+	}
 	if err != nil {
 		wh.logger.Printf("Failed to update workout: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update workout"})
 		return
 	}
 
+	wh.audit.Record(r, audit.Event{
+		ActorID:    currentUser.ID,
+		Action:     audit.ActionWorkoutUpdated,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: workout.ID,
+		Before:     before,
+		After:      workout,
+	})
+
 	// Respond with entire updated workout as JSON to the frontend:
+	w.Header().Set("ETag", workoutETag(workout))
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout}) // 200
 }
 
@@ -187,12 +343,16 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 	// Check if workout exists
-	_, err = wh.workoutStore.GetWorkoutByID(workoutID)
+	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
 	if err != nil {
 		wh.logger.Printf("Workout not found: %v", err)
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"}) // 404
 		return
 	}
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"}) // 404
+		return
+	}
 
 	// Ensure that the current user is the owner of the workout before deletion:
 	currentUser := middleware.GetUser(r)
@@ -212,20 +372,105 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You do not have permission to delete this workout"})
 		return
 	}
-	// Ensure that the workout exists before attempting deletion
-	_, err = wh.workoutStore.GetWorkoutByID(workoutID)
-	if err != nil {
-		wh.logger.Printf("Error retrieving workout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve workout"})
+	if ifMatchFails(r, workout) {
+		writePreconditionFailed(w, workout)
 		return
 	}
 
-	// Delete workout
-	err = wh.workoutStore.DeleteWorkout(workoutID)
+	// Delete the version that was read and checked: the store refuses if someone else saved the workout since
+	err = wh.workoutStore.DeleteWorkout(workoutID, workout.Version)
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.writeVersionConflict(w, r, workoutID)
+		return
+	}
 	if err != nil {
 		wh.logger.Printf("Failed to delete workout: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete workout"}) // 500
 		return
 	}
 
+	wh.audit.Record(r, audit.Event{
+		ActorID:    currentUser.ID,
+		Action:     audit.ActionWorkoutDeleted,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: workout.ID,
+		Before:     workout,
+	})
+
+}
+
+// Scheduling
+
+// Planned workouts that are still ahead of the current user
+func (wh *WorkoutHandler) HandleGetUpcomingWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	workouts, err := wh.workoutStore.GetUpcomingWorkouts(currentUser.ID)
+	if err != nil {
+		wh.logger.Printf("Error fetching upcoming workouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch upcoming workouts"}) // 500
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts}) // 200
+}
+
+// Planned workouts whose date has passed without being completed or skipped
+func (wh *WorkoutHandler) HandleGetOverdueWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	workouts, err := wh.workoutStore.GetOverdueWorkouts(currentUser.ID)
+	if err != nil {
+		wh.logger.Printf("Error fetching overdue workouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch overdue workouts"}) // 500
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts}) // 200
+}
+
+// Trash
+
+// Workouts of the current user that were deleted and can still be restored
+func (wh *WorkoutHandler) HandleGetTrash(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	workouts, err := wh.workoutStore.GetDeletedWorkouts(currentUser.ID)
+	if err != nil {
+		wh.logger.Printf("Error fetching deleted workouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch trash"}) // 500
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts}) // 200
+}
+
+// Take a workout of the current user out of the trash
+func (wh *WorkoutHandler) HandleRestoreWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r, "id")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID"}) // 400
+		return
+	}
+	currentUser := middleware.GetUser(r)
+
+	// The store only restores workouts of the current user, so someone else's workout is simply not found
+	workout, err := wh.workoutStore.RestoreWorkout(currentUser.ID, workoutID)
+	if err != nil {
+		wh.logger.Printf("Failed to restore workout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to restore workout"}) // 500
+		return
+	}
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found in trash"}) // 404
+		return
+	}
+
+	wh.audit.Record(r, audit.Event{
+		ActorID:    currentUser.ID,
+		Action:     audit.ActionWorkoutRestored,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: workout.ID,
+		After:      workout,
+	})
+
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout}) // 200
 }
@@ -0,0 +1,282 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The workout endpoints run on both SQLite and the in-memory stores, which must behave the same
+func TestWorkoutEndpoints(t *testing.T) {
+	t.Parallel()
+	t.Run("sqlite", func(t *testing.T) { testWorkoutEndpoints(t, newTestServer(t)) })
+	t.Run("memory", func(t *testing.T) { testWorkoutEndpoints(t, newTestServerWith(t, store.NewMemoryStores())) })
+}
+
+func testWorkoutEndpoints(t *testing.T, s *testServer) {
+	owner, other := s.register(), s.register()
+	users := map[string]*testUser{"owner": owner, "other": other}
+	workout := s.createWorkout(owner, "Legs")
+	trashed := s.createWorkout(owner, "Trashed")
+	require.Equal(t, http.StatusOK, s.request(http.MethodDelete, fmt.Sprintf("/v1/workouts/%d", trashed.ID), owner, nil).Code)
+
+	path := fmt.Sprintf("/v1/workouts/%d", workout.ID)
+	newWorkout := map[string]interface{}{"title": "Arms", "duration": 30, "calories_burned": 150, "entries": []interface{}{}}
+
+	s.run([]endpointTest{
+		{"create", http.MethodPost, "/v1/workouts", "owner", newWorkout, http.StatusCreated},
+		{"create anonymously", http.MethodPost, "/v1/workouts", "anonymous", newWorkout, http.StatusUnauthorized},
+		{"create without title", http.MethodPost, "/v1/workouts", "owner", map[string]interface{}{"duration": 30}, http.StatusBadRequest},
+		{"create with unknown status", http.MethodPost, "/v1/workouts", "owner", map[string]interface{}{"title": "Arms", "status": "maybe"}, http.StatusBadRequest},
+		{"create with taken external ID", http.MethodPost, "/v1/workouts", "owner", map[string]interface{}{"title": "Twice", "external_id": "ext-1"}, http.StatusCreated},
+		{"create with taken external ID again", http.MethodPost, "/v1/workouts", "owner", map[string]interface{}{"title": "Twice", "external_id": "ext-1"}, http.StatusConflict},
+
+		{"get", http.MethodGet, path, "owner", nil, http.StatusOK},
+		{"get anonymously", http.MethodGet, path, "anonymous", nil, http.StatusUnauthorized},
+		{"get someone else's", http.MethodGet, path, "other", nil, http.StatusNotFound},
+		{"get missing", http.MethodGet, "/v1/workouts/999999", "owner", nil, http.StatusNotFound},
+		{"get with invalid ID", http.MethodGet, "/v1/workouts/abc", "owner", nil, http.StatusBadRequest},
+		{"get in the trash", http.MethodGet, fmt.Sprintf("/v1/workouts/%d", trashed.ID), "owner", nil, http.StatusNotFound},
+
+		{"update", http.MethodPatch, path, "owner", map[string]interface{}{"title": "Leg day"}, http.StatusOK},
+		{"update anonymously", http.MethodPatch, path, "anonymous", map[string]interface{}{"title": "Mine now"}, http.StatusUnauthorized},
+		{"update someone else's", http.MethodPatch, path, "other", map[string]interface{}{"title": "Mine now"}, http.StatusForbidden},
+		{"update missing", http.MethodPatch, "/v1/workouts/999999", "owner", map[string]interface{}{"title": "Ghost"}, http.StatusNotFound},
+		{"update with invalid entries", http.MethodPatch, path, "owner", map[string]interface{}{"entries": []map[string]interface{}{{"exercise_name": "Squat", "reps": "ten"}}}, http.StatusBadRequest},
+		{"update with unknown entry", http.MethodPatch, path, "owner", map[string]interface{}{"entries": []map[string]interface{}{{"id": 999999, "exercise_name": "Squat", "sets": 1}}}, http.StatusBadRequest},
+
+		{"upcoming", http.MethodGet, "/v1/workouts/upcoming", "owner", nil, http.StatusOK},
+		{"upcoming anonymously", http.MethodGet, "/v1/workouts/upcoming", "anonymous", nil, http.StatusUnauthorized},
+		{"overdue", http.MethodGet, "/v1/workouts/overdue", "owner", nil, http.StatusOK},
+		{"overdue anonymously", http.MethodGet, "/v1/workouts/overdue", "anonymous", nil, http.StatusUnauthorized},
+		{"trash", http.MethodGet, "/v1/workouts/trash", "owner", nil, http.StatusOK},
+		{"trash anonymously", http.MethodGet, "/v1/workouts/trash", "anonymous", nil, http.StatusUnauthorized},
+
+		{"restore anonymously", http.MethodPost, fmt.Sprintf("/v1/workouts/%d/restore", trashed.ID), "anonymous", nil, http.StatusUnauthorized},
+		{"restore someone else's", http.MethodPost, fmt.Sprintf("/v1/workouts/%d/restore", trashed.ID), "other", nil, http.StatusNotFound},
+		{"restore with invalid ID", http.MethodPost, "/v1/workouts/abc/restore", "owner", nil, http.StatusBadRequest},
+		{"restore", http.MethodPost, fmt.Sprintf("/v1/workouts/%d/restore", trashed.ID), "owner", nil, http.StatusOK},
+		{"restore again", http.MethodPost, fmt.Sprintf("/v1/workouts/%d/restore", trashed.ID), "owner", nil, http.StatusNotFound},
+
+		{"delete anonymously", http.MethodDelete, path, "anonymous", nil, http.StatusUnauthorized},
+		{"delete someone else's", http.MethodDelete, path, "other", nil, http.StatusForbidden},
+		{"delete with invalid ID", http.MethodDelete, "/v1/workouts/abc", "owner", nil, http.StatusBadRequest},
+		{"delete", http.MethodDelete, path, "owner", nil, http.StatusOK},
+		{"delete again", http.MethodDelete, path, "owner", nil, http.StatusNotFound},
+	}, users)
+}
+
+func TestWorkoutConditionalRequests(t *testing.T) {
+	t.Parallel()
+	s := newTestServerWith(t, store.NewMemoryStores())
+	owner := s.register()
+	workout := s.createWorkout(owner, "Legs")
+	path := fmt.Sprintf("/v1/workouts/%d", workout.ID)
+
+	rec := s.request(http.MethodGet, path, owner, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// Saving with the ETag that was read works once: the save changes it
+	update := func(title string) int {
+		req := map[string]interface{}{"title": title}
+		rec := s.requestWithHeaders(http.MethodPatch, path, owner, req, map[string]string{"If-Match": etag})
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, update("First"))
+	assert.Equal(t, http.StatusPreconditionFailed, update("Second"))
+}
+
+// racingWorkoutStore saves each workout a first time right before it's updated, like a concurrent request would
+type racingWorkoutStore struct {
+	store.WorkoutStore
+}
+
+func (s racingWorkoutStore) UpdateWorkout(workout *store.Workout) error {
+	concurrent, err := s.WorkoutStore.GetWorkoutByID(int64(workout.ID))
+	if err != nil {
+		return err
+	}
+	concurrent.Title = "Concurrent"
+	err = s.WorkoutStore.UpdateWorkout(concurrent)
+	if err != nil {
+		return err
+	}
+	return s.WorkoutStore.UpdateWorkout(workout)
+}
+
+func (s racingWorkoutStore) UpdateWorkoutEntry(workoutID int64, version int, entry *store.WorkoutEntry) (int, error) {
+	reps := 1
+	_, err := s.WorkoutStore.AddWorkoutEntry(workoutID, version, &store.WorkoutEntry{ExerciseName: "Concurrent", Sets: 1, Reps: &reps})
+	if err != nil {
+		return 0, err
+	}
+	return s.WorkoutStore.UpdateWorkoutEntry(workoutID, version, entry)
+}
+
+func (s racingWorkoutStore) DeleteWorkout(id int64, version int) error {
+	concurrent, err := s.WorkoutStore.GetWorkoutByID(id)
+	if err != nil {
+		return err
+	}
+	concurrent.Title = "Concurrent"
+	err = s.WorkoutStore.UpdateWorkout(concurrent)
+	if err != nil {
+		return err
+	}
+	return s.WorkoutStore.DeleteWorkout(id, version)
+}
+
+// A save that loses the race after passing the If-Match check gets the ETag of the version that won, to retry with
+func TestWorkoutConcurrentUpdate(t *testing.T) {
+	t.Parallel()
+	stores := store.NewMemoryStores()
+	stores.Workouts = racingWorkoutStore{stores.Workouts}
+	s := newTestServerWith(t, stores)
+	owner := s.register()
+	workout := s.createWorkout(owner, "Legs")
+	path := fmt.Sprintf("/v1/workouts/%d", workout.ID)
+
+	rec := s.requestWithHeaders(http.MethodPatch, path, owner, map[string]interface{}{"title": "Mine"}, map[string]string{"If-Match": `"1"`})
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	rec = s.request(http.MethodPatch, path, owner, map[string]interface{}{"title": "Mine"})
+	require.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+
+	// The same goes for entries: the store checks the version the handler read
+	entry := fmt.Sprintf("%s/entries/%d", path, workout.Entries[0].ID)
+	rec = s.requestWithHeaders(http.MethodPatch, entry, owner, map[string]interface{}{"sets": 5}, map[string]string{"If-Match": `"3"`})
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+	assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
+	found, _ := s.getWorkout(owner, workout.ID)
+	assert.Equal(t, workout.Entries[0].Sets, found.Entries[0].Sets, "the losing change wasn't saved")
+
+	// A delete doesn't trash a version it didn't see either
+	rec = s.requestWithHeaders(http.MethodDelete, path, owner, nil, map[string]string{"If-Match": `"4"`})
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+	assert.Equal(t, `"5"`, rec.Header().Get("ETag"))
+	rec = s.request(http.MethodDelete, path, owner, nil)
+	require.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+	assert.Equal(t, `"6"`, rec.Header().Get("ETag"))
+	found, _ = s.getWorkout(owner, workout.ID)
+	assert.Equal(t, "Concurrent", found.Title, "the workout wasn't deleted")
+}
+
+func TestWorkoutEntryEndpoints(t *testing.T) {
+	t.Parallel()
+	s := newTestServerWith(t, store.NewMemoryStores())
+	owner, other := s.register(), s.register()
+	users := map[string]*testUser{"owner": owner, "other": other}
+	workout := s.createWorkout(owner, "Legs")
+	squat, lunge := workout.Entries[0], workout.Entries[1]
+
+	entries := fmt.Sprintf("/v1/workouts/%d/entries", workout.ID)
+	entry := func(id int) string { return fmt.Sprintf("%s/%d", entries, id) }
+	plank := map[string]interface{}{"exercise_name": "Plank", "sets": 3, "duration_seconds": 60}
+
+	s.run([]endpointTest{
+		{"add", http.MethodPost, entries, "owner", plank, http.StatusCreated},
+		{"add anonymously", http.MethodPost, entries, "anonymous", plank, http.StatusUnauthorized},
+		{"add to someone else's", http.MethodPost, entries, "other", plank, http.StatusForbidden},
+		{"add to missing workout", http.MethodPost, "/v1/workouts/999999/entries", "owner", plank, http.StatusNotFound},
+		{"add without exercise", http.MethodPost, entries, "owner", map[string]interface{}{"sets": 3}, http.StatusBadRequest},
+
+		{"update", http.MethodPatch, entry(squat.ID), "owner", map[string]interface{}{"sets": 5}, http.StatusOK},
+		{"update anonymously", http.MethodPatch, entry(squat.ID), "anonymous", map[string]interface{}{"sets": 5}, http.StatusUnauthorized},
+		{"update someone else's", http.MethodPatch, entry(squat.ID), "other", map[string]interface{}{"sets": 5}, http.StatusForbidden},
+		{"update missing", http.MethodPatch, entry(999999), "owner", map[string]interface{}{"sets": 5}, http.StatusNotFound},
+		{"update with invalid sets", http.MethodPatch, entry(squat.ID), "owner", map[string]interface{}{"sets": "five"}, http.StatusBadRequest},
+
+		{"reorder anonymously", http.MethodPut, entries + "/order", "anonymous", map[string]interface{}{"entry_ids": []int{lunge.ID, squat.ID}}, http.StatusUnauthorized},
+		{"reorder someone else's", http.MethodPut, entries + "/order", "other", map[string]interface{}{"entry_ids": []int{lunge.ID, squat.ID}}, http.StatusForbidden},
+		{"reorder with missing entries", http.MethodPut, entries + "/order", "owner", map[string]interface{}{"entry_ids": []int{lunge.ID}}, http.StatusBadRequest},
+
+		{"delete anonymously", http.MethodDelete, entry(lunge.ID), "anonymous", nil, http.StatusUnauthorized},
+		{"delete someone else's", http.MethodDelete, entry(lunge.ID), "other", nil, http.StatusForbidden},
+		{"delete", http.MethodDelete, entry(lunge.ID), "owner", nil, http.StatusNoContent},
+		{"delete again", http.MethodDelete, entry(lunge.ID), "owner", nil, http.StatusNotFound},
+	}, users)
+
+	// The added plank is last, and the order given must list every remaining entry
+	found, ok := s.getWorkout(owner, workout.ID)
+	require.True(t, ok)
+	require.Len(t, found.Entries, 2)
+	assert.Equal(t, 5, found.Entries[0].Sets)
+	rec := s.request(http.MethodPut, entries+"/order", owner, map[string]interface{}{"entry_ids": []int{found.Entries[1].ID, found.Entries[0].ID}})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	found, _ = s.getWorkout(owner, workout.ID)
+	assert.Equal(t, "Plank", found.Entries[0].ExerciseName)
+}
+
+func TestWorkoutBatchEndpoint(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner, other := s.register(), s.register()
+	users := map[string]*testUser{"owner": owner, "other": other}
+	workout := s.createWorkout(owner, "Legs")
+
+	create := map[string]interface{}{"op": "create", "workout": map[string]interface{}{"title": "Batched"}}
+	deleteWorkout := map[string]interface{}{"op": "delete", "id": workout.ID}
+	// A wrong version mustn't tell others that they guessed wrong (412) rather than that the workout isn't theirs
+	guessVersion := map[string]interface{}{"op": "delete", "id": workout.ID, "version": workout.Version + 1}
+
+	s.run([]endpointTest{
+		{"anonymously", http.MethodPost, "/v1/workouts/batch", "anonymous", map[string]interface{}{"operations": []interface{}{create}}, http.StatusUnauthorized},
+		{"without operations", http.MethodPost, "/v1/workouts/batch", "owner", map[string]interface{}{"operations": []interface{}{}}, http.StatusBadRequest},
+		{"unknown mode", http.MethodPost, "/v1/workouts/batch", "owner", map[string]interface{}{"mode": "eventually", "operations": []interface{}{create}}, http.StatusBadRequest},
+		{"someone else's workout", http.MethodPost, "/v1/workouts/batch", "other", map[string]interface{}{"operations": []interface{}{create, deleteWorkout}}, http.StatusForbidden},
+		{"someone else's workout with a wrong version", http.MethodPost, "/v1/workouts/batch", "other", map[string]interface{}{"operations": []interface{}{guessVersion}}, http.StatusForbidden},
+		{"wrong version", http.MethodPost, "/v1/workouts/batch", "owner", map[string]interface{}{"operations": []interface{}{guessVersion}}, http.StatusPreconditionFailed},
+		{"atomic", http.MethodPost, "/v1/workouts/batch", "owner", map[string]interface{}{"operations": []interface{}{create, deleteWorkout}}, http.StatusOK},
+	}, users)
+
+	// The failed atomic batch of the other user created nothing
+	rec := s.request(http.MethodGet, "/v1/sync", other, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page struct {
+		Changes []interface{} `json:"changes"`
+	}
+	decode(t, rec, &page)
+	assert.Empty(t, page.Changes)
+}
+
+func TestReorderWorkoutEntriesIsAudited(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	owner := s.register()
+	workout := s.createWorkout(owner, "Legs")
+	squat, lunge := workout.Entries[0].ID, workout.Entries[1].ID
+
+	rec := s.request(http.MethodPut, fmt.Sprintf("/v1/workouts/%d/entries/order", workout.ID), owner, map[string]interface{}{"entry_ids": []int{lunge, squat}})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	events, err := s.stores.Audit.ListAuditEvents(store.AuditFilter{Action: audit.ActionEntriesReordered, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, owner.ID, *events[0].ActorID)
+	assert.Equal(t, fmt.Sprint(workout.ID), events[0].ResourceID)
+	assert.JSONEq(t, fmt.Sprintf(`{"entry_ids": [%d, %d]}`, squat, lunge), string(events[0].Before))
+	assert.JSONEq(t, fmt.Sprintf(`{"entry_ids": [%d, %d]}`, lunge, squat), string(events[0].After))
+}
+
+// getWorkout fetches a workout through the API
+func (s *testServer) getWorkout(user *testUser, id int) (store.Workout, bool) {
+	s.t.Helper()
+	rec := s.request(http.MethodGet, fmt.Sprintf("/v1/workouts/%d", id), user, nil)
+	var found struct {
+		Workout store.Workout `json:"workout"`
+	}
+	if rec.Code != http.StatusOK {
+		return found.Workout, false
+	}
+	decode(s.t, rec, &found)
+	return found.Workout, true
+}
@@ -5,29 +5,66 @@ package app
 // interface = handler
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"      // for formatted I/O operations
 	"log"      // for logging messages
 	"net/http" // for building HTTP servers and clients
 	"os"       // for logging to standard output (console)
 
 	"github.com/OlivierCoq/go_api_template/internal/api"        // Importing the api package to use its handlers
+	"github.com/OlivierCoq/go_api_template/internal/audit"      // Importing the audit package to record who did what
+	"github.com/OlivierCoq/go_api_template/internal/events"     // Importing the events package to react to domain events
+	"github.com/OlivierCoq/go_api_template/internal/grpcapi"    // Importing the grpcapi package for the gRPC server
 	"github.com/OlivierCoq/go_api_template/internal/middleware" // Importing the middleware package for request handling
+	"github.com/OlivierCoq/go_api_template/internal/realtime"   // Importing the realtime package for live updates
 	"github.com/OlivierCoq/go_api_template/internal/store"      // Importing the store package for database access
+	"github.com/OlivierCoq/go_api_template/internal/webhooks"   // Importing the webhooks package to deliver webhook events
 	"github.com/OlivierCoq/go_api_template/migrations"          // Importing the migrations package for database migrations
+	"google.golang.org/grpc"                                    // Importing grpc for the gRPC server type
 )
 
 type Application struct {
 	// Logger is for logging messages to the console or a file
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	DB             *sql.DB // Add the database connection field
-	Middleware     *middleware.UserMiddleware
+	Logger          *log.Logger
+	WorkoutHandler  *api.WorkoutHandler
+	UserHandler     *api.UserHandler
+	TokenHandler    *api.TokenHandler
+	CalendarHandler *api.CalendarHandler
+	ExportHandler   *api.ExportHandler
+	ImportHandler   *api.ImportHandler
+	SyncHandler     *api.SyncHandler
+	AuditHandler    *api.AuditHandler
+	WebhookHandler  *api.WebhookHandler
+	WebhookWorker   *webhooks.Worker   // Sends the webhook events of the outbox, once started
+	Events          *events.Dispatcher // Hands domain events to their subscribers, once started
+	RealtimeHandler *api.RealtimeHandler
+	SessionHandler  *api.SessionHandler
+	GraphQLHandler  *api.GraphQLHandler
+	DocsHandler     *api.DocsHandler
+	GRPCServer      *grpc.Server       // Served on its own port by main.go
+	Realtime        *realtime.Hub      // Live update clients connected to this instance, fed once it listens
+	Audit           *audit.Logger      // Audit log, closed when the application stops
+	WorkoutStore    store.WorkoutStore // Used by background jobs, e.g. the trash purge
+	SessionStore    store.SessionStore // Used by the session expiry job
+	Stores          store.Stores       // All of them, for the commands of the CLI (e.g. user disable)
+	DB              *sql.DB            // Add the database connection field
+	DBConfig        store.Config       // Which database DB is
+	Middleware      *middleware.UserMiddleware
+	Validator       *middleware.RequestValidator // Checks requests against the OpenAPI document
 }
 
-func NewApplication() (*Application, error) {
+// Options of NewApplication that don't come from the environment
+type Options struct {
+	// Apply pending migrations on startup. With several instances, turn it off and run `migrate up` once per deploy instead:
+	// the application then refuses to start on a database that isn't up to date.
+	AutoMigrate bool
+	// Register gRPC reflection, for tools like grpcurl. Off in production, where it would describe the API to anyone.
+	GRPCReflection bool
+}
+
+func NewApplication(options Options) (*Application, error) {
 
 	// Create a new logger instance:
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
@@ -43,48 +80,167 @@ func NewApplication() (*Application, error) {
 		2024/10/05 14:23:45 Application started. Werk it! 🚀
 	*/
 
-	// Database connection
-	pgDB, err := store.Open()
+	// Database connection, to Postgres or SQLite depending on DB_DRIVER (see store.ConfigFromEnv)
+	dbConfig, err := store.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	db, err := store.Open(dbConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to the database: %w", err)
 	}
 
 	// Stores
-	workoutStore := store.NewPostgresWorkoutStore(pgDB)
-	userStore := store.NewPostgresUserStore(pgDB)
-	tokenStore := store.NewPostgresTokenStore(pgDB)
+	stores := store.NewStores(dbConfig.Driver, db)
 
-	// Handlers
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
-	userHandler := api.NewUserHandler(userStore, logger)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+	/*
+		Audit log sinks, configured from the environment:
+		- AUDIT_SINKS: comma separated list of db, file and stdout. Defaults to db
+		- AUDIT_FILE: where the file sink writes. Defaults to audit.log
+	*/
+	auditSinks := os.Getenv("AUDIT_SINKS")
+	if auditSinks == "" {
+		auditSinks = "db"
+	}
+	auditFile := os.Getenv("AUDIT_FILE")
+	if auditFile == "" {
+		auditFile = "audit.log"
+	}
+	sinks, err := audit.SinksFromConfig(auditSinks, stores.Audit, auditFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the audit log: %w", err)
+	}
 
-	// Middleware
-	middlewareHandler := &middleware.UserMiddleware{
-		UserStore: userStore,
+	// Live updates: workout events are announced to every instance through NOTIFY, and each passes them on to its clients.
+	// A SQLite database has a single instance, which passes them on directly (a nil Notify).
+	var notify func(realtime.Notification) error
+	if dbConfig.Driver == store.DriverPostgres {
+		notify = func(n realtime.Notification) error {
+			return realtime.Notify(db, n)
+		}
 	}
-	userMiddleware := middlewareHandler
 
 	// Run database migrations using the embedded filesystem:
 	// the "." means the current directory, which is where the migration files are located in the embedded FS
-	err = store.MigrateFS(pgDB, migrations.FS, ".")
+	if options.AutoMigrate {
+		err = store.MigrateFS(db, migrations.FS, ".")
+	} else {
+		err = checkMigrations(db)
+	}
 	if err != nil {
-		// panic and crash the app if migration fails:
-		panic(err)
+		db.Close()
+		return nil, err
 	}
 
-	// Create a new instance of Application struct, which includes the logger, handlers, etc.:
-	app := &Application{ // &Application is pointer to Application struct
+	app := NewApplicationWith(Dependencies{
+		Stores:         stores,
 		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		DB:             pgDB, // Add the database connection to the Application struct
-		TokenHandler:   tokenHandler,
-		UserHandler:    userHandler,
-		Middleware:     userMiddleware,
-	}
+		AuditSinks:     sinks,
+		Notify:         notify,
+		GRPCReflection: options.GRPCReflection,
+	})
+	app.DB = db // Add the database connection to the Application struct
+	app.DBConfig = dbConfig
 	return app, nil // nil is for the error argument, meaning no error occurred :)
 }
 
+// checkMigrations fails when the database is missing migrations, which the handlers would trip over
+func checkMigrations(db *sql.DB) error {
+	migrator, err := store.NewMigrator(db, migrations.FS, ".")
+	if err != nil {
+		return err
+	}
+	pending, err := migrator.HasPending(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+	if pending {
+		return errors.New("the database has pending migrations: run `migrate up` first, or start with -auto-migrate")
+	}
+	return nil
+}
+
+// Dependencies are what the application is wired on top of. NewApplication builds them from the environment,
+// tests can bring their own (e.g. in-memory stores).
+type Dependencies struct {
+	Stores     store.Stores
+	Logger     *log.Logger
+	AuditSinks []audit.Sink                      // Where audit events go. None means nothing is recorded
+	Notify     func(realtime.Notification) error // Announces live updates to every instance. nil passes them on to this instance's clients only
+
+	GRPCReflection bool // See Options
+}
+
+// NewApplicationWith wires the handlers, middleware and background workers of the application on top of deps.
+// It doesn't touch the database: DB and DBConfig are left for the caller to set, if there is one.
+func NewApplicationWith(deps Dependencies) *Application {
+	logger := deps.Logger
+	stores := deps.Stores
+	auditLogger := audit.NewLogger(logger, deps.AuditSinks...)
+
+	// Handlers
+	workoutHandler := api.NewWorkoutHandler(stores.Workouts, auditLogger, logger)
+	userHandler := api.NewUserHandler(stores.Users, auditLogger, logger)
+	tokenHandler := api.NewTokenHandler(stores.Tokens, stores.Users, auditLogger, logger)
+	calendarHandler := api.NewCalendarHandler(stores.Workouts, stores.Users, stores.Tokens, logger)
+	exportHandler := api.NewExportHandler(stores.Workouts, logger)
+	importHandler := api.NewImportHandler(stores.Workouts, auditLogger, logger)
+	syncHandler := api.NewSyncHandler(stores.Workouts, auditLogger, logger)
+	auditHandler := api.NewAuditHandler(stores.Audit, logger)
+	webhookHandler := api.NewWebhookHandler(stores.Webhooks, auditLogger, logger)
+	sessionHandler := api.NewSessionHandler(stores.Sessions, stores.Workouts, auditLogger, logger)
+	graphqlHandler := api.NewGraphQLHandler(stores.Workouts, auditLogger, logger)
+	docsHandler := api.NewDocsHandler(logger)
+	grpcServer := grpcapi.NewServer(stores.Workouts, stores.Users, stores.Tokens, auditLogger, deps.GRPCReflection, logger)
+
+	// Live updates
+	hub := realtime.NewHub(logger)
+	realtimeHandler := api.NewRealtimeHandler(hub, stores.Tokens, logger)
+	dispatcher := events.NewDispatcher(stores.Events, logger)
+	notify := deps.Notify
+	if notify == nil {
+		notify = func(n realtime.Notification) error {
+			hub.Publish(n)
+			return nil
+		}
+	}
+	subscribeRealtime(dispatcher, notify)
+	webhooks.Subscribe(dispatcher, stores.Webhooks, stores.Workouts)
+
+	// Middleware
+	userMiddleware := &middleware.UserMiddleware{
+		UserStore: stores.Users,
+	}
+
+	// Create a new instance of Application struct, which includes the logger, handlers, etc.:
+	return &Application{ // &Application is pointer to Application struct
+		Logger:          logger,
+		WorkoutHandler:  workoutHandler,
+		WorkoutStore:    stores.Workouts,
+		SessionStore:    stores.Sessions,
+		Stores:          stores,
+		TokenHandler:    tokenHandler,
+		CalendarHandler: calendarHandler,
+		ExportHandler:   exportHandler,
+		ImportHandler:   importHandler,
+		SyncHandler:     syncHandler,
+		AuditHandler:    auditHandler,
+		WebhookHandler:  webhookHandler,
+		WebhookWorker:   webhooks.NewWorker(stores.Webhooks, logger),
+		Events:          dispatcher, // Subscribe with events.On(app.Events, ...) before starting it
+		RealtimeHandler: realtimeHandler,
+		SessionHandler:  sessionHandler,
+		GraphQLHandler:  graphqlHandler,
+		DocsHandler:     docsHandler,
+		GRPCServer:      grpcServer,
+		Realtime:        hub,
+		Audit:           auditLogger,
+		UserHandler:     userHandler,
+		Middleware:      userMiddleware,
+		Validator:       &middleware.RequestValidator{Spec: api.OpenAPISpec()},
+	}
+}
+
 // Methods:
 
 // Health Check Handler
@@ -0,0 +1,23 @@
+package app
+
+import (
+	"github.com/OlivierCoq/go_api_template/internal/events"
+	"github.com/OlivierCoq/go_api_template/internal/realtime"
+)
+
+// subscribeRealtime announces workout events to the live update clients of every instance, through notify.
+// A restored workout shows up again, so clients are told it was created.
+func subscribeRealtime(dispatcher *events.Dispatcher, notify func(realtime.Notification) error) {
+	events.On(dispatcher, func(e events.WorkoutCreated) error {
+		return notify(realtime.Notification{Type: realtime.WorkoutCreated, WorkoutID: e.WorkoutID, UUID: e.UUID, UserID: e.UserID, Version: e.Version})
+	})
+	events.On(dispatcher, func(e events.WorkoutRestored) error {
+		return notify(realtime.Notification{Type: realtime.WorkoutCreated, WorkoutID: e.WorkoutID, UUID: e.UUID, UserID: e.UserID, Version: e.Version})
+	})
+	events.On(dispatcher, func(e events.WorkoutUpdated) error {
+		return notify(realtime.Notification{Type: realtime.WorkoutUpdated, WorkoutID: e.WorkoutID, UUID: e.UUID, UserID: e.UserID, Version: e.Version})
+	})
+	events.On(dispatcher, func(e events.WorkoutDeleted) error {
+		return notify(realtime.Notification{Type: realtime.WorkoutDeleted, WorkoutID: e.WorkoutID, UUID: e.UUID, UserID: e.UserID})
+	})
+}
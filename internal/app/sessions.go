@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+/*
+	Workout sessions left open with no activity (no set logged, no timer started, no pause or resume) for longer than
+	the timeout were most likely abandoned. RunSessionExpiry closes them, once right away and then every interval, so
+	they don't block their user from starting a new one. It runs until ctx is cancelled.
+*/
+
+func (a *Application) RunSessionExpiry(ctx context.Context, timeout time.Duration, interval time.Duration) {
+	for {
+		expired, err := a.SessionStore.ExpireSessions(time.Now().Add(-timeout))
+		if err != nil {
+			a.Logger.Printf("Failed to expire workout sessions: %v", err)
+		} else if expired > 0 {
+			a.Logger.Printf("Expired %d abandoned workout sessions", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
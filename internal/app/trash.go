@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+/*
+	Deleted workouts stay in the trash (see store.PostgresWorkoutStore.DeleteWorkout) until they've been there for longer
+	than the retention period. RunTrashPurge removes them, once right away and then every interval.
+	Sync changes superseded for longer than the retention period are pruned at the same time (see store.PostgresWorkoutStore.PruneSyncChanges).
+	It runs until ctx is cancelled, finishing the purge in progress first.
+*/
+
+func (a *Application) RunTrashPurge(ctx context.Context, retention time.Duration, interval time.Duration) {
+	for {
+		purged, err := a.WorkoutStore.PurgeDeletedWorkouts(time.Now().Add(-retention))
+		if err != nil {
+			a.Logger.Printf("Failed to purge the trash: %v", err)
+		} else if purged > 0 {
+			a.Logger.Printf("Purged %d workouts from the trash", purged)
+		}
+		pruned, err := a.WorkoutStore.PruneSyncChanges(time.Now().Add(-retention))
+		if err != nil {
+			a.Logger.Printf("Failed to prune the sync changes: %v", err)
+		} else if pruned > 0 {
+			a.Logger.Printf("Pruned %d superseded sync changes", pruned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+)
+
+/*
+	Audit log.
+	Handlers describe what happened (who, what action, on which resource, the state before and after) and the Logger
+	hands it to every configured Sink: the database (queryable from the admin endpoint), a file, or stdout.
+	Recording never fails the request it's about: a sink that can't write is reported in the application log instead.
+*/
+
+// Actions recorded in the audit log
+const (
+	ActionLoginSucceeded = "login.succeeded"
+	ActionLoginFailed    = "login.failed"
+	ActionTokenIssued    = "token.issued" // By an operator, from the command line
+	ActionTokenRevoked   = "token.revoked"
+	ActionUserRegistered = "user.registered"
+	ActionUserUpdated    = "user.updated"
+
+	// Account management, from the command line
+	ActionUserDisabled      = "user.disabled"
+	ActionUserEnabled       = "user.enabled"
+	ActionUserPasswordReset = "user.password_reset"
+
+	ActionWorkoutCreated  = "workout.created"
+	ActionWorkoutUpdated  = "workout.updated"
+	ActionWorkoutDeleted  = "workout.deleted"
+	ActionWorkoutRestored = "workout.restored"
+	ActionWorkoutImported = "workout.imported"
+	ActionWorkoutSynced   = "workout.synced"
+
+	ActionEntryCreated = "workout_entry.created"
+	ActionEntryUpdated = "workout_entry.updated"
+	ActionEntryDeleted = "workout_entry.deleted"
+
+	ActionEntriesReordered = "workout.entries_reordered"
+
+	ActionWebhookCreated = "webhook.created"
+	ActionWebhookDeleted = "webhook.deleted"
+)
+
+// Kinds of resources events are about
+const (
+	ResourceUser    = "user"
+	ResourceToken   = "token"
+	ResourceWorkout = "workout"
+	ResourceEntry   = "workout_entry"
+	ResourceWebhook = "webhook"
+)
+
+// Event describes something worth recording. Before and After are any values that marshal to JSON (e.g. a *store.Workout).
+type Event struct {
+	ActorID    int // 0 when nobody is logged in
+	Action     string
+	Resource   string
+	ResourceID interface{}
+	Before     interface{}
+	After      interface{}
+	Metadata   map[string]interface{}
+}
+
+// A Sink is somewhere audit events are written to
+type Sink interface {
+	Write(event *store.AuditEvent) error
+}
+
+type Logger struct {
+	sinks  []Sink
+	logger *log.Logger
+}
+
+// NewLogger returns a Logger writing to all the given sinks. Failures to write are reported to logger.
+func NewLogger(logger *log.Logger, sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks, logger: logger}
+}
+
+/*
+	Record writes an event to every sink. r is the request the event happened in, used for the IP address and user agent.
+	A nil Logger records nothing, which keeps handlers usable without an audit log (e.g. in tests).
+*/
+
+func (l *Logger) Record(r *http.Request, event Event) {
+	if l == nil || len(l.sinks) == 0 {
+		return
+	}
+
+	auditEvent, err := build(r, event, time.Now().UTC())
+	if err != nil {
+		l.logger.Printf("Failed to build audit event %s: %v", event.Action, err)
+		return
+	}
+	for _, sink := range l.sinks {
+		err = sink.Write(auditEvent)
+		if err != nil {
+			l.logger.Printf("Failed to write audit event %s: %v", event.Action, err)
+		}
+	}
+}
+
+// Close closes the sinks that hold resources, like files
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	var firstErr error
+	for _, sink := range l.sinks {
+		closer, ok := sink.(io.Closer)
+		if !ok {
+			continue
+		}
+		err := closer.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// build turns an Event into what the sinks store, computing the changes between Before and After
+func build(r *http.Request, event Event, now time.Time) (*store.AuditEvent, error) {
+	auditEvent := &store.AuditEvent{
+		OccurredAt: now,
+		Action:     event.Action,
+		Resource:   event.Resource,
+	}
+	if event.ActorID != 0 {
+		actorID := event.ActorID
+		auditEvent.ActorID = &actorID
+	}
+	if event.ResourceID != nil {
+		auditEvent.ResourceID = fmt.Sprint(event.ResourceID)
+	}
+	if r != nil {
+		auditEvent.IP = clientIP(r)
+		auditEvent.UserAgent = r.UserAgent()
+	}
+
+	var err error
+	if event.Before != nil {
+		auditEvent.Before, err = json.Marshal(event.Before)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if event.After != nil {
+		auditEvent.After, err = json.Marshal(event.After)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if event.Before != nil && event.After != nil {
+		changes, err := Diff(auditEvent.Before, auditEvent.After)
+		if err != nil {
+			return nil, err
+		}
+		auditEvent.Changes, err = json.Marshal(changes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(event.Metadata) > 0 {
+		auditEvent.Metadata, err = json.Marshal(event.Metadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return auditEvent, nil
+}
+
+// Change is the old and new value of a field
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Diff compares two JSON objects and returns the top-level fields whose value changed.
+// Nested values (e.g. the entries of a workout) are compared as a whole.
+func Diff(before, after json.RawMessage) (map[string]Change, error) {
+	var from, to map[string]interface{}
+	err := json.Unmarshal(before, &from)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(after, &to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]Change{}
+	for field, value := range from {
+		if !reflect.DeepEqual(value, to[field]) {
+			changes[field] = Change{From: value, To: to[field]}
+		}
+	}
+	for field, value := range to {
+		if _, ok := from[field]; !ok {
+			changes[field] = Change{From: nil, To: value}
+		}
+	}
+	return changes, nil
+}
+
+// clientIP returns the address the request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Sinks
+
+// StoreSink writes events to the audit_events table, where the admin endpoint can query them
+type StoreSink struct {
+	store store.AuditStore
+}
+
+func NewStoreSink(auditStore store.AuditStore) *StoreSink {
+	return &StoreSink{store: auditStore}
+}
+
+func (s *StoreSink) Write(event *store.AuditEvent) error {
+	return s.store.InsertAuditEvent(event)
+}
+
+// WriterSink writes events as JSON, one per line, e.g. to a file or stdout
+type WriterSink struct {
+	mu  sync.Mutex // Requests are handled concurrently, and lines must not get mixed up
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w, enc: json.NewEncoder(w)}
+}
+
+func (s *WriterSink) Write(event *store.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(event)
+}
+
+// Close closes the underlying writer if it's a file (stdout is left alone)
+func (s *WriterSink) Close() error {
+	file, ok := s.w.(*os.File)
+	if !ok || file == os.Stdout {
+		return nil
+	}
+	return file.Close()
+}
+
+// NewFileSink appends events to the file at path, creating it if needed. The file is only readable by its owner.
+func NewFileSink(path string) (*WriterSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return NewWriterSink(file), nil
+}
+
+// SinksFromConfig builds the sinks named in a comma separated list of db, file and stdout. file writes to filePath.
+func SinksFromConfig(names string, auditStore store.AuditStore, filePath string) ([]Sink, error) {
+	var sinks []Sink
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "db":
+			sinks = append(sinks, NewStoreSink(auditStore))
+		case "stdout":
+			sinks = append(sinks, NewWriterSink(os.Stdout))
+		case "file":
+			sink, err := NewFileSink(filePath)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q (expected db, file or stdout)", name)
+		}
+	}
+	return sinks, nil
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	changes, err := Diff(
+		json.RawMessage(`{"title": "Push", "duration_minutes": 45, "notes": "same"}`),
+		json.RawMessage(`{"title": "Pull", "duration_minutes": 45, "notes": "same", "status": "completed"}`),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Change{
+		"title":  {From: "Push", To: "Pull"},
+		"status": {From: nil, To: "completed"},
+	}, changes)
+}
+
+func TestBuild(t *testing.T) {
+	r := httptest.NewRequest("PATCH", "/workouts/1", nil)
+	r.RemoteAddr = "203.0.113.7:52000"
+	r.Header.Set("User-Agent", "test-agent")
+	now := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	t.Run("with before and after", func(t *testing.T) {
+		event, err := build(r, Event{
+			ActorID:    3,
+			Action:     ActionWorkoutUpdated,
+			Resource:   ResourceWorkout,
+			ResourceID: int64(1),
+			Before:     &store.Workout{ID: 1, Title: "Push"},
+			After:      &store.Workout{ID: 1, Title: "Pull"},
+		}, now)
+		require.NoError(t, err)
+
+		require.NotNil(t, event.ActorID)
+		assert.Equal(t, 3, *event.ActorID)
+		assert.Equal(t, "1", event.ResourceID)
+		assert.Equal(t, "203.0.113.7", event.IP)
+		assert.Equal(t, "test-agent", event.UserAgent)
+		assert.Equal(t, now, event.OccurredAt)
+		assert.JSONEq(t, `{"title": {"from": "Push", "to": "Pull"}}`, string(event.Changes))
+	})
+
+	t.Run("anonymous, without state", func(t *testing.T) {
+		event, err := build(r, Event{
+			Action:   ActionLoginFailed,
+			Resource: ResourceUser,
+			Metadata: map[string]interface{}{"username": "nobody"},
+		}, now)
+		require.NoError(t, err)
+
+		assert.Nil(t, event.ActorID)
+		assert.Empty(t, event.Before)
+		assert.Empty(t, event.After)
+		assert.Empty(t, event.Changes)
+		assert.JSONEq(t, `{"username": "nobody"}`, string(event.Metadata))
+	})
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil, NewWriterSink(&buf))
+
+	logger.Record(nil, Event{ActorID: 1, Action: ActionWorkoutCreated, Resource: ResourceWorkout, ResourceID: 5})
+	logger.Record(nil, Event{ActorID: 1, Action: ActionWorkoutDeleted, Resource: ResourceWorkout, ResourceID: 5})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var event store.AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, ActionWorkoutDeleted, event.Action)
+	assert.Equal(t, "5", event.ResourceID)
+}
+
+func TestSinksFromConfig(t *testing.T) {
+	sinks, err := SinksFromConfig("db, stdout", nil, "")
+	require.NoError(t, err)
+	assert.Len(t, sinks, 2)
+
+	_, err = SinksFromConfig("db,syslog", nil, "")
+	assert.Error(t, err)
+}
+
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+	logger.Record(nil, Event{Action: ActionWorkoutCreated})
+	assert.NoError(t, logger.Close())
+}
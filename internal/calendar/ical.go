@@ -0,0 +1,149 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+)
+
+/*
+	iCalendar (RFC 5545) is the plain text format calendar apps (Google Calendar, Apple Calendar, Outlook...) use for subscriptions.
+	A feed is a VCALENDAR containing one VEVENT per scheduled workout. A few rules from the RFC matter here:
+	- Lines end with CRLF ("\r\n"), not just "\n".
+	- Lines longer than 75 octets must be "folded": split, with the continuation line starting with a single space.
+	- Commas, semicolons, backslashes and newlines inside text values must be escaped with a backslash.
+*/
+
+const (
+	maxLineOctets    = 75
+	icalTimeFormat   = "20060102T150405Z"
+	defaultEventSpan = time.Hour // Used when a workout has no duration, so the event still shows up in calendars
+)
+
+// WriteFeed writes the scheduled workouts as an iCalendar feed. Workouts without a PlannedFor date are skipped.
+// now is used as the DTSTAMP of every event (when the feed was generated).
+func WriteFeed(w io.Writer, name string, workouts []store.Workout, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	lw := &lineWriter{w: bw}
+
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:-//go_api_template//Workouts//EN")
+	lw.line("CALSCALE:GREGORIAN")
+	lw.line("METHOD:PUBLISH")
+	lw.line("X-WR-CALNAME:" + escapeText(name))
+
+	for _, workout := range workouts {
+		if workout.PlannedFor == nil {
+			continue
+		}
+		start := workout.PlannedFor.UTC()
+		span := time.Duration(workout.DurationMinutes) * time.Minute
+		if span <= 0 {
+			span = defaultEventSpan
+		}
+
+		lw.line("BEGIN:VEVENT")
+		lw.line(fmt.Sprintf("UID:workout-%d@go_api_template", workout.ID))
+		lw.line("DTSTAMP:" + now.UTC().Format(icalTimeFormat))
+		lw.line("DTSTART:" + start.Format(icalTimeFormat))
+		lw.line("DTEND:" + start.Add(span).Format(icalTimeFormat))
+		lw.line("SUMMARY:" + escapeText(workout.Title))
+		if description := eventDescription(workout); description != "" {
+			lw.line("DESCRIPTION:" + escapeText(description))
+		}
+		lw.line("STATUS:" + eventStatus(workout.Status))
+		lw.line("CATEGORIES:" + escapeText(workout.Status))
+		lw.line("END:VEVENT")
+	}
+
+	lw.line("END:VCALENDAR")
+	if lw.err != nil {
+		return lw.err
+	}
+	return bw.Flush()
+}
+
+// eventDescription combines the workout description with its list of exercises, one per line.
+func eventDescription(workout store.Workout) string {
+	var b strings.Builder
+	b.WriteString(workout.Description)
+	for _, entry := range workout.Entries {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(fmt.Sprintf("%s: %d sets", entry.ExerciseName, entry.Sets))
+		if entry.Reps != nil {
+			b.WriteString(fmt.Sprintf(" x %d reps", *entry.Reps))
+		}
+		if entry.DurationSeconds != nil {
+			b.WriteString(fmt.Sprintf(" x %ds", *entry.DurationSeconds))
+		}
+		if entry.Weight != nil {
+			b.WriteString(fmt.Sprintf(" @ %g", *entry.Weight))
+		}
+	}
+	return b.String()
+}
+
+// eventStatus maps a workout status onto the VEVENT STATUS values calendar apps understand.
+func eventStatus(status string) string {
+	if status == store.WorkoutStatusSkipped {
+		return "CANCELLED"
+	}
+	return "CONFIRMED"
+}
+
+// escapeText escapes a TEXT value (RFC 5545 section 3.3.11).
+func escapeText(s string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return replacer.Replace(s)
+}
+
+// lineWriter writes content lines terminated by CRLF, folding them at 75 octets.
+// It remembers the first error so callers can check once at the end instead of after every line.
+type lineWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (lw *lineWriter) line(s string) {
+	if lw.err != nil {
+		return
+	}
+	_, lw.err = io.WriteString(lw.w, foldLine(s)+"\r\n")
+}
+
+// foldLine splits a content line into chunks of at most 75 octets, never cutting a multi-byte UTF-8 character in half.
+// Continuation lines start with a space, which counts towards their 75 octets.
+func foldLine(s string) string {
+	if len(s) <= maxLineOctets {
+		return s
+	}
+
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(s)
+	return b.String()
+}
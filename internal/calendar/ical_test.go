@@ -0,0 +1,74 @@
+package calendar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFeed(t *testing.T) {
+	plannedFor := time.Date(2025, 3, 14, 7, 30, 0, 0, time.UTC)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	reps := 5
+
+	workouts := []store.Workout{
+		{
+			ID:              42,
+			Title:           "Leg day, heavy",
+			Description:     "Squats; then lunges",
+			DurationMinutes: 45,
+			PlannedFor:      &plannedFor,
+			Status:          store.WorkoutStatusPlanned,
+			Entries: []store.WorkoutEntry{
+				{ExerciseName: "Squat", Sets: 5, Reps: &reps},
+			},
+		},
+		{
+			ID:    43,
+			Title: "Logged without a date", // Not scheduled, so it must not show up in the feed
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WriteFeed(&buf, "Workouts", workouts, now)
+	require.NoError(t, err)
+
+	feed := buf.String()
+	assert.True(t, strings.HasPrefix(feed, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(feed, "END:VCALENDAR\r\n"))
+	assert.Equal(t, 1, strings.Count(feed, "BEGIN:VEVENT"))
+	assert.Contains(t, feed, "UID:workout-42@go_api_template\r\n")
+	assert.Contains(t, feed, "DTSTAMP:20250301T120000Z\r\n")
+	assert.Contains(t, feed, "DTSTART:20250314T073000Z\r\n")
+	assert.Contains(t, feed, "DTEND:20250314T081500Z\r\n")
+	assert.Contains(t, feed, `SUMMARY:Leg day\, heavy`)
+	assert.Contains(t, feed, `DESCRIPTION:Squats\; then lunges\nSquat: 5 sets x 5 reps`)
+	assert.Contains(t, feed, "STATUS:CONFIRMED\r\n")
+}
+
+func TestFoldLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "short line", line: "SUMMARY:Push day"},
+		{name: "ascii", line: "DESCRIPTION:" + strings.Repeat("a", 200)},
+		{name: "multi-byte characters", line: "DESCRIPTION:" + strings.Repeat("é💪", 60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			folded := foldLine(tt.line)
+			for _, part := range strings.Split(folded, "\r\n") {
+				assert.LessOrEqual(t, len(part), maxLineOctets)
+			}
+			// Unfolding (removing every CRLF followed by a space) must give the original line back:
+			assert.Equal(t, tt.line, strings.ReplaceAll(folded, "\r\n ", ""))
+		})
+	}
+}
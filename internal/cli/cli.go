@@ -0,0 +1,127 @@
+// Package cli holds the commands of the binary: the server itself, and the tools to manage the system without raw SQL.
+package cli
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/OlivierCoq/go_api_template/internal/app"
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+)
+
+/*
+	Every command reads the database configuration from the environment (DB_DRIVER, DATABASE_URL, see store.ConfigFromEnv),
+	like the server. Commands that act on users and tokens go through the same app.Application as the server (openApplication),
+	so they use the same stores, the same validation, and record what they do in the same audit log.
+*/
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "Start the API (the default, e.g. `go run main.go -port 8080`)", Serve},
+	{"migrate", "Apply, roll back or create migrations", Migrate},
+	{"seed", "Fill the database with demo data or YAML fixtures", Seed},
+	{"user", "Create users, disable them or reset their password", User},
+	{"token", "Issue and revoke tokens", Token},
+	{"export", "Export the workouts of a user", Export},
+}
+
+// Run runs the command of args (the arguments of the binary, without its name) and returns the exit code.
+// Without a command, or with flags only, it starts the server, as it did before there were commands.
+func Run(args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(os.Stdout)
+		return 0
+	}
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		err := c.run(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return 0 // The flag set printed the usage of the command
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage(os.Stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: go run main.go COMMAND [flags]\n\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nRun a command with -h for its flags.")
+}
+
+// openDatabase connects to the database of the environment, for the commands that don't need the whole application
+func openDatabase() (store.Config, *sql.DB, error) {
+	config, err := store.ConfigFromEnv()
+	if err != nil {
+		return store.Config{}, nil, err
+	}
+	db, err := store.Open(config)
+	if err != nil {
+		return store.Config{}, nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	return config, db, nil
+}
+
+// withApplication wires the application as the server does and runs fn with it. It doesn't migrate: the database must be
+// up to date (see `migrate up`), so a command never changes the schema under a running server.
+func withApplication(fn func(app *app.Application) error) error {
+	application, err := app.NewApplication(app.Options{})
+	if err != nil {
+		return err
+	}
+	defer application.DB.Close()
+	defer application.Audit.Close()
+	return fn(application)
+}
+
+// record adds what a command did to the audit log, like the handlers do for requests.
+// There is no actor: commands are run by whoever has access to the database.
+func record(application *app.Application, command string, event audit.Event) {
+	if event.Metadata == nil {
+		event.Metadata = map[string]interface{}{}
+	}
+	event.Metadata["via"] = "cli"
+	event.Metadata["command"] = command
+	application.Audit.Record(nil, event)
+}
+
+// findUser returns the user with the given username, or an error if there is none
+func findUser(stores store.Stores, username string) (*store.User, error) {
+	if username == "" {
+		return nil, errors.New("a USERNAME is required")
+	}
+	user, err := stores.Users.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("no user named %q", username)
+	}
+	return user, nil
+}
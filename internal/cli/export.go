@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/OlivierCoq/go_api_template/internal/app"
+	"github.com/OlivierCoq/go_api_template/internal/export"
+)
+
+// Export writes all workouts of a user to a file (or stdout), same as GET /users/me/export but without going through the API.
+// Handy for support requests or GDPR data requests. Example:
+//
+//	go run main.go export -user 42 -format csv -out workouts.csv
+func Export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	userID := flags.Int("user", 0, "ID of the user whose workouts are exported")
+	format := flags.String("format", export.FormatJSON, "Export format: csv, json or ndjson")
+	out := flags.String("out", "", "File to write the export to (defaults to standard output)")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *userID <= 0 {
+		return errors.New("export: -user is required")
+	}
+
+	return withApplication(func(app *app.Application) error {
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			file, err := os.Create(*out)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", *out, err)
+			}
+			defer file.Close()
+			w = file
+		}
+		return export.Workouts(app.Stores.Workouts, *userID, *format, w)
+	})
+}
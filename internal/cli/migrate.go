@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/migrations"
+)
+
+const migrateUsage = `Usage: go run main.go migrate [-dir migrations] COMMAND
+
+Commands:
+  up            Apply all pending migrations
+  down          Roll back the last migration
+  redo          Roll back the last migration and apply it again
+  to VERSION    Migrate up or down to VERSION (0 rolls everything back)
+  status        List migrations and whether they're applied
+  version       Print the version of the last migration applied
+  create NAME   Add an empty migration to -dir, with its SQLite version
+
+The database is the one of DB_DRIVER and DATABASE_URL, and the migrations the ones built into the binary (except for create).`
+
+// Migrate manages the migrations of the database, e.g. before starting the server with -auto-migrate=false. Example:
+//
+//	go run main.go migrate status
+//	go run main.go migrate to 12
+func Migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := flags.String("dir", "migrations", "Directory create adds migrations to")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), migrateUsage)
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("migrate: a command is required")
+	}
+	command, args := flags.Arg(0), flags.Args()[1:]
+
+	// Creating a migration writes files, it doesn't need a database
+	if command == "create" {
+		if len(args) != 1 {
+			return errors.New("migrate: create needs a NAME")
+		}
+		paths, err := store.CreateMigration(*dir, args[0])
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			fmt.Println("Created", path)
+		}
+		return nil
+	}
+
+	_, db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := store.NewMigrator(db, migrations.FS, ".")
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		_, err = migrator.Up(ctx)
+	case "down":
+		_, err = migrator.Down(ctx)
+	case "redo":
+		_, err = migrator.Redo(ctx)
+	case "to":
+		if len(args) != 1 {
+			return errors.New("migrate: to needs a VERSION")
+		}
+		version, parseErr := strconv.ParseInt(args[0], 10, 64)
+		if parseErr != nil || version < 0 {
+			return fmt.Errorf("migrate: invalid version %q", args[0])
+		}
+		_, err = migrator.To(ctx, version)
+	case "status":
+		return printStatus(ctx, migrator)
+	case "version":
+		// Printed below
+	default:
+		flags.Usage()
+		return fmt.Errorf("migrate: unknown command %q", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Database version:", version)
+	return nil
+}
+
+func printStatus(ctx context.Context, migrator *store.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tAPPLIED AT\tMIGRATION")
+	for _, status := range statuses {
+		applied := "pending"
+		if !status.AppliedAt.IsZero() {
+			applied = status.AppliedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Source.Version, applied, status.Source.Path)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/OlivierCoq/go_api_template/internal/seed"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/migrations"
+)
+
+// Seed fills the database with generated users and workouts, for demos and load tests, and/or with the content of a fixtures file.
+// The same -seed gives the same data, and running it again adds nothing. Examples:
+//
+//	go run main.go seed -users 50 -months 12 -seed 7
+//	go run main.go seed -users 0 -fixtures internal/seed/testdata/fixtures.yaml
+func Seed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	users := flags.Int("users", seed.DefaultOptions.Users, "Number of users to generate, 0 for none")
+	months := flags.Int("months", seed.DefaultOptions.Months, "Months of workouts of each generated user")
+	seedValue := flags.Uint64("seed", seed.DefaultOptions.Seed, "Seed of the random generator")
+	password := flags.String("password", seed.DefaultOptions.Password, "Password of the generated users")
+	prefix := flags.String("prefix", seed.DefaultOptions.Prefix, "Usernames of the generated users are the prefix followed by a number")
+	fixtures := flags.String("fixtures", "", "YAML file of users and workouts to load")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	config, db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// Same as when the server starts, so a new database can be seeded right away
+	err = store.MigrateFS(db, migrations.FS, ".")
+	if err != nil {
+		return err
+	}
+	stores := store.NewStores(config.Driver, db)
+
+	if *fixtures != "" {
+		loaded, err := seed.LoadFixturesFile(stores, *fixtures)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Loaded %d users from %s\n", len(loaded), *fixtures)
+	}
+	if *users <= 0 {
+		return nil
+	}
+
+	result, err := seed.Generate(stores, seed.Options{
+		Users:    *users,
+		Months:   *months,
+		Seed:     *seedValue,
+		Password: *password,
+		Prefix:   *prefix,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Generated %d users (%d already there) and %d workouts. Log in as %s1 with password %s\n",
+		result.Created, len(result.Users)-result.Created, result.Workouts, *prefix, *password)
+	return nil
+}
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/app"
+	"github.com/OlivierCoq/go_api_template/internal/routes"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+)
+
+// shutdownTimeout is how long requests in progress get to finish once the server is asked to stop
+const shutdownTimeout = 30 * time.Second
+
+// Serve starts the API, its gRPC server and the background jobs, until it gets SIGINT or SIGTERM. Example:
+//
+//	go run main.go serve -port 8080 -auto-migrate=false
+func Serve(args []string) error {
+	/*
+	  - the flag package in Go provides a way to define and parse command-line flags.
+	  - In this case, we are defining an integer flag named "port" with a default value of 8080 and a description "Port to run the server on".
+	  - The &port is a pointer to the variable where the parsed value will be stored.
+	*/
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := flags.Int("port", 8080, "Port to run the server on")
+	// The gRPC server listens separately, since it speaks HTTP/2 only
+	grpcPort := flags.Int("grpc-port", 9090, "Port to run the gRPC server on, 0 to disable it")
+	// Reflection lets grpcurl and the like discover the services, handy in development only
+	grpcReflection := flags.Bool("grpc-reflection", false, "Enable gRPC reflection, so tools like grpcurl can list the services")
+	// How long deleted workouts can be restored from the trash before they're purged for good
+	trashRetention := flags.Duration("trash-retention", 30*24*time.Hour, "How long deleted workouts are kept in the trash")
+	// How long a workout session can go without activity before it's considered abandoned
+	sessionTimeout := flags.Duration("session-timeout", 6*time.Hour, "How long an inactive workout session stays open")
+	// Migrating on startup is handy with a single instance. With several, run `migrate up` once per deploy instead.
+	autoMigrate := flags.Bool("auto-migrate", true, "Apply pending migrations on startup, otherwise refuse to start until they're applied")
+	err := flags.Parse(args) // Does heavy lifting of parsing flags
+	if err != nil {
+		return err
+	}
+
+	// Initialize the application (taken from internal/app/app.go):
+	app, err := app.NewApplication(app.Options{AutoMigrate: *autoMigrate, GRPCReflection: *grpcReflection})
+	if err != nil {
+		return err
+	}
+
+	// Ensure the database connection is closed when the application exits
+	defer app.DB.Close()
+	defer app.Audit.Close()
+
+	app.Logger.Println("Application started. Werk it! 🚀")
+
+	// The background jobs run until the server stops, then finish what they're doing before the database is closed
+	ctx, stop := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	defer background.Wait()
+	defer stop()
+
+	// Empty the trash of workouts deleted longer ago than the retention period, every hour
+	background.Go(func() { app.RunTrashPurge(ctx, *trashRetention, time.Hour) })
+
+	// Close abandoned workout sessions, checking every few minutes
+	background.Go(func() { app.RunSessionExpiry(ctx, *sessionTimeout, 5*time.Minute) })
+
+	// Send pending webhook events, checking the outbox every few seconds
+	background.Go(func() { app.WebhookWorker.Run(ctx, 5*time.Second) })
+
+	// Hand domain events to their subscribers, checking the outbox every second
+	background.Go(func() { app.Events.Run(ctx, time.Second) })
+
+	// Pass workout changes announced by any instance on to the live update clients connected here.
+	// Only Postgres announces them (with NOTIFY): on SQLite, there is no other instance and they're published directly.
+	if app.DBConfig.Driver == store.DriverPostgres {
+		background.Go(func() { app.Realtime.Listen(ctx, app.DB) })
+	}
+
+	// Serve gRPC alongside the HTTP API
+	if *grpcPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
+		if err != nil {
+			return err
+		}
+		app.Logger.Printf("Starting gRPC server on port %d\n", *grpcPort)
+		go func() {
+			err := app.GRPCServer.Serve(listener)
+			if err != nil {
+				app.Logger.Printf("gRPC server stopped: %v", err)
+			}
+		}()
+		defer app.GRPCServer.GracefulStop()
+	}
+
+	// Using chi router instead of default http package router. Routes have 2 arguments: path (where the function is),
+	// and the handler function itself (see internal/routes)
+	r := routes.SetupRoutes(app)
+
+	// declare a new server with specific configurations
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", *port), // returns variable port as a string with a colon in front of it
+		Handler:      r,                         // Use the chi router as the main handler for incoming requests
+		IdleTimeout:  time.Minute,               // how long to wait before closing idle connections
+		ReadTimeout:  10 * time.Second,          // max duration for reading the entire request, including the body
+		WriteTimeout: 30 * time.Second,          // max duration before timing out writes of the response
+	}
+	// Stop on Ctrl+C or when the container is stopped: requests in progress get to finish, new ones are refused
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	shutdown := make(chan error, 1)
+	done := make(chan struct{}) // Closed when Serve returns, e.g. because the server couldn't start: nothing to shut down then
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-signals.Done():
+		}
+		app.Logger.Println("Shutting down...")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+
+	app.Logger.Printf("Starting server on port %d\n", *port)
+	err = server.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err // e.g. the port is taken
+	}
+	// ListenAndServe returns as soon as shutdown starts, wait until it's over
+	err = <-shutdown
+	if err != nil {
+		return fmt.Errorf("failed to shut down gracefully: %w", err)
+	}
+	app.Logger.Println("Application stopped. Bye! 👋")
+	return nil
+}
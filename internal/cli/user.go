@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/OlivierCoq/go_api_template/internal/api"
+	"github.com/OlivierCoq/go_api_template/internal/app"
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/tokens"
+)
+
+const userUsage = `Usage: go run main.go user COMMAND [flags] [USERNAME]
+
+Commands:
+  create -username NAME -email EMAIL [-password PASSWORD] [-bio BIO]
+                  Create a user, with the same checks as registration. Without -password, one is generated and printed
+  disable USERNAME
+                  Stop a user from logging in, and revoke their tokens
+  enable USERNAME
+                  Let a disabled user log in again
+  reset-password [-password PASSWORD] USERNAME
+                  Set a new password, generated and printed without -password, and log the user out everywhere`
+
+// User manages accounts, e.g. for support requests. Examples:
+//
+//	go run main.go user create -username olivier -email olivier@example.com
+//	go run main.go user disable olivier
+func User(args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" {
+		fmt.Println(userUsage)
+		return nil
+	}
+	command, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("user "+command, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(flags.Output(), userUsage) }
+	username := flags.String("username", "", "Username of the new user")
+	email := flags.String("email", "", "Email of the new user")
+	password := flags.String("password", "", "Password, generated when empty")
+	bio := flags.String("bio", "", "Bio of the new user")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "create":
+		return withApplication(func(app *app.Application) error {
+			return createUser(app, *username, *email, *password, *bio)
+		})
+	case "disable", "enable":
+		return withApplication(func(app *app.Application) error {
+			return setUserDisabled(app, flags.Arg(0), command == "disable")
+		})
+	case "reset-password":
+		return withApplication(func(app *app.Application) error {
+			return resetPassword(app, flags.Arg(0), *password)
+		})
+	}
+	return fmt.Errorf("user: unknown command %q\n\n%s", command, userUsage)
+}
+
+func createUser(app *app.Application, username, email, password, bio string) error {
+	generated := password == ""
+	if generated {
+		password = generatePassword()
+	}
+	err := api.ValidateRegisterUserRequest(&api.RegisterUserRequest{Username: username, Email: email, Password: password})
+	if err != nil {
+		return err
+	}
+
+	user := &store.User{Username: username, Email: email, Bio: bio}
+	err = user.PasswordHash.Set(password)
+	if err != nil {
+		return err
+	}
+	user, err = app.Stores.Users.CreateUser(user)
+	if err != nil {
+		return fmt.Errorf("failed to create user %s: %w", username, err)
+	}
+	record(app, "user create", audit.Event{
+		Action:     audit.ActionUserRegistered,
+		Resource:   audit.ResourceUser,
+		ResourceID: user.ID,
+		After:      user,
+	})
+
+	fmt.Printf("Created user %s (ID %d)\n", user.Username, user.ID)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return nil
+}
+
+func setUserDisabled(app *app.Application, username string, disabled bool) error {
+	user, err := findUser(app.Stores, username)
+	if err != nil {
+		return err
+	}
+	err = app.Stores.Users.SetUserDisabled(user.ID, disabled)
+	if err != nil {
+		return err
+	}
+
+	command, action, done := "user enable", audit.ActionUserEnabled, "Enabled"
+	if disabled {
+		// Revoked rather than only ignored (see SetUserDisabled), so that enabling the user doesn't bring them back
+		for _, scope := range []string{tokens.ScopeAuth, tokens.ScopeCalendar} {
+			err = app.Stores.Tokens.DeleteAllTokensForUser(scope, user.ID)
+			if err != nil {
+				return fmt.Errorf("disabled %s, but failed to revoke their tokens: %w", user.Username, err)
+			}
+		}
+		command, action, done = "user disable", audit.ActionUserDisabled, "Disabled"
+	}
+	record(app, command, audit.Event{
+		Action:     action,
+		Resource:   audit.ResourceUser,
+		ResourceID: user.ID,
+	})
+	fmt.Printf("%s user %s\n", done, user.Username)
+	return nil
+}
+
+func resetPassword(app *app.Application, username, password string) error {
+	user, err := findUser(app.Stores, username)
+	if err != nil {
+		return err
+	}
+	generated := password == ""
+	if generated {
+		password = generatePassword()
+	}
+	err = api.ValidatePassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = user.PasswordHash.Set(password)
+	if err != nil {
+		return err
+	}
+	err = app.Stores.Users.UpdatePassword(user)
+	if err != nil {
+		return err
+	}
+	// Whoever knew the old password may still be logged in
+	err = app.Stores.Tokens.DeleteAllTokensForUser(tokens.ScopeAuth, user.ID)
+	if err != nil {
+		return fmt.Errorf("changed the password of %s, but failed to log them out: %w", user.Username, err)
+	}
+	record(app, "user reset-password", audit.Event{
+		Action:     audit.ActionUserPasswordReset,
+		Resource:   audit.ResourceUser,
+		ResourceID: user.ID,
+	})
+
+	fmt.Printf("Reset the password of %s and logged them out\n", user.Username)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return nil
+}
+
+// generatePassword returns a random password passing api.ValidatePassword, to hand over to the user
+func generatePassword() string {
+	for {
+		text := rand.Text() // Upper case letters and digits
+		password := strings.ToLower(text[:8]) + text[8:16]
+		if api.ValidatePassword(password) == nil {
+			return password
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package dataloader
+
+import "sync"
+
+/*
+	Batched loading, to avoid N+1 queries.
+	When a list of things is resolved and then something is loaded for each of them (e.g. the entries of each workout
+	in a GraphQL query), loading them one by one costs one query per item. A Loader gathers the keys instead, and fetches
+	everything it has been asked for in a single call:
+
+		entries := dataloader.New(workoutStore.GetEntriesForWorkouts)
+		entries.Want(1, 2, 3)      // the workouts about to be resolved
+		entries.Load(1)            // fetches the entries of 1, 2 and 3 at once
+		entries.Load(2)            // already there, no query
+
+	Keys that are loaded without being wanted first are fetched on their own, so Want is an optimization, never required.
+	Results are cached for the life of the Loader, so make one per request: a long-lived Loader would serve stale data.
+	A Loader can be used from several goroutines; loads of keys in a batch in progress wait for it instead of fetching
+	them again. Fetching happens without holding the lock, so loads of keys that are already there never wait.
+*/
+
+type Loader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K        // Wanted, for the next batch
+	queued  map[K]bool // Keys in pending, so wanting a key twice doesn't fetch it twice
+	loaded  map[K]V
+	done    map[K]bool        // Fetched keys, including those fetch had no value for
+	fetches map[K]*batchFetch // Keys being fetched, and the fetch to wait for
+}
+
+// batchFetch is a call to fetch in progress. done is closed once it's over, with err set if it failed.
+type batchFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// New returns a Loader fetching batches with fetch. Keys missing from the map fetch returns get the zero value of V.
+func New[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{
+		fetch:   fetch,
+		queued:  make(map[K]bool),
+		loaded:  make(map[K]V),
+		done:    make(map[K]bool),
+		fetches: make(map[K]*batchFetch),
+	}
+}
+
+// Want adds keys to the next batch, so they're fetched along with the first key loaded
+func (l *Loader[K, V]) Want(keys ...K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		l.want(key)
+	}
+}
+
+func (l *Loader[K, V]) want(key K) {
+	if l.done[key] || l.queued[key] || l.fetches[key] != nil {
+		return
+	}
+	l.queued[key] = true
+	l.pending = append(l.pending, key)
+}
+
+// Load returns the value of key, fetching it along with every wanted key if it isn't loaded yet
+func (l *Loader[K, V]) Load(key K) (V, error) {
+	l.mu.Lock()
+	if l.done[key] {
+		defer l.mu.Unlock()
+		return l.loaded[key], nil
+	}
+
+	// Another load is already fetching the key
+	if inProgress := l.fetches[key]; inProgress != nil {
+		l.mu.Unlock()
+		<-inProgress.done
+		if inProgress.err != nil {
+			var zero V
+			return zero, inProgress.err
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.loaded[key], nil
+	}
+
+	l.want(key)
+	batch := l.pending
+	l.pending = nil
+	l.queued = make(map[K]bool)
+	current := &batchFetch{done: make(chan struct{})}
+	for _, k := range batch {
+		l.fetches[k] = current
+	}
+	l.mu.Unlock()
+
+	values, err := l.fetch(batch)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, k := range batch {
+		delete(l.fetches, k)
+		// On error, nothing is cached, so the keys are fetched again the next time they're loaded
+		if err == nil {
+			l.done[k] = true
+			if value, ok := values[k]; ok {
+				l.loaded[k] = value
+			}
+		}
+	}
+	current.err = err
+	close(current.done)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return l.loaded[key], nil
+}
@@ -0,0 +1,120 @@
+package dataloader
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// doubler fetches each key times two, and remembers the batches it was called with
+type doubler struct {
+	mu      sync.Mutex
+	batches [][]int
+	err     error
+}
+
+func (d *doubler) fetch(keys []int) (map[int]int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.batches = append(d.batches, keys)
+	if d.err != nil {
+		return nil, d.err
+	}
+	values := make(map[int]int)
+	for _, key := range keys {
+		if key != 0 {
+			values[key] = key * 2
+		}
+	}
+	return values, nil
+}
+
+func TestLoaderBatches(t *testing.T) {
+	d := &doubler{}
+	loader := New(d.fetch)
+	loader.Want(1, 2, 3, 2)
+
+	value, err := loader.Load(2)
+	require.NoError(t, err)
+	assert.Equal(t, 4, value)
+	value, err = loader.Load(3)
+	require.NoError(t, err)
+	assert.Equal(t, 6, value)
+	assert.Equal(t, [][]int{{1, 2, 3}}, d.batches, "wanted keys are fetched together, once")
+
+	// Not wanted: fetched on its own. Keys fetch has nothing for get the zero value, and aren't fetched again.
+	value, err = loader.Load(0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, value)
+	loader.Load(0)
+	assert.Equal(t, [][]int{{1, 2, 3}, {0}}, d.batches)
+}
+
+func TestLoaderConcurrentLoads(t *testing.T) {
+	d := &doubler{}
+	loader := New(d.fetch)
+	keys := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	loader.Want(keys...)
+
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := loader.Load(key)
+			assert.NoError(t, err)
+			assert.Equal(t, key*2, value)
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, d.batches, 1)
+}
+
+func TestLoaderErrorsAreNotCached(t *testing.T) {
+	d := &doubler{err: errors.New("database is down")}
+	loader := New(d.fetch)
+	loader.Want(1, 2)
+
+	_, err := loader.Load(1)
+	assert.Error(t, err)
+
+	d.err = nil
+	value, err := loader.Load(1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+	assert.Equal(t, [][]int{{1, 2}, {1}}, d.batches)
+}
+
+// A slow fetch doesn't hold up loads of keys that are already there
+func TestLoaderDoesNotLockDuringFetch(t *testing.T) {
+	release := make(chan struct{})
+	loader := New(func(keys []int) (map[int]int, error) {
+		if keys[0] == 2 {
+			<-release
+		}
+		return map[int]int{keys[0]: keys[0] * 2}, nil
+	})
+	_, err := loader.Load(1)
+	require.NoError(t, err)
+
+	slow := make(chan int)
+	go func() {
+		value, _ := loader.Load(2)
+		slow <- value
+	}()
+	go func() {
+		value, _ := loader.Load(2) // Waits for the fetch in progress
+		slow <- value
+	}()
+
+	value, err := loader.Load(1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+
+	close(release)
+	assert.Equal(t, 4, <-slow)
+	assert.Equal(t, 4, <-slow)
+}
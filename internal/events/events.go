@@ -0,0 +1,197 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+	Domain events: things that happened in the application, for other parts of it to react to.
+
+	Stores write events to the outbox table in the same transaction as the change they describe, so an event exists
+	if and only if its change was committed. The Dispatcher then polls the outbox and hands each event to the subscribers
+	registered for its type, in-process.
+
+	Delivery is at-least-once: if a subscriber fails, the event is dispatched again later (to every subscriber of its type),
+	so subscribers must cope with seeing the same event twice. Envelope.ID identifies an event across retries.
+*/
+
+// Event is a typed domain event. Type is the name it's stored and subscribed to under, e.g. workout.created.
+type Event interface {
+	Type() string
+}
+
+type UserRegistered struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type UserUpdated struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type TokenRevoked struct {
+	UserID int    `json:"user_id"`
+	Scope  string `json:"scope"`
+}
+
+type WorkoutCreated struct {
+	WorkoutID int    `json:"workout_id"`
+	UUID      string `json:"uuid"`
+	UserID    int    `json:"user_id"`
+	Version   int    `json:"version"`
+}
+
+// WorkoutUpdated is also emitted when the entries of a workout change
+type WorkoutUpdated struct {
+	WorkoutID int    `json:"workout_id"`
+	UUID      string `json:"uuid"`
+	UserID    int    `json:"user_id"`
+	Version   int    `json:"version"`
+}
+
+// WorkoutDeleted means the workout went to the trash
+type WorkoutDeleted struct {
+	WorkoutID int    `json:"workout_id"`
+	UUID      string `json:"uuid"`
+	UserID    int    `json:"user_id"`
+}
+
+type WorkoutRestored struct {
+	WorkoutID int    `json:"workout_id"`
+	UUID      string `json:"uuid"`
+	UserID    int    `json:"user_id"`
+	Version   int    `json:"version"`
+}
+
+// RecordAchieved means an exercise was logged with more weight than the user ever did it with before
+type RecordAchieved struct {
+	WorkoutID      int     `json:"workout_id"`
+	EntryID        int     `json:"entry_id"`
+	UserID         int     `json:"user_id"`
+	ExerciseName   string  `json:"exercise_name"`
+	Weight         float64 `json:"weight"`
+	PreviousWeight float64 `json:"previous_weight"`
+}
+
+func (UserRegistered) Type() string  { return "user.registered" }
+func (UserUpdated) Type() string     { return "user.updated" }
+func (TokenRevoked) Type() string    { return "token.revoked" }
+func (WorkoutCreated) Type() string  { return "workout.created" }
+func (WorkoutUpdated) Type() string  { return "workout.updated" }
+func (WorkoutDeleted) Type() string  { return "workout.deleted" }
+func (WorkoutRestored) Type() string { return "workout.restored" }
+func (RecordAchieved) Type() string  { return "record.achieved" }
+
+// Envelope is an event as stored in the outbox
+type Envelope struct {
+	ID         int64
+	Type       string
+	Payload    json.RawMessage
+	OccurredAt time.Time
+	Attempts   int // Failed dispatches so far
+}
+
+// Outbox is where the dispatcher reads events from (see store.PostgresEventStore)
+type Outbox interface {
+	// Dispatch claims up to limit pending events, calls fn with each of them in order, and records the outcome:
+	// dispatched when fn returns nil, retried later otherwise. It returns how many events it went through.
+	Dispatch(limit int, fn func(Envelope) error) (int, error)
+}
+
+// Handler reacts to an event
+type Handler func(Envelope) error
+
+type Dispatcher struct {
+	outbox Outbox
+	logger *log.Logger
+
+	mu          sync.RWMutex
+	subscribers map[string][]Handler
+}
+
+func NewDispatcher(outbox Outbox, logger *log.Logger) *Dispatcher {
+	return &Dispatcher{
+		outbox:      outbox,
+		logger:      logger,
+		subscribers: map[string][]Handler{},
+	}
+}
+
+// Subscribe registers handler for the events of the given type. Prefer On, which decodes the event for you.
+func (d *Dispatcher) Subscribe(eventType string, handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subscribers[eventType] = append(d.subscribers[eventType], handler)
+}
+
+// On registers handler for the events of type T, decoded from the outbox, e.g.
+//
+//	events.On(dispatcher, func(e events.WorkoutCreated) error { ... })
+func On[T Event](d *Dispatcher, handler func(T) error) {
+	OnEnvelope(d, func(_ Envelope, event T) error {
+		return handler(event)
+	})
+}
+
+// OnEnvelope is On for handlers that also need the envelope of the event, e.g. its ID to tell retries apart
+func OnEnvelope[T Event](d *Dispatcher, handler func(Envelope, T) error) {
+	var zero T
+	d.Subscribe(zero.Type(), func(envelope Envelope) error {
+		var event T
+		err := json.Unmarshal(envelope.Payload, &event)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s event %d: %w", envelope.Type, envelope.ID, err)
+		}
+		return handler(envelope, event)
+	})
+}
+
+// deliver hands an event to all its subscribers. Every subscriber runs even if one fails; the first error is returned.
+func (d *Dispatcher) deliver(envelope Envelope) error {
+	d.mu.RLock()
+	handlers := d.subscribers[envelope.Type]
+	d.mu.RUnlock()
+
+	var firstErr error
+	for _, handler := range handlers {
+		err := handler(envelope)
+		if err != nil {
+			d.logger.Printf("Subscriber failed on %s event %d: %v", envelope.Type, envelope.ID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// batchSize is how many events are dispatched per poll
+const batchSize = 100
+
+// RunOnce dispatches the pending events and returns how many there were
+func (d *Dispatcher) RunOnce() (int, error) {
+	return d.outbox.Dispatch(batchSize, d.deliver)
+}
+
+// Run polls the outbox every interval until ctx is cancelled. The events already taken from the outbox are delivered before it returns.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	for ctx.Err() == nil {
+		// Keep going while there is a backlog, otherwise wait for new events
+		dispatched, err := d.RunOnce()
+		if err != nil {
+			d.logger.Printf("Failed to dispatch events: %v", err)
+		}
+		if dispatched < batchSize {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+	}
+}
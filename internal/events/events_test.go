@@ -0,0 +1,97 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOutbox dispatches its events once and records which ones fn failed on
+type fakeOutbox struct {
+	pending []Envelope
+	failed  []int64
+}
+
+func (f *fakeOutbox) Dispatch(limit int, fn func(Envelope) error) (int, error) {
+	for _, envelope := range f.pending {
+		if fn(envelope) != nil {
+			f.failed = append(f.failed, envelope.ID)
+		}
+	}
+	dispatched := len(f.pending)
+	f.pending = nil
+	return dispatched, nil
+}
+
+func envelope(t *testing.T, id int64, event Event) Envelope {
+	payload, err := json.Marshal(event)
+	require.NoError(t, err)
+	return Envelope{ID: id, Type: event.Type(), Payload: payload}
+}
+
+func TestDispatcher(t *testing.T) {
+	outbox := &fakeOutbox{pending: []Envelope{
+		envelope(t, 1, WorkoutCreated{WorkoutID: 7, UUID: "u7", UserID: 3, Version: 1}),
+		envelope(t, 2, TokenRevoked{UserID: 3, Scope: "authentication"}),
+		envelope(t, 3, UserRegistered{UserID: 4, Username: "nobody_listens"}),
+	}}
+	dispatcher := NewDispatcher(outbox, log.New(io.Discard, "", 0))
+
+	var created []WorkoutCreated
+	On(dispatcher, func(e WorkoutCreated) error {
+		created = append(created, e)
+		return nil
+	})
+	revoked := 0
+	On(dispatcher, func(e TokenRevoked) error {
+		revoked++
+		return nil
+	})
+	On(dispatcher, func(e TokenRevoked) error {
+		return errors.New("subscriber is down")
+	})
+
+	dispatched, err := dispatcher.RunOnce()
+	require.NoError(t, err)
+	assert.Equal(t, 3, dispatched)
+
+	assert.Equal(t, []WorkoutCreated{{WorkoutID: 7, UUID: "u7", UserID: 3, Version: 1}}, created)
+	assert.Equal(t, 1, revoked, "a failing subscriber doesn't stop the others")
+	assert.Equal(t, []int64{2}, outbox.failed, "the event is retried when a subscriber fails")
+}
+
+func TestOnRejectsUndecodablePayload(t *testing.T) {
+	outbox := &fakeOutbox{pending: []Envelope{{ID: 1, Type: "workout.updated", Payload: json.RawMessage(`"not an object"`)}}}
+	dispatcher := NewDispatcher(outbox, log.New(io.Discard, "", 0))
+	On(dispatcher, func(e WorkoutUpdated) error { return nil })
+
+	_, err := dispatcher.RunOnce()
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, outbox.failed)
+}
+
+// Cancelling Run lets the events already taken from the outbox through before it returns
+func TestRunStopsWhenCancelled(t *testing.T) {
+	outbox := &fakeOutbox{pending: []Envelope{
+		envelope(t, 1, TokenRevoked{UserID: 3, Scope: "authentication"}),
+		envelope(t, 2, TokenRevoked{UserID: 4, Scope: "authentication"}),
+	}}
+	dispatcher := NewDispatcher(outbox, log.New(io.Discard, "", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	var revoked []int
+	On(dispatcher, func(e TokenRevoked) error {
+		cancel() // The server shuts down while the first event is being handled
+		revoked = append(revoked, e.UserID)
+		return nil
+	})
+
+	dispatcher.Run(ctx, time.Hour)
+	assert.Equal(t, []int{3, 4}, revoked)
+}
@@ -0,0 +1,214 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+)
+
+// Supported export formats
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson" // Newline delimited JSON: one workout per line, easy to process line by line
+)
+
+/*
+	A Writer receives workouts one at a time and writes them out in its format as they come,
+	so an export never needs the whole history in memory. Close must be called once at the end
+	to write whatever closes the document (e.g. the "]" of a JSON array) and flush buffers.
+*/
+
+type Writer interface {
+	Write(workout *store.Workout) error
+	Close() error
+}
+
+// NewWriter returns a Writer for the given format, or an error if the format isn't supported.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatJSON:
+		return &jsonWriter{w: w}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q (expected csv, json or ndjson)", format)
+}
+
+// ContentType returns the MIME type to send along an export in the given format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// Filename returns the suggested file name of an export, e.g. workouts-2025-03-14.csv
+func Filename(format string, now time.Time) string {
+	return fmt.Sprintf("workouts-%s.%s", now.Format("2006-01-02"), format)
+}
+
+// Workouts streams every workout of the user from the store into w, in the given format.
+func Workouts(workoutStore store.WorkoutStore, userID int, format string, w io.Writer) error {
+	writer, err := NewWriter(format, w)
+	if err != nil {
+		return err
+	}
+
+	err = workoutStore.StreamWorkouts(userID, writer.Write)
+	if err != nil {
+		return fmt.Errorf("failed to export workouts: %w", err)
+	}
+	return writer.Close()
+}
+
+// CSV
+
+// CSV is flat, so each entry gets its own row with the columns of its workout repeated.
+// Workouts without entries get a single row with empty entry columns.
+var csvHeader = []string{
+	"workout_id", "title", "description", "duration_minutes", "calories_burned", "planned_for", "status",
+	"entry_id", "exercise_name", "sets", "reps", "duration_seconds", "weight", "notes", "order_index",
+}
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(workout *store.Workout) error {
+	if !c.headerWritten {
+		err := c.w.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	plannedFor := ""
+	if workout.PlannedFor != nil {
+		plannedFor = workout.PlannedFor.UTC().Format(time.RFC3339)
+	}
+	workoutColumns := []string{
+		strconv.Itoa(workout.ID),
+		workout.Title,
+		workout.Description,
+		strconv.Itoa(workout.DurationMinutes),
+		strconv.Itoa(workout.CaloriesBurned),
+		plannedFor,
+		workout.Status,
+	}
+
+	if len(workout.Entries) == 0 {
+		return c.w.Write(append(workoutColumns, make([]string, 8)...))
+	}
+
+	for _, entry := range workout.Entries {
+		row := append(append([]string{}, workoutColumns...),
+			strconv.Itoa(entry.ID),
+			entry.ExerciseName,
+			strconv.Itoa(entry.Sets),
+			formatIntPtr(entry.Reps),
+			formatIntPtr(entry.DurationSeconds),
+			formatFloatPtr(entry.Weight),
+			entry.Notes,
+			strconv.Itoa(entry.OrderIndex),
+		)
+		err := c.w.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	// An export without any workout still gets its header row
+	if !c.headerWritten {
+		err := c.w.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// JSON
+
+// jsonWriter writes {"workouts": [...]}, the same envelope as the API, one array element at a time.
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonWriter) Write(workout *store.Workout) error {
+	prefix := ",\n"
+	if j.count == 0 {
+		prefix = "{\"workouts\": [\n"
+	}
+	js, err := json.Marshal(workout)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(j.w, prefix+string(js))
+	if err != nil {
+		return err
+	}
+	j.count++
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	if j.count == 0 {
+		_, err := io.WriteString(j.w, "{\"workouts\": []}\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n]}\n")
+	return err
+}
+
+// NDJSON
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(workout *store.Workout) error {
+	// Encode adds the trailing newline for us
+	return n.enc.Encode(workout)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+// Helpers for optional values, which are left empty in the CSV when missing
+
+func formatIntPtr(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+func formatFloatPtr(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
@@ -0,0 +1,83 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testWorkouts() []*store.Workout {
+	reps := 10
+	weight := 60.5
+	return []*store.Workout{
+		{
+			ID:              1,
+			Title:           "Push, day",
+			DurationMinutes: 45,
+			Status:          store.WorkoutStatusCompleted,
+			Entries: []store.WorkoutEntry{
+				{ID: 10, ExerciseName: "Bench press", Sets: 3, Reps: &reps, Weight: &weight, OrderIndex: 1},
+				{ID: 11, ExerciseName: "Dips", Sets: 3, Reps: &reps, OrderIndex: 2},
+			},
+		},
+		{ID: 2, Title: "Rest", Status: store.WorkoutStatusSkipped, Entries: []store.WorkoutEntry{}},
+	}
+}
+
+func writeAll(t *testing.T, format string) string {
+	var buf bytes.Buffer
+	writer, err := NewWriter(format, &buf)
+	require.NoError(t, err)
+	for _, workout := range testWorkouts() {
+		require.NoError(t, writer.Write(workout))
+	}
+	require.NoError(t, writer.Close())
+	return buf.String()
+}
+
+func TestCSVWriter(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(writeAll(t, FormatCSV)), "\n")
+
+	// Header, one row per entry of the first workout, one row for the workout without entries
+	require.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[0], "workout_id,title,"))
+	assert.Equal(t, `1,"Push, day",,45,0,,completed,10,Bench press,3,10,,60.5,,1`, lines[1])
+	assert.Equal(t, `1,"Push, day",,45,0,,completed,11,Dips,3,10,,,,2`, lines[2])
+	assert.Equal(t, `2,Rest,,0,0,,skipped,,,,,,,,`, lines[3])
+}
+
+func TestJSONWriter(t *testing.T) {
+	var decoded struct {
+		Workouts []store.Workout `json:"workouts"`
+	}
+	err := json.Unmarshal([]byte(writeAll(t, FormatJSON)), &decoded)
+	require.NoError(t, err)
+	require.Len(t, decoded.Workouts, 2)
+	assert.Len(t, decoded.Workouts[0].Entries, 2)
+
+	// No workouts at all must still be valid JSON
+	var buf bytes.Buffer
+	writer, err := NewWriter(FormatJSON, &buf)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	assert.JSONEq(t, `{"workouts": []}`, buf.String())
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(writeAll(t, FormatNDJSON)), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var workout store.Workout
+		assert.NoError(t, json.Unmarshal([]byte(line), &workout))
+	}
+}
+
+func TestNewWriterUnsupportedFormat(t *testing.T) {
+	_, err := NewWriter("xml", &bytes.Buffer{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/grpcapi/pb"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// The stores only need what the calls under test use; anything else panics on the nil interface
+
+type fakeUserStore struct {
+	store.UserStore
+}
+
+func (fakeUserStore) GetUserToken(scope, token string) (*store.User, error) {
+	if token == "valid" {
+		return &store.User{ID: 7, Username: "olivier"}, nil
+	}
+	return nil, nil
+}
+
+type fakeWorkoutStore struct {
+	store.WorkoutStore
+}
+
+func (fakeWorkoutStore) GetWorkoutByID(id int64) (*store.Workout, error) {
+	if id == 1 {
+		return &store.Workout{ID: 1, UserID: 7, Title: "Legs"}, nil
+	}
+	return &store.Workout{ID: int(id), UserID: 8, Title: "Someone else's"}, nil
+}
+
+func startServer(t *testing.T, withReflection bool) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(fakeWorkoutStore{}, fakeUserStore{}, nil, nil, withReflection, log.New(io.Discard, "", 0))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", token)
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	auth := pb.NewAuthServiceClient(startServer(t, false))
+
+	_, err := auth.GetCurrentUser(context.Background(), &pb.GetCurrentUserRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "no token")
+	_, err = auth.GetCurrentUser(withToken("Token valid"), &pb.GetCurrentUserRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "not a bearer token")
+	_, err = auth.GetCurrentUser(withToken("Bearer expired"), &pb.GetCurrentUserRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	user, err := auth.GetCurrentUser(withToken("Bearer valid"), &pb.GetCurrentUserRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "olivier", user.Username)
+}
+
+func TestGetWorkout(t *testing.T) {
+	workouts := pb.NewWorkoutServiceClient(startServer(t, false))
+
+	workout, err := workouts.GetWorkout(withToken("Bearer valid"), &pb.GetWorkoutRequest{Id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "Legs", workout.Title)
+
+	_, err = workouts.GetWorkout(withToken("Bearer valid"), &pb.GetWorkoutRequest{Id: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err), "other users' workouts are not found")
+}
+
+func TestFromProto(t *testing.T) {
+	reps := int32(10)
+	workout, err := fromProto(&pb.Workout{Title: "Legs", Entries: []*pb.WorkoutEntry{{ExerciseName: "Squat", Sets: 3, Reps: &reps}}})
+	require.NoError(t, err)
+	assert.Equal(t, 10, *workout.Entries[0].Reps)
+	assert.Nil(t, workout.Entries[0].DurationSeconds)
+
+	_, err = fromProto(&pb.Workout{Title: "Legs", Entries: []*pb.WorkoutEntry{{ExerciseName: "Squat", Sets: 3}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "entries need reps or a duration")
+	_, err = fromProto(&pb.Workout{Title: "Legs", Status: "done"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// listServices asks the reflection service for the list of services
+func listServices(conn *grpc.ClientConn) ([]string, error) {
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}})
+	if err != nil {
+		return nil, err
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, service := range res.GetListServicesResponse().GetService() {
+		names = append(names, service.Name)
+	}
+	return names, nil
+}
+
+func TestReflection(t *testing.T) {
+	_, err := listServices(startServer(t, false))
+	assert.Equal(t, codes.Unimplemented, status.Code(err), "off by default")
+
+	services, err := listServices(startServer(t, true))
+	require.NoError(t, err)
+	assert.Contains(t, services, "workouts.v1.WorkoutService")
+}
@@ -0,0 +1,1025 @@
+// gRPC interface of the API, for backend services that prefer typed RPCs to JSON.
+// Served by internal/grpcapi on its own port (see -grpc-port). After changing this file, regenerate the Go code:
+//   protoc -I internal/grpcapi/pb --go_out=internal/grpcapi/pb --go_opt=paths=source_relative \
+//          --go-grpc_out=internal/grpcapi/pb --go-grpc_opt=paths=source_relative workouts.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: workouts.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type User struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Username      string                 `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	Email         string                 `protobuf:"bytes,3,opt,name=email,proto3" json:"email,omitempty"`
+	Bio           string                 `protobuf:"bytes,4,opt,name=bio,proto3" json:"bio,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *User) Reset() {
+	*x = User{}
+	mi := &file_workouts_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *User) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*User) ProtoMessage() {}
+
+func (x *User) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use User.ProtoReflect.Descriptor instead.
+func (*User) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *User) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *User) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *User) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *User) GetBio() string {
+	if x != nil {
+		return x.Bio
+	}
+	return ""
+}
+
+func (x *User) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+type Workout struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Uuid            string                 `protobuf:"bytes,2,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Title           string                 `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Description     string                 `protobuf:"bytes,4,opt,name=description,proto3" json:"description,omitempty"`
+	DurationMinutes int32                  `protobuf:"varint,5,opt,name=duration_minutes,json=durationMinutes,proto3" json:"duration_minutes,omitempty"`
+	CaloriesBurned  int32                  `protobuf:"varint,6,opt,name=calories_burned,json=caloriesBurned,proto3" json:"calories_burned,omitempty"`
+	PlannedFor      *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=planned_for,json=plannedFor,proto3" json:"planned_for,omitempty"` // Unset for workouts logged without planning
+	Status          string                 `protobuf:"bytes,8,opt,name=status,proto3" json:"status,omitempty"`                           // planned, completed or skipped
+	Version         int32                  `protobuf:"varint,9,opt,name=version,proto3" json:"version,omitempty"`                        // Incremented on every update
+	UpdatedAt       *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	Entries         []*WorkoutEntry        `protobuf:"bytes,11,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Workout) Reset() {
+	*x = Workout{}
+	mi := &file_workouts_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Workout) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Workout) ProtoMessage() {}
+
+func (x *Workout) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Workout.ProtoReflect.Descriptor instead.
+func (*Workout) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Workout) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Workout) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *Workout) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Workout) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Workout) GetDurationMinutes() int32 {
+	if x != nil {
+		return x.DurationMinutes
+	}
+	return 0
+}
+
+func (x *Workout) GetCaloriesBurned() int32 {
+	if x != nil {
+		return x.CaloriesBurned
+	}
+	return 0
+}
+
+func (x *Workout) GetPlannedFor() *timestamppb.Timestamp {
+	if x != nil {
+		return x.PlannedFor
+	}
+	return nil
+}
+
+func (x *Workout) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Workout) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Workout) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Workout) GetEntries() []*WorkoutEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+// An entry is counted in either reps or duration_seconds
+type WorkoutEntry struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Uuid            string                 `protobuf:"bytes,2,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	ExerciseName    string                 `protobuf:"bytes,3,opt,name=exercise_name,json=exerciseName,proto3" json:"exercise_name,omitempty"`
+	Sets            int32                  `protobuf:"varint,4,opt,name=sets,proto3" json:"sets,omitempty"`
+	Reps            *int32                 `protobuf:"varint,5,opt,name=reps,proto3,oneof" json:"reps,omitempty"`
+	DurationSeconds *int32                 `protobuf:"varint,6,opt,name=duration_seconds,json=durationSeconds,proto3,oneof" json:"duration_seconds,omitempty"`
+	Weight          *float64               `protobuf:"fixed64,7,opt,name=weight,proto3,oneof" json:"weight,omitempty"`
+	Notes           string                 `protobuf:"bytes,8,opt,name=notes,proto3" json:"notes,omitempty"`
+	OrderIndex      int32                  `protobuf:"varint,9,opt,name=order_index,json=orderIndex,proto3" json:"order_index,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *WorkoutEntry) Reset() {
+	*x = WorkoutEntry{}
+	mi := &file_workouts_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkoutEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkoutEntry) ProtoMessage() {}
+
+func (x *WorkoutEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkoutEntry.ProtoReflect.Descriptor instead.
+func (*WorkoutEntry) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *WorkoutEntry) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *WorkoutEntry) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *WorkoutEntry) GetExerciseName() string {
+	if x != nil {
+		return x.ExerciseName
+	}
+	return ""
+}
+
+func (x *WorkoutEntry) GetSets() int32 {
+	if x != nil {
+		return x.Sets
+	}
+	return 0
+}
+
+func (x *WorkoutEntry) GetReps() int32 {
+	if x != nil && x.Reps != nil {
+		return *x.Reps
+	}
+	return 0
+}
+
+func (x *WorkoutEntry) GetDurationSeconds() int32 {
+	if x != nil && x.DurationSeconds != nil {
+		return *x.DurationSeconds
+	}
+	return 0
+}
+
+func (x *WorkoutEntry) GetWeight() float64 {
+	if x != nil && x.Weight != nil {
+		return *x.Weight
+	}
+	return 0
+}
+
+func (x *WorkoutEntry) GetNotes() string {
+	if x != nil {
+		return x.Notes
+	}
+	return ""
+}
+
+func (x *WorkoutEntry) GetOrderIndex() int32 {
+	if x != nil {
+		return x.OrderIndex
+	}
+	return 0
+}
+
+type CreateTokenRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Username      string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Password      string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateTokenRequest) Reset() {
+	*x = CreateTokenRequest{}
+	mi := &file_workouts_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateTokenRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateTokenRequest) ProtoMessage() {}
+
+func (x *CreateTokenRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateTokenRequest.ProtoReflect.Descriptor instead.
+func (*CreateTokenRequest) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CreateTokenRequest) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *CreateTokenRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+type CreateTokenResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Expiry        *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=expiry,proto3" json:"expiry,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateTokenResponse) Reset() {
+	*x = CreateTokenResponse{}
+	mi := &file_workouts_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateTokenResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateTokenResponse) ProtoMessage() {}
+
+func (x *CreateTokenResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateTokenResponse.ProtoReflect.Descriptor instead.
+func (*CreateTokenResponse) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CreateTokenResponse) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *CreateTokenResponse) GetExpiry() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Expiry
+	}
+	return nil
+}
+
+type RevokeTokenRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RevokeTokenRequest) Reset() {
+	*x = RevokeTokenRequest{}
+	mi := &file_workouts_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RevokeTokenRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RevokeTokenRequest) ProtoMessage() {}
+
+func (x *RevokeTokenRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RevokeTokenRequest.ProtoReflect.Descriptor instead.
+func (*RevokeTokenRequest) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{5}
+}
+
+type RevokeTokenResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RevokeTokenResponse) Reset() {
+	*x = RevokeTokenResponse{}
+	mi := &file_workouts_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RevokeTokenResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RevokeTokenResponse) ProtoMessage() {}
+
+func (x *RevokeTokenResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RevokeTokenResponse.ProtoReflect.Descriptor instead.
+func (*RevokeTokenResponse) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{6}
+}
+
+type GetCurrentUserRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCurrentUserRequest) Reset() {
+	*x = GetCurrentUserRequest{}
+	mi := &file_workouts_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCurrentUserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCurrentUserRequest) ProtoMessage() {}
+
+func (x *GetCurrentUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCurrentUserRequest.ProtoReflect.Descriptor instead.
+func (*GetCurrentUserRequest) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{7}
+}
+
+type GetWorkoutRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetWorkoutRequest) Reset() {
+	*x = GetWorkoutRequest{}
+	mi := &file_workouts_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetWorkoutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetWorkoutRequest) ProtoMessage() {}
+
+func (x *GetWorkoutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetWorkoutRequest.ProtoReflect.Descriptor instead.
+func (*GetWorkoutRequest) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetWorkoutRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type ListWorkoutsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Limit         int32                  `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"` // 20 if unset, at most 100
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListWorkoutsRequest) Reset() {
+	*x = ListWorkoutsRequest{}
+	mi := &file_workouts_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListWorkoutsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListWorkoutsRequest) ProtoMessage() {}
+
+func (x *ListWorkoutsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListWorkoutsRequest.ProtoReflect.Descriptor instead.
+func (*ListWorkoutsRequest) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListWorkoutsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ListWorkoutsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Workouts      []*Workout             `protobuf:"bytes,1,rep,name=workouts,proto3" json:"workouts,omitempty"` // Most recently changed first
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListWorkoutsResponse) Reset() {
+	*x = ListWorkoutsResponse{}
+	mi := &file_workouts_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListWorkoutsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListWorkoutsResponse) ProtoMessage() {}
+
+func (x *ListWorkoutsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListWorkoutsResponse.ProtoReflect.Descriptor instead.
+func (*ListWorkoutsResponse) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListWorkoutsResponse) GetWorkouts() []*Workout {
+	if x != nil {
+		return x.Workouts
+	}
+	return nil
+}
+
+type CreateWorkoutRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Workout       *Workout               `protobuf:"bytes,1,opt,name=workout,proto3" json:"workout,omitempty"` // id, version and updated_at are ignored
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateWorkoutRequest) Reset() {
+	*x = CreateWorkoutRequest{}
+	mi := &file_workouts_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateWorkoutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateWorkoutRequest) ProtoMessage() {}
+
+func (x *CreateWorkoutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateWorkoutRequest.ProtoReflect.Descriptor instead.
+func (*CreateWorkoutRequest) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CreateWorkoutRequest) GetWorkout() *Workout {
+	if x != nil {
+		return x.Workout
+	}
+	return nil
+}
+
+// Replaces the workout (and all its entries) with the one given
+type UpdateWorkoutRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Workout *Workout               `protobuf:"bytes,1,opt,name=workout,proto3" json:"workout,omitempty"`
+	// Only update if the workout is still at this version, like If-Match on the REST route. Unset to skip the check.
+	ExpectedVersion *int32 `protobuf:"varint,2,opt,name=expected_version,json=expectedVersion,proto3,oneof" json:"expected_version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *UpdateWorkoutRequest) Reset() {
+	*x = UpdateWorkoutRequest{}
+	mi := &file_workouts_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateWorkoutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateWorkoutRequest) ProtoMessage() {}
+
+func (x *UpdateWorkoutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateWorkoutRequest.ProtoReflect.Descriptor instead.
+func (*UpdateWorkoutRequest) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *UpdateWorkoutRequest) GetWorkout() *Workout {
+	if x != nil {
+		return x.Workout
+	}
+	return nil
+}
+
+func (x *UpdateWorkoutRequest) GetExpectedVersion() int32 {
+	if x != nil && x.ExpectedVersion != nil {
+		return *x.ExpectedVersion
+	}
+	return 0
+}
+
+type DeleteWorkoutRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteWorkoutRequest) Reset() {
+	*x = DeleteWorkoutRequest{}
+	mi := &file_workouts_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteWorkoutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteWorkoutRequest) ProtoMessage() {}
+
+func (x *DeleteWorkoutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteWorkoutRequest.ProtoReflect.Descriptor instead.
+func (*DeleteWorkoutRequest) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *DeleteWorkoutRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type DeleteWorkoutResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteWorkoutResponse) Reset() {
+	*x = DeleteWorkoutResponse{}
+	mi := &file_workouts_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteWorkoutResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteWorkoutResponse) ProtoMessage() {}
+
+func (x *DeleteWorkoutResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_workouts_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteWorkoutResponse.ProtoReflect.Descriptor instead.
+func (*DeleteWorkoutResponse) Descriptor() ([]byte, []int) {
+	return file_workouts_proto_rawDescGZIP(), []int{14}
+}
+
+var File_workouts_proto protoreflect.FileDescriptor
+
+const file_workouts_proto_rawDesc = "" +
+	"\n" +
+	"\x0eworkouts.proto\x12\vworkouts.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x95\x01\n" +
+	"\x04User\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1a\n" +
+	"\busername\x18\x02 \x01(\tR\busername\x12\x14\n" +
+	"\x05email\x18\x03 \x01(\tR\x05email\x12\x10\n" +
+	"\x03bio\x18\x04 \x01(\tR\x03bio\x129\n" +
+	"\n" +
+	"created_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\"\x98\x03\n" +
+	"\aWorkout\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04uuid\x18\x02 \x01(\tR\x04uuid\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\x12 \n" +
+	"\vdescription\x18\x04 \x01(\tR\vdescription\x12)\n" +
+	"\x10duration_minutes\x18\x05 \x01(\x05R\x0fdurationMinutes\x12'\n" +
+	"\x0fcalories_burned\x18\x06 \x01(\x05R\x0ecaloriesBurned\x12;\n" +
+	"\vplanned_for\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"plannedFor\x12\x16\n" +
+	"\x06status\x18\b \x01(\tR\x06status\x12\x18\n" +
+	"\aversion\x18\t \x01(\x05R\aversion\x129\n" +
+	"\n" +
+	"updated_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x123\n" +
+	"\aentries\x18\v \x03(\v2\x19.workouts.v1.WorkoutEntryR\aentries\"\xb1\x02\n" +
+	"\fWorkoutEntry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04uuid\x18\x02 \x01(\tR\x04uuid\x12#\n" +
+	"\rexercise_name\x18\x03 \x01(\tR\fexerciseName\x12\x12\n" +
+	"\x04sets\x18\x04 \x01(\x05R\x04sets\x12\x17\n" +
+	"\x04reps\x18\x05 \x01(\x05H\x00R\x04reps\x88\x01\x01\x12.\n" +
+	"\x10duration_seconds\x18\x06 \x01(\x05H\x01R\x0fdurationSeconds\x88\x01\x01\x12\x1b\n" +
+	"\x06weight\x18\a \x01(\x01H\x02R\x06weight\x88\x01\x01\x12\x14\n" +
+	"\x05notes\x18\b \x01(\tR\x05notes\x12\x1f\n" +
+	"\vorder_index\x18\t \x01(\x05R\n" +
+	"orderIndexB\a\n" +
+	"\x05_repsB\x13\n" +
+	"\x11_duration_secondsB\t\n" +
+	"\a_weight\"L\n" +
+	"\x12CreateTokenRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\"_\n" +
+	"\x13CreateTokenResponse\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x122\n" +
+	"\x06expiry\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x06expiry\"\x14\n" +
+	"\x12RevokeTokenRequest\"\x15\n" +
+	"\x13RevokeTokenResponse\"\x17\n" +
+	"\x15GetCurrentUserRequest\"#\n" +
+	"\x11GetWorkoutRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"+\n" +
+	"\x13ListWorkoutsRequest\x12\x14\n" +
+	"\x05limit\x18\x01 \x01(\x05R\x05limit\"H\n" +
+	"\x14ListWorkoutsResponse\x120\n" +
+	"\bworkouts\x18\x01 \x03(\v2\x14.workouts.v1.WorkoutR\bworkouts\"F\n" +
+	"\x14CreateWorkoutRequest\x12.\n" +
+	"\aworkout\x18\x01 \x01(\v2\x14.workouts.v1.WorkoutR\aworkout\"\x8b\x01\n" +
+	"\x14UpdateWorkoutRequest\x12.\n" +
+	"\aworkout\x18\x01 \x01(\v2\x14.workouts.v1.WorkoutR\aworkout\x12.\n" +
+	"\x10expected_version\x18\x02 \x01(\x05H\x00R\x0fexpectedVersion\x88\x01\x01B\x13\n" +
+	"\x11_expected_version\"&\n" +
+	"\x14DeleteWorkoutRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\x17\n" +
+	"\x15DeleteWorkoutResponse2\xfa\x01\n" +
+	"\vAuthService\x12P\n" +
+	"\vCreateToken\x12\x1f.workouts.v1.CreateTokenRequest\x1a .workouts.v1.CreateTokenResponse\x12P\n" +
+	"\vRevokeToken\x12\x1f.workouts.v1.RevokeTokenRequest\x1a .workouts.v1.RevokeTokenResponse\x12G\n" +
+	"\x0eGetCurrentUser\x12\".workouts.v1.GetCurrentUserRequest\x1a\x11.workouts.v1.User2\x95\x03\n" +
+	"\x0eWorkoutService\x12B\n" +
+	"\n" +
+	"GetWorkout\x12\x1e.workouts.v1.GetWorkoutRequest\x1a\x14.workouts.v1.Workout\x12S\n" +
+	"\fListWorkouts\x12 .workouts.v1.ListWorkoutsRequest\x1a!.workouts.v1.ListWorkoutsResponse\x12H\n" +
+	"\rCreateWorkout\x12!.workouts.v1.CreateWorkoutRequest\x1a\x14.workouts.v1.Workout\x12H\n" +
+	"\rUpdateWorkout\x12!.workouts.v1.UpdateWorkoutRequest\x1a\x14.workouts.v1.Workout\x12V\n" +
+	"\rDeleteWorkout\x12!.workouts.v1.DeleteWorkoutRequest\x1a\".workouts.v1.DeleteWorkoutResponseB>Z<github.com/OlivierCoq/go_api_template/internal/grpcapi/pb;pbb\x06proto3"
+
+var (
+	file_workouts_proto_rawDescOnce sync.Once
+	file_workouts_proto_rawDescData []byte
+)
+
+func file_workouts_proto_rawDescGZIP() []byte {
+	file_workouts_proto_rawDescOnce.Do(func() {
+		file_workouts_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_workouts_proto_rawDesc), len(file_workouts_proto_rawDesc)))
+	})
+	return file_workouts_proto_rawDescData
+}
+
+var file_workouts_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_workouts_proto_goTypes = []any{
+	(*User)(nil),                  // 0: workouts.v1.User
+	(*Workout)(nil),               // 1: workouts.v1.Workout
+	(*WorkoutEntry)(nil),          // 2: workouts.v1.WorkoutEntry
+	(*CreateTokenRequest)(nil),    // 3: workouts.v1.CreateTokenRequest
+	(*CreateTokenResponse)(nil),   // 4: workouts.v1.CreateTokenResponse
+	(*RevokeTokenRequest)(nil),    // 5: workouts.v1.RevokeTokenRequest
+	(*RevokeTokenResponse)(nil),   // 6: workouts.v1.RevokeTokenResponse
+	(*GetCurrentUserRequest)(nil), // 7: workouts.v1.GetCurrentUserRequest
+	(*GetWorkoutRequest)(nil),     // 8: workouts.v1.GetWorkoutRequest
+	(*ListWorkoutsRequest)(nil),   // 9: workouts.v1.ListWorkoutsRequest
+	(*ListWorkoutsResponse)(nil),  // 10: workouts.v1.ListWorkoutsResponse
+	(*CreateWorkoutRequest)(nil),  // 11: workouts.v1.CreateWorkoutRequest
+	(*UpdateWorkoutRequest)(nil),  // 12: workouts.v1.UpdateWorkoutRequest
+	(*DeleteWorkoutRequest)(nil),  // 13: workouts.v1.DeleteWorkoutRequest
+	(*DeleteWorkoutResponse)(nil), // 14: workouts.v1.DeleteWorkoutResponse
+	(*timestamppb.Timestamp)(nil), // 15: google.protobuf.Timestamp
+}
+var file_workouts_proto_depIdxs = []int32{
+	15, // 0: workouts.v1.User.created_at:type_name -> google.protobuf.Timestamp
+	15, // 1: workouts.v1.Workout.planned_for:type_name -> google.protobuf.Timestamp
+	15, // 2: workouts.v1.Workout.updated_at:type_name -> google.protobuf.Timestamp
+	2,  // 3: workouts.v1.Workout.entries:type_name -> workouts.v1.WorkoutEntry
+	15, // 4: workouts.v1.CreateTokenResponse.expiry:type_name -> google.protobuf.Timestamp
+	1,  // 5: workouts.v1.ListWorkoutsResponse.workouts:type_name -> workouts.v1.Workout
+	1,  // 6: workouts.v1.CreateWorkoutRequest.workout:type_name -> workouts.v1.Workout
+	1,  // 7: workouts.v1.UpdateWorkoutRequest.workout:type_name -> workouts.v1.Workout
+	3,  // 8: workouts.v1.AuthService.CreateToken:input_type -> workouts.v1.CreateTokenRequest
+	5,  // 9: workouts.v1.AuthService.RevokeToken:input_type -> workouts.v1.RevokeTokenRequest
+	7,  // 10: workouts.v1.AuthService.GetCurrentUser:input_type -> workouts.v1.GetCurrentUserRequest
+	8,  // 11: workouts.v1.WorkoutService.GetWorkout:input_type -> workouts.v1.GetWorkoutRequest
+	9,  // 12: workouts.v1.WorkoutService.ListWorkouts:input_type -> workouts.v1.ListWorkoutsRequest
+	11, // 13: workouts.v1.WorkoutService.CreateWorkout:input_type -> workouts.v1.CreateWorkoutRequest
+	12, // 14: workouts.v1.WorkoutService.UpdateWorkout:input_type -> workouts.v1.UpdateWorkoutRequest
+	13, // 15: workouts.v1.WorkoutService.DeleteWorkout:input_type -> workouts.v1.DeleteWorkoutRequest
+	4,  // 16: workouts.v1.AuthService.CreateToken:output_type -> workouts.v1.CreateTokenResponse
+	6,  // 17: workouts.v1.AuthService.RevokeToken:output_type -> workouts.v1.RevokeTokenResponse
+	0,  // 18: workouts.v1.AuthService.GetCurrentUser:output_type -> workouts.v1.User
+	1,  // 19: workouts.v1.WorkoutService.GetWorkout:output_type -> workouts.v1.Workout
+	10, // 20: workouts.v1.WorkoutService.ListWorkouts:output_type -> workouts.v1.ListWorkoutsResponse
+	1,  // 21: workouts.v1.WorkoutService.CreateWorkout:output_type -> workouts.v1.Workout
+	1,  // 22: workouts.v1.WorkoutService.UpdateWorkout:output_type -> workouts.v1.Workout
+	14, // 23: workouts.v1.WorkoutService.DeleteWorkout:output_type -> workouts.v1.DeleteWorkoutResponse
+	16, // [16:24] is the sub-list for method output_type
+	8,  // [8:16] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_workouts_proto_init() }
+func file_workouts_proto_init() {
+	if File_workouts_proto != nil {
+		return
+	}
+	file_workouts_proto_msgTypes[2].OneofWrappers = []any{}
+	file_workouts_proto_msgTypes[12].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_workouts_proto_rawDesc), len(file_workouts_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_workouts_proto_goTypes,
+		DependencyIndexes: file_workouts_proto_depIdxs,
+		MessageInfos:      file_workouts_proto_msgTypes,
+	}.Build()
+	File_workouts_proto = out.File
+	file_workouts_proto_goTypes = nil
+	file_workouts_proto_depIdxs = nil
+}
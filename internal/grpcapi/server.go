@@ -0,0 +1,139 @@
+package grpcapi
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/grpcapi/pb"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/tokens"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+/*
+	gRPC server, for backend services that prefer typed RPCs to JSON. The services are defined in pb/workouts.proto and
+	implemented here over the same stores as the REST API. It listens on its own port, see main.go.
+	Reflection can be enabled (serve -grpc-reflection), so tools like grpcurl can list and call the services without the
+	.proto file. It's off by default: it describes the whole API to anyone who can reach the port.
+		grpcurl -plaintext -H "authorization: Bearer $TOKEN" localhost:9090 workouts.v1.WorkoutService/ListWorkouts
+*/
+
+// Calls that don't need a token
+var publicMethods = map[string]bool{
+	pb.AuthService_CreateToken_FullMethodName: true,
+}
+
+// NewServer returns a gRPC server with both services registered, and reflection if withReflection, ready to Serve
+func NewServer(workoutStore store.WorkoutStore, userStore store.UserStore, tokenStore store.TokenStore, auditLogger *audit.Logger, withReflection bool, logger *log.Logger) *grpc.Server {
+	auth := &authInterceptor{userStore: userStore, logger: logger}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(auth.unary),
+		grpc.ChainStreamInterceptor(auth.stream),
+	)
+	pb.RegisterAuthServiceServer(server, &authService{userStore: userStore, tokenStore: tokenStore, audit: auditLogger, logger: logger})
+	pb.RegisterWorkoutServiceServer(server, &workoutService{workoutStore: workoutStore, audit: auditLogger, logger: logger})
+	if withReflection {
+		reflection.Register(server)
+	}
+	return server
+}
+
+/*
+	authInterceptor does for gRPC calls what UserMiddleware.Authenticate and RequireUser do for HTTP requests: it reads
+	the bearer token from the "authorization" metadata and puts its user in the context (see middleware.GetUserFromContext).
+	Calls without a valid token are rejected, except to publicMethods and to reflection.
+*/
+
+type authInterceptor struct {
+	userStore store.UserStore
+	logger    *log.Logger
+}
+
+func (a *authInterceptor) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *authInterceptor) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+func (a *authInterceptor) authenticate(ctx context.Context, method string) (context.Context, error) {
+	user, err := a.userFromMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsAnonymous() && !publicMethods[method] && !strings.HasPrefix(method, "/grpc.reflection.") {
+		return nil, status.Error(codes.Unauthenticated, "you must be authenticated to call this method")
+	}
+	return middleware.WithUser(ctx, user), nil
+}
+
+// userFromMetadata returns the user of the call's bearer token, or the anonymous user if there is none
+func (a *authInterceptor) userFromMetadata(ctx context.Context) (*store.User, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return store.AnonymousUser, nil
+	}
+
+	headerParts := strings.Split(values[0], " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization metadata format")
+	}
+	user, err := a.userStore.GetUserToken(tokens.ScopeAuth, headerParts[1])
+	if err != nil {
+		a.logger.Printf("gRPC: failed to retrieve user: %v", err)
+		return nil, status.Error(codes.Internal, "failed to retrieve user")
+	}
+	if user == nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
+	return user, nil
+}
+
+// authenticatedStream is a stream whose context has the user, since a stream's context can't be replaced otherwise
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// bearerToken returns the token a call was made with. The interceptor already checked its format.
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(values[0], "Bearer ")
+}
+
+// grpcAudit is the metadata of audit events recorded for gRPC calls, which have no HTTP request to take it from
+func grpcAudit(ctx context.Context, metadata map[string]interface{}) map[string]interface{} {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["via"] = "grpc"
+	if method, ok := grpc.Method(ctx); ok {
+		metadata["method"] = method
+	}
+	return metadata
+}
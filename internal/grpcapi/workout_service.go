@@ -0,0 +1,284 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/audit"
+	"github.com/OlivierCoq/go_api_template/internal/grpcapi/pb"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Workouts returned by ListWorkouts, when the request doesn't say and at most
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// workoutService serves the current user's workouts, with the same checks as WorkoutHandler
+type workoutService struct {
+	pb.UnimplementedWorkoutServiceServer
+	workoutStore store.WorkoutStore
+	audit        *audit.Logger
+	logger       *log.Logger
+}
+
+// internalError logs an unexpected error and returns the one the client sees
+func (s *workoutService) internalError(action string, err error) error {
+	s.logger.Printf("gRPC: failed to %s: %v", action, err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// ownWorkout returns a workout of the current user. Someone else's workout is simply not found.
+func (s *workoutService) ownWorkout(ctx context.Context, id int64) (*store.Workout, error) {
+	workout, err := s.workoutStore.GetWorkoutByID(id)
+	if err != nil {
+		return nil, s.internalError("fetch workout", err)
+	}
+	if workout == nil || workout.UserID != middleware.GetUserFromContext(ctx).ID {
+		return nil, status.Error(codes.NotFound, "workout not found")
+	}
+	return workout, nil
+}
+
+func (s *workoutService) GetWorkout(ctx context.Context, req *pb.GetWorkoutRequest) (*pb.Workout, error) {
+	workout, err := s.ownWorkout(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return toProto(workout), nil
+}
+
+func (s *workoutService) ListWorkouts(ctx context.Context, req *pb.ListWorkoutsRequest) (*pb.ListWorkoutsResponse, error) {
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	if limit < 0 || limit > maxListLimit {
+		return nil, status.Error(codes.InvalidArgument, "limit must be between 1 and 100")
+	}
+
+	currentUser := middleware.GetUserFromContext(ctx)
+	workouts, err := s.workoutStore.GetRecentWorkouts(currentUser.ID, limit)
+	if err != nil {
+		return nil, s.internalError("list workouts", err)
+	}
+	ids := make([]int64, len(workouts))
+	for i := range workouts {
+		ids[i] = int64(workouts[i].ID)
+	}
+	entries, err := s.workoutStore.GetEntriesForWorkouts(ids)
+	if err != nil {
+		return nil, s.internalError("list workout entries", err)
+	}
+
+	response := &pb.ListWorkoutsResponse{Workouts: make([]*pb.Workout, len(workouts))}
+	for i := range workouts {
+		workouts[i].Entries = entries[int64(workouts[i].ID)]
+		response.Workouts[i] = toProto(&workouts[i])
+	}
+	return response, nil
+}
+
+func (s *workoutService) CreateWorkout(ctx context.Context, req *pb.CreateWorkoutRequest) (*pb.Workout, error) {
+	currentUser := middleware.GetUserFromContext(ctx)
+	workout, err := fromProto(req.Workout)
+	if err != nil {
+		return nil, err
+	}
+	workout.UserID = currentUser.ID
+
+	createdWorkout, err := s.workoutStore.CreateWorkout(workout)
+	if errors.Is(err, store.ErrInvalidUUID) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, s.internalError("create workout", err)
+	}
+
+	s.audit.Record(nil, audit.Event{
+		ActorID:    currentUser.ID,
+		Action:     audit.ActionWorkoutCreated,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: createdWorkout.ID,
+		After:      createdWorkout,
+		Metadata:   grpcAudit(ctx, nil),
+	})
+	return toProto(createdWorkout), nil
+}
+
+func (s *workoutService) UpdateWorkout(ctx context.Context, req *pb.UpdateWorkoutRequest) (*pb.Workout, error) {
+	if req.Workout == nil {
+		return nil, status.Error(codes.InvalidArgument, "workout is required")
+	}
+	before, err := s.ownWorkout(ctx, req.Workout.Id)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpectedVersion != nil && int(*req.ExpectedVersion) != before.Version {
+		return nil, status.Error(codes.FailedPrecondition, store.ErrVersionConflict.Error())
+	}
+
+	workout, err := fromProto(req.Workout)
+	if err != nil {
+		return nil, err
+	}
+	workout.ID = before.ID
+	workout.UUID = before.UUID
+	workout.UserID = before.UserID
+	workout.Version = before.Version
+
+	err = s.workoutStore.UpdateWorkout(workout)
+	if errors.Is(err, store.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, "the workout was modified by another request, please retry")
+	}
+	if errors.Is(err, store.ErrInvalidUUID) || errors.Is(err, store.ErrInvalidEntries) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, s.internalError("update workout", err)
+	}
+
+	s.audit.Record(nil, audit.Event{
+		ActorID:    workout.UserID,
+		Action:     audit.ActionWorkoutUpdated,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: workout.ID,
+		Before:     before,
+		After:      workout,
+		Metadata:   grpcAudit(ctx, nil),
+	})
+	return toProto(workout), nil
+}
+
+func (s *workoutService) DeleteWorkout(ctx context.Context, req *pb.DeleteWorkoutRequest) (*pb.DeleteWorkoutResponse, error) {
+	workout, err := s.ownWorkout(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	err = s.workoutStore.DeleteWorkout(req.Id, workout.Version)
+	if errors.Is(err, store.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, "the workout was modified by another request, please retry")
+	}
+	if err != nil {
+		return nil, s.internalError("delete workout", err)
+	}
+
+	s.audit.Record(nil, audit.Event{
+		ActorID:    workout.UserID,
+		Action:     audit.ActionWorkoutDeleted,
+		Resource:   audit.ResourceWorkout,
+		ResourceID: workout.ID,
+		Before:     workout,
+		Metadata:   grpcAudit(ctx, nil),
+	})
+	return &pb.DeleteWorkoutResponse{}, nil
+}
+
+// Conversions between the store's types and the protobuf messages
+
+func toProto(workout *store.Workout) *pb.Workout {
+	message := &pb.Workout{
+		Id:              int64(workout.ID),
+		Uuid:            workout.UUID,
+		Title:           workout.Title,
+		Description:     workout.Description,
+		DurationMinutes: int32(workout.DurationMinutes),
+		CaloriesBurned:  int32(workout.CaloriesBurned),
+		Status:          workout.Status,
+		Version:         int32(workout.Version),
+		UpdatedAt:       timestamppb.New(workout.UpdatedAt),
+		Entries:         make([]*pb.WorkoutEntry, len(workout.Entries)),
+	}
+	if workout.PlannedFor != nil {
+		message.PlannedFor = timestamppb.New(*workout.PlannedFor)
+	}
+	for i, entry := range workout.Entries {
+		message.Entries[i] = &pb.WorkoutEntry{
+			Id:              int64(entry.ID),
+			Uuid:            entry.UUID,
+			ExerciseName:    entry.ExerciseName,
+			Sets:            int32(entry.Sets),
+			Reps:            int32Ptr(entry.Reps),
+			DurationSeconds: int32Ptr(entry.DurationSeconds),
+			Weight:          entry.Weight,
+			Notes:           entry.Notes,
+			OrderIndex:      int32(entry.OrderIndex),
+		}
+	}
+	return message
+}
+
+// fromProto converts and validates a workout sent by a client. Fields set by the server (ID, version...) are left out.
+func fromProto(message *pb.Workout) (*store.Workout, error) {
+	if message == nil {
+		return nil, status.Error(codes.InvalidArgument, "workout is required")
+	}
+	if message.Title == "" {
+		return nil, status.Error(codes.InvalidArgument, "title is required")
+	}
+	if message.Status != "" && !store.IsValidWorkoutStatus(message.Status) {
+		return nil, status.Error(codes.InvalidArgument, "status must be one of planned, completed or skipped")
+	}
+
+	workout := &store.Workout{
+		UUID:            message.Uuid,
+		Title:           message.Title,
+		Description:     message.Description,
+		DurationMinutes: int(message.DurationMinutes),
+		CaloriesBurned:  int(message.CaloriesBurned),
+		Status:          message.Status,
+		Entries:         make([]store.WorkoutEntry, len(message.Entries)),
+	}
+	if message.PlannedFor != nil {
+		plannedFor := message.PlannedFor.AsTime()
+		workout.PlannedFor = &plannedFor
+	}
+	for i, entry := range message.Entries {
+		if entry.ExerciseName == "" {
+			return nil, status.Error(codes.InvalidArgument, "exercise_name is required")
+		}
+		if entry.Sets < 0 {
+			return nil, status.Error(codes.InvalidArgument, "sets cannot be negative")
+		}
+		if (entry.Reps == nil) == (entry.DurationSeconds == nil) {
+			return nil, status.Error(codes.InvalidArgument, "an entry needs either reps or duration_seconds")
+		}
+		workout.Entries[i] = store.WorkoutEntry{
+			ID:              int(entry.Id), // Keeps existing entries on update, see saveEntries
+			UUID:            entry.Uuid,
+			ExerciseName:    entry.ExerciseName,
+			Sets:            int(entry.Sets),
+			Reps:            intPtr(entry.Reps),
+			DurationSeconds: intPtr(entry.DurationSeconds),
+			Weight:          entry.Weight,
+			Notes:           entry.Notes,
+			OrderIndex:      int(entry.OrderIndex),
+		}
+	}
+	// Let the store stamp the time of the change
+	workout.UpdatedAt = time.Time{}
+	return workout, nil
+}
+
+func int32Ptr(value *int) *int32 {
+	if value == nil {
+		return nil
+	}
+	converted := int32(*value)
+	return &converted
+}
+
+func intPtr(value *int32) *int {
+	if value == nil {
+		return nil
+	}
+	converted := int(*value)
+	return &converted
+}
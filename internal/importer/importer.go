@@ -0,0 +1,464 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+)
+
+/*
+	The importer turns CSV files into workouts. Two kinds of files are supported:
+	- Generic CSV ("csv" format): the client sends a Mapping saying which column holds which field, one row per exercise.
+	- Exports from other fitness apps ("strong" and "hevy" formats): those have one row per *set*, with known column names.
+	  They're just predefined Mappings with SetPerRow turned on.
+
+	Rows are grouped into workouts by external ID when there is one, otherwise by date + title.
+	Parsing never stops at the first bad row: every problem is collected as a RowError, and workouts containing a bad row are left out,
+	so the client gets the full list of things to fix in one go (which is what dry runs are for).
+*/
+
+// Supported import formats
+const (
+	FormatCSV    = "csv"
+	FormatStrong = "strong"
+	FormatHevy   = "hevy"
+)
+
+// Field names that can be used as keys of Mapping.Columns
+const (
+	FieldExternalID      = "external_id"
+	FieldDate            = "date"
+	FieldEndTime         = "end_time" // Used to compute the duration when the file has no duration column (Hevy)
+	FieldTitle           = "title"
+	FieldDescription     = "description"
+	FieldDurationMinutes = "duration_minutes"
+	FieldCaloriesBurned  = "calories_burned"
+	FieldExerciseName    = "exercise_name"
+	FieldSets            = "sets"
+	FieldReps            = "reps"
+	FieldWeight          = "weight"
+	FieldDurationSeconds = "duration_seconds"
+	FieldNotes           = "notes"
+)
+
+var knownFields = map[string]bool{
+	FieldExternalID: true, FieldDate: true, FieldEndTime: true, FieldTitle: true, FieldDescription: true,
+	FieldDurationMinutes: true, FieldCaloriesBurned: true, FieldExerciseName: true, FieldSets: true,
+	FieldReps: true, FieldWeight: true, FieldDurationSeconds: true, FieldNotes: true,
+}
+
+// Mapping describes how the columns of a CSV file map onto workout fields.
+type Mapping struct {
+	Columns    map[string]string `json:"columns"`     // Field name => CSV header, e.g. {"title": "Workout Name"}
+	DateFormat string            `json:"date_format"` // Go time layout of the date columns. RFC 3339 and a few common layouts are tried when empty
+	SetPerRow  bool              `json:"set_per_row"` // Each row is a single set (like Strong/Hevy exports) instead of a whole exercise
+}
+
+// Strong exports one row per set. Date looks like "2023-01-15 08:30:00" and Duration like "1h 5m".
+var strongMapping = Mapping{
+	Columns: map[string]string{
+		FieldDate:            "Date",
+		FieldTitle:           "Workout Name",
+		FieldDurationMinutes: "Duration",
+		FieldExerciseName:    "Exercise Name",
+		FieldWeight:          "Weight",
+		FieldReps:            "Reps",
+		FieldDurationSeconds: "Seconds",
+		FieldNotes:           "Notes",
+		FieldDescription:     "Workout Notes",
+	},
+	DateFormat: "2006-01-02 15:04:05",
+	SetPerRow:  true,
+}
+
+// Hevy also exports one row per set, with start and end times instead of a duration. Dates look like "15 Jan 2023, 08:30".
+var hevyMapping = Mapping{
+	Columns: map[string]string{
+		FieldDate:            "start_time",
+		FieldEndTime:         "end_time",
+		FieldTitle:           "title",
+		FieldDescription:     "description",
+		FieldExerciseName:    "exercise_title",
+		FieldNotes:           "exercise_notes",
+		FieldWeight:          "weight_kg",
+		FieldReps:            "reps",
+		FieldDurationSeconds: "duration_seconds",
+	},
+	DateFormat: "2 Jan 2006, 15:04",
+	SetPerRow:  true,
+}
+
+// Layouts tried when a generic mapping doesn't specify a DateFormat
+var defaultDateFormats = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// RowError is a problem found on one row of the file. Row is the line number as shown in a spreadsheet (the header is row 1).
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Result is the outcome of parsing a file: the valid workouts, ready to be stored, and the errors of the invalid rows.
+type Result struct {
+	Workouts []*store.Workout
+	Errors   []RowError
+}
+
+// MappingFor returns the mapping to use for a format. For the generic csv format, the client's mapping is validated and returned.
+func MappingFor(format string, custom *Mapping) (*Mapping, error) {
+	switch format {
+	case FormatStrong:
+		return &strongMapping, nil
+	case FormatHevy:
+		return &hevyMapping, nil
+	case FormatCSV:
+		if custom == nil || len(custom.Columns) == 0 {
+			return nil, errors.New("the csv format requires a column mapping")
+		}
+		for field := range custom.Columns {
+			if !knownFields[field] {
+				return nil, fmt.Errorf("unknown field %q in column mapping", field)
+			}
+		}
+		if custom.Columns[FieldTitle] == "" || custom.Columns[FieldExerciseName] == "" {
+			return nil, errors.New("the column mapping must include at least title and exercise_name")
+		}
+		return custom, nil
+	}
+	return nil, fmt.Errorf("unsupported import format %q (expected csv, strong or hevy)", format)
+}
+
+// Parse reads a CSV file in the given format and builds the workouts of userID from it.
+// An error is only returned when the file can't be read at all (bad format, mapping or CSV syntax); row level problems end up in Result.Errors.
+func Parse(r io.Reader, format string, custom *Mapping, userID int) (*Result, error) {
+	mapping, err := MappingFor(format, custom)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // Tolerate rows with a different number of columns, missing ones are treated as empty
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	// Find the index of every mapped column in the header. Spreadsheet apps sometimes start files with a byte order mark, which we ignore.
+	columnIndex := make(map[string]int, len(mapping.Columns))
+	for field, column := range mapping.Columns {
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")), column) {
+				columnIndex[field] = i
+				break
+			}
+		}
+	}
+	for _, required := range []string{FieldTitle, FieldExerciseName} {
+		if _, ok := columnIndex[required]; !ok {
+			return nil, fmt.Errorf("column %q (for %s) not found in the CSV header", mapping.Columns[required], required)
+		}
+	}
+
+	p := &parser{
+		mapping:     mapping,
+		format:      format,
+		userID:      userID,
+		columnIndex: columnIndex,
+		groups:      map[string]*group{},
+	}
+
+	rowNumber := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		rowNumber++
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row %d: %w", rowNumber, err)
+		}
+		p.addRow(rowNumber, record)
+	}
+
+	return p.result(), nil
+}
+
+// group collects the rows belonging to the same workout
+type group struct {
+	workout *store.Workout
+	invalid bool
+}
+
+type parser struct {
+	mapping     *Mapping
+	format      string
+	userID      int
+	columnIndex map[string]int
+	groups      map[string]*group
+	order       []string // Keys of groups in the order they appear, so workouts are imported in file order
+	errors      []RowError
+}
+
+func (p *parser) value(record []string, field string) string {
+	i, ok := p.columnIndex[field]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func (p *parser) fail(row int, format string, args ...interface{}) {
+	p.errors = append(p.errors, RowError{Row: row, Error: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) addRow(row int, record []string) {
+	// Skip blank lines
+	if strings.TrimSpace(strings.Join(record, "")) == "" {
+		return
+	}
+
+	title := p.value(record, FieldTitle)
+	rawDate := p.value(record, FieldDate)
+	externalID := p.value(record, FieldExternalID)
+
+	// Find (or start) the workout this row belongs to
+	key := "id:" + externalID
+	if externalID == "" {
+		key = "date:" + rawDate + "|title:" + title
+		// Exports from other apps have no ID column, so we derive one. Importing the same file twice then doesn't create duplicates.
+		if p.format != FormatCSV {
+			externalID = fmt.Sprintf("%s:%s:%s", p.format, rawDate, title)
+		}
+	}
+	g, ok := p.groups[key]
+	if !ok {
+		workout, err := p.parseWorkout(record, title, rawDate, externalID)
+		g = &group{workout: workout}
+		p.groups[key] = g
+		p.order = append(p.order, key)
+		if err != nil {
+			p.fail(row, "%v", err)
+			g.invalid = true
+			return
+		}
+	}
+
+	if p.value(record, FieldExerciseName) == "" {
+		// Workout-only row (no exercise on it), nothing else to do
+		return
+	}
+	entry, err := p.parseEntry(record)
+	if err != nil {
+		p.fail(row, "%v", err)
+		g.invalid = true
+		return
+	}
+	if g.invalid {
+		return
+	}
+
+	/*
+		In set-per-row files, consecutive identical sets (same exercise, reps, duration and weight) are merged into one entry with Sets incremented.
+		A set with a different weight or rep count becomes its own entry, since an entry only has one weight and one rep count.
+	*/
+	entries := g.workout.Entries
+	if p.mapping.SetPerRow && len(entries) > 0 && sameSet(&entries[len(entries)-1], entry) {
+		entries[len(entries)-1].Sets++
+		return
+	}
+	entry.OrderIndex = len(entries) + 1
+	g.workout.Entries = append(entries, *entry)
+}
+
+func (p *parser) parseWorkout(record []string, title, rawDate, externalID string) (*store.Workout, error) {
+	workout := &store.Workout{
+		UserID:      p.userID,
+		Title:       title,
+		Description: p.value(record, FieldDescription),
+		Status:      store.WorkoutStatusCompleted,
+		Entries:     []store.WorkoutEntry{},
+	}
+	if title == "" {
+		return workout, errors.New("title is required")
+	}
+	if len(title) > 100 {
+		return workout, errors.New("title must be at most 100 characters")
+	}
+	if externalID != "" {
+		if len(externalID) > 255 {
+			return workout, errors.New("external_id must be at most 255 characters")
+		}
+		workout.ExternalID = &externalID
+	}
+
+	// Imported workouts are history: the date they were done on goes in PlannedFor, so they show up on the right day in the calendar
+	if rawDate != "" {
+		date, err := p.parseDate(rawDate)
+		if err != nil {
+			return workout, err
+		}
+		workout.PlannedFor = &date
+
+		if rawEnd := p.value(record, FieldEndTime); rawEnd != "" && p.value(record, FieldDurationMinutes) == "" {
+			end, err := p.parseDate(rawEnd)
+			if err != nil {
+				return workout, err
+			}
+			workout.DurationMinutes = int(end.Sub(date).Minutes())
+		}
+	}
+
+	if raw := p.value(record, FieldDurationMinutes); raw != "" {
+		minutes, err := parseDurationMinutes(raw)
+		if err != nil {
+			return workout, err
+		}
+		workout.DurationMinutes = minutes
+	}
+	if raw := p.value(record, FieldCaloriesBurned); raw != "" {
+		calories, err := strconv.Atoi(raw)
+		if err != nil || calories < 0 {
+			return workout, fmt.Errorf("invalid calories_burned %q", raw)
+		}
+		workout.CaloriesBurned = calories
+	}
+	return workout, nil
+}
+
+func (p *parser) parseEntry(record []string) (*store.WorkoutEntry, error) {
+	entry := &store.WorkoutEntry{
+		ExerciseName: p.value(record, FieldExerciseName),
+		Sets:         1,
+		Notes:        p.value(record, FieldNotes),
+	}
+	if len(entry.ExerciseName) > 255 {
+		return nil, errors.New("exercise_name must be at most 255 characters")
+	}
+
+	if raw := p.value(record, FieldSets); raw != "" && !p.mapping.SetPerRow {
+		sets, err := strconv.Atoi(raw)
+		if err != nil || sets < 1 {
+			return nil, fmt.Errorf("invalid sets %q", raw)
+		}
+		entry.Sets = sets
+	}
+
+	var err error
+	entry.Reps, err = p.parseOptionalInt(record, FieldReps)
+	if err != nil {
+		return nil, err
+	}
+	entry.DurationSeconds, err = p.parseOptionalInt(record, FieldDurationSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if raw := p.value(record, FieldWeight); raw != "" {
+		weight, err := strconv.ParseFloat(raw, 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q", raw)
+		}
+		// Other apps write 0 for bodyweight exercises
+		if weight > 0 || !p.mapping.SetPerRow {
+			entry.Weight = &weight
+		}
+	}
+
+	// Same rule as the valid_workout_entry constraint of the workout_entries table
+	if entry.Reps == nil && entry.DurationSeconds == nil {
+		return nil, errors.New("either reps or duration_seconds is required")
+	}
+	if entry.Reps != nil && entry.DurationSeconds != nil {
+		return nil, errors.New("reps and duration_seconds can't both be set")
+	}
+	return entry, nil
+}
+
+func (p *parser) parseOptionalInt(record []string, field string) (*int, error) {
+	raw := p.value(record, field)
+	if raw == "" {
+		return nil, nil
+	}
+	// Some apps write "10.0"
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil || f < 0 {
+		return nil, fmt.Errorf("invalid %s %q", field, raw)
+	}
+	// Set-per-row exports fill both reps and seconds, with 0 for the one that doesn't apply
+	if f == 0 && p.mapping.SetPerRow {
+		return nil, nil
+	}
+	i := int(f)
+	return &i, nil
+}
+
+func (p *parser) parseDate(raw string) (time.Time, error) {
+	if p.mapping.DateFormat != "" {
+		date, err := time.Parse(p.mapping.DateFormat, raw)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q (expected format %q)", raw, p.mapping.DateFormat)
+		}
+		return date, nil
+	}
+	for _, layout := range defaultDateFormats {
+		date, err := time.Parse(layout, raw)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", raw)
+}
+
+func (p *parser) result() *Result {
+	result := &Result{Workouts: []*store.Workout{}, Errors: p.errors}
+	for _, key := range p.order {
+		g := p.groups[key]
+		if !g.invalid {
+			result.Workouts = append(result.Workouts, g.workout)
+		}
+	}
+	if result.Errors == nil {
+		result.Errors = []RowError{}
+	}
+	return result
+}
+
+// sameSet reports whether a set has the same exercise, reps, duration and weight as an existing entry
+func sameSet(entry *store.WorkoutEntry, set *store.WorkoutEntry) bool {
+	return entry.ExerciseName == set.ExerciseName &&
+		equalIntPtr(entry.Reps, set.Reps) &&
+		equalIntPtr(entry.DurationSeconds, set.DurationSeconds) &&
+		equalFloatPtr(entry.Weight, set.Weight)
+}
+
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalFloatPtr(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// parseDurationMinutes accepts plain minutes ("45") as well as the "1h 5m" style used by Strong.
+func parseDurationMinutes(raw string) (int, error) {
+	if minutes, err := strconv.Atoi(raw); err == nil && minutes >= 0 {
+		return minutes, nil
+	}
+	d, err := time.ParseDuration(strings.ReplaceAll(raw, " ", ""))
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+	return int(d.Minutes()), nil
+}
@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStrong(t *testing.T) {
+	file := `Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+2023-01-15 08:30:00,Leg day,1h 5m,Squat (Barbell),1,100,5,0,0,,Felt strong,
+2023-01-15 08:30:00,Leg day,1h 5m,Squat (Barbell),2,100,5,0,0,,Felt strong,
+2023-01-15 08:30:00,Leg day,1h 5m,Squat (Barbell),3,110,3,0,0,,Felt strong,
+2023-01-15 08:30:00,Leg day,1h 5m,Plank,1,0,0,0,60,,Felt strong,
+2023-01-17 18:00:00,Push day,45m,Bench Press (Barbell),1,80,8,0,0,,,
+`
+	result, err := Parse(strings.NewReader(file), FormatStrong, nil, 7)
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	require.Len(t, result.Workouts, 2)
+
+	legDay := result.Workouts[0]
+	assert.Equal(t, 7, legDay.UserID)
+	assert.Equal(t, "Leg day", legDay.Title)
+	assert.Equal(t, "Felt strong", legDay.Description)
+	assert.Equal(t, 65, legDay.DurationMinutes)
+	require.NotNil(t, legDay.ExternalID)
+	assert.Equal(t, "strong:2023-01-15 08:30:00:Leg day", *legDay.ExternalID)
+
+	// Two identical sets are merged, the heavier set is its own entry, and the timed plank has no weight or reps
+	require.Len(t, legDay.Entries, 3)
+	assert.Equal(t, 2, legDay.Entries[0].Sets)
+	assert.Equal(t, 100.0, *legDay.Entries[0].Weight)
+	assert.Equal(t, 1, legDay.Entries[1].Sets)
+	assert.Equal(t, 3, *legDay.Entries[1].Reps)
+	assert.Nil(t, legDay.Entries[2].Reps)
+	assert.Nil(t, legDay.Entries[2].Weight)
+	assert.Equal(t, 60, *legDay.Entries[2].DurationSeconds)
+	assert.Equal(t, 3, legDay.Entries[2].OrderIndex)
+
+	assert.Equal(t, 45, result.Workouts[1].DurationMinutes)
+}
+
+func TestParseCSVWithMapping(t *testing.T) {
+	mapping := &Mapping{
+		Columns: map[string]string{
+			FieldExternalID:   "id",
+			FieldDate:         "day",
+			FieldTitle:        "name",
+			FieldExerciseName: "exercise",
+			FieldSets:         "sets",
+			FieldReps:         "reps",
+		},
+		DateFormat: "2006-01-02",
+	}
+	file := `id,day,name,exercise,sets,reps
+w1,2024-05-01,Morning,Push-ups,3,15
+w1,2024-05-01,Morning,Pull-ups,3,abc
+w2,2024-05-02,,Squats,3,10
+w3,05/03/2024,Evening,Lunges,2,12
+w4,2024-05-04,Night,Burpees,4,10
+`
+	result, err := Parse(strings.NewReader(file), FormatCSV, mapping, 1)
+	require.NoError(t, err)
+
+	// w1 has a bad row, w2 has no title and w3 a bad date: only w4 is valid
+	require.Len(t, result.Workouts, 1)
+	assert.Equal(t, "w4", *result.Workouts[0].ExternalID)
+	assert.Equal(t, 4, result.Workouts[0].Entries[0].Sets)
+
+	require.Len(t, result.Errors, 3)
+	assert.Equal(t, 3, result.Errors[0].Row)
+	assert.Contains(t, result.Errors[0].Error, "reps")
+	assert.Equal(t, 4, result.Errors[1].Row)
+	assert.Equal(t, 5, result.Errors[2].Row)
+}
+
+func TestParseRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		mapping *Mapping
+		file    string
+	}{
+		{name: "unknown format", format: "xlsx", file: "a,b\n"},
+		{name: "csv without mapping", format: FormatCSV, file: "a,b\n"},
+		{name: "mapping with unknown field", format: FormatCSV, mapping: &Mapping{Columns: map[string]string{"title": "a", "exercise_name": "b", "color": "c"}}, file: "a,b,c\n"},
+		{name: "mapped column missing from header", format: FormatStrong, file: "Date,Reps\n"},
+		{name: "empty file", format: FormatHevy, file: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.file), tt.format, tt.mapping, 1)
+			assert.Error(t, err)
+		})
+	}
+}
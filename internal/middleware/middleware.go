@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/OlivierCoq/go_api_template/internal/tokens"
 	"github.com/OlivierCoq/go_api_template/internal/utils"
 )
 
@@ -28,8 +29,12 @@ const userContextKey = contextKey("user")
 func SetUser(r *http.Request, user *store.User) *http.Request {
 	// Insert user into context property of the request. Every http request has a context property:
 	// We will do this even with anonymous users, so that downstream handlers can always expect a user to be present in the context.
-	ctx := context.WithValue(r.Context(), userContextKey, user)
-	return r.WithContext(ctx)
+	return r.WithContext(WithUser(r.Context(), user))
+}
+
+// WithUser is SetUser for code that has a context rather than a request, e.g. gRPC calls
+func WithUser(ctx context.Context, user *store.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
 }
 
 // Log off user:
@@ -45,8 +50,13 @@ func (um *UserMiddleware) Logout(next http.Handler) http.Handler {
 
 // get user from context:
 func GetUser(r *http.Request) *store.User {
+	return GetUserFromContext(r.Context())
+}
+
+// GetUserFromContext is GetUser for code that only has the request's context, e.g. GraphQL resolvers
+func GetUserFromContext(ctx context.Context) *store.User {
 	// So now, we can retrieve the user from the context:
-	user, ok := r.Context().Value(userContextKey).(*store.User)
+	user, ok := ctx.Value(userContextKey).(*store.User)
 	if !ok {
 		panic("missing user in request") // bad actor call. This could be a hacker trying to access a protected route without authentication.
 	}
@@ -95,6 +105,35 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	})
 }
 
+/*
+	AuthenticateRealtime is Authenticate for the live update routes, which browsers open without being able to set
+	headers (EventSource, WebSocket). Without an Authorization header, the token can be passed as ?access_token=...,
+	but only a realtime token (see POST /tokens/realtime): URLs end up in logs, so the token in them is short-lived and
+	opens live update connections, nothing else.
+*/
+
+func (um *UserMiddleware) AuthenticateRealtime(next http.Handler) http.Handler {
+	authenticate := um.Authenticate(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+		if token == "" || r.Header.Get("Authorization") != "" {
+			authenticate.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := um.UserStore.GetUserToken(tokens.ScopeRealtime, token)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve user"})
+			return
+		}
+		if user == nil {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired token"})
+			return
+		}
+		next.ServeHTTP(w, SetUser(r, user))
+	})
+}
+
 // Handler function from routes to protect routes that require authentication:
 func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -106,3 +145,15 @@ func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Handler function from routes to protect routes that only admins can access:
+func (um *UserMiddleware) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+		if !user.IsAdmin {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you must be an admin to access this resource"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
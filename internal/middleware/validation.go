@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/OlivierCoq/go_api_template/internal/openapi"
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// Largest JSON body the validator reads. Bigger requests get a 413 before reaching the handler.
+const maxValidatedBody = 10 << 20 // 10 MB
+
+/*
+	RequestValidator checks requests against the OpenAPI document (see api.OpenAPISpec) before handlers run: path
+	parameters, query parameters and JSON bodies. Invalid requests get a 400 listing every problem:
+		{
+			"error": "Invalid request",
+			"details": [
+				{"in": "path", "field": "id", "message": "must be an integer"},
+				{"in": "body", "field": "entries[0].reps", "message": "must be an integer or null"}
+			]
+		}
+	Handlers still do their own checks (e.g. that an entry has reps or a duration), this only covers what the spec says.
+	Routes that aren't in the spec are let through untouched.
+*/
+
+type RequestValidator struct {
+	Spec *openapi.Document
+
+	// ResponseDrift, when set, is called for every response that doesn't match the spec (undocumented status, body
+	// of the wrong shape...). Responses are buffered to be checked, so only set it in tests, e.g. to t.Errorf.
+	ResponseDrift func(r *http.Request, err error)
+}
+
+func (v *RequestValidator) Validate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// This runs before routing, so ask the router which route the request is for. When the routes are mounted
+		// under a prefix (e.g. /v1), the spec has them without it.
+		match := chi.NewRouteContext()
+		pattern := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.Routes != nil {
+			pattern = rctx.Routes.Find(match, r.Method, r.URL.Path)
+			pattern = strings.TrimPrefix(pattern, strings.TrimSuffix(rctx.RoutePattern(), "/*"))
+		}
+		op := v.Spec.FindOperation(r.Method, pattern)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if v.ResponseDrift != nil {
+			recorder := &responseRecorder{ResponseWriter: w}
+			defer func() {
+				if recorder.status == 0 {
+					return // Hijacked, e.g. by a WebSocket
+				}
+				err := v.Spec.ValidateResponse(op, recorder.status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+				if err != nil {
+					v.ResponseDrift(r, fmt.Errorf("%s %s: %w", r.Method, pattern, err))
+				}
+			}()
+			w = recorder
+		}
+
+		var problems []openapi.ValidationError
+		for _, param := range op.Parameters {
+			switch param.In {
+			case "path":
+				value := match.URLParam(param.Name)
+				problems = append(problems, v.Spec.ValidateParameter(param, value, value != "")...)
+			case "query":
+				values, present := r.URL.Query()[param.Name]
+				value := ""
+				if present {
+					value = values[0]
+				}
+				problems = append(problems, v.Spec.ValidateParameter(param, value, present)...)
+			}
+		}
+
+		if op.RequestBody != nil {
+			if content, ok := op.RequestBody.Content["application/json"]; ok {
+				body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValidatedBody))
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "Request body is too large"}) // 413
+					return
+				}
+				if err != nil {
+					utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Failed to read request body"}) // 400
+					return
+				}
+				// Put the body back for the handler
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				problems = append(problems, v.validateBody(content.Schema, op.RequestBody.Required, body)...)
+			}
+		}
+
+		if len(problems) > 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request", "details": problems}) // 400
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (v *RequestValidator) validateBody(schema *openapi.Schema, required bool, body []byte) []openapi.ValidationError {
+	if len(bytes.TrimSpace(body)) == 0 {
+		if required {
+			return []openapi.ValidationError{{In: "body", Message: "is required"}}
+		}
+		return nil
+	}
+	value, err := openapi.DecodeJSON(body)
+	if err != nil {
+		return []openapi.ValidationError{{In: "body", Message: "must be valid JSON: " + err.Error()}}
+	}
+	return v.Spec.ValidateValue(schema, value, "body", "")
+}
+
+// responseRecorder keeps a copy of what's written, for RequestValidator.ResponseDrift
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the real writer, to flush streams and hijack WebSockets
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/openapi"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testWorkout struct {
+	Title    string `json:"title"`
+	Duration *int   `json:"duration"`
+}
+
+func testSpec() *openapi.Document {
+	g := openapi.NewGenerator()
+	max := 100.0
+	id := &openapi.Parameter{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer"}}
+	workout := &openapi.Response{Description: "OK", Content: map[string]openapi.MediaType{"application/json": {Schema: openapi.Object(map[string]*openapi.Schema{"title": {Type: "string"}})}}}
+	return &openapi.Document{
+		Paths: map[string]*openapi.PathItem{
+			"/workouts/{id}": {"patch": {
+				Parameters: []*openapi.Parameter{id, {Name: "limit", In: "query", Schema: &openapi.Schema{Type: "integer", Maximum: &max}}},
+				RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+					"application/json": {Schema: openapi.Require(g.SchemaFor(testWorkout{}), "title")},
+				}},
+				Responses: map[string]*openapi.Response{"200": workout},
+			}},
+		},
+		Components: openapi.Components{Schemas: g.Schemas},
+	}
+}
+
+func testRouter(validator *RequestValidator, handler http.HandlerFunc) http.Handler {
+	r := chi.NewRouter()
+	r.Use(validator.Validate)
+	r.Patch("/workouts/{id}", handler)
+	r.Get("/health", handler)
+	return r
+}
+
+func TestValidateRequests(t *testing.T) {
+	var received string
+	router := testRouter(&RequestValidator{Spec: testSpec()}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(http.MethodPatch, "/workouts/12?limit=5", `{"title": "Legs", "duration": null}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"title": "Legs", "duration": null}`, received, "the handler gets the body")
+
+	rec = serve(http.MethodPatch, "/workouts/abc?limit=500", `{"duration": "long"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	var response struct {
+		Error   string                    `json:"error"`
+		Details []openapi.ValidationError `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, []openapi.ValidationError{
+		{In: "path", Field: "id", Message: "must be an integer"},
+		{In: "query", Field: "limit", Message: "must be at most 100"},
+		{In: "body", Field: "title", Message: "is required"},
+		{In: "body", Field: "duration", Message: "must be an integer or null"},
+	}, response.Details)
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPatch, "/workouts/1", "").Code, "the body is required")
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPatch, "/workouts/1", "{").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/health", "").Code, "routes without a spec entry are let through")
+}
+
+func TestValidateResponses(t *testing.T) {
+	var drift []error
+	validator := &RequestValidator{Spec: testSpec(), ResponseDrift: func(r *http.Request, err error) { drift = append(drift, err) }}
+
+	respond := func(status int, body string) {
+		drift = nil
+		router := testRouter(validator, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+		})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, "/workouts/1", strings.NewReader(`{"title": "Legs"}`)))
+	}
+
+	respond(http.StatusOK, `{"title": "Legs"}`)
+	assert.Empty(t, drift)
+	respond(http.StatusOK, `{"name": "Legs"}`)
+	require.Len(t, drift, 1)
+	assert.ErrorContains(t, drift[0], "PATCH /workouts/{id}: body of status 200 doesn't match the spec: body title: is required")
+	respond(http.StatusTeapot, `{}`)
+	require.Len(t, drift, 1)
+	assert.ErrorContains(t, drift[0], "status 418 is not documented")
+}
@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+)
+
+/*
+	API versions. The routes are mounted once per version (/v1/workouts, /v2/workouts...) and once more at the root for
+	apps that predate versioning. Handlers only speak one shape (v1's); the other versions are adapters that rewrite
+	JSON request bodies into it and responses out of it, so a field can be renamed without breaking old apps.
+
+	The version is picked from the path. On the unversioned routes it can also be asked for with the Accept header:
+		Accept: application/vnd.workouts.v2+json
+	Unversioned requests without it get the legacy version, with Deprecation and Sunset headers telling clients to move.
+*/
+
+const versionContextKey = contextKey("api_version")
+
+var acceptVersionRegex = regexp.MustCompile(`application/vnd\.workouts\.(v[0-9]+)\+json`)
+
+type APIVersion struct {
+	Name string // e.g. v2: the path prefix, and what the Accept header asks for
+
+	// Rewrite decoded JSON bodies from this version's shape to the handlers' (requests) and back (responses).
+	// nil when the version is the handlers' own.
+	AdaptRequest  func(body interface{}) interface{}
+	AdaptResponse func(body interface{}) interface{}
+}
+
+// GetAPIVersion returns the version a request is served as, or "" outside of the versioned routes
+func GetAPIVersion(r *http.Request) string {
+	version, _ := r.Context().Value(versionContextKey).(string)
+	return version
+}
+
+// Serve is the middleware of the routes mounted for this version
+func (v APIVersion) Serve(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v.serve(w, r, next)
+	})
+}
+
+func (v APIVersion) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	w.Header().Set("API-Version", v.Name)
+	r = r.WithContext(context.WithValue(r.Context(), versionContextKey, v.Name))
+
+	if v.AdaptRequest != nil && r.Body != nil && !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValidatedBody))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "Request body is too large"}) // 413
+			return
+		}
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Failed to read request body"}) // 400
+			return
+		}
+		// Bodies that aren't JSON are left for the handler (or the validator) to reject
+		if value, err := decodeJSON(body); err == nil {
+			if adapted, err := json.Marshal(v.AdaptRequest(value)); err == nil {
+				body = adapted
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+
+	if v.AdaptResponse == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+	writer := &adaptingWriter{ResponseWriter: w, adapt: v.AdaptResponse}
+	next.ServeHTTP(writer, r)
+	writer.finish()
+}
+
+/*
+	LegacyVersions serves the unversioned routes: as the version the Accept header asks for, if any, and otherwise as
+	Legacy, with the headers of RFC 9745 and RFC 8594 announcing when the unversioned routes go away:
+		Deprecation: @1793491200
+		Sunset: Sat, 01 May 2027 00:00:00 GMT
+		Link: </v1/workouts>; rel="successor-version"
+*/
+
+type LegacyVersions struct {
+	Versions     []APIVersion
+	Legacy       APIVersion // What old apps get
+	DeprecatedAt time.Time
+	SunsetAt     time.Time
+}
+
+func (l *LegacyVersions) Negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if match := acceptVersionRegex.FindStringSubmatch(r.Header.Get("Accept")); match != nil {
+			for _, version := range l.Versions {
+				if version.Name == match[1] {
+					version.serve(w, r, next)
+					return
+				}
+			}
+			names := make([]string, len(l.Versions))
+			for i, version := range l.Versions {
+				names[i] = version.Name
+			}
+			utils.WriteJSON(w, http.StatusNotAcceptable, utils.Envelope{"error": fmt.Sprintf("unknown API version %s, supported versions: %s", match[1], strings.Join(names, ", "))}) // 406
+			return
+		}
+
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", l.DeprecatedAt.Unix()))
+		w.Header().Set("Sunset", l.SunsetAt.UTC().Format(http.TimeFormat))
+		w.Header().Add("Link", fmt.Sprintf(`</%s%s>; rel="successor-version"`, l.Legacy.Name, r.URL.Path))
+		l.Legacy.serve(w, r, next)
+	})
+}
+
+/*
+	adaptingWriter holds back JSON responses to pass them through AdaptResponse once the handler is done. Anything else
+	(event streams, calendar feeds, CSV exports, WebSockets) goes straight through, and so do files to download
+	(Content-Disposition: attachment) and responses the handler flushes: they're streamed, possibly for longer and
+	larger than is reasonable to hold in memory, and they're in the handlers' shape whatever the version.
+*/
+
+type adaptingWriter struct {
+	http.ResponseWriter
+	adapt       func(body interface{}) interface{}
+	wroteHeader bool
+	buffering   bool
+	status      int
+	body        bytes.Buffer
+}
+
+func (aw *adaptingWriter) WriteHeader(status int) {
+	if aw.wroteHeader {
+		return
+	}
+	aw.wroteHeader = true
+	mediaType, _, _ := mime.ParseMediaType(aw.Header().Get("Content-Type"))
+	disposition, _, _ := mime.ParseMediaType(aw.Header().Get("Content-Disposition"))
+	if mediaType == "application/json" && disposition != "attachment" {
+		aw.buffering = true
+		aw.status = status
+		return
+	}
+	aw.ResponseWriter.WriteHeader(status)
+}
+
+func (aw *adaptingWriter) Write(b []byte) (int, error) {
+	if !aw.wroteHeader {
+		aw.WriteHeader(http.StatusOK)
+	}
+	if aw.buffering {
+		return aw.body.Write(b)
+	}
+	return aw.ResponseWriter.Write(b)
+}
+
+// FlushError is what http.ResponseController.Flush calls. A handler flushing is streaming its response: what's held back
+// so far is sent as it is, and the rest goes straight through.
+func (aw *adaptingWriter) FlushError() error {
+	aw.wroteHeader = true // Flushing sends the headers, if they weren't already
+	if aw.buffering {
+		aw.buffering = false
+		aw.ResponseWriter.WriteHeader(aw.status)
+		_, err := aw.ResponseWriter.Write(aw.body.Bytes())
+		aw.body.Reset()
+		if err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(aw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the real writer, to flush streams and hijack WebSockets
+func (aw *adaptingWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
+
+// finish writes the adapted response, once the handler is done
+func (aw *adaptingWriter) finish() {
+	if !aw.buffering {
+		return
+	}
+	body := aw.body.Bytes()
+	if value, err := decodeJSON(body); err == nil {
+		// Indented like utils.WriteJSON
+		if adapted, err := json.MarshalIndent(aw.adapt(value), "", "  "); err == nil {
+			body = append(adapted, '\n')
+		}
+	}
+	aw.Header().Del("Content-Length")
+	aw.ResponseWriter.WriteHeader(aw.status)
+	aw.ResponseWriter.Write(body)
+}
+
+// decodeJSON decodes a body for the adapters, keeping numbers as they were written
+func decodeJSON(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	return value, err
+}
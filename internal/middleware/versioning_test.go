@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A version renaming title to name, both ways
+var testV2 = APIVersion{
+	Name: "v2",
+	AdaptRequest: func(body interface{}) interface{} {
+		if object, ok := body.(map[string]interface{}); ok {
+			object["title"] = object["name"]
+			delete(object, "name")
+		}
+		return body
+	},
+	AdaptResponse: func(body interface{}) interface{} {
+		if object, ok := body.(map[string]interface{}); ok {
+			object["name"] = object["title"]
+			delete(object, "title")
+		}
+		return body
+	},
+}
+
+func TestVersionAdapters(t *testing.T) {
+	var received string
+	routes := testRouter(&RequestValidator{Spec: testSpec()}, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"title": "Legs", "api_version": GetAPIVersion(r)})
+	})
+	r := chi.NewRouter()
+	r.With(testV2.Serve).Mount("/v2", routes)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/v2/workouts/1", strings.NewReader(`{"name": "Legs"}`)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"title": "Legs"}`, received)
+	assert.JSONEq(t, `{"name": "Legs", "api_version": "v2"}`, rec.Body.String())
+	assert.Equal(t, "v2", rec.Header().Get("API-Version"))
+
+	// The validator finds the route without the version prefix
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/v2/workouts/abc", strings.NewReader(`{"name": "Legs"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Bodies that aren't JSON go through as they are
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/health", strings.NewReader("not json")))
+	assert.Equal(t, "not json", received)
+}
+
+func TestLegacyVersions(t *testing.T) {
+	legacy := &LegacyVersions{
+		Versions:     []APIVersion{{Name: "v1"}, testV2},
+		Legacy:       APIVersion{Name: "v1"},
+		DeprecatedAt: time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC),
+		SunsetAt:     time.Date(2027, time.May, 1, 0, 0, 0, 0, time.UTC),
+	}
+	handler := legacy.Negotiate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"title": GetAPIVersion(r)})
+	}))
+
+	serve := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/workouts", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("application/json")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"title": "v1"}`, rec.Body.String())
+	assert.Equal(t, "@1793491200", rec.Header().Get("Deprecation"))
+	assert.Equal(t, "Sat, 01 May 2027 00:00:00 GMT", rec.Header().Get("Sunset"))
+	assert.Equal(t, `</v1/workouts>; rel="successor-version"`, rec.Header().Get("Link"))
+
+	rec = serve("application/vnd.workouts.v2+json")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"name": "v2"}`, rec.Body.String())
+	assert.Empty(t, rec.Header().Get("Deprecation"))
+
+	rec = serve("application/vnd.workouts.v3+json")
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+	var response map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "unknown API version v3, supported versions: v1, v2", response["error"])
+}
+
+// Downloads and flushed responses are streamed as they are, without being held back to be adapted
+func TestVersionAdaptersSkipStreams(t *testing.T) {
+	handler := testV2.Serve(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/export" {
+			w.Header().Set("Content-Disposition", `attachment; filename="workouts.json"`)
+		}
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, `[{"title": "Legs"}`)
+		if r.URL.Path == "/stream" {
+			assert.NoError(t, http.NewResponseController(w).Flush())
+		}
+		io.WriteString(w, `]`)
+	}))
+
+	for _, target := range []string{"/export", "/stream"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, target)
+		assert.JSONEq(t, `[{"title": "Legs"}]`, rec.Body.String(), target)
+		assert.Equal(t, target == "/stream", rec.Flushed, target)
+	}
+}
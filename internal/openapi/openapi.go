@@ -0,0 +1,256 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	The parts of an OpenAPI 3.1 document this API needs, and schemas generated from Go types.
+	The API describes its routes with these (see api.OpenAPISpec), and the schemas come from the same structs the
+	handlers encode and decode, so a field added to store.Workout shows up in the spec without anyone editing it.
+*/
+
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server is where the paths are served from. A relative URL is relative to where the document was fetched.
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path, by lowercase HTTP method (get, post...)
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // path, query or header
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]*Header   `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+/*
+	Schema is a JSON Schema (2020-12, which OpenAPI 3.1 uses). Type is a string, or a list of them for values that
+	can also be null, e.g. ["integer", "null"] for an *int.
+*/
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+/*
+	Generator turns Go types into schemas, the way encoding/json would encode them:
+	- fields are named after their json tag, and skipped when it's "-"
+	- embedded structs have their fields inlined
+	- pointers without omitempty can be null, pointers with omitempty are left out instead
+	- time.Time is a date-time string, json.RawMessage and interface{} are any value
+
+	Exported struct types are added to the components once, and referred to with $ref. Unexported ones (the request
+	types of handlers) are described inline. Nothing is marked required here: the same struct is often both a request and a
+	response, where what's required differs. Callers add that with Require.
+*/
+
+type Generator struct {
+	Schemas map[string]*Schema
+}
+
+func NewGenerator() *Generator {
+	return &Generator{Schemas: make(map[string]*Schema)}
+}
+
+// SchemaFor returns the schema of the type of value, e.g. SchemaFor(store.Workout{})
+func (g *Generator) SchemaFor(value interface{}) *Schema {
+	return g.schema(reflect.TypeOf(value))
+}
+
+func (g *Generator) schema(t reflect.Type) *Schema {
+	switch {
+	case t == nil:
+		return &Schema{}
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" || !isExported(t.Name()) {
+			return g.object(t)
+		}
+		if _, ok := g.Schemas[t.Name()]; !ok {
+			g.Schemas[t.Name()] = &Schema{} // Placeholder first, for types that refer to themselves
+			g.Schemas[t.Name()] = g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	// interface{} and anything else encoding/json would take
+	return &Schema{}
+}
+
+func (g *Generator) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.addFields(schema, t)
+	return schema
+}
+
+func (g *Generator) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(schema, embedded)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schema(field.Type)
+		if field.Type.Kind() == reflect.Pointer && !strings.Contains(options, "omitempty") {
+			property = Nullable(property)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// Object returns the schema of an object with the given properties, all of them required
+func Object(properties map[string]*Schema) *Schema {
+	schema := &Schema{Type: "object", Properties: properties}
+	for name := range properties {
+		schema.Required = append(schema.Required, name)
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// Nullable returns a schema that also accepts null
+func Nullable(schema *Schema) *Schema {
+	if schema.Ref != "" {
+		return &Schema{AnyOf: []*Schema{schema, {Type: "null"}}}
+	}
+	nullable := *schema
+	if typ, ok := schema.Type.(string); ok {
+		nullable.Type = []string{typ, "null"}
+	}
+	return &nullable
+}
+
+// Require returns schema with the given properties required. References are wrapped, so the component is left alone.
+func Require(schema *Schema, properties ...string) *Schema {
+	if schema.Ref != "" {
+		return &Schema{AllOf: []*Schema{schema, {Required: properties}}}
+	}
+	required := *schema
+	required.Required = append(append([]string(nil), schema.Required...), properties...)
+	return &required
+}
+
+func isExported(name string) bool {
+	return name[0] >= 'A' && name[0] <= 'Z'
+}
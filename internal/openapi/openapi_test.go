@@ -0,0 +1,66 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Entry struct {
+	Name   string   `json:"name"`
+	Weight *float64 `json:"weight"`
+}
+
+type Workout struct {
+	ID        int64           `json:"id"`
+	Secret    string          `json:"-"`
+	PlannedAt *time.Time      `json:"planned_at"`
+	DeletedAt *time.Time      `json:"deleted_at,omitempty"`
+	Entries   []Entry         `json:"entries"`
+	Extra     json.RawMessage `json:"extra"`
+}
+
+type createRequest struct {
+	Workout
+	Notify bool `json:"notify"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	g := NewGenerator()
+	schema := g.SchemaFor(Workout{})
+	assert.Equal(t, "#/components/schemas/Workout", schema.Ref)
+
+	workout := g.Schemas["Workout"]
+	require.NotNil(t, workout)
+	assert.NotContains(t, workout.Properties, "Secret")
+	assert.Equal(t, "int64", workout.Properties["id"].Format)
+	assert.Equal(t, []string{"string", "null"}, workout.Properties["planned_at"].Type)
+	assert.Equal(t, "string", workout.Properties["deleted_at"].Type, "omitempty pointers are left out, not null")
+	assert.Equal(t, "#/components/schemas/Entry", workout.Properties["entries"].Items.Ref)
+	assert.Equal(t, []string{"number", "null"}, g.Schemas["Entry"].Properties["weight"].Type)
+	assert.Nil(t, workout.Properties["extra"].Type, "raw JSON can be anything")
+}
+
+func TestSchemaForUnexported(t *testing.T) {
+	g := NewGenerator()
+	schema := g.SchemaFor(createRequest{})
+	assert.Empty(t, schema.Ref, "unexported types are inlined")
+	assert.Contains(t, schema.Properties, "id", "embedded fields are inlined")
+	assert.Contains(t, schema.Properties, "notify")
+	assert.NotContains(t, g.Schemas, "createRequest")
+}
+
+func TestRequire(t *testing.T) {
+	g := NewGenerator()
+	ref := Require(g.SchemaFor(Workout{}), "id")
+	require.Len(t, ref.AllOf, 2)
+	assert.Empty(t, g.Schemas["Workout"].Required, "the component isn't changed")
+
+	inline := g.SchemaFor(createRequest{})
+	required := Require(inline, "notify")
+	assert.Equal(t, []string{"notify"}, required.Required)
+	assert.Empty(t, inline.Required)
+}
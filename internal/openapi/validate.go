@@ -0,0 +1,324 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Validation of requests and responses against a Document. It covers what the API's schemas use: types (with null),
+	required properties, items, additionalProperties, allOf/anyOf, enums, minimum/maximum, and the int32, int64 and
+	date-time formats. JSON is decoded with DecodeJSON, which keeps numbers as json.Number so integers can be told apart.
+*/
+
+// ValidationError is one problem with a request, reported to the client as is
+type ValidationError struct {
+	In      string `json:"in"`              // path, query or body
+	Field   string `json:"field,omitempty"` // The parameter, or where the value is in the body, e.g. entries[0].reps
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Field == "" {
+		return e.In + ": " + e.Message
+	}
+	return e.In + " " + e.Field + ": " + e.Message
+}
+
+// FindOperation returns the operation of a route as the router has it, e.g. ("PATCH", "/workouts/{id}"), or nil
+func (d *Document) FindOperation(method, path string) *Operation {
+	item := d.Paths[path]
+	if item == nil {
+		return nil
+	}
+	return (*item)[strings.ToLower(method)]
+}
+
+// DecodeJSON decodes a JSON document for ValidateValue
+func DecodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+// ValidateValue checks a value decoded with DecodeJSON against schema. field is where the value is, "" for the whole body.
+func (d *Document) ValidateValue(schema *Schema, value interface{}, in, field string) []ValidationError {
+	var errs []ValidationError
+	d.validate(schema, value, in, field, &errs)
+	return errs
+}
+
+/*
+	ValidateParameter checks the raw value of a path or query parameter. present tells an empty value ("?limit=")
+	apart from a missing one, which is only a problem for required parameters.
+*/
+
+func (d *Document) ValidateParameter(param *Parameter, raw string, present bool) []ValidationError {
+	if !present {
+		if param.Required {
+			return []ValidationError{{In: param.In, Field: param.Name, Message: "is required"}}
+		}
+		return nil
+	}
+
+	// Parameters are strings, so convert them to what the schema expects before checking them like JSON values
+	var value interface{} = raw
+	schema := d.resolve(param.Schema)
+	switch {
+	case schemaAllows(schema, "integer") || schemaAllows(schema, "number"):
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			value = json.Number(raw)
+		}
+	case schemaAllows(schema, "boolean"):
+		if b, err := strconv.ParseBool(raw); err == nil {
+			value = b
+		}
+	}
+	return d.ValidateValue(param.Schema, value, param.In, param.Name)
+}
+
+/*
+	ValidateResponse checks a response an operation sent: that its status is documented, and that a JSON body matches
+	the documented schema. It's meant to catch handlers drifting away from the spec in tests.
+*/
+
+func (d *Document) ValidateResponse(op *Operation, status int, contentType string, body []byte) error {
+	response := op.Responses[strconv.Itoa(status)]
+	if response == nil {
+		return fmt.Errorf("status %d is not documented", status)
+	}
+	if len(response.Content) == 0 {
+		if len(bytes.TrimSpace(body)) > 0 {
+			return fmt.Errorf("status %d is documented without a body, but got %q", status, body)
+		}
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q for status %d", contentType, status)
+	}
+	content, ok := response.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("content type %s is not documented for status %d", mediaType, status)
+	}
+	if mediaType != "application/json" || content.Schema == nil {
+		return nil
+	}
+
+	value, err := DecodeJSON(body)
+	if err != nil {
+		return fmt.Errorf("invalid JSON body for status %d: %w", status, err)
+	}
+	errs := d.ValidateValue(content.Schema, value, "body", "")
+	if len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, e := range errs {
+			messages[i] = e.Error()
+		}
+		return fmt.Errorf("body of status %d doesn't match the spec: %s", status, strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// resolve follows a $ref to the component it points to
+func (d *Document) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	if schema == nil {
+		return &Schema{}
+	}
+	return schema
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, in, field string, errs *[]ValidationError) {
+	schema = d.resolve(schema)
+	fail := func(message string) {
+		*errs = append(*errs, ValidationError{In: in, Field: field, Message: message})
+	}
+
+	for _, sub := range schema.AllOf {
+		d.validate(sub, value, in, field, errs)
+	}
+	if len(schema.AnyOf) > 0 {
+		// Report what's wrong according to the first option (for nullable values, the non-null one)
+		var first []ValidationError
+		for i, sub := range schema.AnyOf {
+			var subErrs []ValidationError
+			d.validate(sub, value, in, field, &subErrs)
+			if len(subErrs) == 0 {
+				first = nil
+				break
+			}
+			if i == 0 {
+				first = subErrs
+			}
+		}
+		*errs = append(*errs, first...)
+	}
+
+	types := schemaTypes(schema)
+	if len(types) > 0 && !matchesType(types, value) {
+		fail("must be " + describeTypes(types))
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				fail("must be an RFC 3339 date-time, e.g. 2025-03-14T10:00:00Z")
+			}
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		if schema.Format == "int32" && (n < math.MinInt32 || n > math.MaxInt32) {
+			fail("is out of range")
+		}
+		if schema.Minimum != nil && n < *schema.Minimum {
+			fail(fmt.Sprintf("must be at least %v", *schema.Minimum))
+		}
+		if schema.Maximum != nil && n > *schema.Maximum {
+			fail(fmt.Sprintf("must be at most %v", *schema.Maximum))
+		}
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, ValidationError{In: in, Field: joinField(field, name), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names) // Same errors in the same order every time
+		for _, name := range names {
+			property := v[name]
+			if propertySchema, ok := schema.Properties[name]; ok {
+				d.validate(propertySchema, property, in, joinField(field, name), errs)
+			} else if schema.AdditionalProperties != nil {
+				d.validate(schema.AdditionalProperties, property, in, joinField(field, name), errs)
+			}
+		}
+	case []interface{}:
+		if schema.Items != nil {
+			for i, item := range v {
+				d.validate(schema.Items, item, in, fmt.Sprintf("%s[%d]", field, i), errs)
+			}
+		}
+	}
+
+	if len(schema.Enum) > 0 && value != nil {
+		for _, allowed := range schema.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return
+			}
+		}
+		options := make([]string, len(schema.Enum))
+		for i, allowed := range schema.Enum {
+			options[i] = fmt.Sprint(allowed)
+		}
+		fail("must be one of " + strings.Join(options, ", "))
+	}
+}
+
+func schemaTypes(schema *Schema) []string {
+	switch t := schema.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	case []interface{}: // Documents read back from JSON
+		types := make([]string, 0, len(t))
+		for _, typ := range t {
+			if s, ok := typ.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func schemaAllows(schema *Schema, typ string) bool {
+	for _, t := range schemaTypes(schema) {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(types []string, value interface{}) bool {
+	for _, typ := range types {
+		switch v := value.(type) {
+		case nil:
+			if typ == "null" {
+				return true
+			}
+		case bool:
+			if typ == "boolean" {
+				return true
+			}
+		case string:
+			if typ == "string" {
+				return true
+			}
+		case json.Number:
+			if typ == "number" {
+				return true
+			}
+			if _, err := v.Int64(); err == nil && typ == "integer" {
+				return true
+			}
+		case map[string]interface{}:
+			if typ == "object" {
+				return true
+			}
+		case []interface{}:
+			if typ == "array" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describeTypes words a list of types for error messages, e.g. "an integer or null"
+func describeTypes(types []string) string {
+	words := make([]string, len(types))
+	for i, typ := range types {
+		switch typ {
+		case "integer", "object", "array":
+			words[i] = "an " + typ
+		case "null":
+			words[i] = "null"
+		default:
+			words[i] = "a " + typ
+		}
+	}
+	return strings.Join(words, " or ")
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,72 @@
+package openapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDocument() (*Document, *Operation) {
+	g := NewGenerator()
+	one, hundred := 1.0, 100.0
+	op := &Operation{
+		Parameters: []*Parameter{
+			{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer", Format: "int64"}},
+			{Name: "limit", In: "query", Schema: &Schema{Type: "integer", Minimum: &one, Maximum: &hundred}},
+			{Name: "format", In: "query", Schema: &Schema{Type: "string", Enum: []interface{}{"csv", "json"}}},
+		},
+		RequestBody: &RequestBody{Content: map[string]MediaType{"application/json": {Schema: Require(g.SchemaFor(Workout{}), "id")}}},
+		Responses: map[string]*Response{
+			"200": {Description: "OK", Content: map[string]MediaType{"application/json": {Schema: Object(map[string]*Schema{"workout": g.SchemaFor(Workout{})})}}},
+			"204": {Description: "No content"},
+		},
+	}
+	doc := &Document{
+		Paths:      map[string]*PathItem{"/workouts/{id}": {"patch": op}},
+		Components: Components{Schemas: g.Schemas},
+	}
+	return doc, op
+}
+
+func validateBody(t *testing.T, doc *Document, op *Operation, body string) []ValidationError {
+	value, err := DecodeJSON([]byte(body))
+	require.NoError(t, err)
+	return doc.ValidateValue(op.RequestBody.Content["application/json"].Schema, value, "body", "")
+}
+
+func TestValidateValue(t *testing.T) {
+	doc, op := testDocument()
+	require.Same(t, op, doc.FindOperation("PATCH", "/workouts/{id}"))
+
+	assert.Empty(t, validateBody(t, doc, op, `{"id": 1, "planned_at": null, "entries": [{"name": "Squat", "weight": 60.5}]}`))
+	assert.Equal(t, []ValidationError{{In: "body", Field: "id", Message: "is required"}}, validateBody(t, doc, op, `{}`))
+	assert.Equal(t, []ValidationError{{In: "body", Field: "id", Message: "must be an integer"}}, validateBody(t, doc, op, `{"id": 1.5}`))
+	assert.Equal(t, []ValidationError{{In: "body", Field: "planned_at", Message: "must be an RFC 3339 date-time, e.g. 2025-03-14T10:00:00Z"}},
+		validateBody(t, doc, op, `{"id": 1, "planned_at": "tomorrow"}`))
+	assert.Equal(t, []ValidationError{{In: "body", Field: "entries[1].weight", Message: "must be a number or null"}},
+		validateBody(t, doc, op, `{"id": 1, "entries": [{}, {"weight": "heavy"}]}`))
+	assert.Equal(t, []ValidationError{{In: "body", Message: "must be an object"}}, validateBody(t, doc, op, `[]`))
+}
+
+func TestValidateParameter(t *testing.T) {
+	doc, op := testDocument()
+	id, limit, format := op.Parameters[0], op.Parameters[1], op.Parameters[2]
+
+	assert.Empty(t, doc.ValidateParameter(id, "12", true))
+	assert.Equal(t, "must be an integer", doc.ValidateParameter(id, "twelve", true)[0].Message)
+	assert.Equal(t, "is required", doc.ValidateParameter(id, "", false)[0].Message)
+	assert.Empty(t, doc.ValidateParameter(limit, "", false), "optional")
+	assert.Equal(t, "must be at most 100", doc.ValidateParameter(limit, "500", true)[0].Message)
+	assert.Equal(t, "must be one of csv, json", doc.ValidateParameter(format, "xml", true)[0].Message)
+}
+
+func TestValidateResponse(t *testing.T) {
+	doc, op := testDocument()
+
+	assert.NoError(t, doc.ValidateResponse(op, 200, "application/json", []byte(`{"workout": {"id": 1, "entries": []}}`)))
+	assert.NoError(t, doc.ValidateResponse(op, 204, "", nil))
+	assert.ErrorContains(t, doc.ValidateResponse(op, 404, "application/json", []byte(`{"error": "not found"}`)), "not documented")
+	assert.ErrorContains(t, doc.ValidateResponse(op, 200, "text/plain", []byte("OK")), "content type text/plain")
+	assert.ErrorContains(t, doc.ValidateResponse(op, 200, "application/json", []byte(`{"workouts": []}`)), "body workout: is required")
+}
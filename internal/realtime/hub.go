@@ -0,0 +1,154 @@
+package realtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+/*
+	Live workout updates.
+	Changes are announced with Postgres NOTIFY on the workout_changes channel, and every instance of the API LISTENs to it:
+	whichever replica the change happened on, every replica hears about it and passes it on to the SSE and WebSocket
+	clients of that user it has connected. The Hub keeps track of those clients.
+*/
+
+// Channel is the Postgres channel notifications are sent on
+const Channel = "workout_changes"
+
+// Notification types
+const (
+	WorkoutCreated = "workout.created"
+	WorkoutUpdated = "workout.updated"
+	WorkoutDeleted = "workout.deleted"
+)
+
+// Notification tells a client that one of its workouts changed. It's up to the client to fetch the workout if it needs it.
+type Notification struct {
+	Type      string `json:"type"`
+	WorkoutID int    `json:"workout_id"`
+	UUID      string `json:"uuid"`
+	UserID    int    `json:"-"`
+	Version   int    `json:"version,omitempty"` // 0 for deletes
+}
+
+// How many notifications can wait for a slow client before new ones are dropped for it
+const clientBuffer = 32
+
+type Hub struct {
+	mu      sync.Mutex
+	clients map[int]map[chan Notification]struct{} // By user ID
+	logger  *log.Logger
+}
+
+func NewHub(logger *log.Logger) *Hub {
+	return &Hub{
+		clients: map[int]map[chan Notification]struct{}{},
+		logger:  logger,
+	}
+}
+
+// Subscribe returns a channel receiving the notifications of a user, and a function to call once done with it
+func (h *Hub) Subscribe(userID int) (<-chan Notification, func()) {
+	ch := make(chan Notification, clientBuffer)
+
+	h.mu.Lock()
+	if h.clients[userID] == nil {
+		h.clients[userID] = map[chan Notification]struct{}{}
+	}
+	h.clients[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.clients[userID], ch)
+		if len(h.clients[userID]) == 0 {
+			delete(h.clients, userID)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Publish passes a notification on to the clients of its user connected to this instance.
+// A client that isn't keeping up misses it rather than holding everyone else up.
+func (h *Hub) Publish(n Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients[n.UserID] {
+		select {
+		case ch <- n:
+		default:
+			h.logger.Printf("Dropping %s notification for a slow client of user %d", n.Type, n.UserID)
+		}
+	}
+}
+
+// notifyPayload is what goes over NOTIFY, where the user ID is needed (unlike in what clients get)
+type notifyPayload struct {
+	Notification
+	UserID int `json:"user_id"`
+}
+
+// Notify announces a change to every instance, through NOTIFY
+func Notify(db *sql.DB, n Notification) error {
+	payload, err := json.Marshal(notifyPayload{Notification: n, UserID: n.UserID})
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`SELECT pg_notify($1, $2)`, Channel, string(payload))
+	return err
+}
+
+// Listen LISTENs to the notification channel and publishes what it hears, until ctx is cancelled.
+// It holds a database connection of its own, and gets a new one if it's lost.
+func (h *Hub) Listen(ctx context.Context, db *sql.DB) {
+	for {
+		err := h.listen(ctx, db)
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.Printf("Stopped listening for workout changes, retrying in 5s: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (h *Hub) listen(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// database/sql has no notion of notifications, so we use the pgx connection underneath
+	return conn.Raw(func(driverConn interface{}) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		_, err := pgxConn.Exec(ctx, "LISTEN "+Channel)
+		if err != nil {
+			return err
+		}
+		for {
+			notification, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			var payload notifyPayload
+			err = json.Unmarshal([]byte(notification.Payload), &payload)
+			if err != nil {
+				h.logger.Printf("Ignoring invalid workout change notification: %v", err)
+				continue
+			}
+			payload.Notification.UserID = payload.UserID
+			h.Publish(payload.Notification)
+		}
+	})
+}
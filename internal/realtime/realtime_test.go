@@ -0,0 +1,30 @@
+package realtime
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub(log.New(io.Discard, "", 0))
+	mine, unsubscribe := hub.Subscribe(1)
+	theirs, unsubscribeTheirs := hub.Subscribe(2)
+	defer unsubscribeTheirs()
+
+	hub.Publish(Notification{Type: WorkoutCreated, WorkoutID: 10, UserID: 1})
+	assert.Equal(t, 10, (<-mine).WorkoutID)
+	assert.Empty(t, theirs, "users only get their own notifications")
+
+	unsubscribe()
+	hub.Publish(Notification{Type: WorkoutUpdated, WorkoutID: 10, UserID: 1})
+	assert.Empty(t, mine)
+
+	// A client that doesn't read isn't waited for
+	for i := 0; i < clientBuffer+5; i++ {
+		hub.Publish(Notification{Type: WorkoutUpdated, WorkoutID: i, UserID: 2})
+	}
+	assert.Len(t, theirs, clientBuffer)
+}
@@ -1,13 +1,47 @@
 package routes
 
 import (
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/api"
 	"github.com/OlivierCoq/go_api_template/internal/app"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
 	"github.com/go-chi/chi/v5"
 )
 
+// The unversioned routes (/workouts...) are deprecated in favor of /v1/workouts, and will be removed at the sunset date
+var (
+	legacyDeprecatedAt = time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+	legacySunsetAt     = time.Date(2027, time.May, 1, 0, 0, 0, 0, time.UTC)
+)
+
 func SetupRoutes(app *app.Application) *chi.Mux {
 	r := chi.NewRouter()
 
+	// The API is mounted once per version (/v1, /v2..., see api.APIVersions), and at the root for apps that predate
+	// versioning. Those get v1, or the version their Accept header asks for.
+	routes := apiRoutes(app)
+	for _, version := range api.APIVersions {
+		r.With(version.Serve).Mount("/"+version.Name, routes)
+	}
+	legacy := &middleware.LegacyVersions{
+		Versions:     api.APIVersions,
+		Legacy:       api.APIv1,
+		DeprecatedAt: legacyDeprecatedAt,
+		SunsetAt:     legacySunsetAt,
+	}
+	r.With(legacy.Negotiate).Mount("/", routes)
+
+	return r
+}
+
+// apiRoutes has every route of the API, whatever the version
+func apiRoutes(app *app.Application) *chi.Mux {
+	r := chi.NewRouter()
+
+	// Check path params, query params and JSON bodies against the OpenAPI document, before any handler runs
+	r.Use(app.Validator.Validate)
+
 	// Grouping routes and applying middleware can be done here if needed
 	// the purpose of this r.Group method is to create a sub-router with specific middleware applied to it.
 	// This is useful for applying middleware to a set of routes that share common requirements, such as authentication.
@@ -17,23 +51,91 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 		r.Use(app.Middleware.Authenticate) // Apply the authentication middleware to all routes in this group
 
 		// Workout routes
+		r.Get("/workouts/upcoming", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetUpcomingWorkouts))
+		r.Get("/workouts/overdue", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetOverdueWorkouts))
+		r.Get("/workouts/trash", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetTrash))
 		r.Get("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutByID))
 		r.Post("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkout))
+		r.Post("/workouts/batch", app.Middleware.RequireUser(app.WorkoutHandler.HandleBatchWorkouts))
+		r.Post("/workouts/import", app.Middleware.RequireUser(app.ImportHandler.HandleImportWorkouts))
 		r.Patch("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateWorkout))
 		r.Delete("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkout))
+		r.Post("/workouts/{id}/restore", app.Middleware.RequireUser(app.WorkoutHandler.HandleRestoreWorkout))
+
+		// Entries of a workout, one at a time
+		r.Post("/workouts/{id}/entries", app.Middleware.RequireUser(app.WorkoutHandler.HandleAddWorkoutEntry))
+		r.Put("/workouts/{id}/entries/order", app.Middleware.RequireUser(app.WorkoutHandler.HandleReorderWorkoutEntries))
+		r.Patch("/workouts/{id}/entries/{entryID}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateWorkoutEntry))
+		r.Delete("/workouts/{id}/entries/{entryID}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkoutEntry))
+
+		// Live workout sessions of the current user
+		r.Post("/sessions", app.Middleware.RequireUser(app.SessionHandler.HandleCreateSession))
+		r.Get("/sessions/current", app.Middleware.RequireUser(app.SessionHandler.HandleGetCurrentSession))
+		r.Get("/sessions/{id}", app.Middleware.RequireUser(app.SessionHandler.HandleGetSession))
+		r.Delete("/sessions/{id}", app.Middleware.RequireUser(app.SessionHandler.HandleDiscardSession))
+		r.Post("/sessions/{id}/sets", app.Middleware.RequireUser(app.SessionHandler.HandleLogSet))
+		r.Post("/sessions/{id}/rest", app.Middleware.RequireUser(app.SessionHandler.HandleStartRest))
+		r.Delete("/sessions/{id}/rest", app.Middleware.RequireUser(app.SessionHandler.HandleStopRest))
+		r.Post("/sessions/{id}/pause", app.Middleware.RequireUser(app.SessionHandler.HandlePauseSession))
+		r.Post("/sessions/{id}/resume", app.Middleware.RequireUser(app.SessionHandler.HandleResumeSession))
+		r.Post("/sessions/{id}/finish", app.Middleware.RequireUser(app.SessionHandler.HandleFinishSession))
+
+		// Offline sync: pull the change feed, push changes made offline
+		r.Get("/sync", app.Middleware.RequireUser(app.SyncHandler.HandleGetChanges))
+		r.Post("/sync", app.Middleware.RequireUser(app.SyncHandler.HandlePushChanges))
+
+		// Data export of the current user's workouts
+		r.Get("/users/me/export", app.Middleware.RequireUser(app.ExportHandler.HandleExportWorkouts))
+
+		// Profile of the current user
+		r.Patch("/users/me", app.Middleware.RequireUser(app.UserHandler.HandleUpdateCurrentUser))
+
+		// Webhooks of the current user
+		r.Get("/webhooks", app.Middleware.RequireUser(app.WebhookHandler.HandleGetWebhooks))
+		r.Post("/webhooks", app.Middleware.RequireUser(app.WebhookHandler.HandleCreateWebhook))
+		r.Get("/webhooks/dead-letters", app.Middleware.RequireUser(app.WebhookHandler.HandleGetDeadLetters))
+		r.Post("/webhooks/dead-letters/{id}/retry", app.Middleware.RequireUser(app.WebhookHandler.HandleRetryDeadLetter))
+		r.Delete("/webhooks/{id}", app.Middleware.RequireUser(app.WebhookHandler.HandleDeleteWebhook))
+
+		// GraphQL, over the current user's data
+		r.Post("/graphql", app.Middleware.RequireUser(app.GraphQLHandler.HandleGraphQL))
+
+		// Audit log, admins only
+		r.Get("/admin/audit", app.Middleware.RequireAdmin(app.AuditHandler.HandleListAuditEvents))
+
+		// Short-lived token for the URL of live update connections
+		r.Post("/tokens/realtime", app.Middleware.RequireUser(app.RealtimeHandler.HandleCreateRealtimeToken))
+
+		// Calendar subscription URL for the current user
+		r.Post("/tokens/calendar", app.Middleware.RequireUser(app.CalendarHandler.HandleCreateCalendarToken))
+
+		// Logging user out. RequireUser needs the user Authenticate puts on the request, so this can't live outside the group.
+		r.Delete("/tokens/authentication", app.Middleware.RequireUser(app.TokenHandler.HandleRevokeToken))
+	})
+
+	// Live updates. Also accept a realtime token in the URL, since browsers can't set headers on these connections
+	r.Group(func(r chi.Router) {
+		r.Use(app.Middleware.AuthenticateRealtime)
+
+		r.Get("/events", app.Middleware.RequireUser(app.RealtimeHandler.HandleEvents))
+		r.Get("/ws", app.Middleware.RequireUser(app.RealtimeHandler.HandleWebSocket))
 	})
 
 	// Define routes and their handlers here
 	r.Get("/health", app.HealthCheck) // Health check endpoint
 
+	// API description (OpenAPI) and its browsable docs
+	r.Get("/openapi.json", app.DocsHandler.HandleOpenAPISpec)
+	r.Get("/docs", app.DocsHandler.HandleDocs)
+
 	// User registration route
 	r.Post("/users/register", app.UserHandler.HandleRegisterUser)
 
 	// Token creation route
 	r.Post("/tokens/authentication", app.TokenHandler.HandleCreateToken)
 
-	// Logging user out:
-	r.Delete("/tokens/authentication", app.Middleware.RequireUser(app.TokenHandler.HandleRevokeToken))
+	// Calendar feed. Authenticated by the calendar token in the URL, since calendar apps can't send headers:
+	r.Get("/calendar/{token}.ics", app.CalendarHandler.HandleCalendarFeed)
 
 	return r
 }
@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/api"
+	"github.com/OlivierCoq/go_api_template/internal/app"
+	"github.com/OlivierCoq/go_api_template/internal/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The routes are mounted under every version prefix, the OpenAPI document has them without it
+var versionPrefixRegex = regexp.MustCompile(`^/v[0-9]+/`)
+
+// Every route must be in the OpenAPI document (see api.OpenAPISpec), and the document must not have routes that don't exist
+func TestRoutesHaveOpenAPIEntries(t *testing.T) {
+	// Handlers are only referred to, never called, so an empty Application will do
+	router := SetupRoutes(&app.Application{})
+	spec := api.OpenAPISpec()
+
+	routes := make(map[string]bool)
+	err := chi.Walk(router, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		method = strings.ToLower(method)
+		route = versionPrefixRegex.ReplaceAllString(route, "/")
+		routes[method+" "+route] = true
+
+		item := spec.Paths[route]
+		if assert.NotNil(t, item, "%s has no OpenAPI entry", route) {
+			assert.Contains(t, *item, method, "%s %s has no OpenAPI entry", strings.ToUpper(method), route)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	for path, item := range spec.Paths {
+		for method := range *item {
+			assert.True(t, routes[method+" "+path], "OpenAPI entry for %s %s without a route", strings.ToUpper(method), path)
+		}
+	}
+}
+
+// Invalid requests are rejected by the validator, before the handlers (which are nil here) run
+func TestInvalidRequestsAreRejected(t *testing.T) {
+	router := SetupRoutes(&app.Application{Validator: &middleware.RequestValidator{Spec: api.OpenAPISpec()}})
+
+	tests := []struct {
+		method, target, body string
+		field                string
+	}{
+		{http.MethodPost, "/workouts", `{"description": "no title"}`, "title"},
+		{http.MethodPost, "/workouts", `{"title": "Legs", "duration": "45 minutes"}`, "duration"},
+		{http.MethodPatch, "/workouts/abc", `{}`, "id"},
+		{http.MethodPatch, "/workouts/1", `{"entries": [{"exercise_name": "Squat", "reps": "ten"}]}`, "entries[0].reps"},
+		{http.MethodGet, "/sync?limit=5000", "", "limit"},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+		require.Equal(t, http.StatusBadRequest, rec.Code, "%s %s", test.method, test.target)
+
+		var response struct {
+			Details []struct {
+				Field string `json:"field"`
+			} `json:"details"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		require.Len(t, response.Details, 1, "%s %s: %s", test.method, test.target, rec.Body)
+		assert.Equal(t, test.field, response.Details[0].Field)
+	}
+}
+
+// Versions are picked from the path, or from the Accept header on the deprecated unversioned routes
+func TestVersionNegotiation(t *testing.T) {
+	router := SetupRoutes(&app.Application{Validator: &middleware.RequestValidator{Spec: api.OpenAPISpec()}})
+
+	tests := []struct {
+		target, accept string
+		status         int
+		version        string
+		deprecated     bool
+	}{
+		{"/v1/health", "", http.StatusOK, "v1", false},
+		{"/v2/health", "", http.StatusOK, "v2", false},
+		{"/health", "", http.StatusOK, "v1", true},
+		{"/health", "application/vnd.workouts.v2+json", http.StatusOK, "v2", false},
+		{"/health", "application/vnd.workouts.v9+json", http.StatusNotAcceptable, "", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.target, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, test.status, rec.Code, "%s (Accept: %s)", test.target, test.accept)
+		assert.Equal(t, test.version, rec.Header().Get("API-Version"), "%s (Accept: %s)", test.target, test.accept)
+		if test.deprecated {
+			assert.Equal(t, "@1793491200", rec.Header().Get("Deprecation"))
+			assert.Equal(t, "Sat, 01 May 2027 00:00:00 GMT", rec.Header().Get("Sunset"))
+			assert.Equal(t, `</v1/health>; rel="successor-version"`, rec.Header().Get("Link"))
+		} else {
+			assert.Empty(t, rec.Header().Get("Deprecation"), "%s (Accept: %s)", test.target, test.accept)
+		}
+	}
+}
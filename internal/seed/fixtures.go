@@ -0,0 +1,143 @@
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+	Fixtures are users and workouts written by hand in YAML, for tests that need known data rather than a lot of it:
+
+	users:
+	  - username: alice
+	    email: alice@example.com
+	    password: Secret123
+	    workouts:
+	      - title: Leg day
+	        duration: 45
+	        status: completed
+	        planned_for: 2026-01-05T08:30:00Z
+	        entries:
+	          - exercise_name: Squat
+	            sets: 5
+	            reps: 5
+	            weight: 100
+
+	Field names are the ones of the API. Unknown fields are an error, so a typo doesn't silently leave a field empty.
+*/
+
+// Fixtures is the content of a fixtures file
+type Fixtures struct {
+	Users []FixtureUser `yaml:"users"`
+}
+
+type FixtureUser struct {
+	Username string           `yaml:"username"`
+	Email    string           `yaml:"email"`
+	Password string           `yaml:"password"`
+	Bio      string           `yaml:"bio"`
+	Workouts []FixtureWorkout `yaml:"workouts"`
+}
+
+type FixtureWorkout struct {
+	UUID            string         `yaml:"uuid"`
+	Title           string         `yaml:"title"`
+	Description     string         `yaml:"description"`
+	DurationMinutes int            `yaml:"duration"`
+	CaloriesBurned  int            `yaml:"calories_burned"`
+	PlannedFor      *time.Time     `yaml:"planned_for"`
+	Status          string         `yaml:"status"` // Defaults as in the API: planned with a date in the future, completed otherwise
+	ExternalID      *string        `yaml:"external_id"`
+	Entries         []FixtureEntry `yaml:"entries"`
+}
+
+type FixtureEntry struct {
+	ExerciseName    string   `yaml:"exercise_name"`
+	Sets            int      `yaml:"sets"`
+	Reps            *int     `yaml:"reps"`
+	DurationSeconds *int     `yaml:"duration_seconds"`
+	Weight          *float64 `yaml:"weight"`
+	Notes           string   `yaml:"notes"`
+}
+
+// LoadFixturesFile loads the fixtures of a YAML file, see LoadFixtures
+func LoadFixturesFile(stores store.Stores, path string) (map[string]*store.User, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadFixtures(stores, file)
+}
+
+// LoadFixtures creates the users and workouts of a YAML document, and returns the users by username, so tests can find their IDs
+func LoadFixtures(stores store.Stores, r io.Reader) (map[string]*store.User, error) {
+	var fixtures Fixtures
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	err := decoder.Decode(&fixtures)
+	if err != nil && !errors.Is(err, io.EOF) { // An empty document is no fixtures, not an error
+		return nil, fmt.Errorf("seed: invalid fixtures: %w", err)
+	}
+
+	users := make(map[string]*store.User, len(fixtures.Users))
+	for _, fixture := range fixtures.Users {
+		if fixture.Username == "" || fixture.Password == "" {
+			return nil, errors.New("seed: fixture users need a username and a password")
+		}
+		user := &store.User{Username: fixture.Username, Email: fixture.Email, Bio: fixture.Bio}
+		if user.Email == "" {
+			user.Email = fixture.Username + "@example.com"
+		}
+		err := user.PasswordHash.Set(fixture.Password)
+		if err != nil {
+			return nil, err
+		}
+		user, err = stores.Users.CreateUser(user)
+		if err != nil {
+			return nil, fmt.Errorf("seed: failed to create user %s: %w", fixture.Username, err)
+		}
+		users[user.Username] = user
+
+		for _, w := range fixture.Workouts {
+			_, err := stores.Workouts.CreateWorkout(w.workout(user.ID))
+			if err != nil {
+				return nil, fmt.Errorf("seed: failed to create workout %q of %s: %w", w.Title, user.Username, err)
+			}
+		}
+	}
+	return users, nil
+}
+
+func (w FixtureWorkout) workout(userID int) *store.Workout {
+	workout := &store.Workout{
+		UUID:            w.UUID,
+		UserID:          userID,
+		Title:           w.Title,
+		Description:     w.Description,
+		DurationMinutes: w.DurationMinutes,
+		CaloriesBurned:  w.CaloriesBurned,
+		PlannedFor:      w.PlannedFor,
+		Status:          w.Status,
+		ExternalID:      w.ExternalID,
+		Entries:         []store.WorkoutEntry{},
+	}
+	for i, e := range w.Entries {
+		workout.Entries = append(workout.Entries, store.WorkoutEntry{
+			ExerciseName:    e.ExerciseName,
+			Sets:            e.Sets,
+			Reps:            e.Reps,
+			DurationSeconds: e.DurationSeconds,
+			Weight:          e.Weight,
+			Notes:           e.Notes,
+			OrderIndex:      i,
+		})
+	}
+	return workout
+}
@@ -0,0 +1,58 @@
+package seed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFixtures(t *testing.T) {
+	stores := store.NewMemoryStores()
+	users, err := LoadFixturesFile(stores, "testdata/fixtures.yaml")
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "alice@example.com", users["alice"].Email, "the email defaults to one made of the username")
+	assert.Equal(t, "bob@example.org", users["bob"].Email)
+
+	alice, err := stores.Users.GetUserByUsername("alice")
+	require.NoError(t, err)
+	matches, err := alice.PasswordHash.Matches("Secret123")
+	require.NoError(t, err)
+	assert.True(t, matches)
+
+	list := workouts(t, stores, users["alice"].ID)
+	require.Len(t, list, 2)
+	legs := list[0]
+	assert.Equal(t, "Leg day", legs.Title)
+	assert.Equal(t, 45, legs.DurationMinutes)
+	assert.Equal(t, store.WorkoutStatusCompleted, legs.Status)
+	require.Len(t, legs.Entries, 2)
+	assert.Equal(t, 100.0, *legs.Entries[0].Weight)
+	assert.Nil(t, legs.Entries[1].Weight)
+	assert.Equal(t, 10, *legs.Entries[1].Reps)
+	require.NotNil(t, list[1].ExternalID)
+	assert.Equal(t, "fixture-push", *list[1].ExternalID)
+
+	assert.Empty(t, workouts(t, stores, users["bob"].ID))
+}
+
+func TestLoadInvalidFixtures(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":    "users:\n  - username: alice\n    password: Secret123\n    pasword: oops\n",
+		"without password": "users:\n  - username: alice\n",
+		"not YAML":         "users: [",
+	}
+	for name, document := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadFixtures(store.NewMemoryStores(), strings.NewReader(document))
+			assert.Error(t, err)
+		})
+	}
+
+	users, err := LoadFixtures(store.NewMemoryStores(), strings.NewReader(""))
+	require.NoError(t, err)
+	assert.Empty(t, users)
+}
@@ -0,0 +1,231 @@
+// Package seed fills a database with realistic data, for demos and load tests (Generate), or with the data of YAML files, for tests (LoadFixtures).
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+)
+
+/*
+	Generated users follow a simple training program: they alternate between a few workouts (legs, push, pull),
+	a few times a week, and lift a bit more every week. How strong they start and how often they train depends on the user.
+	Everything goes through the store interfaces, so it works the same on Postgres, SQLite and the in-memory stores.
+
+	The data only depends on Options: the same seed, number of months and date give the same users and workouts
+	(IDs and UUIDs are still assigned by the database). Each user has a random generator of its own, seeded with the seed
+	and the user's number, so raising Users adds users without changing the existing ones.
+
+	Generating is idempotent: users that already exist are reused as they are, and workouts have an external ID made of
+	their date ("seed:2026-01-05"), which ImportWorkouts skips when the user already has it. Running it twice adds nothing.
+*/
+
+// Options of Generate. Zero values get the defaults of DefaultOptions.
+type Options struct {
+	Users    int    // Number of users
+	Months   int    // How many months of workouts each user has, up to Now
+	Seed     uint64 // Seed of the random generator
+	Password string // Password of every user
+	Prefix   string // Usernames are Prefix followed by the user's number, e.g. athlete1
+	Now      time.Time
+}
+
+// DefaultOptions are the options used for the zero values of Options
+var DefaultOptions = Options{
+	Users:    10,
+	Months:   6,
+	Seed:     1,
+	Password: "Password123",
+	Prefix:   "athlete",
+}
+
+// Result tells what Generate added
+type Result struct {
+	Users    []*store.User // All the users of the options, whether they were created or already there
+	Created  int           // Users created
+	Workouts int           // Workouts created
+}
+
+// Generate creates the users of options and their workouts
+func Generate(stores store.Stores, options Options) (*Result, error) {
+	options = withDefaults(options)
+	if options.Users < 0 || options.Months < 0 {
+		return nil, errors.New("seed: the number of users and months can't be negative")
+	}
+
+	// bcrypt is slow on purpose (see password.Set): every user gets the same hash, computed once
+	var hashed store.User
+	err := hashed.PasswordHash.Set(options.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for number := 1; number <= options.Users; number++ {
+		user, created, err := ensureUser(stores.Users, options.Prefix, number, &hashed)
+		if err != nil {
+			return nil, err
+		}
+		result.Users = append(result.Users, user)
+		if created {
+			result.Created++
+		}
+
+		rng := rand.New(rand.NewPCG(options.Seed, uint64(number)))
+		workouts := generateWorkouts(rng, user.ID, options.Months, options.Now)
+		imported, err := stores.Workouts.ImportWorkouts(workouts)
+		if err != nil {
+			return nil, fmt.Errorf("seed: failed to create the workouts of %s: %w", user.Username, err)
+		}
+		result.Workouts += imported
+	}
+	return result, nil
+}
+
+func withDefaults(options Options) Options {
+	if options.Users == 0 {
+		options.Users = DefaultOptions.Users
+	}
+	if options.Months == 0 {
+		options.Months = DefaultOptions.Months
+	}
+	if options.Seed == 0 {
+		options.Seed = DefaultOptions.Seed
+	}
+	if options.Password == "" {
+		options.Password = DefaultOptions.Password
+	}
+	if options.Prefix == "" {
+		options.Prefix = DefaultOptions.Prefix
+	}
+	if options.Now.IsZero() {
+		options.Now = time.Now()
+	}
+	return options
+}
+
+// ensureUser returns the user with the given number, creating it with the password of hashed if it doesn't exist yet
+func ensureUser(users store.UserStore, prefix string, number int, hashed *store.User) (*store.User, bool, error) {
+	username := fmt.Sprintf("%s%d", prefix, number)
+	user, err := users.GetUserByUsername(username)
+	if err != nil || user != nil {
+		return user, false, err
+	}
+	user = &store.User{
+		Username:     username,
+		Email:        username + "@example.com",
+		Bio:          "Generated by the seed command",
+		PasswordHash: hashed.PasswordHash,
+	}
+	user, err = users.CreateUser(user)
+	if err != nil {
+		return nil, false, fmt.Errorf("seed: failed to create user %s: %w", username, err)
+	}
+	return user, true, nil
+}
+
+// exercise of the program. Weights are for a user of level 1 on the first week, in kg.
+type exercise struct {
+	name     string
+	sets     int
+	reps     int
+	weight   float64 // 0 for bodyweight exercises
+	progress float64 // Weight added every week, as a fraction of the starting weight
+}
+
+type routine struct {
+	title       string
+	description string
+	exercises   []exercise
+	calories    int // Burned per minute
+}
+
+var program = []routine{
+	{"Legs", "Squats and accessories", []exercise{
+		{name: "Squat", sets: 5, reps: 5, weight: 80, progress: 0.02},
+		{name: "Romanian Deadlift", sets: 3, reps: 8, weight: 60, progress: 0.015},
+		{name: "Lunge", sets: 3, reps: 10, weight: 20, progress: 0.01},
+		{name: "Hanging Leg Raise", sets: 3, reps: 12},
+	}, 8},
+	{"Push", "Chest, shoulders and triceps", []exercise{
+		{name: "Bench Press", sets: 5, reps: 5, weight: 60, progress: 0.015},
+		{name: "Overhead Press", sets: 3, reps: 8, weight: 35, progress: 0.01},
+		{name: "Dips", sets: 3, reps: 12},
+	}, 6},
+	{"Pull", "Back and biceps", []exercise{
+		{name: "Deadlift", sets: 3, reps: 5, weight: 100, progress: 0.02},
+		{name: "Barbell Row", sets: 4, reps: 8, weight: 50, progress: 0.015},
+		{name: "Pull-up", sets: 3, reps: 8},
+	}, 7},
+}
+
+// generateWorkouts returns the workouts of a user, from months before now up to now, plus the ones planned for the coming week
+func generateWorkouts(rng *rand.Rand, userID, months int, now time.Time) []*store.Workout {
+	level := 0.6 + rng.Float64()*0.8 // How strong the user is compared to the weights of the program
+	perWeek := 2 + rng.IntN(4)       // Training days per week
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := today.AddDate(0, -months, 0)
+
+	var workouts []*store.Workout
+	next := 0 // Routine of the next workout, they're done in turn
+	for day := start; day.Before(today.AddDate(0, 0, 7)); day = day.AddDate(0, 0, 1) {
+		if rng.IntN(7) >= perWeek {
+			continue
+		}
+		week := int(day.Sub(start).Hours() / 24 / 7)
+		at := day.Add(time.Duration(6+rng.IntN(15))*time.Hour + time.Duration(rng.IntN(4))*15*time.Minute)
+		workout := generateWorkout(rng, program[next%len(program)], level, week)
+		workout.UserID = userID
+		workout.PlannedFor = &at
+		externalID := "seed:" + day.Format(time.DateOnly)
+		workout.ExternalID = &externalID
+
+		switch {
+		case !at.Before(now):
+			workout.Status = store.WorkoutStatusPlanned
+		case rng.IntN(20) == 0:
+			workout.Status = store.WorkoutStatusSkipped
+		default:
+			workout.Status = store.WorkoutStatusCompleted
+			workout.UpdatedAt = at.Add(time.Duration(workout.DurationMinutes) * time.Minute)
+		}
+		workouts = append(workouts, workout)
+		next++
+	}
+	return workouts
+}
+
+func generateWorkout(rng *rand.Rand, routine routine, level float64, week int) *store.Workout {
+	workout := &store.Workout{
+		Title:           routine.title,
+		Description:     routine.description,
+		DurationMinutes: 30 + rng.IntN(61),
+		Entries:         []store.WorkoutEntry{},
+	}
+	workout.CaloriesBurned = workout.DurationMinutes * (routine.calories - 1 + rng.IntN(3))
+
+	for i, exercise := range routine.exercises {
+		// Only exercises with reps: the workout_entries tables require them, even though their check allows timed entries instead
+		reps := exercise.reps
+		entry := store.WorkoutEntry{ExerciseName: exercise.name, Sets: exercise.sets, Reps: &reps, OrderIndex: i}
+		if exercise.weight > 0 {
+			// A bad day now and then: one plate less than planned
+			weight := roundToPlate(exercise.weight * level * (1 + exercise.progress*float64(week)))
+			if rng.IntN(10) == 0 && weight > 2.5 {
+				weight -= 2.5
+			}
+			entry.Weight = &weight
+		}
+		workout.Entries = append(workout.Entries, entry)
+	}
+	return workout
+}
+
+// roundToPlate rounds a weight down to what can be loaded on a bar, in steps of 2.5 kg
+func roundToPlate(weight float64) float64 {
+	return math.Floor(weight/2.5) * 2.5
+}
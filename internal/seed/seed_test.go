@@ -0,0 +1,114 @@
+package seed
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+// workouts returns the workouts of a user, oldest first
+func workouts(t *testing.T, stores store.Stores, userID int) []store.Workout {
+	var result []store.Workout
+	err := stores.Workouts.StreamWorkouts(userID, func(w *store.Workout) error {
+		result = append(result, *w)
+		return nil
+	})
+	require.NoError(t, err)
+	return result
+}
+
+// comparable drops what the stores assign, which differs from one run to the other
+func comparable(workouts []store.Workout) []store.Workout {
+	for i := range workouts {
+		workouts[i].ID, workouts[i].UUID, workouts[i].UserID, workouts[i].Version = 0, "", 0, 0
+		if workouts[i].Status != store.WorkoutStatusCompleted {
+			workouts[i].UpdatedAt = time.Time{} // Stamped with the current time
+		}
+		for j := range workouts[i].Entries {
+			workouts[i].Entries[j].ID, workouts[i].Entries[j].UUID = 0, ""
+		}
+	}
+	return workouts
+}
+
+func TestGenerate(t *testing.T) {
+	stores := store.NewMemoryStores()
+	result, err := Generate(stores, Options{Users: 2, Months: 3, Now: now})
+	require.NoError(t, err)
+	require.Len(t, result.Users, 2)
+	assert.Equal(t, 2, result.Created)
+	assert.Equal(t, "athlete1", result.Users[0].Username)
+
+	// The password works for logging in
+	user, err := stores.Users.GetUserByUsername("athlete2")
+	require.NoError(t, err)
+	matches, err := user.PasswordHash.Matches(DefaultOptions.Password)
+	require.NoError(t, err)
+	assert.True(t, matches)
+
+	list := workouts(t, stores, result.Users[0].ID)
+	require.NotEmpty(t, list)
+	total := len(list) + len(workouts(t, stores, result.Users[1].ID))
+	assert.Equal(t, result.Workouts, total)
+
+	var planned int
+	squats := map[string]float64{} // Heaviest squat of each month
+	for _, w := range list {
+		require.NotNil(t, w.PlannedFor)
+		assert.False(t, w.PlannedFor.Before(now.AddDate(0, -3, -1)), "no workout before the months asked for")
+		assert.True(t, strings.HasPrefix(*w.ExternalID, "seed:"))
+		assert.GreaterOrEqual(t, w.DurationMinutes, 30)
+		assert.LessOrEqual(t, w.DurationMinutes, 90)
+		if w.Status == store.WorkoutStatusPlanned {
+			planned++
+			assert.True(t, w.PlannedFor.After(now), "only future workouts are still planned")
+		}
+		for _, entry := range w.Entries {
+			if entry.ExerciseName == "Squat" {
+				month := w.PlannedFor.Format("2006-01")
+				squats[month] = max(squats[month], *entry.Weight)
+			}
+		}
+	}
+	assert.NotZero(t, planned, "the coming week is planned")
+
+	// Weights go up over time
+	require.Contains(t, squats, "2025-12")
+	require.Contains(t, squats, "2026-03")
+	assert.Greater(t, squats["2026-03"], squats["2025-12"])
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	first, second := store.NewMemoryStores(), store.NewMemoryStores()
+	a, err := Generate(first, Options{Users: 1, Months: 2, Seed: 42, Now: now})
+	require.NoError(t, err)
+	b, err := Generate(second, Options{Users: 2, Months: 2, Seed: 42, Now: now})
+	require.NoError(t, err)
+	// Adding users leaves the data of the others as it was
+	assert.Equal(t, comparable(workouts(t, first, a.Users[0].ID)), comparable(workouts(t, second, b.Users[0].ID)))
+
+	other := store.NewMemoryStores()
+	c, err := Generate(other, Options{Users: 1, Months: 2, Seed: 43, Now: now})
+	require.NoError(t, err)
+	assert.NotEqual(t, comparable(workouts(t, first, a.Users[0].ID)), comparable(workouts(t, other, c.Users[0].ID)))
+}
+
+func TestGenerateIsIdempotent(t *testing.T) {
+	stores := store.NewMemoryStores()
+	options := Options{Users: 1, Months: 1, Now: now}
+	first, err := Generate(stores, options)
+	require.NoError(t, err)
+	again, err := Generate(stores, options)
+	require.NoError(t, err)
+
+	assert.Zero(t, again.Created)
+	assert.Zero(t, again.Workouts)
+	assert.Equal(t, first.Users[0].ID, again.Users[0].ID)
+	assert.Len(t, workouts(t, stores, first.Users[0].ID), first.Workouts)
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEvent is one entry of the audit log. Before, After, Changes and Metadata are JSON documents, left empty when not relevant.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	ActorID    *int            `json:"actor_id"` // The user who did it. nil when nobody was logged in, e.g. a failed login
+	Action     string          `json:"action"`
+	Resource   string          `json:"resource"`
+	ResourceID string          `json:"resource_id,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Changes    json.RawMessage `json:"changes,omitempty"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+}
+
+// AuditFilter narrows down ListAuditEvents. Zero values mean "any".
+type AuditFilter struct {
+	ActorID    *int
+	Action     string
+	Resource   string
+	ResourceID string
+	Since      *time.Time
+	Until      *time.Time
+	BeforeID   int64 // For paging: only events older than this one
+	Limit      int
+}
+
+type PostgresAuditStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAuditStore(db *sql.DB) *PostgresAuditStore {
+	return &PostgresAuditStore{db: db}
+}
+
+// The audit log is append-only: there is no way to change or remove an event (the table rejects it too).
+type AuditStore interface {
+	InsertAuditEvent(event *AuditEvent) error
+	ListAuditEvents(filter AuditFilter) ([]AuditEvent, error)
+}
+
+func (s *PostgresAuditStore) InsertAuditEvent(event *AuditEvent) error {
+	query := `INSERT INTO audit_events (occurred_at, actor_id, action, resource, resource_id, ip, user_agent, before, after, changes, metadata)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			  RETURNING id`
+	return s.db.QueryRow(query,
+		event.OccurredAt,
+		event.ActorID,
+		event.Action,
+		event.Resource,
+		nullString(event.ResourceID),
+		nullString(event.IP),
+		nullString(event.UserAgent),
+		nullJSON(event.Before),
+		nullJSON(event.After),
+		nullJSON(event.Changes),
+		nullJSON(event.Metadata),
+	).Scan(&event.ID)
+}
+
+// ListAuditEvents returns the events matching the filter, most recent first
+func (s *PostgresAuditStore) ListAuditEvents(filter AuditFilter) ([]AuditEvent, error) {
+	// Only the conditions of the filter that are set end up in the query, each with its own placeholder
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.ActorID != nil {
+		where("actor_id = $%d", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if filter.Resource != "" {
+		where("resource = $%d", filter.Resource)
+	}
+	if filter.ResourceID != "" {
+		where("resource_id = $%d", filter.ResourceID)
+	}
+	if filter.Since != nil {
+		where("occurred_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		where("occurred_at < $%d", *filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		where("id < $%d", filter.BeforeID)
+	}
+
+	query := `SELECT id, occurred_at, actor_id, action, resource, COALESCE(resource_id, ''), COALESCE(ip, ''), COALESCE(user_agent, ''), before, after, changes, metadata
+			  FROM audit_events`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var event AuditEvent
+		// JSON columns are scanned into []byte, which database/sql copies for us
+		var before, after, changes, metadata []byte
+		err = rows.Scan(&event.ID, &event.OccurredAt, &event.ActorID, &event.Action, &event.Resource, &event.ResourceID, &event.IP, &event.UserAgent, &before, &after, &changes, &metadata)
+		if err != nil {
+			return nil, err
+		}
+		event.Before, event.After, event.Changes, event.Metadata = before, after, changes, metadata
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// nullString turns an empty string into NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullJSON turns an empty JSON document into NULL. Documents are sent as text, which Postgres casts to JSONB.
+func nullJSON(doc json.RawMessage) interface{} {
+	if len(doc) == 0 {
+		return nil
+	}
+	return string(doc)
+}
@@ -0,0 +1,649 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/*
+	Conformance suite: every backend must pass the same tests, so the application behaves the same whichever database it runs on.
+	TestSQLiteStores runs it on an in-memory SQLite database; TestPostgresStores runs it on a Postgres database of its own (see setupTestDB), and is skipped without a server.
+	TestMemoryStores holds the in-memory stores used by unit tests to the same contract.
+*/
+
+func TestMemoryStores(t *testing.T) {
+	testStores(t, NewMemoryStores())
+}
+
+func TestSQLiteStores(t *testing.T) {
+	db, err := Open(Config{Driver: DriverSQLite, DSN: ":memory:"})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, Migrate(db, "../../migrations"))
+
+	testStores(t, NewStores(DriverSQLite, db))
+}
+
+func TestPostgresStores(t *testing.T) {
+	t.Parallel()
+	db := setupTestDB(t)
+	defer db.Close()
+
+	testStores(t, NewStores(DriverPostgres, db))
+}
+
+func testStores(t *testing.T, stores Stores) {
+	t.Run("users", func(t *testing.T) { testUserStore(t, stores) })
+	t.Run("tokens", func(t *testing.T) { testTokenStore(t, stores) })
+	t.Run("passwords and disabling", func(t *testing.T) { testUserAdministration(t, stores) })
+	t.Run("workouts", func(t *testing.T) { testWorkoutStore(t, stores) })
+	t.Run("entries", func(t *testing.T) { testWorkoutEntries(t, stores) })
+	t.Run("entry constraints", func(t *testing.T) { testEntryConstraints(t, stores) })
+	t.Run("trash and sync", func(t *testing.T) { testTrashAndSync(t, stores) })
+	t.Run("pruning sync changes", func(t *testing.T) { testSyncPruning(t, stores) })
+	t.Run("scheduling and records", func(t *testing.T) { testSchedulingAndRecords(t, stores) })
+	t.Run("deleting users", func(t *testing.T) { testDeleteUser(t, stores) })
+	if stores.Sessions != nil {
+		t.Run("sessions", func(t *testing.T) { testSessionStore(t, stores) })
+	}
+}
+
+// createTestUser registers a user with a unique name, since the suite registers several in the same database
+func createTestUser(t *testing.T, stores Stores) *User {
+	t.Helper()
+	name := fmt.Sprintf("user%d", time.Now().UnixNano())
+	user := &User{Username: name, Email: name + "@example.com", Bio: "Lifts things"}
+	require.NoError(t, user.PasswordHash.Set("correct horse"))
+	_, err := stores.Users.CreateUser(user)
+	require.NoError(t, err)
+	return user
+}
+
+func testUserStore(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+	assert.NotZero(t, user.ID)
+	assert.False(t, user.CreatedAt.IsZero())
+
+	found, err := stores.Users.GetUserByUsername(user.Username)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, user.ID, found.ID)
+	assert.Equal(t, user.Email, found.Email)
+	assert.False(t, found.IsAdmin)
+	matches, err := found.PasswordHash.Matches("correct horse")
+	require.NoError(t, err)
+	assert.True(t, matches, "the password hash is stored as is")
+
+	found.Bio = "Lifts heavier things"
+	require.NoError(t, stores.Users.UpdateUser(found))
+	found, err = stores.Users.GetUserByUsername(user.Username)
+	require.NoError(t, err)
+	assert.Equal(t, "Lifts heavier things", found.Bio)
+
+	missing, err := stores.Users.GetUserByUsername("nobody-" + user.Username)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	_, err = stores.Users.CreateUser(&User{Username: user.Username, Email: "other-" + user.Email, PasswordHash: user.PasswordHash})
+	assert.Error(t, err, "usernames are unique")
+}
+
+func testTokenStore(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+
+	token, err := stores.Tokens.CreateNewToken(user.ID, time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+	found, err := stores.Users.GetUserToken(tokens.ScopeAuth, token.Plaintext)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, user.ID, found.ID)
+
+	found, err = stores.Users.GetUserToken(tokens.ScopeCalendar, token.Plaintext)
+	require.NoError(t, err)
+	assert.Nil(t, found, "tokens only work for their scope")
+
+	expired, err := stores.Tokens.CreateNewToken(user.ID, -time.Minute, tokens.ScopeAuth)
+	require.NoError(t, err)
+	found, err = stores.Users.GetUserToken(tokens.ScopeAuth, expired.Plaintext)
+	require.NoError(t, err)
+	assert.Nil(t, found, "expired tokens don't work")
+
+	require.NoError(t, stores.Tokens.RevokeToken(token.Plaintext))
+	require.NoError(t, stores.Tokens.RevokeToken(token.Plaintext), "revoking twice is fine")
+	found, err = stores.Users.GetUserToken(tokens.ScopeAuth, token.Plaintext)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	calendar, err := stores.Tokens.CreateNewToken(user.ID, time.Hour, tokens.ScopeCalendar)
+	require.NoError(t, err)
+	other, err := stores.Tokens.CreateNewToken(user.ID, time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+	require.NoError(t, stores.Tokens.DeleteAllTokensForUser(tokens.ScopeAuth, user.ID))
+	found, err = stores.Users.GetUserToken(tokens.ScopeAuth, other.Plaintext)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+	found, err = stores.Users.GetUserToken(tokens.ScopeCalendar, calendar.Plaintext)
+	require.NoError(t, err)
+	assert.NotNil(t, found, "other scopes are left alone")
+}
+
+func testUserAdministration(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+	token, err := stores.Tokens.CreateNewToken(user.ID, time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+
+	require.NoError(t, user.PasswordHash.Set("battery staple"))
+	require.NoError(t, stores.Users.UpdatePassword(user))
+	found, err := stores.Users.GetUserByUsername(user.Username)
+	require.NoError(t, err)
+	matches, err := found.PasswordHash.Matches("battery staple")
+	require.NoError(t, err)
+	assert.True(t, matches)
+	assert.False(t, found.IsDisabled())
+
+	require.NoError(t, stores.Users.SetUserDisabled(user.ID, true))
+	found, err = stores.Users.GetUserByUsername(user.Username)
+	require.NoError(t, err)
+	require.True(t, found.IsDisabled())
+	disabledAt := *found.DisabledAt
+	byToken, err := stores.Users.GetUserToken(tokens.ScopeAuth, token.Plaintext)
+	require.NoError(t, err)
+	assert.Nil(t, byToken, "the tokens of disabled users don't work")
+
+	require.NoError(t, stores.Users.SetUserDisabled(user.ID, true))
+	found, err = stores.Users.GetUserByUsername(user.Username)
+	require.NoError(t, err)
+	assert.True(t, disabledAt.Equal(*found.DisabledAt), "disabling again keeps the first date")
+
+	require.NoError(t, stores.Users.SetUserDisabled(user.ID, false))
+	byToken, err = stores.Users.GetUserToken(tokens.ScopeAuth, token.Plaintext)
+	require.NoError(t, err)
+	assert.NotNil(t, byToken, "tokens that weren't revoked work again")
+
+	assert.ErrorIs(t, stores.Users.SetUserDisabled(0, true), sql.ErrNoRows)
+	assert.ErrorIs(t, stores.Users.UpdatePassword(&User{}), sql.ErrNoRows)
+}
+
+// newTestWorkout returns a workout of the user with two entries
+func newTestWorkout(userID int, title string) *Workout {
+	return &Workout{
+		UserID:          userID,
+		Title:           title,
+		Description:     "Test workout",
+		DurationMinutes: 45,
+		CaloriesBurned:  300,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Squat", Sets: 3, Reps: ptrInt(10), Weight: FloatPtr(60), OrderIndex: 1},
+			{ExerciseName: "Lunge", Sets: 2, Reps: ptrInt(12), Notes: "each leg", OrderIndex: 2},
+		},
+	}
+}
+
+func testWorkoutStore(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+	workouts := stores.Workouts
+
+	workout, err := workouts.CreateWorkout(newTestWorkout(user.ID, "Legs"))
+	require.NoError(t, err)
+	assert.NotZero(t, workout.ID)
+	assert.NotEmpty(t, workout.UUID)
+	assert.Equal(t, 1, workout.Version)
+	assert.Equal(t, WorkoutStatusCompleted, workout.Status)
+	assert.NotZero(t, workout.Entries[0].ID)
+
+	found, err := workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, "Legs", found.Title)
+	assert.Equal(t, 300, found.CaloriesBurned)
+	require.Len(t, found.Entries, 2)
+	assert.Equal(t, "Squat", found.Entries[0].ExerciseName)
+	assert.Equal(t, 60.0, *found.Entries[0].Weight)
+	assert.Nil(t, found.Entries[1].Weight)
+	assert.Equal(t, "each leg", found.Entries[1].Notes)
+
+	byUUID, err := workouts.GetWorkoutByUUID(workout.UUID)
+	require.NoError(t, err)
+	require.NotNil(t, byUUID)
+	assert.Equal(t, workout.ID, byUUID.ID)
+
+	owner, err := workouts.GetWorkoutOwner(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, owner)
+
+	missing, err := workouts.GetWorkoutByID(int64(workout.ID) + 100000)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+	_, err = workouts.GetWorkoutOwner(int64(workout.ID) + 100000)
+	assert.Error(t, err)
+
+	// Updating keeps the entries that stay, changes the ones that changed, and adds and removes the others
+	squatID := found.Entries[0].ID
+	found.Title = "Leg day"
+	found.Entries = []WorkoutEntry{
+		{ID: squatID, ExerciseName: "Squat", Sets: 5, Reps: ptrInt(5), Weight: FloatPtr(80), OrderIndex: 1},
+		{ExerciseName: "Calf raise", Sets: 3, Reps: ptrInt(15), OrderIndex: 2},
+	}
+	require.NoError(t, workouts.UpdateWorkout(found))
+	assert.Equal(t, 2, found.Version)
+
+	updated, err := workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "Leg day", updated.Title)
+	assert.Equal(t, 2, updated.Version)
+	require.Len(t, updated.Entries, 2)
+	assert.Equal(t, squatID, updated.Entries[0].ID, "kept entries keep their ID")
+	assert.Equal(t, 5, updated.Entries[0].Sets)
+	assert.Equal(t, "Calf raise", updated.Entries[1].ExerciseName)
+
+	// Saving with the version that was read before is a conflict
+	stale := *updated
+	stale.Version = 1
+	assert.ErrorIs(t, workouts.UpdateWorkout(&stale), ErrVersionConflict)
+
+	found.Entries = []WorkoutEntry{{ID: squatID + 100000, ExerciseName: "Squat", Sets: 1, Reps: ptrInt(1), OrderIndex: 1}}
+	assert.ErrorIs(t, workouts.UpdateWorkout(found), ErrInvalidEntries)
+
+	// External IDs are unique per user
+	external := "strava-42"
+	imported := newTestWorkout(user.ID, "Imported")
+	imported.ExternalID = &external
+	_, err = workouts.CreateWorkout(imported)
+	require.NoError(t, err)
+	again := newTestWorkout(user.ID, "Imported again")
+	again.ExternalID = &external
+	_, err = workouts.CreateWorkout(again)
+	assert.ErrorIs(t, err, ErrDuplicateExternalID)
+
+	batch := []*Workout{newTestWorkout(user.ID, "Batch 1"), again, newTestWorkout(user.ID, "Batch 2")}
+	created, err := workouts.ImportWorkouts(batch)
+	require.NoError(t, err)
+	assert.Equal(t, 2, created)
+	assert.Zero(t, batch[1].ID, "duplicates are skipped")
+
+	// Transactions are all or nothing
+	err = workouts.WithTransaction(func(tx WorkoutTx) error {
+		_, err := tx.CreateWorkout(newTestWorkout(user.ID, "Rolled back"))
+		require.NoError(t, err)
+		return fmt.Errorf("changed my mind")
+	})
+	assert.EqualError(t, err, "changed my mind")
+
+	var titles []string
+	err = workouts.StreamWorkouts(user.ID, func(w *Workout) error {
+		titles = append(titles, w.Title)
+		assert.NotNil(t, w.Entries)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Leg day", "Imported", "Batch 1", "Batch 2"}, titles)
+
+	recent, err := workouts.GetRecentWorkouts(user.ID, 2)
+	require.NoError(t, err)
+	assert.Len(t, recent, 2)
+	entries, err := workouts.GetEntriesForWorkouts([]int64{int64(workout.ID), int64(batch[0].ID)})
+	require.NoError(t, err)
+	assert.Len(t, entries[int64(workout.ID)], 2)
+	assert.Len(t, entries[int64(batch[0].ID)], 2)
+}
+
+func testWorkoutEntries(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+	workouts := stores.Workouts
+
+	workout, err := workouts.CreateWorkout(newTestWorkout(user.ID, "Entries"))
+	require.NoError(t, err)
+	squat, lunge := workout.Entries[0], workout.Entries[1]
+
+	plank := &WorkoutEntry{ExerciseName: "Push-up", Sets: 3, Reps: ptrInt(20)}
+	version, err := workouts.AddWorkoutEntry(int64(workout.ID), workout.Version, plank)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.Equal(t, 3, plank.OrderIndex, "added at the end")
+
+	squat.Sets = 4
+	version, err = workouts.UpdateWorkoutEntry(int64(workout.ID), version, &squat)
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	// Changes made to a version that moved on fail, like two requests with the same ETag would
+	_, err = workouts.UpdateWorkoutEntry(int64(workout.ID), version-1, &squat)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	_, err = workouts.AddWorkoutEntry(int64(workout.ID), version-1, &WorkoutEntry{ExerciseName: "Lost", Sets: 1, Reps: ptrInt(1)})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	_, err = workouts.DeleteWorkoutEntry(int64(workout.ID), version-1, int64(lunge.ID))
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	_, err = workouts.ReorderWorkoutEntries(int64(workout.ID), version-1, []int64{int64(lunge.ID), int64(squat.ID), int64(plank.ID)})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	_, err = workouts.AddWorkoutEntry(999999, 1, &WorkoutEntry{ExerciseName: "Lost", Sets: 1, Reps: ptrInt(1)})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrVersionConflict, "a missing workout isn't a conflict")
+
+	version, err = workouts.ReorderWorkoutEntries(int64(workout.ID), version, []int64{int64(plank.ID), int64(squat.ID), int64(lunge.ID)})
+	require.NoError(t, err)
+	assert.Equal(t, 4, version)
+	_, err = workouts.ReorderWorkoutEntries(int64(workout.ID), version, []int64{int64(plank.ID), int64(plank.ID), int64(lunge.ID)})
+	assert.ErrorIs(t, err, ErrInvalidEntries)
+
+	version, err = workouts.DeleteWorkoutEntry(int64(workout.ID), version, int64(lunge.ID))
+	require.NoError(t, err)
+	assert.Equal(t, 5, version)
+	_, err = workouts.DeleteWorkoutEntry(int64(workout.ID), version, int64(lunge.ID))
+	assert.ErrorIs(t, err, ErrInvalidEntries)
+
+	found, err := workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Equal(t, 5, found.Version)
+	require.Len(t, found.Entries, 2)
+	assert.Equal(t, "Push-up", found.Entries[0].ExerciseName)
+	assert.Equal(t, 4, found.Entries[1].Sets)
+
+	// A workout left without entries reads back with an empty list, not null, alone or in a list
+	found.Entries = []WorkoutEntry{}
+	require.NoError(t, workouts.UpdateWorkout(found))
+	found, err = workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.NotNil(t, found.Entries)
+	assert.Empty(t, found.Entries)
+	require.NoError(t, workouts.DeleteWorkout(int64(found.ID), found.Version))
+	trash, err := workouts.GetDeletedWorkouts(user.ID)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.NotNil(t, trash[0].Entries)
+}
+
+// Entries have either reps or a duration (the valid_workout_entry constraint), never both nor neither
+func testEntryConstraints(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+	workouts := stores.Workouts
+
+	workout := newTestWorkout(user.ID, "Timed")
+	workout.Entries = append(workout.Entries, WorkoutEntry{ExerciseName: "Plank", Sets: 1, DurationSeconds: ptrInt(60), OrderIndex: 3})
+	_, err := workouts.CreateWorkout(workout)
+	require.NoError(t, err)
+	found, err := workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	require.Len(t, found.Entries, 3)
+	assert.Nil(t, found.Entries[2].Reps)
+	assert.Equal(t, ptrInt(60), found.Entries[2].DurationSeconds)
+
+	neither := newTestWorkout(user.ID, "Neither")
+	neither.Entries[0].Reps = nil
+	_, err = workouts.CreateWorkout(neither)
+	assert.Error(t, err)
+	both := newTestWorkout(user.ID, "Both")
+	both.Entries[0].DurationSeconds = ptrInt(30)
+	_, err = workouts.CreateWorkout(both)
+	assert.Error(t, err)
+	var titles []string
+	require.NoError(t, workouts.StreamWorkouts(user.ID, func(w *Workout) error {
+		titles = append(titles, w.Title)
+		return nil
+	}))
+	assert.Equal(t, []string{"Timed"}, titles, "nothing is left of the workouts that failed")
+
+	squat := found.Entries[0]
+	squat.DurationSeconds = ptrInt(30)
+	_, err = workouts.UpdateWorkoutEntry(int64(workout.ID), found.Version, &squat)
+	assert.Error(t, err)
+	_, err = workouts.AddWorkoutEntry(int64(workout.ID), found.Version, &WorkoutEntry{ExerciseName: "Nothing", Sets: 1})
+	assert.Error(t, err)
+}
+
+func testTrashAndSync(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+	workouts := stores.Workouts
+
+	page, err := workouts.GetChangesSince(user.ID, 0, 100)
+	require.NoError(t, err)
+	assert.Empty(t, page.Changes)
+
+	workout, err := workouts.CreateWorkout(newTestWorkout(user.ID, "Synced"))
+	require.NoError(t, err)
+	page, err = workouts.GetChangesSince(user.ID, 0, 100)
+	require.NoError(t, err)
+	require.Len(t, page.Changes, 3, "the workout and its two entries")
+	assert.Equal(t, SyncEntityWorkout, page.Changes[0].Entity)
+	assert.Equal(t, workout.UUID, page.Changes[0].UUID)
+	require.NotNil(t, page.Changes[0].Workout)
+	assert.Equal(t, "Synced", page.Changes[0].Workout.Title)
+	assert.Equal(t, workout.UUID, page.Changes[1].WorkoutUUID)
+	assert.False(t, page.HasMore)
+	cursor := page.Cursor
+
+	deletedAt, err := workouts.GetWorkoutDeletedAt(user.ID, workout.UUID)
+	require.NoError(t, err)
+	assert.Nil(t, deletedAt)
+
+	// Deleting a version that moved on fails, like updating it would
+	assert.ErrorIs(t, workouts.DeleteWorkout(int64(workout.ID), workout.Version+1), ErrVersionConflict)
+	require.NoError(t, workouts.DeleteWorkout(int64(workout.ID), workout.Version))
+	err = workouts.DeleteWorkout(int64(workout.ID), workout.Version)
+	assert.Error(t, err, "already in the trash")
+	assert.NotErrorIs(t, err, ErrVersionConflict)
+	found, err := workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	page, err = workouts.GetChangesSince(user.ID, cursor, 100)
+	require.NoError(t, err)
+	require.Len(t, page.Changes, 1)
+	assert.Equal(t, SyncOpDelete, page.Changes[0].Op)
+	deletedAt, err = workouts.GetWorkoutDeletedAt(user.ID, workout.UUID)
+	require.NoError(t, err)
+	assert.NotNil(t, deletedAt)
+
+	trash, err := workouts.GetDeletedWorkouts(user.ID)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.NotNil(t, trash[0].DeletedAt)
+	assert.Len(t, trash[0].Entries, 2)
+
+	other := createTestUser(t, stores)
+	restored, err := workouts.RestoreWorkout(other.ID, int64(workout.ID))
+	require.NoError(t, err)
+	assert.Nil(t, restored, "only the owner can restore a workout")
+
+	restored, err = workouts.RestoreWorkout(user.ID, int64(workout.ID))
+	require.NoError(t, err)
+	require.NotNil(t, restored)
+	assert.Equal(t, 2, restored.Version)
+	assert.Nil(t, restored.DeletedAt)
+
+	// Sync restores by UUID, the only ID clients have
+	require.NoError(t, workouts.DeleteWorkout(int64(workout.ID), restored.Version))
+	restored, err = workouts.RestoreWorkoutByUUID(other.ID, workout.UUID)
+	require.NoError(t, err)
+	assert.Nil(t, restored, "only the owner can restore a workout")
+	restored, err = workouts.RestoreWorkoutByUUID(user.ID, "not-a-uuid")
+	require.NoError(t, err)
+	assert.Nil(t, restored)
+	restored, err = workouts.RestoreWorkoutByUUID(user.ID, workout.UUID)
+	require.NoError(t, err)
+	require.NotNil(t, restored)
+	assert.Equal(t, workout.ID, restored.ID)
+	assert.Equal(t, 3, restored.Version)
+	restored, err = workouts.RestoreWorkoutByUUID(user.ID, workout.UUID)
+	require.NoError(t, err)
+	assert.Nil(t, restored, "not in the trash anymore")
+
+	require.NoError(t, workouts.DeleteWorkout(int64(workout.ID), 3))
+	_, err = workouts.PurgeDeletedWorkouts(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	trash, err = workouts.GetDeletedWorkouts(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, trash, 1, "deleted too recently to be purged")
+
+	purged, err := workouts.PurgeDeletedWorkouts(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, int64(1))
+	trash, err = workouts.GetDeletedWorkouts(user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+}
+
+func testSyncPruning(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+	workouts := stores.Workouts
+
+	workout, err := workouts.CreateWorkout(newTestWorkout(user.ID, "Pruned"))
+	require.NoError(t, err)
+	page, err := workouts.GetChangesSince(user.ID, 0, 100)
+	require.NoError(t, err)
+	cursor := page.Cursor
+	workout.Title = "Renamed"
+	require.NoError(t, workouts.UpdateWorkout(workout))
+	workout.Title = "Renamed again"
+	require.NoError(t, workouts.UpdateWorkout(workout))
+	before, err := workouts.GetChangesSince(user.ID, 0, 100)
+	require.NoError(t, err)
+
+	pruned, err := workouts.PruneSyncChanges(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, pruned, "nothing is old enough")
+	pruned, err = workouts.PruneSyncChanges(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, pruned, int64(2), "the first two changes of the workout are superseded")
+
+	// Clients get the same changes as before, whether they start over or pull from an older cursor
+	after, err := workouts.GetChangesSince(user.ID, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, changeKeys(before.Changes), changeKeys(after.Changes))
+	page, err = workouts.GetChangesSince(user.ID, cursor, 100)
+	require.NoError(t, err)
+	require.NotEmpty(t, page.Changes)
+	assert.Contains(t, changeKeys(page.Changes), SyncEntityWorkout+" "+SyncOpUpsert+" "+workout.UUID)
+	found, err := workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed again", found.Title)
+}
+
+// changeKeys describes changes without their cursors, which depend on the backend
+func changeKeys(changes []SyncChange) []string {
+	keys := make([]string, len(changes))
+	for i, change := range changes {
+		keys[i] = change.Entity + " " + change.Op + " " + change.UUID
+	}
+	return keys
+}
+
+func testSchedulingAndRecords(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+	workouts := stores.Workouts
+
+	// An offset other than UTC, to check times are compared as times
+	paris := time.FixedZone("Paris", 2*60*60)
+	tomorrow := time.Now().Add(24 * time.Hour).In(paris)
+	yesterday := time.Now().Add(-24 * time.Hour).In(paris)
+
+	upcoming := newTestWorkout(user.ID, "Upcoming")
+	upcoming.PlannedFor = &tomorrow
+	_, err := workouts.CreateWorkout(upcoming)
+	require.NoError(t, err)
+	assert.Equal(t, WorkoutStatusPlanned, upcoming.Status)
+
+	overdue := newTestWorkout(user.ID, "Overdue")
+	overdue.PlannedFor = &yesterday
+	_, err = workouts.CreateWorkout(overdue)
+	require.NoError(t, err)
+
+	heavier := newTestWorkout(user.ID, "Heavier")
+	heavier.Entries[0].ExerciseName = "squat"
+	heavier.Entries[0].Weight = FloatPtr(100)
+	_, err = workouts.CreateWorkout(heavier)
+	require.NoError(t, err)
+
+	found, err := workouts.GetUpcomingWorkouts(user.ID)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "Upcoming", found[0].Title)
+	assert.WithinDuration(t, tomorrow, *found[0].PlannedFor, time.Millisecond)
+	assert.Len(t, found[0].Entries, 2)
+
+	found, err = workouts.GetOverdueWorkouts(user.ID)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "Overdue", found[0].Title)
+
+	found, err = workouts.GetScheduledWorkouts(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, found, 2)
+
+	records, err := workouts.GetPersonalRecords(user.ID)
+	require.NoError(t, err)
+	require.Len(t, records, 1, "exercise names are compared case-insensitively")
+	assert.Equal(t, 100.0, records[0].Weight)
+	assert.Equal(t, heavier.ID, records[0].WorkoutID)
+	assert.Equal(t, heavier.Entries[0].ID, records[0].EntryID)
+}
+
+func testDeleteUser(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+	other := createTestUser(t, stores)
+
+	token, err := stores.Tokens.CreateNewToken(user.ID, time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+	workout, err := stores.Workouts.CreateWorkout(newTestWorkout(user.ID, "Gone with the user"))
+	require.NoError(t, err)
+	trashed, err := stores.Workouts.CreateWorkout(newTestWorkout(user.ID, "Already in the trash"))
+	require.NoError(t, err)
+	require.NoError(t, stores.Workouts.DeleteWorkout(int64(trashed.ID), trashed.Version))
+	kept, err := stores.Workouts.CreateWorkout(newTestWorkout(other.ID, "Someone else's"))
+	require.NoError(t, err)
+
+	require.NoError(t, stores.Users.DeleteUser(user.ID))
+	assert.ErrorIs(t, stores.Users.DeleteUser(user.ID), sql.ErrNoRows)
+
+	found, err := stores.Users.GetUserByUsername(user.Username)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+	found, err = stores.Users.GetUserToken(tokens.ScopeAuth, token.Plaintext)
+	require.NoError(t, err)
+	assert.Nil(t, found, "tokens go with their user")
+
+	missing, err := stores.Workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Nil(t, missing, "workouts go with their user")
+	entries, err := stores.Workouts.GetEntriesForWorkouts([]int64{int64(workout.ID), int64(trashed.ID)})
+	require.NoError(t, err)
+	assert.Empty(t, entries, "and so do their entries, trash included")
+
+	still, err := stores.Workouts.GetWorkoutByID(int64(kept.ID))
+	require.NoError(t, err)
+	require.NotNil(t, still, "other users are left alone")
+	assert.Len(t, still.Entries, 2)
+}
+
+func testSessionStore(t *testing.T, stores Stores) {
+	user := createTestUser(t, stores)
+	session, err := stores.Sessions.CreateSession(&WorkoutSession{UserID: user.ID, Title: "Core"})
+	require.NoError(t, err)
+
+	// A timed set has a duration and no reps
+	ok, err := stores.Sessions.LogSessionSet(user.ID, session.ID, &SessionSet{ExerciseName: "Plank", DurationSeconds: ptrInt(60)}, 0)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = stores.Sessions.LogSessionSet(user.ID, session.ID, &SessionSet{ExerciseName: "Crunch", Reps: ptrInt(20)}, 0)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	workout, err := stores.Sessions.FinishSession(user.ID, session.ID)
+	require.NoError(t, err)
+	require.NotNil(t, workout)
+	saved, err := stores.Workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	require.Len(t, saved.Entries, 2)
+	assert.Nil(t, saved.Entries[0].Reps)
+	assert.Equal(t, ptrInt(60), saved.Entries[0].DurationSeconds)
+	assert.Equal(t, ptrInt(20), saved.Entries[1].Reps)
+
+	open, err := stores.Sessions.GetOpenSession(user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, open, "the session is over")
+}
@@ -1,53 +1,154 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io/fs" // for working with the embedded filesystem
+	"os"
+	"strings"
 
-	"github.com/pressly/goose/v3" // for database migrations
+	"github.com/OlivierCoq/go_api_template/internal/events"
 
 	_ "github.com/jackc/pgx/v5/stdlib" // PostgreSQL driver, sql package uses it via side-effects
+	_ "github.com/mattn/go-sqlite3"    // SQLite driver, registered as "sqlite3"
 )
 
-func Open() (*sql.DB, error) {
-	db, err := sql.Open("pgx", "host=localhost port=5432 user=postgres password=postgres dbname=postgres sslmode=disable")
+// Databases the stores can run on
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Used when DATABASE_URL isn't set
+const (
+	defaultPostgresDSN = "host=localhost port=5432 user=postgres password=postgres dbname=postgres sslmode=disable"
+	defaultSQLiteDSN   = "workouts.db"
+)
+
+// Config says which database to use and how to reach it
+type Config struct {
+	Driver string // DriverPostgres or DriverSQLite
+	DSN    string // Connection string for Postgres, file path (or :memory:) for SQLite
+}
+
+/*
+	ConfigFromEnv reads the database configuration from the environment:
+	- DB_DRIVER: postgres or sqlite. Defaults to postgres
+	- DATABASE_URL: connection string or file path. Defaults to the local Postgres of docker-compose, or workouts.db
+*/
+
+func ConfigFromEnv() (Config, error) {
+	config := Config{Driver: os.Getenv("DB_DRIVER"), DSN: os.Getenv("DATABASE_URL")}
+	if config.Driver == "" {
+		config.Driver = DriverPostgres
+	}
+	switch config.Driver {
+	case DriverPostgres:
+		if config.DSN == "" {
+			config.DSN = defaultPostgresDSN
+		}
+	case DriverSQLite:
+		if config.DSN == "" {
+			config.DSN = defaultSQLiteDSN
+		}
+	default:
+		return Config{}, fmt.Errorf("unknown DB_DRIVER %q, expected %s or %s", config.Driver, DriverPostgres, DriverSQLite)
+	}
+	return config, nil
+}
+
+func Open(config Config) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	switch config.Driver {
+	case DriverPostgres:
+		db, err = sql.Open("pgx", config.DSN)
+	case DriverSQLite:
+		db, err = sql.Open("sqlite3", sqliteDSN(config.DSN))
+		if err == nil {
+			// SQLite has a single writer anyway. One connection also keeps an in-memory database alive, and the same for every query.
+			db.SetMaxOpenConns(1)
+		}
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", config.Driver)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-	fmt.Println("Database connection established! 🚀")
+	// Printed to stderr so it doesn't end up mixed with the output of CLI commands (e.g. an export written to stdout)
+	fmt.Fprintln(os.Stderr, "Database connection established! 🚀")
 	// db.SetMaxOpenConns(), db.SetMaxIdleConns(), and db.SetConnMaxIdleTime()
 	return db, nil
 }
 
-// MigrateFS applies database migrations from the provided fs.FS (embedded filesystem).
-// It sets the base filesystem for goose to the provided migrationFS, runs the migrations,
-// and then resets the base filesystem to nil.
-func MigrateFS(db *sql.DB, migrationFS fs.FS, dir string) error {
-	goose.SetBaseFS(migrationFS)
+// sqliteDSN turns a file path into a DSN enforcing foreign keys (off by default in SQLite, and ON DELETE CASCADE relies on them),
+// waiting on locks instead of failing right away, and using the write-ahead log so reads don't block on writes.
+func sqliteDSN(file string) string {
+	separator := "?"
+	if strings.Contains(file, "?") {
+		separator = "&"
+	}
+	if !strings.HasPrefix(file, "file:") {
+		file = "file:" + file
+	}
+	return file + separator + "_foreign_keys=1&_busy_timeout=5000&_journal_mode=WAL"
+}
 
-	defer func() {
-		goose.SetBaseFS(nil)
-	}()
-	return Migrate(db, dir)
+// Stores groups the stores of the application, for one database
+type Stores struct {
+	Workouts WorkoutStore
+	Users    UserStore
+	Tokens   TokenStore
+	Audit    AuditStore
+	Webhooks WebhookStore
+	Events   events.Outbox
+	Sessions SessionStore
 }
 
-func Migrate(db *sql.DB, dir string) error {
+// NewStores returns the stores of the given driver, on top of db
+func NewStores(driver string, db *sql.DB) Stores {
+	if driver == DriverSQLite {
+		return Stores{
+			Workouts: NewSQLiteWorkoutStore(db),
+			Users:    NewSQLiteUserStore(db),
+			Tokens:   NewSQLiteTokenStore(db),
+			Audit:    NewSQLiteAuditStore(db),
+			Webhooks: NewSQLiteWebhookStore(db),
+			Events:   NewSQLiteEventStore(db),
+			Sessions: NewSQLiteSessionStore(db),
+		}
+	}
+	return Stores{
+		Workouts: NewPostgresWorkoutStore(db),
+		Users:    NewPostgresUserStore(db),
+		Tokens:   NewPostgresTokenStore(db),
+		Audit:    NewPostgresAuditStore(db),
+		Webhooks: NewPostgresWebhookStore(db),
+		Events:   NewPostgresEventStore(db),
+		Sessions: NewPostgresSessionStore(db),
+	}
+}
 
-	// Set the dialect for goose to PostgreSQL
-	err := goose.SetDialect("postgres")
+// MigrateFS applies the pending migrations in dir of migrationFS (e.g. the embedded migrations.FS), or in its sqlite
+// subdirectory when db is a SQLite database. See Migrator for the other commands.
+func MigrateFS(db *sql.DB, migrationFS fs.FS, dir string) error {
+	migrator, err := NewMigrator(db, migrationFS, dir)
 	if err != nil {
-		return fmt.Errorf("failed to set goose dialect: %w", err)
+		return err
 	}
-
-	// Apply all up migrations
-	err = goose.Up(db, dir)
+	_, err = migrator.Up(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 	return nil
 }
 
+// Migrate applies the migrations in the directory dir, or in its sqlite subdirectory when db is a SQLite database
+func Migrate(db *sql.DB, dir string) error {
+	return MigrateFS(db, os.DirFS(dir), ".")
+}
+
 //db.SetMaxOpenConns(), db.SetMaxIdleConns(), and db.SetConnMaxIdleTime() can be used to fine-tune the connection pool settings based on your application's needs.
 // These settings help manage the number of open connections, idle connections, and the duration for which a connection can remain idle before being closed.
 // Properly configuring these settings can improve performance and resource utilization, especially under varying workloads.
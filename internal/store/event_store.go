@@ -0,0 +1,100 @@
+package store
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+)
+
+const (
+	// How many times an event is dispatched before the dispatcher gives up on it
+	maxEventAttempts = 5
+	// How long claimed events are held back from other dispatchers. The subscribers of a batch must be done by then,
+	// or its events may be dispatched twice.
+	eventLease = 2 * time.Minute
+)
+
+type PostgresEventStore struct {
+	db *sql.DB
+}
+
+func NewPostgresEventStore(db *sql.DB) *PostgresEventStore {
+	return &PostgresEventStore{db: db}
+}
+
+// writeEvent adds an event to the outbox as part of tx, so it's only kept if the change it describes is committed
+func writeEvent(tx *sql.Tx, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO event_outbox (event_type, payload) VALUES ($1, $2)`, event.Type(), string(payload))
+	return err
+}
+
+/*
+	Dispatch implements events.Outbox.
+	Pending events are claimed by pushing them back by eventLease, in a statement of their own that commits before fn runs:
+	nothing is held open while subscribers work, so the transaction horizon the sync feed waits on keeps moving.
+	FOR UPDATE SKIP LOCKED lets another dispatcher polling at the same time (e.g. on another replica) skip the events being
+	claimed. If the dispatcher dies before recording how an event went, it's dispatched again once the lease is over.
+	An event fn fails on is tried again later, after 1, 4, 9... minutes, until it has failed maxEventAttempts times.
+*/
+
+func (s *PostgresEventStore) Dispatch(limit int, fn func(events.Envelope) error) (int, error) {
+	query := `UPDATE event_outbox
+			  SET available_at = NOW() + $2 * INTERVAL '1 second'
+			  WHERE id IN (
+				  SELECT id FROM event_outbox
+				  WHERE dispatched_at IS NULL AND failed_at IS NULL AND available_at <= NOW()
+				  ORDER BY id
+				  LIMIT $1
+				  FOR UPDATE SKIP LOCKED
+			  )
+			  RETURNING id, event_type, payload, occurred_at, attempts`
+	rows, err := s.db.Query(query, limit, eventLease.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var pending []events.Envelope
+	for rows.Next() {
+		var envelope events.Envelope
+		var payload []byte
+		err = rows.Scan(&envelope.ID, &envelope.Type, &payload, &envelope.OccurredAt, &envelope.Attempts)
+		if err != nil {
+			return 0, err
+		}
+		envelope.Payload = payload
+		pending = append(pending, envelope)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	// RETURNING comes in no particular order, and subscribers expect the order events happened in
+	slices.SortFunc(pending, func(a, b events.Envelope) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	for _, envelope := range pending {
+		dispatchErr := fn(envelope)
+		if dispatchErr == nil {
+			_, err = s.db.Exec(`UPDATE event_outbox SET dispatched_at = NOW() WHERE id = $1`, envelope.ID)
+		} else if envelope.Attempts+1 >= maxEventAttempts {
+			_, err = s.db.Exec(`UPDATE event_outbox SET attempts = attempts + 1, last_error = $2, failed_at = NOW() WHERE id = $1`, envelope.ID, dispatchErr.Error())
+		} else {
+			retryIn := time.Duration((envelope.Attempts+1)*(envelope.Attempts+1)) * time.Minute
+			_, err = s.db.Exec(`UPDATE event_outbox SET attempts = attempts + 1, last_error = $2, available_at = $3 WHERE id = $1`, envelope.ID, dispatchErr.Error(), time.Now().Add(retryIn))
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to record the dispatch of event %d: %w", envelope.ID, err)
+		}
+	}
+	return len(pending), nil
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Subscribers run with nothing held open: claimed events are committed as claimed before they do, and stay claimed while they work
+func TestPostgresEventDispatch(t *testing.T) {
+	t.Parallel()
+	db := setupTestDB(t)
+	defer db.Close()
+	stores := NewStores(DriverPostgres, db)
+
+	user := createTestUser(t, stores)
+	_, err := stores.Workouts.CreateWorkout(newTestWorkout(user.ID, "Dispatched"))
+	require.NoError(t, err)
+
+	var dispatched []int64
+	count, err := stores.Events.Dispatch(100, func(envelope events.Envelope) error {
+		dispatched = append(dispatched, envelope.ID)
+
+		// Another connection can lock the event: no transaction of the dispatcher holds it
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		defer tx.Rollback()
+		_, err = tx.Exec(`SELECT id FROM event_outbox WHERE id = $1 FOR UPDATE NOWAIT`, envelope.ID)
+		require.NoError(t, err)
+
+		// but another dispatcher doesn't get it
+		claimed, err := stores.Events.Dispatch(100, func(other events.Envelope) error {
+			t.Errorf("event %d dispatched while event %d of the same batch was", other.ID, envelope.ID)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Zero(t, claimed)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotZero(t, count)
+	assert.Len(t, dispatched, count)
+	assert.IsIncreasing(t, dispatched, "in the order they happened")
+
+	count, err = stores.Events.Dispatch(100, func(events.Envelope) error { return nil })
+	require.NoError(t, err)
+	assert.Zero(t, count, "every event was dispatched")
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/tokens"
+)
+
+/*
+	In-memory stores, for unit tests that shouldn't need a database.
+	They behave like the Postgres stores (the same contract tests run on both, see conformance_test.go): ownership, unique
+	usernames and external IDs, versions, the trash, the sync change feed, cascades when a user is deleted, token expiry...
+	What they don't do is write domain events, webhooks or audit events, which only the SQL stores have outboxes for.
+
+	The stores share a MemoryDB, the same way the Postgres stores share a *sql.DB, so a token created through the TokenStore
+	can be looked up through the UserStore. Every call takes the lock of the MemoryDB, so they're safe to use concurrently.
+*/
+
+// MemoryDB holds the data of the in-memory stores. Rows are kept by value, so callers never share memory with the store.
+type MemoryDB struct {
+	mu sync.Mutex
+
+	users    map[int]User
+	tokens   map[string]tokens.Token // By hash
+	workouts map[int]Workout         // Without their entries
+	entries  map[int]memoryEntry
+	changes  []memoryChange
+
+	lastUserID    int
+	lastWorkoutID int
+	lastEntryID   int
+	lastChangeID  int64 // Changes are pruned, so their number isn't the last cursor
+}
+
+// memoryEntry is a row of workout_entries
+type memoryEntry struct {
+	WorkoutEntry
+	workoutID int
+	userID    int
+}
+
+// memoryChange is a row of sync_changes
+type memoryChange struct {
+	SyncChange
+	userID int
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:    map[int]User{},
+		tokens:   map[string]tokens.Token{},
+		workouts: map[int]Workout{},
+		entries:  map[int]memoryEntry{},
+	}
+}
+
+// NewMemoryStores returns in-memory workout, user and token stores sharing a new MemoryDB. The other stores are left nil.
+func NewMemoryStores() Stores {
+	db := NewMemoryDB()
+	return Stores{
+		Workouts: NewMemoryWorkoutStore(db),
+		Users:    NewMemoryUserStore(db),
+		Tokens:   NewMemoryTokenStore(db),
+	}
+}
+
+/*
+	atomically runs fn with the lock held, and puts the data back the way it was if fn fails: the in-memory equivalent of
+	a transaction. Maps are copied, not the rows in them, which is enough because rows are values that are only ever replaced.
+*/
+
+func (db *MemoryDB) atomically(fn func() error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	users, tokens, workouts, entries, changes := maps.Clone(db.users), maps.Clone(db.tokens), maps.Clone(db.workouts), maps.Clone(db.entries), db.changes
+	lastUserID, lastWorkoutID, lastEntryID, lastChangeID := db.lastUserID, db.lastWorkoutID, db.lastEntryID, db.lastChangeID
+
+	err := fn()
+	if err != nil {
+		db.users, db.tokens, db.workouts, db.entries, db.changes = users, tokens, workouts, entries, changes
+		db.lastUserID, db.lastWorkoutID, db.lastEntryID, db.lastChangeID = lastUserID, lastWorkoutID, lastEntryID, lastChangeID
+	}
+	return err
+}
+
+// recordChange adds to the sync change feed what the triggers of sync_changes would
+func (db *MemoryDB) recordChange(userID int, entity string, uuid string, op string) {
+	db.lastChangeID++
+	db.changes = append(db.changes, memoryChange{
+		SyncChange: SyncChange{Cursor: db.lastChangeID, Entity: entity, UUID: uuid, Op: op, ChangedAt: time.Now()},
+		userID:     userID,
+	})
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The memory stores are shared by every request of a test server, so they're used from many goroutines at once
+func TestMemoryStoresConcurrently(t *testing.T) {
+	stores := NewMemoryStores()
+	user := createTestUser(t, stores)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workout, err := stores.Workouts.CreateWorkout(newTestWorkout(user.ID, fmt.Sprintf("Workout %d", i)))
+			assert.NoError(t, err)
+			_, err = stores.Workouts.AddWorkoutEntry(int64(workout.ID), workout.Version, &WorkoutEntry{ExerciseName: "Plank", Sets: 1, DurationSeconds: ptrInt(60)})
+			assert.NoError(t, err)
+			_, err = stores.Workouts.GetRecentWorkouts(user.ID, 5)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	page, err := stores.Workouts.GetChangesSince(user.ID, 0, 1000)
+	require.NoError(t, err)
+	assert.Len(t, page.Changes, 20*4, "every workout and its three entries")
+}
+
+func TestMemoryWorkoutStoreCopies(t *testing.T) {
+	stores := NewMemoryStores()
+	user := createTestUser(t, stores)
+
+	workout, err := stores.Workouts.CreateWorkout(newTestWorkout(user.ID, "Original"))
+	require.NoError(t, err)
+	*workout.Entries[0].Weight = 500
+	workout.Title = "Changed behind the store's back"
+
+	found, err := stores.Workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "Original", found.Title)
+	assert.Equal(t, 60.0, *found.Entries[0].Weight, "rows don't share memory with the workouts handed in")
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/tokens"
+)
+
+type MemoryTokenStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryTokenStore(db *MemoryDB) *MemoryTokenStore {
+	return &MemoryTokenStore{db: db}
+}
+
+func (t *MemoryTokenStore) CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Insert(token)
+	return token, err
+}
+
+func (t *MemoryTokenStore) Insert(token *tokens.Token) error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	// Tokens must belong to a user, and their hash is the primary key
+	if _, ok := t.db.users[token.UserID]; !ok {
+		return fmt.Errorf("no user found with id %d", token.UserID)
+	}
+	if _, ok := t.db.tokens[string(token.Hash)]; ok {
+		return fmt.Errorf("duplicate token")
+	}
+	stored := *token
+	stored.Plaintext = "" // Only the hash is kept, like in the tokens table
+	t.db.tokens[string(token.Hash)] = stored
+	return nil
+}
+
+func (t *MemoryTokenStore) DeleteAllTokensForUser(scope string, userID int) error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	for hash, token := range t.db.tokens {
+		if token.UserID == userID && token.Scope == scope {
+			delete(t.db.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (t *MemoryTokenStore) RevokeToken(tokenPlaintext string) error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	delete(t.db.tokens, string(tokenHash[:]))
+	return nil
+}
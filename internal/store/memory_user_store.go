@@ -0,0 +1,152 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type MemoryUserStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryUserStore(db *MemoryDB) *MemoryUserStore {
+	return &MemoryUserStore{db: db}
+}
+
+func (s *MemoryUserStore) CreateUser(user *User) (*User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	err := s.db.checkUniqueUser(user)
+	if err != nil {
+		return nil, err
+	}
+	s.db.lastUserID++
+	user.ID = s.db.lastUserID
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	s.db.users[user.ID] = *user
+	return user, nil
+}
+
+// checkUniqueUser enforces the unique constraints of the users table
+func (db *MemoryDB) checkUniqueUser(user *User) error {
+	for _, existing := range db.users {
+		if existing.ID == user.ID {
+			continue
+		}
+		if existing.Username == user.Username {
+			return fmt.Errorf("username %q is already taken", user.Username)
+		}
+		if existing.Email == user.Email {
+			return fmt.Errorf("email %q is already taken", user.Email)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) GetUserByUsername(username string) (*User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, user := range s.db.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryUserStore) UpdateUser(user *User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	existing, ok := s.db.users[user.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	err := s.db.checkUniqueUser(user)
+	if err != nil {
+		return err
+	}
+	existing.Username = user.Username
+	existing.Email = user.Email
+	existing.Bio = user.Bio
+	existing.UpdatedAt = time.Now()
+	s.db.users[user.ID] = existing
+	return nil
+}
+
+// DeleteUser removes the user along with their tokens, workouts and entries, like ON DELETE CASCADE
+func (s *MemoryUserStore) DeleteUser(id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.db.users, id)
+	for hash, token := range s.db.tokens {
+		if token.UserID == id {
+			delete(s.db.tokens, hash)
+		}
+	}
+	for workoutID, workout := range s.db.workouts {
+		if workout.UserID == id {
+			s.db.purgeWorkout(workoutID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) GetUserToken(scope, tokenPlaintext string) (*User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	token, ok := s.db.tokens[string(tokenHash[:])]
+	if !ok || token.Scope != scope || !token.Expiry.After(time.Now()) {
+		return nil, nil
+	}
+	user, ok := s.db.users[token.UserID]
+	if !ok || user.IsDisabled() {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (s *MemoryUserStore) UpdatePassword(user *User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	existing, ok := s.db.users[user.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	existing.PasswordHash = password{hash: user.PasswordHash.hash}
+	existing.UpdatedAt = time.Now()
+	s.db.users[user.ID] = existing
+	return nil
+}
+
+func (s *MemoryUserStore) SetUserDisabled(id int, disabled bool) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	existing, ok := s.db.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	switch {
+	case !disabled:
+		existing.DisabledAt = nil
+	case existing.DisabledAt == nil:
+		existing.DisabledAt = &now
+	}
+	existing.UpdatedAt = now
+	s.db.users[id] = existing
+	return nil
+}
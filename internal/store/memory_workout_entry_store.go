@@ -0,0 +1,123 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// Entries of a workout changed one at a time, in memory. See workout_entry_store.go for how each change works.
+
+func (s *MemoryWorkoutStore) AddWorkoutEntry(workoutID int64, version int, entry *WorkoutEntry) (int, error) {
+	var newVersion int
+	err := s.db.atomically(func() error {
+		workout, err := s.db.touchWorkout(workoutID, version)
+		if err != nil {
+			return err
+		}
+		newVersion = workout.Version
+
+		if entry.OrderIndex == 0 {
+			entry.OrderIndex = 1
+			for _, existing := range s.db.workoutEntries(workout.ID) {
+				entry.OrderIndex = max(entry.OrderIndex, existing.OrderIndex+1)
+			}
+		}
+		entry.ID = 0
+		return s.db.insertEntry(workout, entry)
+	})
+	return newVersion, err
+}
+
+func (s *MemoryWorkoutStore) UpdateWorkoutEntry(workoutID int64, version int, entry *WorkoutEntry) (int, error) {
+	var newVersion int
+	err := s.db.atomically(func() error {
+		workout, err := s.db.touchWorkout(workoutID, version)
+		if err != nil {
+			return err
+		}
+		newVersion = workout.Version
+		return s.db.updateEntry(workoutID, entry)
+	})
+	return newVersion, err
+}
+
+func (s *MemoryWorkoutStore) DeleteWorkoutEntry(workoutID int64, version int, entryID int64) (int, error) {
+	var newVersion int
+	err := s.db.atomically(func() error {
+		workout, err := s.db.touchWorkout(workoutID, version)
+		if err != nil {
+			return err
+		}
+		newVersion = workout.Version
+		return s.db.deleteEntry(workoutID, entryID)
+	})
+	return newVersion, err
+}
+
+func (s *MemoryWorkoutStore) ReorderWorkoutEntries(workoutID int64, version int, entryIDs []int64) (int, error) {
+	var newVersion int
+	err := s.db.atomically(func() error {
+		workout, err := s.db.touchWorkout(workoutID, version)
+		if err != nil {
+			return err
+		}
+		newVersion = workout.Version
+
+		moves, err := reorderEntries(s.db.workoutEntries(workout.ID), entryIDs)
+		if err != nil {
+			return err
+		}
+		for id, orderIndex := range moves {
+			entry := s.db.entries[int(id)]
+			entry.OrderIndex = orderIndex
+			s.db.entries[int(id)] = entry
+			s.db.recordChange(entry.userID, SyncEntityEntry, entry.UUID, SyncOpUpsert)
+		}
+		return nil
+	})
+	return newVersion, err
+}
+
+// touchWorkout bumps the version and updated_at of a workout whose entries are about to change, if it's still at version
+func (db *MemoryDB) touchWorkout(workoutID int64, version int) (*Workout, error) {
+	row, ok := db.workouts[int(workoutID)]
+	if !ok || row.DeletedAt != nil {
+		return nil, fmt.Errorf("no workout found with id %d", workoutID)
+	}
+	if row.Version != version {
+		return nil, ErrVersionConflict
+	}
+	row.UpdatedAt = time.Now()
+	row.Version++
+	db.workouts[row.ID] = row
+	db.recordChange(row.UserID, SyncEntityWorkout, row.UUID, SyncOpUpsert)
+	return &row, nil
+}
+
+func (db *MemoryDB) updateEntry(workoutID int64, entry *WorkoutEntry) error {
+	existing, ok := db.entries[entry.ID]
+	if !ok || existing.workoutID != int(workoutID) {
+		return fmt.Errorf("%w: entry %d does not belong to this workout", ErrInvalidEntries, entry.ID)
+	}
+	err := checkEntry(entry)
+	if err != nil {
+		return err
+	}
+	// The UUID of an entry never changes
+	row := entryRow(entry)
+	row.UUID = existing.UUID
+	existing.WorkoutEntry = row
+	db.entries[entry.ID] = existing
+	db.recordChange(existing.userID, SyncEntityEntry, existing.UUID, SyncOpUpsert)
+	return nil
+}
+
+func (db *MemoryDB) deleteEntry(workoutID int64, entryID int64) error {
+	existing, ok := db.entries[int(entryID)]
+	if !ok || existing.workoutID != int(workoutID) {
+		return fmt.Errorf("%w: entry %d does not belong to this workout", ErrInvalidEntries, entryID)
+	}
+	delete(db.entries, int(entryID))
+	db.recordChange(existing.userID, SyncEntityEntry, existing.UUID, SyncOpDelete)
+	return nil
+}
@@ -0,0 +1,525 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryWorkoutStore keeps workouts in a MemoryDB. See memory_store.go.
+type MemoryWorkoutStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryWorkoutStore(db *MemoryDB) *MemoryWorkoutStore {
+	return &MemoryWorkoutStore{db: db}
+}
+
+// clonePtr copies an optional value, so rows never share memory with the workouts handed in or out of the store
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// Rows as they are stored: without entries (they're kept apart), and with their own copy of every optional value
+func workoutRow(workout *Workout) Workout {
+	row := *workout
+	row.PlannedFor = clonePtr(workout.PlannedFor)
+	row.ExternalID = clonePtr(workout.ExternalID)
+	row.DeletedAt = clonePtr(workout.DeletedAt)
+	row.Entries = nil
+	return row
+}
+
+func entryRow(entry *WorkoutEntry) WorkoutEntry {
+	row := *entry
+	row.Reps = clonePtr(entry.Reps)
+	row.DurationSeconds = clonePtr(entry.DurationSeconds)
+	row.Weight = clonePtr(entry.Weight)
+	return row
+}
+
+func (s *MemoryWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
+	err := s.db.atomically(func() error {
+		inserted, err := s.db.insertWorkout(workout)
+		if err != nil {
+			return err
+		}
+		if !inserted {
+			return ErrDuplicateExternalID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+// insertWorkout is insertWorkout of workout_store.go: false means the user already has a workout with this ExternalID
+func (db *MemoryDB) insertWorkout(workout *Workout) (bool, error) {
+	if workout.Status == "" {
+		workout.Status = defaultWorkoutStatus(workout)
+	}
+	if workout.Entries == nil {
+		workout.Entries = []WorkoutEntry{} // As when it's read back: no entries is an empty list, not null
+	}
+	err := ensureUUID(&workout.UUID)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := db.users[workout.UserID]; !ok {
+		return false, fmt.Errorf("no user found with id %d", workout.UserID)
+	}
+	for _, existing := range db.workouts {
+		if existing.UUID == workout.UUID {
+			return false, fmt.Errorf("a workout with uuid %s already exists", workout.UUID)
+		}
+		// Workouts in the trash count too, like in the unique index
+		if workout.ExternalID != nil && existing.UserID == workout.UserID && existing.ExternalID != nil && *existing.ExternalID == *workout.ExternalID {
+			return false, nil
+		}
+	}
+
+	db.lastWorkoutID++
+	workout.ID = db.lastWorkoutID
+	if workout.UpdatedAt.IsZero() {
+		workout.UpdatedAt = time.Now()
+	}
+	workout.Version = 1
+	workout.DeletedAt = nil
+	db.workouts[workout.ID] = workoutRow(workout)
+	db.recordChange(workout.UserID, SyncEntityWorkout, workout.UUID, SyncOpUpsert)
+
+	for i := range workout.Entries {
+		err = db.insertEntry(workout, &workout.Entries[i])
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// checkEntry is the valid_workout_entry constraint of the workout_entries table: an entry has either reps or a duration
+func checkEntry(entry *WorkoutEntry) error {
+	if (entry.Reps == nil) == (entry.DurationSeconds == nil) {
+		return fmt.Errorf("entry %q must have either reps or duration_seconds", entry.ExerciseName)
+	}
+	return nil
+}
+
+func (db *MemoryDB) insertEntry(workout *Workout, entry *WorkoutEntry) error {
+	err := checkEntry(entry)
+	if err != nil {
+		return err
+	}
+	err = ensureUUID(&entry.UUID)
+	if err != nil {
+		return err
+	}
+	for _, existing := range db.entries {
+		if existing.UUID == entry.UUID {
+			return fmt.Errorf("an entry with uuid %s already exists", entry.UUID)
+		}
+	}
+
+	db.lastEntryID++
+	entry.ID = db.lastEntryID
+	db.entries[entry.ID] = memoryEntry{WorkoutEntry: entryRow(entry), workoutID: workout.ID, userID: workout.UserID}
+	db.recordChange(workout.UserID, SyncEntityEntry, entry.UUID, SyncOpUpsert)
+	return nil
+}
+
+func (s *MemoryWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.getWorkoutByID(id), nil
+}
+
+// getWorkoutByID returns the workout with its entries, or nil if there is none (or it's in the trash)
+func (db *MemoryDB) getWorkoutByID(id int64) *Workout {
+	row, ok := db.workouts[int(id)]
+	if !ok || row.DeletedAt != nil {
+		return nil
+	}
+	return db.loadWorkout(row)
+}
+
+// loadWorkout copies a stored workout and attaches its entries
+func (db *MemoryDB) loadWorkout(row Workout) *Workout {
+	workout := workoutRow(&row)
+	workout.Entries = db.workoutEntries(workout.ID)
+	if workout.Entries == nil {
+		workout.Entries = []WorkoutEntry{} // Like getWorkoutEntries
+	}
+	return &workout
+}
+
+// workoutEntries returns the entries of a workout, in order. nil if it has none.
+func (db *MemoryDB) workoutEntries(workoutID int) []WorkoutEntry {
+	var entries []WorkoutEntry
+	for _, entry := range db.entries {
+		if entry.workoutID == workoutID {
+			entries = append(entries, entryRow(&entry.WorkoutEntry))
+		}
+	}
+	slices.SortFunc(entries, func(a, b WorkoutEntry) int {
+		return cmp.Or(cmp.Compare(a.OrderIndex, b.OrderIndex), cmp.Compare(a.ID, b.ID))
+	})
+	return entries
+}
+
+func (s *MemoryWorkoutStore) GetWorkoutByUUID(id string) (*Workout, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.getWorkoutByUUID(id), nil
+}
+
+func (db *MemoryDB) getWorkoutByUUID(id string) *Workout {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+	for _, row := range db.workouts {
+		if row.UUID == parsed.String() && row.DeletedAt == nil {
+			return db.loadWorkout(row)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryWorkoutStore) UpdateWorkout(workout *Workout) error {
+	return s.db.atomically(func() error {
+		return s.db.updateWorkout(workout)
+	})
+}
+
+// updateWorkout is updateWorkout of workout_store.go, version check included
+func (db *MemoryDB) updateWorkout(workout *Workout) error {
+	if workout.Status == "" {
+		workout.Status = defaultWorkoutStatus(workout)
+	}
+
+	row, ok := db.workouts[workout.ID]
+	if !ok || row.DeletedAt != nil {
+		return fmt.Errorf("no workout found with id %d", workout.ID)
+	}
+	if row.Version != workout.Version {
+		return ErrVersionConflict
+	}
+	if _, ok := db.users[workout.UserID]; !ok {
+		return fmt.Errorf("no user found with id %d", workout.UserID)
+	}
+
+	row.UserID = workout.UserID
+	row.Title = workout.Title
+	row.Description = workout.Description
+	row.DurationMinutes = workout.DurationMinutes
+	row.CaloriesBurned = workout.CaloriesBurned
+	row.PlannedFor = clonePtr(workout.PlannedFor)
+	row.Status = workout.Status
+	row.UpdatedAt = workout.UpdatedAt
+	if row.UpdatedAt.IsZero() {
+		row.UpdatedAt = time.Now()
+	}
+	row.Version++
+	db.workouts[row.ID] = row
+	db.recordChange(row.UserID, SyncEntityWorkout, row.UUID, SyncOpUpsert)
+	workout.UpdatedAt, workout.Version = row.UpdatedAt, row.Version
+
+	diff, err := diffEntries(workout, db.workoutEntries(workout.ID))
+	if err != nil {
+		return err
+	}
+	for _, entry := range diff.inserted {
+		err = db.insertEntry(workout, entry)
+		if err != nil {
+			return err
+		}
+	}
+	for _, entry := range diff.updated {
+		err = db.updateEntry(int64(workout.ID), entry)
+		if err != nil {
+			return err
+		}
+	}
+	for _, entryID := range diff.deleted {
+		err = db.deleteEntry(int64(workout.ID), entryID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryWorkoutStore) DeleteWorkout(id int64, version int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.deleteWorkout(id, version)
+}
+
+// deleteWorkout puts the workout in the trash, if it's still at the version that was read
+func (db *MemoryDB) deleteWorkout(id int64, version int) error {
+	row, ok := db.workouts[int(id)]
+	if !ok || row.DeletedAt != nil {
+		return fmt.Errorf("no workout found with id %d", id)
+	}
+	if row.Version != version {
+		return ErrVersionConflict
+	}
+	now := time.Now()
+	row.DeletedAt = &now
+	db.workouts[row.ID] = row
+	db.recordChange(row.UserID, SyncEntityWorkout, row.UUID, SyncOpDelete)
+	return nil
+}
+
+// purgeWorkout removes a workout for good, along with its entries (ON DELETE CASCADE)
+func (db *MemoryDB) purgeWorkout(id int) {
+	row := db.workouts[id]
+	for entryID, entry := range db.entries {
+		if entry.workoutID == id {
+			delete(db.entries, entryID)
+			db.recordChange(entry.userID, SyncEntityEntry, entry.UUID, SyncOpDelete)
+		}
+	}
+	delete(db.workouts, id)
+	db.recordChange(row.UserID, SyncEntityWorkout, row.UUID, SyncOpDelete)
+}
+
+func (s *MemoryWorkoutStore) GetWorkoutOwner(id int64) (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.getWorkoutOwner(id)
+}
+
+func (db *MemoryDB) getWorkoutOwner(id int64) (int, error) {
+	row, ok := db.workouts[int(id)]
+	if !ok || row.DeletedAt != nil {
+		return 0, fmt.Errorf("no workout found with id %d", id)
+	}
+	return row.UserID, nil
+}
+
+// Scheduling:
+
+func (s *MemoryWorkoutStore) GetUpcomingWorkouts(userID int) ([]Workout, error) {
+	now := time.Now()
+	return s.findWorkouts(func(w *Workout) bool {
+		return w.UserID == userID && w.Status == WorkoutStatusPlanned && w.PlannedFor != nil && !w.PlannedFor.Before(now) && w.DeletedAt == nil
+	}, byPlannedFor), nil
+}
+
+func (s *MemoryWorkoutStore) GetOverdueWorkouts(userID int) ([]Workout, error) {
+	now := time.Now()
+	return s.findWorkouts(func(w *Workout) bool {
+		return w.UserID == userID && w.Status == WorkoutStatusPlanned && w.PlannedFor != nil && w.PlannedFor.Before(now) && w.DeletedAt == nil
+	}, byPlannedFor), nil
+}
+
+func (s *MemoryWorkoutStore) GetScheduledWorkouts(userID int) ([]Workout, error) {
+	return s.findWorkouts(func(w *Workout) bool {
+		return w.UserID == userID && w.PlannedFor != nil && w.DeletedAt == nil
+	}, byPlannedFor), nil
+}
+
+func byPlannedFor(a, b *Workout) int {
+	return cmp.Or(a.PlannedFor.Compare(*b.PlannedFor), cmp.Compare(a.ID, b.ID))
+}
+
+func byID(a, b *Workout) int {
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// findWorkouts returns the workouts matching keep with their entries, in the order of compare.
+// The in-memory equivalent of queryWorkouts.
+func (s *MemoryWorkoutStore) findWorkouts(keep func(*Workout) bool, compare func(a, b *Workout) int) []Workout {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.findWorkouts(keep, compare)
+}
+
+func (db *MemoryDB) findWorkouts(keep func(*Workout) bool, compare func(a, b *Workout) int) []Workout {
+	workouts := []Workout{}
+	for _, row := range db.workouts {
+		if keep(&row) {
+			workouts = append(workouts, *db.loadWorkout(row))
+		}
+	}
+	slices.SortFunc(workouts, func(a, b Workout) int { return compare(&a, &b) })
+	return workouts
+}
+
+func (s *MemoryWorkoutStore) GetEntriesForWorkouts(workoutIDs []int64) (map[int64][]WorkoutEntry, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	entries := make(map[int64][]WorkoutEntry, len(workoutIDs))
+	for _, id := range workoutIDs {
+		if found := s.db.workoutEntries(int(id)); found != nil {
+			entries[id] = found
+		}
+	}
+	return entries, nil
+}
+
+// GetRecentWorkouts returns the user's latest workouts, most recently changed first, without their entries
+func (s *MemoryWorkoutStore) GetRecentWorkouts(userID int, limit int) ([]Workout, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	workouts := []Workout{}
+	for _, row := range s.db.workouts {
+		if row.UserID == userID && row.DeletedAt == nil {
+			workouts = append(workouts, workoutRow(&row))
+		}
+	}
+	slices.SortFunc(workouts, func(a, b Workout) int {
+		return cmp.Or(b.UpdatedAt.Compare(a.UpdatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	if len(workouts) > limit {
+		workouts = workouts[:limit]
+	}
+	return workouts, nil
+}
+
+// GetPersonalRecords returns the heaviest entry of each exercise, see PostgresWorkoutStore.GetPersonalRecords
+func (s *MemoryWorkoutStore) GetPersonalRecords(userID int) ([]PersonalRecord, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	best := map[string]PersonalRecord{}
+	for _, entry := range s.db.entries {
+		workout := s.db.workouts[entry.workoutID]
+		if entry.userID != userID || entry.Weight == nil || workout.DeletedAt != nil {
+			continue
+		}
+		record := PersonalRecord{ExerciseName: entry.ExerciseName, Weight: *entry.Weight, WorkoutID: workout.ID, EntryID: entry.ID, AchievedAt: workout.UpdatedAt}
+		name := strings.ToLower(entry.ExerciseName)
+		current, ok := best[name]
+		// The heaviest, and the earliest of equally heavy ones
+		if !ok || cmp.Or(cmp.Compare(record.Weight, current.Weight), current.AchievedAt.Compare(record.AchievedAt), cmp.Compare(current.EntryID, record.EntryID)) > 0 {
+			best[name] = record
+		}
+	}
+
+	records := []PersonalRecord{}
+	for _, name := range slices.Sorted(maps.Keys(best)) {
+		records = append(records, best[name])
+	}
+	return records, nil
+}
+
+// StreamWorkouts calls fn once per workout of the user, ordered by ID. fn runs without the lock held, so it can use the store.
+func (s *MemoryWorkoutStore) StreamWorkouts(userID int, fn func(*Workout) error) error {
+	workouts := s.findWorkouts(func(w *Workout) bool {
+		return w.UserID == userID && w.DeletedAt == nil
+	}, byID)
+	for i := range workouts {
+		if workouts[i].Entries == nil {
+			workouts[i].Entries = []WorkoutEntry{}
+		}
+		err := fn(&workouts[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Importing:
+
+// ImportWorkouts inserts the workouts in batches of importBatchSize, each all or nothing, like PostgresWorkoutStore.ImportWorkouts
+func (s *MemoryWorkoutStore) ImportWorkouts(workouts []*Workout) (int, error) {
+	created := 0
+	for start := 0; start < len(workouts); start += importBatchSize {
+		end := min(start+importBatchSize, len(workouts))
+
+		batchCreated := 0
+		err := s.db.atomically(func() error {
+			for _, workout := range workouts[start:end] {
+				inserted, err := s.db.insertWorkout(workout)
+				if err != nil {
+					return err
+				}
+				if inserted {
+					batchCreated++
+				} else {
+					workout.ID = 0
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return created, err
+		}
+		created += batchCreated
+	}
+	return created, nil
+}
+
+// Transactions:
+
+/*
+	WithTransaction runs fn with the MemoryDB locked, and undoes everything fn did if it returns an error.
+	fn must only go through tx: calling the store itself from fn would wait forever on the lock.
+*/
+
+func (s *MemoryWorkoutStore) WithTransaction(fn func(tx WorkoutTx) error) error {
+	return s.db.atomically(func() error {
+		return fn(&memoryWorkoutTx{db: s.db})
+	})
+}
+
+// memoryWorkoutTx implements WorkoutTx on a MemoryDB that's already locked
+type memoryWorkoutTx struct {
+	db *MemoryDB
+}
+
+func (t *memoryWorkoutTx) CreateWorkout(workout *Workout) (*Workout, error) {
+	inserted, err := t.db.insertWorkout(workout)
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		return nil, ErrDuplicateExternalID
+	}
+	return workout, nil
+}
+
+func (t *memoryWorkoutTx) GetWorkoutByID(id int64) (*Workout, error) {
+	return t.db.getWorkoutByID(id), nil
+}
+
+func (t *memoryWorkoutTx) UpdateWorkout(workout *Workout) error {
+	return t.db.updateWorkout(workout)
+}
+
+func (t *memoryWorkoutTx) DeleteWorkout(id int64, version int) error {
+	return t.db.deleteWorkout(id, version)
+}
+
+func (t *memoryWorkoutTx) GetWorkoutOwner(id int64) (int, error) {
+	return t.db.getWorkoutOwner(id)
+}
+
+func (t *memoryWorkoutTx) GetWorkoutByUUID(id string) (*Workout, error) {
+	return t.db.getWorkoutByUUID(id), nil
+}
+
+func (t *memoryWorkoutTx) GetWorkoutDeletedAt(userID int, workoutUUID string) (*time.Time, error) {
+	return t.db.getWorkoutDeletedAt(userID, workoutUUID), nil
+}
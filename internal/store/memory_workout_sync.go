@@ -0,0 +1,104 @@
+package store
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Offline sync, in memory. The MemoryDB records changes where the triggers of sync_changes would (see recordChange).
+
+func (s *MemoryWorkoutStore) GetChangesSince(userID int, cursor int64, limit int) (*SyncPage, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	page := &SyncPage{Cursor: cursor}
+	var all []SyncChange
+	for _, change := range s.db.changes {
+		if len(all) == limit {
+			break
+		}
+		if change.userID == userID && change.Cursor > cursor {
+			all = append(all, change.SyncChange)
+			page.Cursor = change.Cursor
+		}
+	}
+	page.HasMore = len(all) == limit
+
+	compacted, workoutUUIDs, entryUUIDs := compactChanges(all)
+
+	workoutsByUUID := map[string]*Workout{}
+	for _, id := range workoutUUIDs {
+		workout := s.db.getWorkoutByUUID(id)
+		if workout != nil && workout.UserID == userID {
+			workoutsByUUID[id] = workout
+		}
+	}
+
+	// Entries of workouts in the trash are left out, like their workout
+	entriesByUUID := map[string]*WorkoutEntry{}
+	workoutOfEntry := map[string]string{}
+	wanted := make(map[string]bool, len(entryUUIDs))
+	for _, id := range entryUUIDs {
+		wanted[id] = true
+	}
+	for _, entry := range s.db.entries {
+		workout := s.db.workouts[entry.workoutID]
+		if !wanted[entry.UUID] || entry.userID != userID || workout.DeletedAt != nil {
+			continue
+		}
+		row := entryRow(&entry.WorkoutEntry)
+		entriesByUUID[entry.UUID] = &row
+		workoutOfEntry[entry.UUID] = workout.UUID
+	}
+
+	page.Changes = attachChanges(compacted, workoutsByUUID, entriesByUUID, workoutOfEntry)
+	return page, nil
+}
+
+func (s *MemoryWorkoutStore) PruneSyncChanges(changedBefore time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// Walking backwards, an entity seen already has a later change
+	seen := map[string]bool{}
+	kept := make([]memoryChange, 0, len(s.db.changes))
+	var pruned int64
+	for i := len(s.db.changes) - 1; i >= 0; i-- {
+		change := s.db.changes[i]
+		key := change.Entity + ":" + change.UUID
+		if seen[key] && change.ChangedAt.Before(changedBefore) {
+			pruned++
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, change)
+	}
+	slices.Reverse(kept)
+	s.db.changes = kept
+	return pruned, nil
+}
+
+func (s *MemoryWorkoutStore) GetWorkoutDeletedAt(userID int, workoutUUID string) (*time.Time, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.getWorkoutDeletedAt(userID, workoutUUID), nil
+}
+
+// getWorkoutDeletedAt finds the latest delete of the workout in the change feed
+func (db *MemoryDB) getWorkoutDeletedAt(userID int, workoutUUID string) *time.Time {
+	parsed, err := uuid.Parse(workoutUUID)
+	if err != nil {
+		return nil
+	}
+	for i := len(db.changes) - 1; i >= 0; i-- {
+		change := db.changes[i]
+		if change.userID == userID && change.Entity == SyncEntityWorkout && change.UUID == parsed.String() && change.Op == SyncOpDelete {
+			deletedAt := change.ChangedAt
+			return &deletedAt
+		}
+	}
+	return nil
+}
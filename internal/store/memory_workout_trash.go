@@ -0,0 +1,72 @@
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The trash, in memory. See workout_trash.go.
+
+func (s *MemoryWorkoutStore) GetDeletedWorkouts(userID int) ([]Workout, error) {
+	return s.findWorkouts(func(w *Workout) bool {
+		return w.UserID == userID && w.DeletedAt != nil
+	}, func(a, b *Workout) int {
+		return b.DeletedAt.Compare(*a.DeletedAt)
+	}), nil
+}
+
+func (s *MemoryWorkoutStore) RestoreWorkout(userID int, id int64) (*Workout, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.restoreWorkout(userID, id), nil
+}
+
+func (s *MemoryWorkoutStore) RestoreWorkoutByUUID(userID int, workoutUUID string) (workout *Workout, err error) {
+	err = s.WithTransaction(func(tx WorkoutTx) error {
+		workout, err = tx.RestoreWorkoutByUUID(userID, workoutUUID)
+		return err
+	})
+	return workout, err
+}
+
+func (t *memoryWorkoutTx) RestoreWorkoutByUUID(userID int, workoutUUID string) (*Workout, error) {
+	parsed, err := uuid.Parse(workoutUUID)
+	if err != nil {
+		return nil, nil
+	}
+	for _, row := range t.db.workouts {
+		if row.UserID == userID && row.UUID == parsed.String() && row.DeletedAt != nil {
+			return t.db.restoreWorkout(userID, int64(row.ID)), nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *MemoryDB) restoreWorkout(userID int, id int64) *Workout {
+	row, ok := db.workouts[int(id)]
+	if !ok || row.UserID != userID || row.DeletedAt == nil {
+		return nil
+	}
+	row.DeletedAt = nil
+	row.UpdatedAt = time.Now()
+	row.Version++
+	db.workouts[row.ID] = row
+	db.recordChange(row.UserID, SyncEntityWorkout, row.UUID, SyncOpUpsert)
+	return db.getWorkoutByID(id)
+}
+
+func (s *MemoryWorkoutStore) PurgeDeletedWorkouts(deletedBefore time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var purged int64
+	for id, row := range s.db.workouts {
+		if row.DeletedAt != nil && row.DeletedAt.Before(deletedBefore) {
+			s.db.purgeWorkout(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
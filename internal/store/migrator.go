@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+/*
+	Migrator runs the migrations of a database, one way or the other. It goes through a goose Provider rather than
+	goose's package level functions, which share their dialect and filesystem between callers: tests migrating several
+	databases at once would race on them.
+
+	On Postgres, every command holds an advisory lock (goose's session locker) while it runs, so instances starting at
+	the same time, or a `migrate` command run during a deploy, wait for each other instead of applying the same migration
+	twice. SQLite has a single writer anyway.
+*/
+
+// Migrator runs the migrations of one database, see NewMigrator
+type Migrator struct {
+	provider *goose.Provider
+}
+
+// NewMigrator loads the migrations in dir of migrationFS (e.g. the embedded migrations.FS), or in its sqlite
+// subdirectory when db is a SQLite database
+func NewMigrator(db *sql.DB, migrationFS fs.FS, dir string) (*Migrator, error) {
+	dialect := goose.DialectPostgres
+	if _, ok := db.Driver().(*sqlite3.SQLiteDriver); ok {
+		dialect = goose.DialectSQLite3
+		dir = path.Join(dir, "sqlite")
+	}
+	migrations, err := fs.Sub(migrationFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migrations: %w", err)
+	}
+
+	options := []goose.ProviderOption{goose.WithVerbose(true)}
+	if dialect == goose.DialectPostgres {
+		locker, err := lock.NewPostgresSessionLocker()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, goose.WithSessionLocker(locker))
+	}
+	provider, err := goose.NewProvider(dialect, db, migrations, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	return &Migrator{provider: provider}, nil
+}
+
+// Up applies all pending migrations
+func (m *Migrator) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	return m.provider.Up(ctx)
+}
+
+// Down rolls back the last applied migration
+func (m *Migrator) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	return m.provider.Down(ctx)
+}
+
+// Redo rolls back the last applied migration and applies it again
+func (m *Migrator) Redo(ctx context.Context) ([]*goose.MigrationResult, error) {
+	down, err := m.provider.Down(ctx)
+	if err != nil {
+		return nil, err
+	}
+	up, err := m.provider.UpByOne(ctx)
+	if err != nil {
+		return []*goose.MigrationResult{down}, err
+	}
+	return []*goose.MigrationResult{down, up}, nil
+}
+
+// To migrates up or down to version, which is the last migration applied afterwards. 0 rolls everything back.
+func (m *Migrator) To(ctx context.Context, version int64) ([]*goose.MigrationResult, error) {
+	if version != 0 && !m.hasVersion(version) {
+		return nil, fmt.Errorf("no migration with version %d", version)
+	}
+	current, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version >= current {
+		return m.provider.UpTo(ctx, version)
+	}
+	return m.provider.DownTo(ctx, version)
+}
+
+func (m *Migrator) hasVersion(version int64) bool {
+	for _, source := range m.provider.ListSources() {
+		if source.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns every migration, applied or pending
+func (m *Migrator) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	return m.provider.Status(ctx)
+}
+
+// Version returns the version of the last migration applied
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	return m.provider.GetDBVersion(ctx)
+}
+
+// HasPending reports whether some migrations haven't been applied yet
+func (m *Migrator) HasPending(ctx context.Context) (bool, error) {
+	return m.provider.HasPending(ctx)
+}
+
+// migrationFile matches the file names of migrations, e.g. 00013_workout_sessions.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_.+\.sql$`)
+
+const migrationTemplate = `-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
+`
+
+// CreateMigration adds an empty migration to the directory dir (e.g. migrations) and its SQLite version to dir/sqlite,
+// numbered after the last one, and returns their paths. Every Postgres migration has its SQLite version (see MigrateFS),
+// so both are created at once even when only one needs changes: the other then stays a no-op.
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, errors.New("the migration needs a name")
+	}
+
+	var last int64
+	for _, d := range []string{dir, filepath.Join(dir, "sqlite")} {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			match := migrationFile.FindStringSubmatch(entry.Name())
+			if match == nil {
+				continue
+			}
+			version, err := strconv.ParseInt(match[1], 10, 64)
+			if err == nil && version > last {
+				last = version
+			}
+		}
+	}
+
+	file := fmt.Sprintf("%05d_%s.sql", last+1, name)
+	paths := []string{filepath.Join(dir, file), filepath.Join(dir, "sqlite", file)}
+	for _, p := range paths {
+		// O_EXCL, in case someone else created it in the meantime: never overwrite a migration
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.WriteString(migrationTemplate)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/OlivierCoq/go_api_template/migrations"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSQLiteMigrator(t *testing.T) (*Migrator, *sql.DB) {
+	db, err := Open(Config{Driver: DriverSQLite, DSN: ":memory:"})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	migrator, err := NewMigrator(db, migrations.FS, ".")
+	require.NoError(t, err)
+	return migrator, db
+}
+
+func TestMigrator(t *testing.T) {
+	migrator, db := newSQLiteMigrator(t)
+	ctx := context.Background()
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	last := statuses[len(statuses)-1].Source.Version
+
+	pending, err := migrator.HasPending(ctx)
+	require.NoError(t, err)
+	assert.True(t, pending)
+
+	_, err = migrator.To(ctx, 3)
+	require.NoError(t, err)
+	version, err := migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, version)
+	statuses, err = migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, goose.StateApplied, statuses[2].State)
+	assert.Equal(t, goose.StatePending, statuses[3].State)
+
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	pending, err = migrator.HasPending(ctx)
+	require.NoError(t, err)
+	assert.False(t, pending)
+
+	// Redo leaves the database where it was, with the last migration applied again
+	results, err := migrator.Redo(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, last, results[1].Source.Version)
+	version, err = migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, last, version)
+
+	_, err = migrator.Down(ctx)
+	require.NoError(t, err)
+	version, err = migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, last-1, version)
+
+	// Down to nothing, which drops every table
+	_, err = migrator.To(ctx, 0)
+	require.NoError(t, err)
+	var tables int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'`).Scan(&tables))
+	assert.Zero(t, tables)
+
+	_, err = migrator.To(ctx, last+1)
+	assert.Error(t, err, "there is no such migration")
+}
+
+func TestMigratePostgresConcurrently(t *testing.T) {
+	t.Parallel()
+	db := setupTestDB(t)
+	defer db.Close()
+	migrator, err := NewMigrator(db, migrations.FS, ".")
+	require.NoError(t, err)
+	_, err = migrator.To(context.Background(), 0)
+	require.NoError(t, err)
+
+	// Instances starting at the same time: the advisory lock makes them apply the migrations one after the other
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = MigrateFS(db, migrations.FS, ".")
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	pending, err := migrator.HasPending(context.Background())
+	require.NoError(t, err)
+	assert.False(t, pending)
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sqlite"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00007_existing.sql"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sqlite", "00008_only_sqlite.sql"), nil, 0o644))
+
+	paths, err := CreateMigration(dir, "Add Workout Tags")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "00009_add_workout_tags.sql"),
+		filepath.Join(dir, "sqlite", "00009_add_workout_tags.sql"),
+	}, paths)
+	content, err := os.ReadFile(paths[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "-- +goose Up")
+	assert.Contains(t, string(content), "-- +goose Down")
+
+	next, err := CreateMigration(dir, "add workout tags")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "00010_add_workout_tags.sql"), next[0])
+
+	_, err = CreateMigration(dir, "!!!")
+	assert.Error(t, err)
+}
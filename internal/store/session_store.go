@@ -0,0 +1,373 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+/*
+	Live workout sessions.
+	A session is a workout being done right now: sets are logged one by one as they happen, timestamped by the database
+	(so every device of the user, and every instance of the API, agrees on the time), with optional rest timers in between.
+	Finishing a session saves it as a completed Workout. Sessions live in the database, so they survive restarts;
+	the ones left open without any activity for too long are expired by ExpireSessions.
+*/
+
+// Session statuses. Active and paused sessions are "open": a user has at most one at a time.
+const (
+	SessionStatusActive   = "active"
+	SessionStatusPaused   = "paused"
+	SessionStatusFinished = "finished"
+	SessionStatusExpired  = "expired"
+)
+
+// ErrSessionInProgress is returned when starting a session while the user already has one open
+var ErrSessionInProgress = errors.New("a workout session is already in progress")
+
+type WorkoutSession struct {
+	ID             int64          `json:"id"`
+	UserID         int            `json:"user_id"`
+	TemplateID     *int64         `json:"template_id"` // The workout the session was started from, if any
+	Title          string         `json:"title"`
+	Description    string         `json:"description"`
+	Plan           []WorkoutEntry `json:"plan,omitempty"` // Entries of the template, for the client to follow
+	Status         string         `json:"status"`
+	StartedAt      time.Time      `json:"started_at"`
+	PausedAt       *time.Time     `json:"paused_at"`
+	PausedSeconds  int            `json:"-"` // Time spent in earlier pauses, see ElapsedSeconds
+	RestStartedAt  *time.Time     `json:"rest_started_at"`
+	RestEndsAt     *time.Time     `json:"rest_ends_at"`
+	LastActivityAt time.Time      `json:"last_activity_at"`
+	FinishedAt     *time.Time     `json:"finished_at"`
+	WorkoutID      *int64         `json:"workout_id"` // The workout it was saved as, once finished
+	Sets           []SessionSet   `json:"sets"`
+
+	// Timers, computed when the session is read, as of ServerTime
+	ServerTime           time.Time `json:"server_time"`
+	ElapsedSeconds       int       `json:"elapsed_seconds"`        // Time spent working out, pauses excluded
+	RestRemainingSeconds int       `json:"rest_remaining_seconds"` // 0 when not resting
+}
+
+type SessionSet struct {
+	ID              int64     `json:"id"`
+	ExerciseName    string    `json:"exercise_name"`
+	Reps            *int      `json:"reps"`
+	DurationSeconds *int      `json:"duration_seconds"`
+	Weight          *float64  `json:"weight"`
+	Notes           string    `json:"notes"`
+	LoggedAt        time.Time `json:"logged_at"`
+}
+
+// IsOpen reports whether the session can still be worked on
+func (s *WorkoutSession) IsOpen() bool {
+	return s.Status == SessionStatusActive || s.Status == SessionStatusPaused
+}
+
+// computeTimers fills in the timers of the session as of now
+func (s *WorkoutSession) computeTimers(now time.Time) {
+	s.ServerTime = now
+	end := now
+	if s.FinishedAt != nil {
+		end = *s.FinishedAt
+	}
+	paused := time.Duration(s.PausedSeconds) * time.Second
+	if s.PausedAt != nil {
+		paused += end.Sub(*s.PausedAt)
+	}
+
+	s.ElapsedSeconds = int((end.Sub(s.StartedAt) - paused).Seconds())
+	if s.ElapsedSeconds < 0 {
+		s.ElapsedSeconds = 0
+	}
+	s.RestRemainingSeconds = 0
+	if s.Status == SessionStatusActive && s.RestEndsAt != nil && s.RestEndsAt.After(now) {
+		// Rounded up, so a timer showing 0 is really over
+		s.RestRemainingSeconds = int((s.RestEndsAt.Sub(now) + time.Second - 1) / time.Second)
+	}
+}
+
+type PostgresSessionStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSessionStore(db *sql.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{db: db}
+}
+
+/*
+	Every change to a session is made with the status it requires in the WHERE clause of the query, so it's decided by
+	the database even when two devices act at the same time. Methods returning a bool report whether the change was made:
+	false means the user has no session with that ID in the required status.
+*/
+
+type SessionStore interface {
+	CreateSession(session *WorkoutSession) (*WorkoutSession, error)
+	GetSession(userID int, id int64) (*WorkoutSession, error)
+	GetOpenSession(userID int) (*WorkoutSession, error)
+	LogSessionSet(userID int, sessionID int64, set *SessionSet, restSeconds int) (bool, error)
+	StartSessionRest(userID int, sessionID int64, seconds int) (bool, error)
+	PauseSession(userID int, sessionID int64) (bool, error)
+	ResumeSession(userID int, sessionID int64) (bool, error)
+	FinishSession(userID int, sessionID int64) (*Workout, error)
+	DiscardSession(userID int, sessionID int64) (bool, error)
+	ExpireSessions(inactiveSince time.Time) (int64, error)
+}
+
+const sessionColumns = `id, user_id, template_id, title, description, plan, status, started_at, paused_at, paused_seconds,
+	rest_started_at, rest_ends_at, last_activity_at, finished_at, workout_id, NOW()`
+
+func scanSession(row scanner, session *WorkoutSession) error {
+	var plan []byte
+	var now time.Time
+	err := row.Scan(&session.ID, &session.UserID, &session.TemplateID, &session.Title, &session.Description, &plan, &session.Status,
+		&session.StartedAt, &session.PausedAt, &session.PausedSeconds, &session.RestStartedAt, &session.RestEndsAt,
+		&session.LastActivityAt, &session.FinishedAt, &session.WorkoutID, &now)
+	if err != nil {
+		return err
+	}
+	if plan != nil {
+		err = json.Unmarshal(plan, &session.Plan)
+		if err != nil {
+			return err
+		}
+	}
+	session.computeTimers(now)
+	return nil
+}
+
+// CreateSession starts a session and returns it. It returns ErrSessionInProgress if the user already has one open.
+func (s *PostgresSessionStore) CreateSession(session *WorkoutSession) (*WorkoutSession, error) {
+	var plan interface{}
+	if len(session.Plan) > 0 {
+		planJSON, err := json.Marshal(session.Plan)
+		if err != nil {
+			return nil, err
+		}
+		plan = string(planJSON)
+	}
+
+	// Same trick as insertWorkout: the unique index on open sessions makes a second one a no-op, with no row returned
+	query := `INSERT INTO workout_sessions (user_id, template_id, title, description, plan)
+			  VALUES ($1, $2, $3, $4, $5)
+			  ON CONFLICT (user_id) WHERE status IN ('active', 'paused') DO NOTHING
+			  RETURNING id`
+	var id int64
+	err := s.db.QueryRow(query, session.UserID, session.TemplateID, session.Title, session.Description, plan).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSession(session.UserID, id)
+}
+
+// GetSession returns a session of the user with its sets, or nil if there is no such session
+func (s *PostgresSessionStore) GetSession(userID int, id int64) (*WorkoutSession, error) {
+	query := `SELECT ` + sessionColumns + ` FROM workout_sessions WHERE id = $1 AND user_id = $2`
+	return getSession(s.db, query, id, userID)
+}
+
+// GetOpenSession returns the session the user has going on, or nil
+func (s *PostgresSessionStore) GetOpenSession(userID int) (*WorkoutSession, error) {
+	query := `SELECT ` + sessionColumns + ` FROM workout_sessions WHERE user_id = $1 AND status IN ('active', 'paused')`
+	return getSession(s.db, query, userID)
+}
+
+func getSession(q queryer, query string, args ...interface{}) (*WorkoutSession, error) {
+	session := &WorkoutSession{}
+	err := scanSession(q.QueryRow(query, args...), session)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.Sets, err = getSessionSets(q, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func getSessionSets(q queryer, sessionID int64) ([]SessionSet, error) {
+	query := `SELECT id, exercise_name, reps, duration_seconds, weight, notes, logged_at
+			  FROM session_sets
+			  WHERE session_id = $1
+			  ORDER BY logged_at, id`
+	rows, err := q.Query(query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sets := []SessionSet{}
+	for rows.Next() {
+		var set SessionSet
+		err = rows.Scan(&set.ID, &set.ExerciseName, &set.Reps, &set.DurationSeconds, &set.Weight, &set.Notes, &set.LoggedAt)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, rows.Err()
+}
+
+// LogSessionSet adds a set to an active session, timestamped now. Any running rest timer stops, and a new one of
+// restSeconds starts if it's more than 0.
+func (s *PostgresSessionStore) LogSessionSet(userID int, sessionID int64, set *SessionSet, restSeconds int) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	ok, err := startRest(tx, userID, sessionID, restSeconds)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	query := `INSERT INTO session_sets (session_id, exercise_name, reps, duration_seconds, weight, notes)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING id, logged_at`
+	err = tx.QueryRow(query, sessionID, set.ExerciseName, set.Reps, set.DurationSeconds, set.Weight, set.Notes).Scan(&set.ID, &set.LoggedAt)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// StartSessionRest starts a rest timer of seconds on an active session, replacing the running one. 0 stops the timer.
+func (s *PostgresSessionStore) StartSessionRest(userID int, sessionID int64, seconds int) (bool, error) {
+	return startRest(s.db, userID, sessionID, seconds)
+}
+
+func startRest(q queryer, userID int, sessionID int64, seconds int) (bool, error) {
+	query := `UPDATE workout_sessions
+			  SET rest_started_at = CASE WHEN $3 > 0 THEN NOW() END,
+				  rest_ends_at = CASE WHEN $3 > 0 THEN NOW() + $3 * INTERVAL '1 second' END,
+				  last_activity_at = NOW()
+			  WHERE id = $1 AND user_id = $2 AND status = 'active'`
+	return changed(q.Exec(query, sessionID, userID, seconds))
+}
+
+// PauseSession stops the clock of an active session (and its rest timer) until it's resumed
+func (s *PostgresSessionStore) PauseSession(userID int, sessionID int64) (bool, error) {
+	query := `UPDATE workout_sessions
+			  SET status = 'paused', paused_at = NOW(), rest_started_at = NULL, rest_ends_at = NULL, last_activity_at = NOW()
+			  WHERE id = $1 AND user_id = $2 AND status = 'active'`
+	return changed(s.db.Exec(query, sessionID, userID))
+}
+
+func (s *PostgresSessionStore) ResumeSession(userID int, sessionID int64) (bool, error) {
+	query := `UPDATE workout_sessions
+			  SET status = 'active', paused_seconds = paused_seconds + ` + pausedSinceQuery + `, paused_at = NULL, last_activity_at = NOW()
+			  WHERE id = $1 AND user_id = $2 AND status = 'paused'`
+	return changed(s.db.Exec(query, sessionID, userID))
+}
+
+// Seconds spent in the current pause, 0 if not paused
+const pausedSinceQuery = `COALESCE(EXTRACT(EPOCH FROM NOW() - paused_at)::INTEGER, 0)`
+
+/*
+	FinishSession closes an open session and saves it as a completed workout, which it returns (nil if the user has no
+	such open session). See sessionWorkout for how sets become entries. Both happen in one transaction, so a session is
+	never finished without its workout, and saving the workout emits the usual events and webhooks.
+*/
+
+func (s *PostgresSessionStore) FinishSession(userID int, sessionID int64) (*Workout, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE workout_sessions
+			  SET status = 'finished', finished_at = NOW(), paused_seconds = paused_seconds + ` + pausedSinceQuery + `,
+				  paused_at = NULL, rest_started_at = NULL, rest_ends_at = NULL, last_activity_at = NOW()
+			  WHERE id = $1 AND user_id = $2 AND status IN ('active', 'paused')
+			  RETURNING ` + sessionColumns
+	session, err := getSession(tx, query, sessionID, userID)
+	if err != nil || session == nil {
+		return nil, err
+	}
+
+	workout := sessionWorkout(session)
+	_, err = insertWorkout(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`UPDATE workout_sessions SET workout_id = $1 WHERE id = $2`, workout.ID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return workout, tx.Commit()
+}
+
+/*
+	sessionWorkout turns a finished session into a completed workout. Its duration is the time spent working out,
+	pauses excluded. Sets follow each other as entries, except that consecutive identical sets (same exercise, reps,
+	duration and weight) make a single entry, e.g. three sets of 10 squats at 60kg in a row become one entry of 3 sets.
+*/
+
+func sessionWorkout(session *WorkoutSession) *Workout {
+	workout := &Workout{
+		UserID:          session.UserID,
+		Title:           session.Title,
+		Description:     session.Description,
+		DurationMinutes: (session.ElapsedSeconds + 30) / 60, // Rounded to the nearest minute
+		Status:          WorkoutStatusCompleted,
+		Entries:         []WorkoutEntry{},
+	}
+	for _, set := range session.Sets {
+		last := len(workout.Entries) - 1
+		if last >= 0 {
+			previous := &workout.Entries[last]
+			if previous.ExerciseName == set.ExerciseName && sameValue(previous.Reps, set.Reps) &&
+				sameValue(previous.DurationSeconds, set.DurationSeconds) && sameValue(previous.Weight, set.Weight) {
+				previous.Sets++
+				continue
+			}
+		}
+		workout.Entries = append(workout.Entries, WorkoutEntry{
+			ExerciseName:    set.ExerciseName,
+			Sets:            1,
+			Reps:            set.Reps,
+			DurationSeconds: set.DurationSeconds,
+			Weight:          set.Weight,
+			Notes:           set.Notes,
+			OrderIndex:      len(workout.Entries) + 1,
+		})
+	}
+	return workout
+}
+
+// DiscardSession deletes an open session and its sets, without saving anything
+func (s *PostgresSessionStore) DiscardSession(userID int, sessionID int64) (bool, error) {
+	query := `DELETE FROM workout_sessions WHERE id = $1 AND user_id = $2 AND status IN ('active', 'paused')`
+	return changed(s.db.Exec(query, sessionID, userID))
+}
+
+// ExpireSessions closes the open sessions with no activity since inactiveSince, and returns how many there were.
+// Expired sessions aren't saved as workouts; their sets stay readable with GetSession.
+func (s *PostgresSessionStore) ExpireSessions(inactiveSince time.Time) (int64, error) {
+	query := `UPDATE workout_sessions
+			  SET status = 'expired', finished_at = last_activity_at, paused_at = NULL, rest_started_at = NULL, rest_ends_at = NULL
+			  WHERE status IN ('active', 'paused') AND last_activity_at < $1`
+	res, err := s.db.Exec(query, inactiveSince)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// changed reports whether a statement affected any row
+func changed(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	return rowsAffected > 0, err
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These don't need the test database: they cover how sessions are computed, not how they're saved
+
+func TestSessionTimers(t *testing.T) {
+	start := time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC)
+	pausedAt := start.Add(40 * time.Minute)
+	restEnds := start.Add(30*time.Minute + 500*time.Millisecond)
+
+	session := &WorkoutSession{Status: SessionStatusActive, StartedAt: start, PausedSeconds: 300, RestEndsAt: &restEnds}
+	session.computeTimers(start.Add(30 * time.Minute))
+	assert.Equal(t, 25*60, session.ElapsedSeconds, "earlier pauses don't count")
+	assert.Equal(t, 1, session.RestRemainingSeconds, "rest is rounded up")
+
+	session.Status = SessionStatusPaused
+	session.PausedAt = &pausedAt
+	session.computeTimers(start.Add(time.Hour))
+	assert.Equal(t, 35*60, session.ElapsedSeconds, "the clock stops while paused")
+	assert.Equal(t, 0, session.RestRemainingSeconds)
+}
+
+func TestSessionWorkout(t *testing.T) {
+	reps := func(n int) *int { return &n }
+	weight := func(kg float64) *float64 { return &kg }
+
+	session := &WorkoutSession{
+		UserID:         7,
+		Title:          "Legs",
+		ElapsedSeconds: 45*60 + 40,
+		Sets: []SessionSet{
+			{ExerciseName: "Squat", Reps: reps(10), Weight: weight(60)},
+			{ExerciseName: "Squat", Reps: reps(10), Weight: weight(60)},
+			{ExerciseName: "Squat", Reps: reps(8), Weight: weight(70)},
+			{ExerciseName: "Plank", DurationSeconds: reps(60)},
+			{ExerciseName: "Squat", Reps: reps(8), Weight: weight(70)},
+		},
+	}
+
+	workout := sessionWorkout(session)
+	assert.Equal(t, 7, workout.UserID)
+	assert.Equal(t, 46, workout.DurationMinutes)
+	assert.Equal(t, WorkoutStatusCompleted, workout.Status)
+	require.Len(t, workout.Entries, 4, "only consecutive identical sets are grouped")
+	assert.Equal(t, 2, workout.Entries[0].Sets)
+	assert.Equal(t, 1, workout.Entries[1].Sets)
+	assert.Equal(t, "Plank", workout.Entries[2].ExerciseName)
+	assert.Equal(t, 4, workout.Entries[3].OrderIndex)
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+)
+
+type SQLiteAuditStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteAuditStore(db *sql.DB) *SQLiteAuditStore {
+	return &SQLiteAuditStore{db: db}
+}
+
+func (s *SQLiteAuditStore) InsertAuditEvent(event *AuditEvent) error {
+	query := `INSERT INTO audit_events (occurred_at, actor_id, action, resource, resource_id, ip, user_agent, before, after, changes, metadata)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			  RETURNING id`
+	return s.db.QueryRow(query,
+		event.OccurredAt.UTC(),
+		event.ActorID,
+		event.Action,
+		event.Resource,
+		nullString(event.ResourceID),
+		nullString(event.IP),
+		nullString(event.UserAgent),
+		nullJSON(event.Before),
+		nullJSON(event.After),
+		nullJSON(event.Changes),
+		nullJSON(event.Metadata),
+	).Scan(&event.ID)
+}
+
+func (s *SQLiteAuditStore) ListAuditEvents(filter AuditFilter) ([]AuditEvent, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	if filter.ActorID != nil {
+		where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		where("action = ?", filter.Action)
+	}
+	if filter.Resource != "" {
+		where("resource = ?", filter.Resource)
+	}
+	if filter.ResourceID != "" {
+		where("resource_id = ?", filter.ResourceID)
+	}
+	if filter.Since != nil {
+		where("occurred_at >= ?", filter.Since.UTC())
+	}
+	if filter.Until != nil {
+		where("occurred_at < ?", filter.Until.UTC())
+	}
+	if filter.BeforeID > 0 {
+		where("id < ?", filter.BeforeID)
+	}
+
+	query := `SELECT id, occurred_at, actor_id, action, resource, COALESCE(resource_id, ''), COALESCE(ip, ''), COALESCE(user_agent, ''), before, after, changes, metadata
+			  FROM audit_events`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var event AuditEvent
+		var before, after, changes, metadata []byte
+		err = rows.Scan(&event.ID, &event.OccurredAt, &event.ActorID, &event.Action, &event.Resource, &event.ResourceID, &event.IP, &event.UserAgent, &before, &after, &changes, &metadata)
+		if err != nil {
+			return nil, err
+		}
+		event.Before, event.After, event.Changes, event.Metadata = before, after, changes, metadata
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
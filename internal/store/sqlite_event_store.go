@@ -0,0 +1,80 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+)
+
+type SQLiteEventStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteEventStore(db *sql.DB) *SQLiteEventStore {
+	return &SQLiteEventStore{db: db}
+}
+
+// sqliteWriteEvent adds an event to the outbox as part of tx, like writeEvent
+func sqliteWriteEvent(tx *sql.Tx, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now := sqliteNow()
+	_, err = tx.Exec(`INSERT INTO event_outbox (event_type, payload, occurred_at, available_at) VALUES (?, ?, ?, ?)`, event.Type(), string(payload), now, now)
+	return err
+}
+
+/*
+	Dispatch implements events.Outbox, with the same retries as PostgresEventStore.Dispatch.
+	A SQLite database belongs to a single instance, so there is no other dispatcher to lock events from, and no transaction
+	is held while fn runs: with the single connection of Open, a subscriber using the stores would wait on it forever.
+*/
+
+func (s *SQLiteEventStore) Dispatch(limit int, fn func(events.Envelope) error) (int, error) {
+	query := `SELECT id, event_type, payload, occurred_at, attempts
+			  FROM event_outbox
+			  WHERE dispatched_at IS NULL AND failed_at IS NULL AND available_at <= ?
+			  ORDER BY id
+			  LIMIT ?`
+	rows, err := s.db.Query(query, sqliteNow(), limit)
+	if err != nil {
+		return 0, err
+	}
+	var pending []events.Envelope
+	for rows.Next() {
+		var envelope events.Envelope
+		var payload []byte
+		err = rows.Scan(&envelope.ID, &envelope.Type, &payload, &envelope.OccurredAt, &envelope.Attempts)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		envelope.Payload = payload
+		pending = append(pending, envelope)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, envelope := range pending {
+		dispatchErr := fn(envelope)
+		now := sqliteNow()
+		if dispatchErr == nil {
+			_, err = s.db.Exec(`UPDATE event_outbox SET dispatched_at = ? WHERE id = ?`, now, envelope.ID)
+		} else if envelope.Attempts+1 >= maxEventAttempts {
+			_, err = s.db.Exec(`UPDATE event_outbox SET attempts = attempts + 1, last_error = ?, failed_at = ? WHERE id = ?`, dispatchErr.Error(), now, envelope.ID)
+		} else {
+			retryIn := time.Duration((envelope.Attempts+1)*(envelope.Attempts+1)) * time.Minute
+			_, err = s.db.Exec(`UPDATE event_outbox SET attempts = attempts + 1, last_error = ?, available_at = ? WHERE id = ?`, dispatchErr.Error(), now.Add(retryIn), envelope.ID)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to record the dispatch of event %d: %w", envelope.ID, err)
+		}
+	}
+	return len(pending), nil
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Live workout sessions on SQLite. Times come from the application instead of the database, which is fine with a
+// single instance; the timers are computed as of when the session was read.
+
+type SQLiteSessionStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteSessionStore(db *sql.DB) *SQLiteSessionStore {
+	return &SQLiteSessionStore{db: db}
+}
+
+const sqliteSessionColumns = `id, user_id, template_id, title, description, plan, status, started_at, paused_at, paused_seconds,
+	rest_started_at, rest_ends_at, last_activity_at, finished_at, workout_id`
+
+// sqlitePausedSince is pausedSinceQuery for SQLite: seconds from paused_at to the time given as argument, 0 if not paused
+const sqlitePausedSince = `COALESCE(CAST(ROUND((julianday(?) - julianday(paused_at)) * 86400) AS INTEGER), 0)`
+
+func (s *SQLiteSessionStore) CreateSession(session *WorkoutSession) (*WorkoutSession, error) {
+	var plan interface{}
+	if len(session.Plan) > 0 {
+		planJSON, err := json.Marshal(session.Plan)
+		if err != nil {
+			return nil, err
+		}
+		plan = string(planJSON)
+	}
+
+	now := sqliteNow()
+	query := `INSERT INTO workout_sessions (user_id, template_id, title, description, plan, started_at, last_activity_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?)
+			  ON CONFLICT (user_id) WHERE status IN ('active', 'paused') DO NOTHING
+			  RETURNING id`
+	var id int64
+	err := s.db.QueryRow(query, session.UserID, session.TemplateID, session.Title, session.Description, plan, now, now).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSession(session.UserID, id)
+}
+
+func (s *SQLiteSessionStore) GetSession(userID int, id int64) (*WorkoutSession, error) {
+	query := `SELECT ` + sqliteSessionColumns + ` FROM workout_sessions WHERE id = ? AND user_id = ?`
+	return sqliteGetSession(s.db, query, id, userID)
+}
+
+func (s *SQLiteSessionStore) GetOpenSession(userID int) (*WorkoutSession, error) {
+	query := `SELECT ` + sqliteSessionColumns + ` FROM workout_sessions WHERE user_id = ? AND status IN ('active', 'paused')`
+	return sqliteGetSession(s.db, query, userID)
+}
+
+func sqliteGetSession(q queryer, query string, args ...interface{}) (*WorkoutSession, error) {
+	session := &WorkoutSession{}
+	var plan []byte
+	err := q.QueryRow(query, args...).Scan(&session.ID, &session.UserID, &session.TemplateID, &session.Title, &session.Description, &plan, &session.Status,
+		&session.StartedAt, &session.PausedAt, &session.PausedSeconds, &session.RestStartedAt, &session.RestEndsAt,
+		&session.LastActivityAt, &session.FinishedAt, &session.WorkoutID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if plan != nil {
+		err = json.Unmarshal(plan, &session.Plan)
+		if err != nil {
+			return nil, err
+		}
+	}
+	session.computeTimers(sqliteNow())
+
+	session.Sets, err = sqliteGetSessionSets(q, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func sqliteGetSessionSets(q queryer, sessionID int64) ([]SessionSet, error) {
+	query := `SELECT id, exercise_name, reps, duration_seconds, weight, notes, logged_at
+			  FROM session_sets
+			  WHERE session_id = ?
+			  ORDER BY logged_at, id`
+	rows, err := q.Query(query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sets := []SessionSet{}
+	for rows.Next() {
+		var set SessionSet
+		err = rows.Scan(&set.ID, &set.ExerciseName, &set.Reps, &set.DurationSeconds, &set.Weight, &set.Notes, &set.LoggedAt)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, rows.Err()
+}
+
+func (s *SQLiteSessionStore) LogSessionSet(userID int, sessionID int64, set *SessionSet, restSeconds int) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+	ok, err := sqliteStartRest(tx, userID, sessionID, restSeconds, now)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	query := `INSERT INTO session_sets (session_id, exercise_name, reps, duration_seconds, weight, notes, logged_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?)
+			  RETURNING id`
+	err = tx.QueryRow(query, sessionID, set.ExerciseName, set.Reps, set.DurationSeconds, set.Weight, set.Notes, now).Scan(&set.ID)
+	if err != nil {
+		return false, err
+	}
+	set.LoggedAt = now
+	return true, tx.Commit()
+}
+
+func (s *SQLiteSessionStore) StartSessionRest(userID int, sessionID int64, seconds int) (bool, error) {
+	return sqliteStartRest(s.db, userID, sessionID, seconds, sqliteNow())
+}
+
+func sqliteStartRest(q queryer, userID int, sessionID int64, seconds int, now time.Time) (bool, error) {
+	var restStartedAt, restEndsAt *time.Time
+	if seconds > 0 {
+		endsAt := now.Add(time.Duration(seconds) * time.Second)
+		restStartedAt, restEndsAt = &now, &endsAt
+	}
+	query := `UPDATE workout_sessions
+			  SET rest_started_at = ?, rest_ends_at = ?, last_activity_at = ?
+			  WHERE id = ? AND user_id = ? AND status = 'active'`
+	return changed(q.Exec(query, restStartedAt, restEndsAt, now, sessionID, userID))
+}
+
+func (s *SQLiteSessionStore) PauseSession(userID int, sessionID int64) (bool, error) {
+	now := sqliteNow()
+	query := `UPDATE workout_sessions
+			  SET status = 'paused', paused_at = ?, rest_started_at = NULL, rest_ends_at = NULL, last_activity_at = ?
+			  WHERE id = ? AND user_id = ? AND status = 'active'`
+	return changed(s.db.Exec(query, now, now, sessionID, userID))
+}
+
+func (s *SQLiteSessionStore) ResumeSession(userID int, sessionID int64) (bool, error) {
+	now := sqliteNow()
+	query := `UPDATE workout_sessions
+			  SET status = 'active', paused_seconds = paused_seconds + ` + sqlitePausedSince + `, paused_at = NULL, last_activity_at = ?
+			  WHERE id = ? AND user_id = ? AND status = 'paused'`
+	return changed(s.db.Exec(query, now, now, sessionID, userID))
+}
+
+// FinishSession closes an open session and saves it as a completed workout, in one transaction like on Postgres
+func (s *SQLiteSessionStore) FinishSession(userID int, sessionID int64) (*Workout, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+	query := `UPDATE workout_sessions
+			  SET status = 'finished', finished_at = ?, paused_seconds = paused_seconds + ` + sqlitePausedSince + `,
+				  paused_at = NULL, rest_started_at = NULL, rest_ends_at = NULL, last_activity_at = ?
+			  WHERE id = ? AND user_id = ? AND status IN ('active', 'paused')`
+	ok, err := changed(tx.Exec(query, now, now, now, sessionID, userID))
+	if err != nil || !ok {
+		return nil, err
+	}
+	session, err := sqliteGetSession(tx, `SELECT `+sqliteSessionColumns+` FROM workout_sessions WHERE id = ?`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	workout := sessionWorkout(session)
+	_, err = sqliteInsertWorkout(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`UPDATE workout_sessions SET workout_id = ? WHERE id = ?`, workout.ID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return workout, tx.Commit()
+}
+
+func (s *SQLiteSessionStore) DiscardSession(userID int, sessionID int64) (bool, error) {
+	query := `DELETE FROM workout_sessions WHERE id = ? AND user_id = ? AND status IN ('active', 'paused')`
+	return changed(s.db.Exec(query, sessionID, userID))
+}
+
+func (s *SQLiteSessionStore) ExpireSessions(inactiveSince time.Time) (int64, error) {
+	query := `UPDATE workout_sessions
+			  SET status = 'expired', finished_at = last_activity_at, paused_at = NULL, rest_started_at = NULL, rest_ends_at = NULL
+			  WHERE status IN ('active', 'paused') AND last_activity_at < ?`
+	res, err := s.db.Exec(query, inactiveSince.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
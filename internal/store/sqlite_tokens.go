@@ -0,0 +1,78 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+	"github.com/OlivierCoq/go_api_template/internal/tokens"
+)
+
+type SQLiteTokenStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteTokenStore(db *sql.DB) *SQLiteTokenStore {
+	return &SQLiteTokenStore{db: db}
+}
+
+func (t *SQLiteTokenStore) CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Insert(token)
+	return token, err
+}
+
+// Insert saves a token. Its expiry is stored in UTC, so GetUserToken can compare it with the current time.
+func (t *SQLiteTokenStore) Insert(token *tokens.Token) error {
+	query := `INSERT INTO tokens (hash, user_id, expiry, scope) VALUES (?, ?, ?, ?)`
+	_, err := t.db.Exec(query, token.Hash, token.UserID, token.Expiry.UTC(), token.Scope)
+	return err
+}
+
+func (t *SQLiteTokenStore) DeleteAllTokensForUser(scope string, userID int) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deleted, err := changed(tx.Exec(`DELETE FROM tokens WHERE user_id = ? AND scope = ?`, userID, scope))
+	if err != nil {
+		return err
+	}
+	if deleted {
+		err = sqliteWriteEvent(tx, events.TokenRevoked{UserID: userID, Scope: scope})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (t *SQLiteTokenStore) RevokeToken(tokenPlaintext string) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	var revoked events.TokenRevoked
+	err = tx.QueryRow(`DELETE FROM tokens WHERE hash = ? RETURNING user_id, scope`, tokenHash[:]).Scan(&revoked.UserID, &revoked.Scope)
+	if err == sql.ErrNoRows {
+		return nil // Already revoked, or expired and cleaned up
+	}
+	if err != nil {
+		return err
+	}
+	err = sqliteWriteEvent(tx, revoked)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
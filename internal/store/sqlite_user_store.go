@@ -0,0 +1,140 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+)
+
+type SQLiteUserStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserStore(db *sql.DB) *SQLiteUserStore {
+	return &SQLiteUserStore{db: db}
+}
+
+const userColumns = `id, username, email, password_hash, bio, is_admin, disabled_at, created_at, updated_at`
+
+func scanUser(row scanner, user *User) error {
+	return row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.IsAdmin, &user.DisabledAt, &user.CreatedAt, &user.UpdatedAt)
+}
+
+func (s *SQLiteUserStore) CreateUser(user *User) (*User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+	query := `INSERT INTO users (username, email, password_hash, bio, created_at, updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?)
+			  RETURNING id`
+	err = tx.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, now, now).Scan(&user.ID)
+	if err != nil {
+		return nil, err
+	}
+	user.CreatedAt, user.UpdatedAt = now, now
+
+	err = sqliteWriteEvent(tx, events.UserRegistered{UserID: user.ID, Username: user.Username})
+	if err != nil {
+		return nil, err
+	}
+	return user, tx.Commit()
+}
+
+func (s *SQLiteUserStore) GetUserByUsername(username string) (*User, error) {
+	user := &User{}
+	err := scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, username), user)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *SQLiteUserStore) UpdateUser(user *User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET username = ?, email = ?, bio = ?, updated_at = ? WHERE id = ?`
+	ok, err := changed(tx.Exec(query, user.Username, user.Email, user.Bio, sqliteNow(), user.ID))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	err = sqliteWriteEvent(tx, events.UserUpdated{UserID: user.ID, Username: user.Username})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteUserStore) DeleteUser(id int) error {
+	ok, err := changed(s.db.Exec(`DELETE FROM users WHERE id = ?`, id))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SQLiteUserStore) UpdatePassword(user *User) error {
+	ok, err := changed(s.db.Exec(`UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`, user.PasswordHash.hash, sqliteNow(), user.ID))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SQLiteUserStore) SetUserDisabled(id int, disabled bool) error {
+	now := sqliteNow()
+	query := `UPDATE users SET disabled_at = NULL, updated_at = ? WHERE id = ?`
+	args := []interface{}{now, id}
+	if disabled {
+		query = `UPDATE users SET disabled_at = COALESCE(disabled_at, ?), updated_at = ? WHERE id = ?`
+		args = []interface{}{now, now, id}
+	}
+	ok, err := changed(s.db.Exec(query, args...))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SQLiteUserStore) GetUserToken(scope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.is_admin, u.disabled_at, u.created_at, u.updated_at
+			  FROM users u
+			  INNER JOIN tokens t ON t.user_id = u.id
+			  WHERE t.hash = ? AND t.scope = ? AND t.expiry > ? AND u.disabled_at IS NULL`
+	user := &User{}
+	err := scanUser(s.db.QueryRow(query, tokenHash[:], scope, time.Now().UTC()), user)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Webhooks on SQLite. Event types are stored as comma separated text, matched with instr on ",type," (they never contain commas).
+
+type SQLiteWebhookStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteWebhookStore(db *sql.DB) *SQLiteWebhookStore {
+	return &SQLiteWebhookStore{db: db}
+}
+
+// sqliteEventTypeMatch is the condition matching the subscriptions to an event type, given as sqliteEventType
+const sqliteEventTypeMatch = `instr(',' || event_types || ',', ?) > 0`
+
+func sqliteEventType(eventType string) string {
+	return "," + eventType + ","
+}
+
+func (s *SQLiteWebhookStore) CreateWebhookSubscription(subscription *WebhookSubscription) error {
+	subscription.CreatedAt = sqliteNow()
+	query := `INSERT INTO webhook_subscriptions (user_id, url, secret, event_types, created_at)
+			  VALUES (?, ?, ?, ?, ?)
+			  RETURNING id`
+	return s.db.QueryRow(query, subscription.UserID, subscription.URL, subscription.Secret, strings.Join(subscription.EventTypes, ","), subscription.CreatedAt).Scan(&subscription.ID)
+}
+
+func (s *SQLiteWebhookStore) GetWebhookSubscriptions(userID int) ([]WebhookSubscription, error) {
+	query := `SELECT id, user_id, url, event_types, created_at
+			  FROM webhook_subscriptions
+			  WHERE user_id = ?
+			  ORDER BY id`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []WebhookSubscription{}
+	for rows.Next() {
+		var subscription WebhookSubscription
+		var eventTypes string
+		err = rows.Scan(&subscription.ID, &subscription.UserID, &subscription.URL, &eventTypes, &subscription.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		subscription.EventTypes = strings.Split(eventTypes, ",")
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (s *SQLiteWebhookStore) DeleteWebhookSubscription(userID int, id int64) (bool, error) {
+	return changed(s.db.Exec(`DELETE FROM webhook_subscriptions WHERE id = ? AND user_id = ?`, id, userID))
+}
+
+func (s *SQLiteWebhookStore) GetDeadLetters(userID int) ([]WebhookDelivery, error) {
+	query := `SELECT id, subscription_id, url, event_id, event_type, payload, attempts, last_attempt_at, last_status_code, COALESCE(last_error, ''), created_at
+			  FROM webhook_dead_letters
+			  WHERE user_id = ?
+			  ORDER BY id DESC`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload []byte
+		err = rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.URL, &delivery.EventID, &delivery.EventType, &payload, &delivery.Attempts, &delivery.LastAttemptAt, &delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *SQLiteWebhookStore) RetryDeadLetter(userID int, id int64) (bool, error) {
+	query := `UPDATE webhook_deliveries
+			  SET status = 'pending', attempts = 0, next_attempt_at = ?
+			  WHERE id = ? AND status = 'failed' AND subscription_id IN (SELECT id FROM webhook_subscriptions WHERE user_id = ?)`
+	return changed(s.db.Exec(query, sqliteNow(), id, userID))
+}
+
+// ClaimWebhookDeliveries works like PostgresWebhookStore.ClaimWebhookDeliveries. The deliveries are read and pushed back
+// by lease in one transaction, which SQLite runs alone, so two workers can't claim the same ones.
+func (s *SQLiteWebhookStore) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+	query := `SELECT d.id, d.subscription_id, s.url, s.secret, d.event_id, d.event_type, d.payload, d.attempts, d.created_at
+			  FROM webhook_deliveries d
+			  JOIN webhook_subscriptions s ON s.id = d.subscription_id
+			  WHERE d.status = 'pending' AND d.next_attempt_at <= ?
+			  ORDER BY d.next_attempt_at
+			  LIMIT ?`
+	rows, err := tx.Query(query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	var ids []interface{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload []byte
+		err = rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.URL, &delivery.Secret, &delivery.EventID, &delivery.EventType, &payload, &delivery.Attempts, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+		ids = append(ids, delivery.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.Exec(`UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id IN `+sqliteIn(len(ids)), append([]interface{}{now.Add(lease)}, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, tx.Commit()
+}
+
+func (s *SQLiteWebhookStore) MarkWebhookDelivered(id int64, statusCode int) error {
+	now := sqliteNow()
+	query := `UPDATE webhook_deliveries
+			  SET status = 'delivered', attempts = attempts + 1, last_attempt_at = ?, last_status_code = ?, last_error = NULL, delivered_at = ?
+			  WHERE id = ?`
+	_, err := s.db.Exec(query, now, statusCode, now, id)
+	return err
+}
+
+func (s *SQLiteWebhookStore) MarkWebhookFailed(id int64, statusCode int, deliveryErr string, retryAt *time.Time) error {
+	status := WebhookDeliveryPending
+	if retryAt == nil {
+		status = WebhookDeliveryFailed
+	}
+	var lastStatusCode *int
+	if statusCode != 0 {
+		lastStatusCode = &statusCode
+	}
+	query := `UPDATE webhook_deliveries
+			  SET status = ?, attempts = attempts + 1, last_attempt_at = ?, last_status_code = ?, last_error = ?, next_attempt_at = COALESCE(?, next_attempt_at)
+			  WHERE id = ?`
+	_, err := s.db.Exec(query, status, sqliteNow(), lastStatusCode, deliveryErr, sqliteTime(retryAt), id)
+	return err
+}
+
+func (s *SQLiteWebhookStore) EnqueueWebhookEvent(userID int, event WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, next_attempt_at, created_at)
+			  SELECT id, ?, ?, ?, ?, ?
+			  FROM webhook_subscriptions
+			  WHERE user_id = ? AND ` + sqliteEventTypeMatch + `
+			  ON CONFLICT (subscription_id, event_id) DO NOTHING`
+	now := sqliteNow()
+	_, err = s.db.Exec(query, event.ID, event.Type, string(payload), now, now, userID, sqliteEventType(event.Type))
+	return err
+}
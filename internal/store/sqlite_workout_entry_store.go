@@ -0,0 +1,216 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+)
+
+// Entries of a workout changed one at a time, on SQLite. See workout_entry_store.go for how each change works.
+
+func (s *SQLiteWorkoutStore) AddWorkoutEntry(workoutID int64, version int, entry *WorkoutEntry) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	workout, err := sqliteTouchWorkout(tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+
+	if entry.OrderIndex == 0 {
+		err = tx.QueryRow(`SELECT COALESCE(MAX(order_index), 0) + 1 FROM workout_entries WHERE workout_id = ?`, workoutID).Scan(&entry.OrderIndex)
+		if err != nil {
+			return 0, err
+		}
+	}
+	entry.ID = 0
+	err = sqliteInsertEntry(tx, workout, entry)
+	if err != nil {
+		return 0, err
+	}
+	err = sqliteWorkoutEntriesChanged(tx, workoutID, []WorkoutEntry{*entry})
+	if err != nil {
+		return 0, err
+	}
+	return workout.Version, tx.Commit()
+}
+
+func (s *SQLiteWorkoutStore) UpdateWorkoutEntry(workoutID int64, version int, entry *WorkoutEntry) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	workout, err := sqliteTouchWorkout(tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+	previous, err := sqliteGetWorkoutEntries(tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+	err = sqliteUpdateEntry(tx, workoutID, entry)
+	if err != nil {
+		return 0, err
+	}
+	err = sqliteWorkoutEntriesChanged(tx, workoutID, entriesWithNewWeight(previous, []WorkoutEntry{*entry}))
+	if err != nil {
+		return 0, err
+	}
+	return workout.Version, tx.Commit()
+}
+
+func (s *SQLiteWorkoutStore) DeleteWorkoutEntry(workoutID int64, version int, entryID int64) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	workout, err := sqliteTouchWorkout(tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+	err = sqliteDeleteEntry(tx, workoutID, entryID)
+	if err != nil {
+		return 0, err
+	}
+	err = sqliteWorkoutEntriesChanged(tx, workoutID, nil)
+	if err != nil {
+		return 0, err
+	}
+	return workout.Version, tx.Commit()
+}
+
+func (s *SQLiteWorkoutStore) ReorderWorkoutEntries(workoutID int64, version int, entryIDs []int64) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	workout, err := sqliteTouchWorkout(tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := sqliteGetWorkoutEntries(tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+	moves, err := reorderEntries(entries, entryIDs)
+	if err != nil {
+		return 0, err
+	}
+	for id, orderIndex := range moves {
+		_, err = tx.Exec(`UPDATE workout_entries SET order_index = ? WHERE id = ?`, orderIndex, id)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = sqliteWorkoutEntriesChanged(tx, workoutID, nil)
+	if err != nil {
+		return 0, err
+	}
+	return workout.Version, tx.Commit()
+}
+
+// sqliteTouchWorkout bumps the version and updated_at of a workout whose entries are about to change, if it's still at version.
+// Writes are serialized by SQLite, so there is no row to lock.
+func sqliteTouchWorkout(tx *sql.Tx, workoutID int64, version int) (*Workout, error) {
+	workout := &Workout{ID: int(workoutID), UpdatedAt: sqliteNow()}
+	query := `UPDATE workouts
+			  SET updated_at = ?, version = version + 1
+			  WHERE id = ? AND version = ? AND deleted_at IS NULL
+			  RETURNING user_id, version`
+	err := tx.QueryRow(query, workout.UpdatedAt, workoutID, version).Scan(&workout.UserID, &workout.Version)
+	if err == sql.ErrNoRows {
+		return nil, sqliteMissingOrConflict(tx, workoutID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+func sqliteMissingOrConflict(q queryer, workoutID int64) error {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM workouts WHERE id = ? AND deleted_at IS NULL)`, workoutID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return fmt.Errorf("no workout found with id %d", workoutID)
+}
+
+func sqliteWorkoutEntriesChanged(tx *sql.Tx, workoutID int64, changed []WorkoutEntry) error {
+	workout, err := sqliteGetWorkoutByID(tx, workoutID)
+	if err != nil {
+		return err
+	}
+	err = sqliteWriteEvent(tx, events.WorkoutUpdated{WorkoutID: workout.ID, UUID: workout.UUID, UserID: workout.UserID, Version: workout.Version})
+	if err != nil {
+		return err
+	}
+	return sqliteWriteRecords(tx, workout, changed)
+}
+
+func sqliteUpdateEntry(tx *sql.Tx, workoutID int64, entry *WorkoutEntry) error {
+	query := `UPDATE workout_entries
+			  SET exercise_name = ?, sets = ?, reps = ?, duration_seconds = ?, weight = ?, notes = ?, order_index = ?
+			  WHERE id = ? AND workout_id = ?`
+	ok, err := changed(tx.Exec(query, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex, entry.ID, workoutID))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: entry %d does not belong to this workout", ErrInvalidEntries, entry.ID)
+	}
+	return nil
+}
+
+func sqliteDeleteEntry(tx *sql.Tx, workoutID int64, entryID int64) error {
+	ok, err := changed(tx.Exec(`DELETE FROM workout_entries WHERE id = ? AND workout_id = ?`, entryID, workoutID))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: entry %d does not belong to this workout", ErrInvalidEntries, entryID)
+	}
+	return nil
+}
+
+// sqliteSaveEntries is saveEntries for SQLite. existing are the entries the workout has before the save.
+func sqliteSaveEntries(tx *sql.Tx, workout *Workout, existing []WorkoutEntry) error {
+	diff, err := diffEntries(workout, existing)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range diff.inserted {
+		err = sqliteInsertEntry(tx, workout, entry)
+		if err != nil {
+			return err
+		}
+	}
+	for _, entry := range diff.updated {
+		err = sqliteUpdateEntry(tx, int64(workout.ID), entry)
+		if err != nil {
+			return err
+		}
+	}
+	for _, entryID := range diff.deleted {
+		err = sqliteDeleteEntry(tx, int64(workout.ID), entryID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
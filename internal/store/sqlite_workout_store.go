@@ -0,0 +1,600 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+	"github.com/google/uuid"
+)
+
+/*
+	SQLite implementation of WorkoutStore, for running without a Postgres server (local development, demos, small installs).
+	It behaves like PostgresWorkoutStore on the schema of migrations/sqlite. The differences come from SQLite itself:
+	- Times are computed here rather than with NOW(), and always stored in UTC: they're text, compared as text.
+	- Queries use ? placeholders, and lists of IDs are expanded into IN (?, ?, ...) instead of ANY($1).
+	- There is a single connection (see Open), so a query's rows are always read to the end before the next query runs.
+*/
+
+type SQLiteWorkoutStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteWorkoutStore(db *sql.DB) *SQLiteWorkoutStore {
+	return &SQLiteWorkoutStore{db: db}
+}
+
+// sqliteNow is the current time as stored by the SQLite stores
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
+
+// sqliteTime converts an optional time to UTC, so it compares with the stored ones
+func sqliteTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// sqliteIn returns the placeholders of an IN list of n values, e.g. (?, ?, ?)
+func sqliteIn(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
+
+func (s *SQLiteWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	inserted, err := sqliteInsertWorkout(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		return nil, ErrDuplicateExternalID
+	}
+	return workout, tx.Commit()
+}
+
+// sqliteInsertWorkout is insertWorkout for SQLite: it returns false, inserting nothing, when the ExternalID is taken.
+func sqliteInsertWorkout(tx *sql.Tx, workout *Workout) (bool, error) {
+	if workout.Status == "" {
+		workout.Status = defaultWorkoutStatus(workout)
+	}
+	if workout.Entries == nil {
+		workout.Entries = []WorkoutEntry{} // As when it's read back: no entries is an empty list, not null
+	}
+	err := ensureUUID(&workout.UUID)
+	if err != nil {
+		return false, err
+	}
+	updatedAt := workout.UpdatedAt.UTC()
+	if workout.UpdatedAt.IsZero() {
+		updatedAt = sqliteNow()
+	}
+
+	query := `INSERT INTO workouts (uuid, user_id, title, description, duration_minutes, calories_burned, planned_for, status, external_id, updated_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			  ON CONFLICT (user_id, external_id) WHERE external_id IS NOT NULL DO NOTHING
+			  RETURNING id, version`
+	err = tx.QueryRow(query, workout.UUID, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, sqliteTime(workout.PlannedFor), workout.Status, workout.ExternalID, updatedAt).Scan(&workout.ID, &workout.Version)
+	if err == sql.ErrNoRows {
+		return false, nil // Duplicate external ID, nothing was inserted
+	}
+	if err != nil {
+		return false, err
+	}
+	workout.UpdatedAt = updatedAt
+
+	for i := range workout.Entries {
+		err = sqliteInsertEntry(tx, workout, &workout.Entries[i])
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = sqliteWriteEvent(tx, events.WorkoutCreated{WorkoutID: workout.ID, UUID: workout.UUID, UserID: workout.UserID, Version: workout.Version})
+	if err != nil {
+		return false, err
+	}
+	err = sqliteWriteRecords(tx, workout, workout.Entries)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func sqliteInsertEntry(tx *sql.Tx, workout *Workout, entry *WorkoutEntry) error {
+	err := ensureUUID(&entry.UUID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO workout_entries (uuid, user_id, workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			  RETURNING id`
+	return tx.QueryRow(query, entry.UUID, workout.UserID, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
+}
+
+func (s *SQLiteWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
+	return sqliteGetWorkoutByID(s.db, id)
+}
+
+func sqliteGetWorkoutByID(q queryer, id int64) (*Workout, error) {
+	query := `SELECT ` + workoutColumns + ` FROM workouts WHERE id = ? AND deleted_at IS NULL`
+	return sqliteGetWorkout(q, query, id)
+}
+
+func (s *SQLiteWorkoutStore) GetWorkoutByUUID(id string) (*Workout, error) {
+	return sqliteGetWorkoutByUUID(s.db, id)
+}
+
+func sqliteGetWorkoutByUUID(q queryer, id string) (*Workout, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil // Not a UUID, so no workout can have it
+	}
+	// UUIDs are text here, so they're compared in the canonical form they're stored in
+	query := `SELECT ` + workoutColumns + ` FROM workouts WHERE uuid = ? AND deleted_at IS NULL`
+	return sqliteGetWorkout(q, query, parsed.String())
+}
+
+func sqliteGetWorkout(q queryer, query string, args ...interface{}) (*Workout, error) {
+	workout := &Workout{}
+	err := scanWorkout(q.QueryRow(query, args...), workout)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	workout.Entries, err = sqliteGetWorkoutEntries(q, int64(workout.ID))
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+func sqliteGetWorkoutEntries(q queryer, workoutID int64) ([]WorkoutEntry, error) {
+	query := `SELECT ` + entryColumns + `
+			  FROM workout_entries
+			  WHERE workout_id = ?
+			  ORDER BY order_index ASC, id ASC`
+	rows, err := q.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WorkoutEntry{} // No entries is an empty list, not null
+	for rows.Next() {
+		var entry WorkoutEntry
+		err = scanEntry(rows, &entry)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLiteWorkoutStore) UpdateWorkout(workout *Workout) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = sqliteUpdateWorkout(tx, workout)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteUpdateWorkout is updateWorkout for SQLite, with the same optimistic concurrency on workout.Version
+func sqliteUpdateWorkout(tx *sql.Tx, workout *Workout) error {
+	if workout.Status == "" {
+		workout.Status = defaultWorkoutStatus(workout)
+	}
+	updatedAt := workout.UpdatedAt.UTC()
+	if workout.UpdatedAt.IsZero() {
+		updatedAt = sqliteNow()
+	}
+
+	query := `UPDATE workouts
+			  SET user_id = ?, title = ?, description = ?, duration_minutes = ?, calories_burned = ?, planned_for = ?, status = ?, updated_at = ?, version = version + 1
+			  WHERE id = ? AND version = ? AND deleted_at IS NULL
+			  RETURNING version`
+	err := tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, sqliteTime(workout.PlannedFor), workout.Status, updatedAt, workout.ID, workout.Version).Scan(&workout.Version)
+	if err == sql.ErrNoRows {
+		return sqliteMissingOrConflict(tx, int64(workout.ID))
+	}
+	if err != nil {
+		return err
+	}
+	workout.UpdatedAt = updatedAt
+
+	// Weights before the save, so only entries with a new weight are checked for records
+	previous, err := sqliteGetWorkoutEntries(tx, int64(workout.ID))
+	if err != nil {
+		return err
+	}
+	err = sqliteSaveEntries(tx, workout, previous)
+	if err != nil {
+		return fmt.Errorf("save entries: %w", err)
+	}
+
+	err = sqliteWriteEvent(tx, events.WorkoutUpdated{WorkoutID: workout.ID, UUID: workout.UUID, UserID: workout.UserID, Version: workout.Version})
+	if err != nil {
+		return err
+	}
+	return sqliteWriteRecords(tx, workout, entriesWithNewWeight(previous, workout.Entries))
+}
+
+func (s *SQLiteWorkoutStore) DeleteWorkout(id int64, version int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = sqliteDeleteWorkout(tx, id, version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func sqliteDeleteWorkout(tx *sql.Tx, id int64, version int) error {
+	// Soft delete of the version that was read, like on Postgres
+	deleted := &Workout{ID: int(id)}
+	query := `UPDATE workouts SET deleted_at = ? WHERE id = ? AND version = ? AND deleted_at IS NULL RETURNING uuid, user_id`
+	err := tx.QueryRow(query, sqliteNow(), id, version).Scan(&deleted.UUID, &deleted.UserID)
+	if err == sql.ErrNoRows {
+		return sqliteMissingOrConflict(tx, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	return sqliteWriteEvent(tx, events.WorkoutDeleted{WorkoutID: deleted.ID, UUID: deleted.UUID, UserID: deleted.UserID})
+}
+
+// sqliteWriteRecords writes the records among entries, like writeRecords
+func sqliteWriteRecords(tx *sql.Tx, workout *Workout, entries []WorkoutEntry) error {
+	query := `SELECT MAX(e.weight)
+			  FROM workout_entries e
+			  JOIN workouts w ON w.id = e.workout_id
+			  WHERE e.user_id = ? AND LOWER(e.exercise_name) = LOWER(?) AND e.id <> ? AND w.deleted_at IS NULL`
+	for _, entry := range entries {
+		if entry.Weight == nil {
+			continue
+		}
+		var previous sql.NullFloat64
+		err := tx.QueryRow(query, workout.UserID, entry.ExerciseName, entry.ID).Scan(&previous)
+		if err != nil {
+			return err
+		}
+		if !previous.Valid || *entry.Weight <= previous.Float64 {
+			continue
+		}
+		err = sqliteWriteEvent(tx, events.RecordAchieved{
+			WorkoutID:      workout.ID,
+			EntryID:        entry.ID,
+			UserID:         workout.UserID,
+			ExerciseName:   entry.ExerciseName,
+			Weight:         *entry.Weight,
+			PreviousWeight: previous.Float64,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteWorkoutStore) GetWorkoutOwner(id int64) (int, error) {
+	return sqliteGetWorkoutOwner(s.db, id)
+}
+
+func sqliteGetWorkoutOwner(q queryer, id int64) (int, error) {
+	var userID int
+	err := q.QueryRow(`SELECT user_id FROM workouts WHERE id = ? AND deleted_at IS NULL`, id).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("no workout found with id %d", id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// Scheduling:
+
+func (s *SQLiteWorkoutStore) GetUpcomingWorkouts(userID int) ([]Workout, error) {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = ? AND status = 'planned' AND planned_for >= ? AND deleted_at IS NULL
+			  ORDER BY planned_for ASC`
+	return s.queryWorkouts(query, userID, sqliteNow())
+}
+
+func (s *SQLiteWorkoutStore) GetOverdueWorkouts(userID int) ([]Workout, error) {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = ? AND status = 'planned' AND planned_for < ? AND deleted_at IS NULL
+			  ORDER BY planned_for ASC`
+	return s.queryWorkouts(query, userID, sqliteNow())
+}
+
+func (s *SQLiteWorkoutStore) GetScheduledWorkouts(userID int) ([]Workout, error) {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = ? AND planned_for IS NOT NULL AND deleted_at IS NULL
+			  ORDER BY planned_for ASC`
+	return s.queryWorkouts(query, userID)
+}
+
+// queryWorkouts runs a query selecting workoutColumns, then loads the entries of every workout found
+func (s *SQLiteWorkoutStore) queryWorkouts(query string, args ...interface{}) ([]Workout, error) {
+	workouts, err := sqliteScanWorkouts(s.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(workouts) == 0 {
+		return workouts, nil
+	}
+
+	ids := make([]int64, len(workouts))
+	for i := range workouts {
+		ids[i] = int64(workouts[i].ID)
+	}
+	entries, err := s.GetEntriesForWorkouts(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range workouts {
+		workouts[i].Entries = entries[int64(workouts[i].ID)]
+		if workouts[i].Entries == nil {
+			workouts[i].Entries = []WorkoutEntry{}
+		}
+	}
+	return workouts, nil
+}
+
+// sqliteScanWorkouts runs a query selecting workoutColumns, without loading entries
+func sqliteScanWorkouts(q queryer, query string, args ...interface{}) ([]Workout, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []Workout{}
+	for rows.Next() {
+		var workout Workout
+		err = scanWorkout(rows, &workout)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, workout)
+	}
+	return workouts, rows.Err()
+}
+
+func (s *SQLiteWorkoutStore) GetEntriesForWorkouts(workoutIDs []int64) (map[int64][]WorkoutEntry, error) {
+	entries := make(map[int64][]WorkoutEntry, len(workoutIDs))
+	if len(workoutIDs) == 0 {
+		return entries, nil
+	}
+
+	args := make([]interface{}, len(workoutIDs))
+	for i, id := range workoutIDs {
+		args[i] = id
+	}
+	query := `SELECT workout_id, ` + entryColumns + `
+			  FROM workout_entries
+			  WHERE workout_id IN ` + sqliteIn(len(workoutIDs)) + `
+			  ORDER BY workout_id, order_index ASC, id ASC`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int64
+		var entry WorkoutEntry
+		err = scanEntry(rows, &entry, &workoutID)
+		if err != nil {
+			return nil, err
+		}
+		entries[workoutID] = append(entries[workoutID], entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLiteWorkoutStore) GetRecentWorkouts(userID int, limit int) ([]Workout, error) {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = ? AND deleted_at IS NULL
+			  ORDER BY updated_at DESC, id DESC
+			  LIMIT ?`
+	return sqliteScanWorkouts(s.db, query, userID, limit)
+}
+
+// GetPersonalRecords ranks the entries of each exercise with a window function, where Postgres uses DISTINCT ON
+func (s *SQLiteWorkoutStore) GetPersonalRecords(userID int) ([]PersonalRecord, error) {
+	query := `SELECT exercise_name, weight, workout_id, entry_id, updated_at
+			  FROM (
+				  SELECT e.exercise_name, e.weight, w.id AS workout_id, e.id AS entry_id, w.updated_at,
+						 ROW_NUMBER() OVER (PARTITION BY LOWER(e.exercise_name) ORDER BY e.weight DESC, w.updated_at ASC, e.id ASC) AS position
+				  FROM workout_entries e
+				  JOIN workouts w ON w.id = e.workout_id
+				  WHERE e.user_id = ? AND e.weight IS NOT NULL AND w.deleted_at IS NULL
+			  )
+			  WHERE position = 1
+			  ORDER BY LOWER(exercise_name)`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []PersonalRecord{}
+	for rows.Next() {
+		var record PersonalRecord
+		err = rows.Scan(&record.ExerciseName, &record.Weight, &record.WorkoutID, &record.EntryID, &record.AchievedAt)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// Exporting:
+
+/*
+	StreamWorkouts calls fn once per workout of the user (with its entries), ordered by ID.
+	SQLite has no server-side cursors, so workouts are read in pages of exportBatchSize, each starting after the last ID
+	of the previous one: memory use stays flat, and fn is free to use the store since no query is left open while it runs.
+*/
+
+func (s *SQLiteWorkoutStore) StreamWorkouts(userID int, fn func(*Workout) error) error {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = ? AND id > ? AND deleted_at IS NULL
+			  ORDER BY id
+			  LIMIT ?`
+	lastID := 0
+	for {
+		workouts, err := s.queryWorkouts(query, userID, lastID, exportBatchSize)
+		if err != nil {
+			return err
+		}
+		for i := range workouts {
+			if workouts[i].Entries == nil {
+				workouts[i].Entries = []WorkoutEntry{}
+			}
+			err = fn(&workouts[i])
+			if err != nil {
+				return err
+			}
+			lastID = workouts[i].ID
+		}
+		if len(workouts) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// Importing:
+
+// ImportWorkouts inserts workouts in transactions of importBatchSize, like PostgresWorkoutStore.ImportWorkouts
+func (s *SQLiteWorkoutStore) ImportWorkouts(workouts []*Workout) (int, error) {
+	created := 0
+	for start := 0; start < len(workouts); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(workouts) {
+			end = len(workouts)
+		}
+
+		batchCreated, err := s.importBatch(workouts[start:end])
+		if err != nil {
+			return created, err
+		}
+		created += batchCreated
+	}
+	return created, nil
+}
+
+func (s *SQLiteWorkoutStore) importBatch(workouts []*Workout) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	created := 0
+	for _, workout := range workouts {
+		inserted, err := sqliteInsertWorkout(tx, workout)
+		if err != nil {
+			return 0, err
+		}
+		if inserted {
+			created++
+		} else {
+			workout.ID = 0
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return created, nil
+}
+
+// Transactions:
+
+func (s *SQLiteWorkoutStore) WithTransaction(fn func(tx WorkoutTx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(&sqliteWorkoutTx{tx: tx})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteWorkoutTx implements WorkoutTx on top of an open transaction
+type sqliteWorkoutTx struct {
+	tx *sql.Tx
+}
+
+func (t *sqliteWorkoutTx) CreateWorkout(workout *Workout) (*Workout, error) {
+	inserted, err := sqliteInsertWorkout(t.tx, workout)
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		return nil, ErrDuplicateExternalID
+	}
+	return workout, nil
+}
+
+func (t *sqliteWorkoutTx) GetWorkoutByID(id int64) (*Workout, error) {
+	return sqliteGetWorkoutByID(t.tx, id)
+}
+
+func (t *sqliteWorkoutTx) UpdateWorkout(workout *Workout) error {
+	return sqliteUpdateWorkout(t.tx, workout)
+}
+
+func (t *sqliteWorkoutTx) DeleteWorkout(id int64, version int) error {
+	return sqliteDeleteWorkout(t.tx, id, version)
+}
+
+func (t *sqliteWorkoutTx) GetWorkoutOwner(id int64) (int, error) {
+	return sqliteGetWorkoutOwner(t.tx, id)
+}
+
+func (t *sqliteWorkoutTx) GetWorkoutByUUID(id string) (*Workout, error) {
+	return sqliteGetWorkoutByUUID(t.tx, id)
+}
+
+func (t *sqliteWorkoutTx) GetWorkoutDeletedAt(userID int, workoutUUID string) (*time.Time, error) {
+	return sqliteGetWorkoutDeletedAt(t.tx, userID, workoutUUID)
+}
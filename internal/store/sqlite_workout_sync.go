@@ -0,0 +1,145 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Offline sync on SQLite. The change feed is filled by triggers too (see migrations/sqlite/00007_sync_changes.sql).
+
+func (s *SQLiteWorkoutStore) GetChangesSince(userID int, cursor int64, limit int) (*SyncPage, error) {
+	query := `SELECT id, entity, entity_uuid, op, changed_at
+			  FROM sync_changes
+			  WHERE user_id = ? AND id > ?
+			  ORDER BY id ASC
+			  LIMIT ?`
+	rows, err := s.db.Query(query, userID, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &SyncPage{Cursor: cursor}
+	var all []SyncChange
+	for rows.Next() {
+		var change SyncChange
+		err = rows.Scan(&change.Cursor, &change.Entity, &change.UUID, &change.Op, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, change)
+		page.Cursor = change.Cursor
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	page.HasMore = len(all) == limit
+
+	compacted, workoutUUIDs, entryUUIDs := compactChanges(all)
+
+	workoutsByUUID := map[string]*Workout{}
+	if len(workoutUUIDs) > 0 {
+		query := `SELECT ` + workoutColumns + `
+				  FROM workouts
+				  WHERE user_id = ? AND uuid IN ` + sqliteIn(len(workoutUUIDs)) + ` AND deleted_at IS NULL`
+		workouts, err := s.queryWorkouts(query, append([]interface{}{userID}, sqliteArgs(workoutUUIDs)...)...)
+		if err != nil {
+			return nil, err
+		}
+		for i := range workouts {
+			workoutsByUUID[workouts[i].UUID] = &workouts[i]
+		}
+	}
+
+	entriesByUUID, workoutOfEntry, err := s.entriesByUUID(userID, entryUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	page.Changes = attachChanges(compacted, workoutsByUUID, entriesByUUID, workoutOfEntry)
+	return page, nil
+}
+
+// PruneSyncChanges deletes the changes made before changedBefore that a later change of the same entity supersedes.
+// Ids follow the order of commits on SQLite, so the later change is the one with the greater id.
+func (s *SQLiteWorkoutStore) PruneSyncChanges(changedBefore time.Time) (int64, error) {
+	query := `DELETE FROM sync_changes
+			  WHERE changed_at < ? AND EXISTS (
+			      SELECT 1 FROM sync_changes later
+			      WHERE later.entity_uuid = sync_changes.entity_uuid AND later.entity = sync_changes.entity AND later.id > sync_changes.id
+			  )`
+	res, err := s.db.Exec(query, changedBefore.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// sqliteArgs turns strings into query arguments, e.g. for an IN list
+func sqliteArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+func (s *SQLiteWorkoutStore) entriesByUUID(userID int, uuids []string) (map[string]*WorkoutEntry, map[string]string, error) {
+	entries := map[string]*WorkoutEntry{}
+	workoutOfEntry := map[string]string{}
+	if len(uuids) == 0 {
+		return entries, workoutOfEntry, nil
+	}
+
+	// Entries of workouts in the trash are left out, like their workout
+	query := `SELECT (SELECT w.uuid FROM workouts w WHERE w.id = workout_entries.workout_id) AS workout_uuid, ` + entryColumns + `
+			  FROM workout_entries
+			  WHERE user_id = ? AND uuid IN ` + sqliteIn(len(uuids)) + `
+			  AND workout_id IN (SELECT id FROM workouts WHERE user_id = ? AND deleted_at IS NULL)`
+	args := append([]interface{}{userID}, sqliteArgs(uuids)...)
+	rows, err := s.db.Query(query, append(args, userID)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutUUID string
+		entry := &WorkoutEntry{}
+		err = scanEntry(rows, entry, &workoutUUID)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries[entry.UUID] = entry
+		workoutOfEntry[entry.UUID] = workoutUUID
+	}
+	return entries, workoutOfEntry, rows.Err()
+}
+
+func (s *SQLiteWorkoutStore) GetWorkoutDeletedAt(userID int, workoutUUID string) (*time.Time, error) {
+	return sqliteGetWorkoutDeletedAt(s.db, userID, workoutUUID)
+}
+
+func sqliteGetWorkoutDeletedAt(q queryer, userID int, workoutUUID string) (*time.Time, error) {
+	parsed, err := uuid.Parse(workoutUUID)
+	if err != nil {
+		return nil, nil
+	}
+
+	query := `SELECT changed_at
+			  FROM sync_changes
+			  WHERE user_id = ? AND entity = 'workout' AND entity_uuid = ? AND op = 'delete'
+			  ORDER BY id DESC
+			  LIMIT 1`
+	var deletedAt time.Time
+	err = q.QueryRow(query, userID, parsed.String()).Scan(&deletedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &deletedAt, nil
+}
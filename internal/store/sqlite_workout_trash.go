@@ -0,0 +1,87 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+	"github.com/google/uuid"
+)
+
+// Trash on SQLite. See workout_trash.go for how it works.
+
+func (s *SQLiteWorkoutStore) GetDeletedWorkouts(userID int) ([]Workout, error) {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = ? AND deleted_at IS NOT NULL
+			  ORDER BY deleted_at DESC`
+	return s.queryWorkouts(query, userID)
+}
+
+func (s *SQLiteWorkoutStore) RestoreWorkout(userID int, id int64) (*Workout, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	workout, err := sqliteRestoreWorkout(tx, userID, id)
+	if err != nil || workout == nil {
+		return nil, err
+	}
+	return workout, tx.Commit()
+}
+
+func (s *SQLiteWorkoutStore) RestoreWorkoutByUUID(userID int, workoutUUID string) (workout *Workout, err error) {
+	err = s.WithTransaction(func(tx WorkoutTx) error {
+		workout, err = tx.RestoreWorkoutByUUID(userID, workoutUUID)
+		return err
+	})
+	return workout, err
+}
+
+func (t *sqliteWorkoutTx) RestoreWorkoutByUUID(userID int, workoutUUID string) (*Workout, error) {
+	parsed, err := uuid.Parse(workoutUUID)
+	if err != nil {
+		return nil, nil
+	}
+
+	var id int64
+	query := `SELECT id FROM workouts WHERE user_id = ? AND uuid = ? AND deleted_at IS NOT NULL`
+	err = t.tx.QueryRow(query, userID, parsed.String()).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sqliteRestoreWorkout(t.tx, userID, id)
+}
+
+func sqliteRestoreWorkout(tx *sql.Tx, userID int, id int64) (*Workout, error) {
+	query := `UPDATE workouts
+			  SET deleted_at = NULL, updated_at = ?, version = version + 1
+			  WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL`
+	ok, err := changed(tx.Exec(query, sqliteNow(), id, userID))
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	workout, err := sqliteGetWorkoutByID(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = sqliteWriteEvent(tx, events.WorkoutRestored{WorkoutID: workout.ID, UUID: workout.UUID, UserID: workout.UserID, Version: workout.Version})
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+func (s *SQLiteWorkoutStore) PurgeDeletedWorkouts(deletedBefore time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM workouts WHERE deleted_at IS NOT NULL AND deleted_at < ?`, deletedBefore.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
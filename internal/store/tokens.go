@@ -1,9 +1,11 @@
 package store
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"time"
 
+	"github.com/OlivierCoq/go_api_template/internal/events"
 	"github.com/OlivierCoq/go_api_template/internal/tokens"
 )
 
@@ -20,7 +22,7 @@ type TokenStore interface {
 	Insert(token *tokens.Token) error
 	CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error)
 	DeleteAllTokensForUser(scope string, userID int) error
-	RevokeToken(tokenHash string) error
+	RevokeToken(tokenPlaintext string) error
 }
 
 // Insert a new token into the database
@@ -44,21 +46,60 @@ func (t *PostgresTokenStore) Insert(token *tokens.Token) error {
 }
 
 func (t *PostgresTokenStore) DeleteAllTokensForUser(scope string, userID int) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		DELETE FROM tokens
 		WHERE user_id = $1 AND scope = $2
 	`
-	_, err := t.db.Exec(query, userID, scope)
-	return err
+	res, err := tx.Exec(query, userID, scope)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// Only an event if there was something to revoke
+	if deleted > 0 {
+		err = writeEvent(tx, events.TokenRevoked{UserID: userID, Scope: scope})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 // Logging out:
-// RevokeToken
-func (t *PostgresTokenStore) RevokeToken(tokenHash string) error {
+// RevokeToken deletes the token the client sent. Tokens are stored hashed, like in GetUserToken.
+func (t *PostgresTokenStore) RevokeToken(tokenPlaintext string) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	query := `
 		DELETE FROM tokens
 		WHERE hash = $1
+		RETURNING user_id, scope
 	`
-	_, err := t.db.Exec(query, tokenHash)
-	return err
+	var revoked events.TokenRevoked
+	err = tx.QueryRow(query, tokenHash[:]).Scan(&revoked.UserID, &revoked.Scope)
+	if err == sql.ErrNoRows {
+		return nil // Already revoked, or expired and cleaned up
+	}
+	if err != nil {
+		return err
+	}
+	err = writeEvent(tx, revoked)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
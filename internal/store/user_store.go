@@ -6,6 +6,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/OlivierCoq/go_api_template/internal/events"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -51,13 +52,15 @@ func (p *password) Matches(plainText string) (bool, error) {
 }
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash password  `json:"-"`
-	Bio          string    `json:"bio"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email"`
+	PasswordHash password   `json:"-"`
+	Bio          string     `json:"bio"`
+	IsAdmin      bool       `json:"is_admin"` // Admins can read the audit log. Only set in the database, never through the API
+	DisabledAt   *time.Time `json:"-"`        // Set while the user is disabled, see SetUserDisabled
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 // AnonymousUser is a placeholder for unauthenticated users.
@@ -68,6 +71,11 @@ func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// IsDisabled reports whether the user was disabled, in which case they can't log in
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
 type PostgresUserStore struct {
 	db *sql.DB
 }
@@ -81,30 +89,43 @@ type UserStore interface {
 	CreateUser(*User) (*User, error)
 	GetUserByUsername(username string) (*User, error)
 	UpdateUser(*User) error
+	DeleteUser(id int) error
 	GetUserToken(scope, tokenPlaintext string) (*User, error)
+	UpdatePassword(user *User) error
+	SetUserDisabled(id int, disabled bool) error
 }
 
 // CRU operations:
 
 // Create user:
 func (s *PostgresUserStore) CreateUser(user *User) (*User, error) {
+	// A transaction, so the UserRegistered event is saved along with the user
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 
 	query := `
 		INSERT INTO users (username, email, password_hash, bio, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 		RETURNING id, created_at, updated_at
 	`
-	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err = tx.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
-	return user, nil
+	err = writeEvent(tx, events.UserRegistered{UserID: user.ID, Username: user.Username})
+	if err != nil {
+		return nil, err
+	}
+	return user, tx.Commit()
 }
 
 // Read (Get) user by username:
 func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, bio, created_at, updated_at
+		SELECT id, username, email, password_hash, bio, is_admin, disabled_at, created_at, updated_at
 		FROM users
 		WHERE username = $1
 	`
@@ -117,6 +138,8 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.IsAdmin,
+		&user.DisabledAt,
 		&user.CreatedAt,
 		&user.UpdatedAt)
 	if err == sql.ErrNoRows {
@@ -129,12 +152,18 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 
 // Update user:
 func (s *PostgresUserStore) UpdateUser(user *User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE users
 		SET username = $1, email = $2, bio = $3, updated_at = NOW()
 		WHERE id = $4
 	`
-	result, err := s.db.Exec(query, user.Username, user.Email, user.Bio, user.ID)
+	result, err := tx.Exec(query, user.Username, user.Email, user.Bio, user.ID)
 	if err != nil {
 		return err
 	}
@@ -149,6 +178,68 @@ func (s *PostgresUserStore) UpdateUser(user *User) error {
 		return sql.ErrNoRows
 	}
 
+	err = writeEvent(tx, events.UserUpdated{UserID: user.ID, Username: user.Username})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete user: their workouts, entries, tokens, webhooks and sessions go with them (ON DELETE CASCADE).
+// The audit log keeps what they did. Returns sql.ErrNoRows if there is no such user, like UpdateUser.
+func (s *PostgresUserStore) DeleteUser(id int) error {
+	result, err := s.db.Exec(`DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdatePassword saves the password hash of user, set with PasswordHash.Set. Returns sql.ErrNoRows if there is no such user.
+func (s *PostgresUserStore) UpdatePassword(user *User) error {
+	result, err := s.db.Exec(`UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`, user.PasswordHash.hash, user.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+/*
+	SetUserDisabled disables a user, or enables them again. Disabled users can't log in and GetUserToken ignores their tokens,
+	though the tokens stay in the table: revoke them with DeleteAllTokensForUser so they don't come back on enabling.
+	Disabling a disabled user keeps the date they were first disabled. Returns sql.ErrNoRows if there is no such user.
+*/
+
+func (s *PostgresUserStore) SetUserDisabled(id int, disabled bool) error {
+	query := `UPDATE users SET disabled_at = NULL, updated_at = NOW() WHERE id = $1`
+	if disabled {
+		query = `UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()), updated_at = NOW() WHERE id = $1`
+	}
+	result, err := s.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
 
@@ -159,12 +250,12 @@ func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User
 
 	// INNER JOIN tokens t ON u.id = t.user_id (Not sure if order matters here)
 	query := `
-		SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.created_at, u.updated_at
+		SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.is_admin, u.created_at, u.updated_at
 		FROM users u
 		INNER JOIN tokens t ON t.user_id = u.id
-		WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3
+		WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3 AND u.disabled_at IS NULL
 	`
-	// the t.expiry is to ensure the token is still valid (not expired)
+	// the t.expiry is to ensure the token is still valid (not expired), and tokens of disabled users don't work either
 	user := &User{
 		PasswordHash: password{},
 	}
@@ -174,6 +265,7 @@ func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.IsAdmin,
 		&user.CreatedAt,
 		&user.UpdatedAt)
 	if err == sql.ErrNoRows {
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Events a webhook can subscribe to
+const (
+	WebhookWorkoutCreated = "workout.created"
+	WebhookWorkoutUpdated = "workout.updated"
+	WebhookWorkoutDeleted = "workout.deleted"
+	WebhookRecordAchieved = "record.achieved"
+)
+
+func IsValidWebhookEvent(eventType string) bool {
+	switch eventType {
+	case WebhookWorkoutCreated, WebhookWorkoutUpdated, WebhookWorkoutDeleted, WebhookRecordAchieved:
+		return true
+	}
+	return false
+}
+
+// Statuses of a webhook delivery
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed" // The worker gave up: it's a dead letter
+)
+
+type WebhookSubscription struct {
+	ID         int64     `json:"id"`
+	UserID     int       `json:"user_id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"` // Only shown when the subscription is created
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event to send to one subscription
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	URL            string          `json:"url"`
+	Secret         string          `json:"-"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// WebhookEvent is the body POSTed to webhook URLs
+type WebhookEvent struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+type PostgresWebhookStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWebhookStore(db *sql.DB) *PostgresWebhookStore {
+	return &PostgresWebhookStore{db: db}
+}
+
+type WebhookStore interface {
+	CreateWebhookSubscription(subscription *WebhookSubscription) error
+	GetWebhookSubscriptions(userID int) ([]WebhookSubscription, error)
+	DeleteWebhookSubscription(userID int, id int64) (bool, error)
+	GetDeadLetters(userID int) ([]WebhookDelivery, error)
+	RetryDeadLetter(userID int, id int64) (bool, error)
+
+	// Used by the webhooks subscriber of the domain events
+	EnqueueWebhookEvent(userID int, event WebhookEvent) error
+
+	// Used by the delivery worker
+	ClaimWebhookDeliveries(limit int, lease time.Duration) ([]WebhookDelivery, error)
+	MarkWebhookDelivered(id int64, statusCode int) error
+	MarkWebhookFailed(id int64, statusCode int, deliveryErr string, retryAt *time.Time) error
+}
+
+// CreateWebhookSubscription saves a subscription. Event types go to and from Postgres as comma separated text,
+// which database/sql handles unlike arrays (they never contain commas).
+func (s *PostgresWebhookStore) CreateWebhookSubscription(subscription *WebhookSubscription) error {
+	query := `INSERT INTO webhook_subscriptions (user_id, url, secret, event_types)
+			  VALUES ($1, $2, $3, string_to_array($4, ','))
+			  RETURNING id, created_at`
+	return s.db.QueryRow(query, subscription.UserID, subscription.URL, subscription.Secret, strings.Join(subscription.EventTypes, ",")).Scan(&subscription.ID, &subscription.CreatedAt)
+}
+
+// GetWebhookSubscriptions returns the subscriptions of a user, without their secrets
+func (s *PostgresWebhookStore) GetWebhookSubscriptions(userID int) ([]WebhookSubscription, error) {
+	query := `SELECT id, user_id, url, array_to_string(event_types, ','), created_at
+			  FROM webhook_subscriptions
+			  WHERE user_id = $1
+			  ORDER BY id`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []WebhookSubscription{}
+	for rows.Next() {
+		var subscription WebhookSubscription
+		var eventTypes string
+		err = rows.Scan(&subscription.ID, &subscription.UserID, &subscription.URL, &eventTypes, &subscription.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		subscription.EventTypes = strings.Split(eventTypes, ",")
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+// DeleteWebhookSubscription removes a subscription of the user, along with its pending deliveries.
+// It returns false if the user has no such subscription.
+func (s *PostgresWebhookStore) DeleteWebhookSubscription(userID int, id int64) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// GetDeadLetters returns the deliveries to the user's webhooks that were given up on, most recent first
+func (s *PostgresWebhookStore) GetDeadLetters(userID int) ([]WebhookDelivery, error) {
+	query := `SELECT id, subscription_id, url, event_id, event_type, payload, attempts, last_attempt_at, last_status_code, COALESCE(last_error, ''), created_at
+			  FROM webhook_dead_letters
+			  WHERE user_id = $1
+			  ORDER BY id DESC`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload []byte
+		err = rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.URL, &delivery.EventID, &delivery.EventType, &payload, &delivery.Attempts, &delivery.LastAttemptAt, &delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// RetryDeadLetter puts a dead letter of the user back in the queue, with a fresh set of attempts.
+// It returns false if the user has no such dead letter.
+func (s *PostgresWebhookStore) RetryDeadLetter(userID int, id int64) (bool, error) {
+	query := `UPDATE webhook_deliveries d
+			  SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+			  FROM webhook_subscriptions s
+			  WHERE d.id = $1 AND d.status = 'failed' AND s.id = d.subscription_id AND s.user_id = $2`
+	res, err := s.db.Exec(query, id, userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+/*
+	ClaimWebhookDeliveries returns up to limit pending deliveries that are due, oldest first.
+	Claimed deliveries are pushed back by lease: if the worker dies before reporting how the delivery went, it's tried again
+	once the lease is over. FOR UPDATE SKIP LOCKED lets several workers poll at the same time without claiming the same rows.
+*/
+
+func (s *PostgresWebhookStore) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	query := `UPDATE webhook_deliveries d
+			  SET next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+			  FROM webhook_subscriptions s
+			  WHERE s.id = d.subscription_id AND d.id IN (
+				  SELECT id FROM webhook_deliveries
+				  WHERE status = 'pending' AND next_attempt_at <= NOW()
+				  ORDER BY next_attempt_at
+				  LIMIT $1
+				  FOR UPDATE SKIP LOCKED
+			  )
+			  RETURNING d.id, d.subscription_id, s.url, s.secret, d.event_id, d.event_type, d.payload, d.attempts, d.created_at`
+	rows, err := s.db.Query(query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload []byte
+		err = rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.URL, &delivery.Secret, &delivery.EventID, &delivery.EventType, &payload, &delivery.Attempts, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *PostgresWebhookStore) MarkWebhookDelivered(id int64, statusCode int) error {
+	query := `UPDATE webhook_deliveries
+			  SET status = 'delivered', attempts = attempts + 1, last_attempt_at = NOW(), last_status_code = $2, last_error = NULL, delivered_at = NOW()
+			  WHERE id = $1`
+	_, err := s.db.Exec(query, id, statusCode)
+	return err
+}
+
+// MarkWebhookFailed records a failed attempt. The delivery is tried again at retryAt, or becomes a dead letter if retryAt is nil.
+// statusCode is 0 when no response was received.
+func (s *PostgresWebhookStore) MarkWebhookFailed(id int64, statusCode int, deliveryErr string, retryAt *time.Time) error {
+	status := WebhookDeliveryPending
+	if retryAt == nil {
+		status = WebhookDeliveryFailed
+	}
+	var lastStatusCode *int
+	if statusCode != 0 {
+		lastStatusCode = &statusCode
+	}
+	query := `UPDATE webhook_deliveries
+			  SET status = $2, attempts = attempts + 1, last_attempt_at = NOW(), last_status_code = $3, last_error = $4, next_attempt_at = COALESCE($5, next_attempt_at)
+			  WHERE id = $1`
+	_, err := s.db.Exec(query, id, status, lastStatusCode, deliveryErr, retryAt)
+	return err
+}
+
+/*
+	EnqueueWebhookEvent adds event to the deliveries of every subscription of the user to its type. Users without a matching
+	subscription get nothing. An event already enqueued for a subscription (same ID) isn't added again, so the domain event
+	it comes from can be dispatched more than once.
+*/
+
+func (s *PostgresWebhookStore) EnqueueWebhookEvent(userID int, event WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+			  SELECT id, $3, $2, $4
+			  FROM webhook_subscriptions
+			  WHERE user_id = $1 AND $2 = ANY(event_types)
+			  ON CONFLICT (subscription_id, event_id) DO NOTHING`
+	_, err = s.db.Exec(query, userID, event.Type, event.ID, string(payload))
+	return err
+}
@@ -0,0 +1,369 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+)
+
+/*
+	Entries of a workout can be changed one at a time, instead of sending the whole workout with its full list of entries.
+	Every change also bumps the version and updated_at of the workout they belong to: entries are part of the workout,
+	so its ETag must change with them, sync clients must see the workout as changed, and webhooks get a workout.updated event.
+	Changes are made to the version of the workout the caller read: if it moved on since, they return ErrVersionConflict
+	and nothing changes, like UpdateWorkout.
+*/
+
+// ErrInvalidEntries is returned when the entries given for a workout don't match the ones it has (unknown ID, entry listed twice...)
+var ErrInvalidEntries = errors.New("invalid entries")
+
+// AddWorkoutEntry adds an entry at the end of a workout (or at entry.OrderIndex, if set), and returns the new version of the workout.
+func (pg *PostgresWorkoutStore) AddWorkoutEntry(workoutID int64, version int, entry *WorkoutEntry) (int, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	workout, err := touchWorkout(tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+
+	if entry.OrderIndex == 0 {
+		err = tx.QueryRow(`SELECT COALESCE(MAX(order_index), 0) + 1 FROM workout_entries WHERE workout_id = $1`, workoutID).Scan(&entry.OrderIndex)
+		if err != nil {
+			return 0, err
+		}
+	}
+	entry.ID = 0
+	err = insertEntry(tx, workout, entry)
+	if err != nil {
+		return 0, err
+	}
+	err = workoutEntriesChanged(tx, workoutID, []WorkoutEntry{*entry})
+	if err != nil {
+		return 0, err
+	}
+	return workout.Version, tx.Commit()
+}
+
+// UpdateWorkoutEntry saves an entry of a workout, and returns the new version of the workout.
+func (pg *PostgresWorkoutStore) UpdateWorkoutEntry(workoutID int64, version int, entry *WorkoutEntry) (int, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	workout, err := touchWorkout(tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+	previous, err := getWorkoutEntries(tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+	err = updateEntry(tx, workoutID, entry)
+	if err != nil {
+		return 0, err
+	}
+	err = workoutEntriesChanged(tx, workoutID, entriesWithNewWeight(previous, []WorkoutEntry{*entry}))
+	if err != nil {
+		return 0, err
+	}
+	return workout.Version, tx.Commit()
+}
+
+// DeleteWorkoutEntry removes an entry from a workout, and returns the new version of the workout.
+func (pg *PostgresWorkoutStore) DeleteWorkoutEntry(workoutID int64, version int, entryID int64) (int, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	workout, err := touchWorkout(tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+	err = deleteEntry(tx, workoutID, entryID)
+	if err != nil {
+		return 0, err
+	}
+	err = workoutEntriesChanged(tx, workoutID, nil)
+	if err != nil {
+		return 0, err
+	}
+	return workout.Version, tx.Commit()
+}
+
+/*
+	ReorderWorkoutEntries puts the entries of a workout in the given order, and returns the new version of the workout.
+	entryIDs must list every entry of the workout exactly once, otherwise ErrInvalidEntries is returned and nothing changes.
+	Only the entries whose position actually changed are written.
+*/
+
+func (pg *PostgresWorkoutStore) ReorderWorkoutEntries(workoutID int64, version int, entryIDs []int64) (int, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	workout, err := touchWorkout(tx, workoutID, version)
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := getWorkoutEntries(tx, workoutID)
+	if err != nil {
+		return 0, err
+	}
+	moves, err := reorderEntries(entries, entryIDs)
+	if err != nil {
+		return 0, err
+	}
+	for id, orderIndex := range moves {
+		_, err = tx.Exec(`UPDATE workout_entries SET order_index = $1 WHERE id = $2`, orderIndex, id)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = workoutEntriesChanged(tx, workoutID, nil)
+	if err != nil {
+		return 0, err
+	}
+	return workout.Version, tx.Commit()
+}
+
+// reorderEntries checks that entryIDs lists every one of the entries exactly once, and returns the new position of each
+// entry that moves, by ID
+func reorderEntries(entries []WorkoutEntry, entryIDs []int64) (map[int64]int, error) {
+	if len(entryIDs) != len(entries) {
+		return nil, fmt.Errorf("%w: expected the %d entries of the workout, got %d", ErrInvalidEntries, len(entries), len(entryIDs))
+	}
+	orderIndexes := make(map[int64]int, len(entries))
+	for _, entry := range entries {
+		orderIndexes[int64(entry.ID)] = entry.OrderIndex
+	}
+
+	moves := make(map[int64]int)
+	seen := make(map[int64]bool, len(entryIDs))
+	for i, id := range entryIDs {
+		current, ok := orderIndexes[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: entry %d does not belong to this workout", ErrInvalidEntries, id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%w: entry %d is listed more than once", ErrInvalidEntries, id)
+		}
+		seen[id] = true
+
+		// Positions start at 1, like the ones clients send when creating workouts
+		if current != i+1 {
+			moves[id] = i + 1
+		}
+	}
+	return moves, nil
+}
+
+// touchWorkout bumps the version and updated_at of a workout whose entries are about to change, if it's still at version.
+// Updating the row also locks it until the end of the transaction, so concurrent entry changes on the same workout queue up,
+// and the ones that were made to the same version as the first fail with ErrVersionConflict.
+func touchWorkout(tx *sql.Tx, workoutID int64, version int) (*Workout, error) {
+	workout := &Workout{ID: int(workoutID)}
+	query := `UPDATE workouts
+			  SET updated_at = NOW(), version = version + 1
+			  WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+			  RETURNING user_id, updated_at, version`
+	err := tx.QueryRow(query, workoutID, version).Scan(&workout.UserID, &workout.UpdatedAt, &workout.Version)
+	if err == sql.ErrNoRows {
+		return nil, missingOrConflict(tx, workoutID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+// missingOrConflict tells why a workout wasn't found at the expected version: either it's gone, or its version moved on
+func missingOrConflict(q queryer, workoutID int64) error {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM workouts WHERE id = $1 AND deleted_at IS NULL)`, workoutID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return fmt.Errorf("no workout found with id %d", workoutID)
+}
+
+// workoutEntriesChanged announces that the workout was updated. changed are the entries whose weight is new, which may be records.
+func workoutEntriesChanged(tx *sql.Tx, workoutID int64, changed []WorkoutEntry) error {
+	workout, err := getWorkoutByID(tx, workoutID)
+	if err != nil {
+		return err
+	}
+	err = writeEvent(tx, events.WorkoutUpdated{WorkoutID: workout.ID, UUID: workout.UUID, UserID: workout.UserID, Version: workout.Version})
+	if err != nil {
+		return err
+	}
+	return writeRecords(tx, workout, changed)
+}
+
+func updateEntry(tx *sql.Tx, workoutID int64, entry *WorkoutEntry) error {
+	query := `UPDATE workout_entries
+			  SET exercise_name = $1, sets = $2, reps = $3, duration_seconds = $4, weight = $5, notes = $6, order_index = $7
+			  WHERE id = $8 AND workout_id = $9`
+	res, err := tx.Exec(query, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex, entry.ID, workoutID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: entry %d does not belong to this workout", ErrInvalidEntries, entry.ID)
+	}
+	return nil
+}
+
+func deleteEntry(tx *sql.Tx, workoutID int64, entryID int64) error {
+	res, err := tx.Exec(`DELETE FROM workout_entries WHERE id = $1 AND workout_id = $2`, entryID, workoutID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: entry %d does not belong to this workout", ErrInvalidEntries, entryID)
+	}
+	return nil
+}
+
+/*
+	saveEntries makes the stored entries of a workout match workout.Entries, touching only the rows that changed:
+		- an entry with an ID (or the UUID of an existing entry) updates that entry, if any of its fields changed
+		- an entry without either is inserted
+		- stored entries that aren't listed anymore are deleted
+	Entries that stay keep their ID and created_at, instead of being deleted and inserted again on every save.
+*/
+
+func saveEntries(tx *sql.Tx, workout *Workout) error {
+	existing, err := getWorkoutEntries(tx, int64(workout.ID))
+	if err != nil {
+		return err
+	}
+	diff, err := diffEntries(workout, existing)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range diff.inserted {
+		err = insertEntry(tx, workout, entry)
+		if err != nil {
+			return err
+		}
+	}
+	for _, entry := range diff.updated {
+		err = updateEntry(tx, int64(workout.ID), entry)
+		if err != nil {
+			return err
+		}
+	}
+	for _, entryID := range diff.deleted {
+		err = deleteEntry(tx, int64(workout.ID), entryID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryDiff is what saving a workout changes in its entries. Inserted and updated entries point into workout.Entries.
+type entryDiff struct {
+	inserted []*WorkoutEntry
+	updated  []*WorkoutEntry
+	deleted  []int64
+}
+
+// diffEntries compares the entries a workout should have with the existing ones (see saveEntries).
+// Entries matched with an existing one get its ID and UUID.
+func diffEntries(workout *Workout, existing []WorkoutEntry) (*entryDiff, error) {
+	byID := make(map[int]*WorkoutEntry, len(existing))
+	byUUID := make(map[string]*WorkoutEntry, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+		byUUID[existing[i].UUID] = &existing[i]
+	}
+
+	diff := &entryDiff{}
+	kept := make(map[int]bool, len(workout.Entries))
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		if entry.UUID != "" {
+			err := ensureUUID(&entry.UUID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var current *WorkoutEntry
+		if entry.ID != 0 {
+			current = byID[entry.ID]
+			if current == nil {
+				return nil, fmt.Errorf("%w: entry %d does not belong to this workout", ErrInvalidEntries, entry.ID)
+			}
+		} else if entry.UUID != "" {
+			current = byUUID[entry.UUID]
+		}
+
+		if current == nil {
+			diff.inserted = append(diff.inserted, entry)
+			continue
+		}
+
+		if kept[current.ID] {
+			return nil, fmt.Errorf("%w: entry %d is listed more than once", ErrInvalidEntries, current.ID)
+		}
+		kept[current.ID] = true
+		entry.ID = current.ID
+		entry.UUID = current.UUID
+		if !sameEntry(entry, current) {
+			diff.updated = append(diff.updated, entry)
+		}
+	}
+
+	for _, entry := range existing {
+		if !kept[entry.ID] {
+			diff.deleted = append(diff.deleted, int64(entry.ID))
+		}
+	}
+	return diff, nil
+}
+
+// sameEntry reports whether two entries have the same content, so unchanged entries can be left alone
+func sameEntry(a, b *WorkoutEntry) bool {
+	return a.ExerciseName == b.ExerciseName &&
+		a.Sets == b.Sets &&
+		sameValue(a.Reps, b.Reps) &&
+		sameValue(a.DurationSeconds, b.DurationSeconds) &&
+		sameValue(a.Weight, b.Weight) &&
+		a.Notes == b.Notes &&
+		a.OrderIndex == b.OrderIndex
+}
+
+// sameValue compares two optional values: both missing, or both set to the same value
+func sameValue[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// existingEntries are the entries of a saved workout, as getWorkoutEntries returns them
+func existingEntries() []WorkoutEntry {
+	return []WorkoutEntry{
+		{ID: 1, UUID: "3b1a6f0e-8c1d-4a52-9a7e-1f2d3c4b5a61", ExerciseName: "Squat", Sets: 3, Reps: ptrInt(10), Weight: FloatPtr(60), OrderIndex: 1},
+		{ID: 2, UUID: "7c2e4d1a-5b3f-4e6a-8d9c-0a1b2c3d4e5f", ExerciseName: "Lunge", Sets: 2, Reps: ptrInt(12), OrderIndex: 2},
+		{ID: 3, UUID: "9f8e7d6c-5b4a-4392-8170-6f5e4d3c2b1a", ExerciseName: "Plank", Sets: 1, DurationSeconds: ptrInt(60), OrderIndex: 3},
+	}
+}
+
+func TestDiffEntries(t *testing.T) {
+	existing := existingEntries()
+	workout := &Workout{Entries: []WorkoutEntry{
+		existing[0], // Unchanged, by ID
+		{UUID: "7C2E4D1A-5B3F-4E6A-8D9C-0A1B2C3D4E5F", ExerciseName: "Lunge", Sets: 3, Reps: ptrInt(12), OrderIndex: 2}, // Changed, matched by its UUID in upper case
+		{ExerciseName: "Push-up", Sets: 3, Reps: ptrInt(20), OrderIndex: 3},                                             // New
+	}}
+
+	diff, err := diffEntries(workout, existing)
+	require.NoError(t, err)
+	require.Len(t, diff.inserted, 1)
+	assert.Equal(t, "Push-up", diff.inserted[0].ExerciseName)
+	require.Len(t, diff.updated, 1)
+	assert.Equal(t, 2, diff.updated[0].ID, "matched by UUID")
+	assert.Equal(t, existing[1].UUID, diff.updated[0].UUID)
+	assert.Same(t, &workout.Entries[1], diff.updated[0], "points into the workout's entries")
+	assert.Equal(t, []int64{3}, diff.deleted, "the plank isn't listed anymore")
+}
+
+func TestDiffEntriesErrors(t *testing.T) {
+	existing := existingEntries()
+	tests := []struct {
+		name    string
+		entries []WorkoutEntry
+		wantErr error
+	}{
+		{"unknown ID", []WorkoutEntry{{ID: 42, ExerciseName: "Squat"}}, ErrInvalidEntries},
+		{"listed twice", []WorkoutEntry{existing[0], {UUID: existing[0].UUID, ExerciseName: "Squat"}}, ErrInvalidEntries},
+		{"invalid UUID", []WorkoutEntry{{UUID: "not-a-uuid", ExerciseName: "Squat"}}, ErrInvalidUUID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := diffEntries(&Workout{Entries: tt.entries}, existingEntries())
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestReorderEntries(t *testing.T) {
+	tests := []struct {
+		name      string
+		entryIDs  []int64
+		wantMoves map[int64]int
+		wantErr   bool
+	}{
+		{"same order", []int64{1, 2, 3}, map[int64]int{}, false},
+		{"last first", []int64{3, 1, 2}, map[int64]int{3: 1, 1: 2, 2: 3}, false},
+		{"swap two", []int64{2, 1, 3}, map[int64]int{2: 1, 1: 2}, false},
+		{"missing entry", []int64{1, 2}, nil, true},
+		{"unknown entry", []int64{1, 2, 4}, nil, true},
+		{"entry listed twice", []int64{1, 1, 2}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moves, err := reorderEntries(existingEntries(), tt.entryIDs)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidEntries)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMoves, moves, "only the entries that move")
+		})
+	}
+}
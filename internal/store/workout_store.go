@@ -2,21 +2,41 @@ package store
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+	"github.com/google/uuid"
+)
+
+// Workout statuses. A workout is either planned for the future, or it was done (completed) or missed (skipped).
+const (
+	WorkoutStatusPlanned   = "planned"
+	WorkoutStatusCompleted = "completed"
+	WorkoutStatusSkipped   = "skipped"
 )
 
 type Workout struct {
 	ID              int            `json:"id"`
+	UUID            string         `json:"uuid"` // Can be generated by the client, so offline-created workouts have a stable ID before they reach the server
 	UserID          int            `json:"user_id"`
 	Title           string         `json:"title"`
 	Description     string         `json:"description"`
 	DurationMinutes int            `json:"duration"` // Duration in minutes
 	CaloriesBurned  int            `json:"calories_burned"`
+	PlannedFor      *time.Time     `json:"planned_for"`          // When the workout is scheduled. nil for workouts that were logged without planning
+	Status          string         `json:"status"`               // planned, completed or skipped
+	ExternalID      *string        `json:"external_id"`          // ID given by the client or the app a workout was imported from, unique per user
+	UpdatedAt       time.Time      `json:"updated_at"`           // Last change. Left zero when saving, the store stamps the current time
+	Version         int            `json:"version"`              // Incremented on every update, see UpdateWorkout
+	DeletedAt       *time.Time     `json:"deleted_at,omitempty"` // Set while the workout is in the trash, see DeleteWorkout
 	Entries         []WorkoutEntry `json:"entries"`
 }
 
 type WorkoutEntry struct {
 	ID              int      `json:"id"`
+	UUID            string   `json:"uuid"`
 	ExerciseName    string   `json:"exercise_name"`
 	Sets            int      `json:"sets"`
 	Reps            *int     `json:"reps"`
@@ -44,8 +64,131 @@ type WorkoutStore interface {
 	CreateWorkout(*Workout) (*Workout, error)
 	GetWorkoutByID(id int64) (*Workout, error)
 	UpdateWorkout(*Workout) error
-	DeleteWorkout(id int64) error
+	DeleteWorkout(id int64, version int) error
 	GetWorkoutOwner(id int64) (int, error)
+	GetUpcomingWorkouts(userID int) ([]Workout, error)
+	GetOverdueWorkouts(userID int) ([]Workout, error)
+	GetScheduledWorkouts(userID int) ([]Workout, error)
+	StreamWorkouts(userID int, fn func(*Workout) error) error
+	ImportWorkouts(workouts []*Workout) (int, error)
+	WithTransaction(fn func(tx WorkoutTx) error) error
+	GetWorkoutByUUID(uuid string) (*Workout, error)
+	GetWorkoutDeletedAt(userID int, workoutUUID string) (*time.Time, error)
+	GetChangesSince(userID int, cursor int64, limit int) (*SyncPage, error)
+	PruneSyncChanges(changedBefore time.Time) (int64, error)
+	GetDeletedWorkouts(userID int) ([]Workout, error)
+	RestoreWorkout(userID int, id int64) (*Workout, error)
+	RestoreWorkoutByUUID(userID int, workoutUUID string) (*Workout, error)
+	PurgeDeletedWorkouts(deletedBefore time.Time) (int64, error)
+	AddWorkoutEntry(workoutID int64, version int, entry *WorkoutEntry) (int, error)
+	UpdateWorkoutEntry(workoutID int64, version int, entry *WorkoutEntry) (int, error)
+	DeleteWorkoutEntry(workoutID int64, version int, entryID int64) (int, error)
+	ReorderWorkoutEntries(workoutID int64, version int, entryIDs []int64) (int, error)
+	GetRecentWorkouts(userID int, limit int) ([]Workout, error)
+	GetEntriesForWorkouts(workoutIDs []int64) (map[int64][]WorkoutEntry, error)
+	GetPersonalRecords(userID int) ([]PersonalRecord, error)
+}
+
+// WorkoutTx is the subset of WorkoutStore available inside WithTransaction. Every call goes through the same database transaction.
+type WorkoutTx interface {
+	CreateWorkout(*Workout) (*Workout, error)
+	GetWorkoutByID(id int64) (*Workout, error)
+	UpdateWorkout(*Workout) error
+	DeleteWorkout(id int64, version int) error
+	GetWorkoutOwner(id int64) (int, error)
+	GetWorkoutByUUID(uuid string) (*Workout, error)
+	GetWorkoutDeletedAt(userID int, workoutUUID string) (*time.Time, error)
+	RestoreWorkoutByUUID(userID int, workoutUUID string) (*Workout, error)
+}
+
+// queryer is what *sql.DB and *sql.Tx have in common, so the same query code can run inside or outside a transaction.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// IsValidWorkoutStatus reports whether status is one of the known workout statuses.
+func IsValidWorkoutStatus(status string) bool {
+	switch status {
+	case WorkoutStatusPlanned, WorkoutStatusCompleted, WorkoutStatusSkipped:
+		return true
+	}
+	return false
+}
+
+// ErrInvalidUUID is returned when a workout or entry comes with a UUID that isn't one
+var ErrInvalidUUID = errors.New("invalid uuid")
+
+// ErrVersionConflict is returned by UpdateWorkout when the workout was changed by someone else since it was read.
+var ErrVersionConflict = errors.New("the workout was modified since it was read")
+
+// ErrDuplicateExternalID is returned when creating a workout whose ExternalID the user already has (e.g. a workout imported twice).
+var ErrDuplicateExternalID = errors.New("a workout with this external ID already exists")
+
+// Columns selected whenever we read workouts and entries, in the order scanWorkout and scanEntry expect them
+const (
+	workoutColumns = `id, uuid, user_id, title, description, duration_minutes, calories_burned, planned_for, status, external_id, updated_at, version, deleted_at`
+	entryColumns   = `id, uuid, exercise_name, sets, reps, duration_seconds, weight, notes, order_index`
+)
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+/*
+	- When scanning db query results, the Scan method must receive pointers to the destination variables.
+*/
+
+func scanWorkout(row scanner, workout *Workout) error {
+	return row.Scan(&workout.ID, &workout.UUID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.PlannedFor, &workout.Status, &workout.ExternalID, &workout.UpdatedAt, &workout.Version, &workout.DeletedAt)
+}
+
+// scanEntry scans entryColumns into entry. Destinations for columns selected before entryColumns (e.g. workout_id) can be passed as before.
+func scanEntry(row scanner, entry *WorkoutEntry, before ...interface{}) error {
+	dest := append(before,
+		&entry.ID,
+		&entry.UUID,
+		&entry.ExerciseName,
+		&entry.Sets,
+		&entry.Reps,
+		&entry.DurationSeconds,
+		&entry.Weight,
+		&entry.Notes,
+		&entry.OrderIndex,
+	)
+	return row.Scan(dest...)
+}
+
+// ensureUUID generates a UUID when none was given, and checks the format of the ones that were
+func ensureUUID(id *string) error {
+	if *id == "" {
+		*id = uuid.NewString()
+		return nil
+	}
+	parsed, err := uuid.Parse(*id)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidUUID, *id)
+	}
+	*id = parsed.String()
+	return nil
+}
+
+// nullTime turns a zero time into NULL, so queries can fall back on NOW() with COALESCE
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Workouts without an explicit status are planned if they have a date attached, otherwise they're logged as completed:
+func defaultWorkoutStatus(workout *Workout) string {
+	if workout.PlannedFor != nil {
+		return WorkoutStatusPlanned
+	}
+	return WorkoutStatusCompleted
 }
 
 func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
@@ -63,10 +206,45 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	}
 	defer tx.Rollback()
 
+	inserted, err := insertWorkout(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		return nil, ErrDuplicateExternalID
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+/*
+	insertWorkout inserts a workout and its entries inside an existing transaction, so it can be shared by CreateWorkout and ImportWorkouts.
+	It returns false (and inserts nothing) when the user already has a workout with the same ExternalID:
+	ON CONFLICT ... DO NOTHING makes Postgres skip the row instead of failing, and RETURNING then gives no rows.
+*/
+
+func insertWorkout(tx *sql.Tx, workout *Workout) (bool, error) {
+	if workout.Status == "" {
+		workout.Status = defaultWorkoutStatus(workout)
+	}
+	if workout.Entries == nil {
+		workout.Entries = []WorkoutEntry{} // As when it's read back: no entries is an empty list, not null
+	}
+	err := ensureUUID(&workout.UUID)
+	if err != nil {
+		return false, err
+	}
+
 	// The $ notation is used for parameterized queries in PostgreSQL.
-	query := `INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
-			  VALUES ($1, $2, $3, $4, $5)
-			  RETURNING id`
+	query := `INSERT INTO workouts (uuid, user_id, title, description, duration_minutes, calories_burned, planned_for, status, external_id, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, COALESCE($10, NOW()))
+			  ON CONFLICT (user_id, external_id) WHERE external_id IS NOT NULL DO NOTHING
+			  RETURNING id, updated_at, version`
 
 	/*
 		What's happening here:
@@ -74,44 +252,77 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 		2. We use the QueryRow method to execute the query with the provided workout details.
 		3. The Scan method retrieves the generated ID of the newly created workout and assigns it to workout.ID.
 	*/
-	err = tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID)
+	err = tx.QueryRow(query, workout.UUID, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.PlannedFor, workout.Status, workout.ExternalID, nullTime(workout.UpdatedAt)).Scan(&workout.ID, &workout.UpdatedAt, &workout.Version)
+	if err == sql.ErrNoRows {
+		return false, nil // Duplicate external ID, nothing was inserted
+	}
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
 	// Entries is a slice of WorkoutEntry structs within the Workout struct.
-	// We iterate over each entry to insert them into the workout_entries table:
-
-	for _, entry := range workout.Entries {
-		entryQuery := `INSERT INTO workout_entries (user_id, workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-					   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-					   RETURNING id`
-		err = tx.QueryRow(entryQuery, workout.UserID, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
+	// We iterate over each entry to insert them into the workout_entries table.
+	// Indexing (instead of `for _, entry := range`) lets us write the generated ID back into the slice rather than into a copy:
+	for i := range workout.Entries {
+		err = insertEntry(tx, workout, &workout.Entries[i])
 		if err != nil {
-			return nil, err
+			return false, err
 		}
 	}
 
-	err = tx.Commit()
+	err = writeEvent(tx, events.WorkoutCreated{WorkoutID: workout.ID, UUID: workout.UUID, UserID: workout.UserID, Version: workout.Version})
 	if err != nil {
-		return nil, err
+		return false, err
+	}
+	err = writeRecords(tx, workout, workout.Entries)
+	if err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	// Implementation for creating a workout in PostgreSQL
-	return workout, nil
+// insertEntry inserts one entry of a workout and fills in its generated ID (and UUID, when the client didn't provide one).
+func insertEntry(tx *sql.Tx, workout *Workout, entry *WorkoutEntry) error {
+	err := ensureUUID(&entry.UUID)
+	if err != nil {
+		return err
+	}
+
+	entryQuery := `INSERT INTO workout_entries (uuid, user_id, workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
+				   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				   RETURNING id`
+	return tx.QueryRow(entryQuery, entry.UUID, workout.UserID, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
 }
 
 func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
-	workout := &Workout{}
+	return getWorkoutByID(pg.db, id)
+}
 
-	query := `SELECT id, user_id, title, description, duration_minutes, calories_burned
+func getWorkoutByID(q queryer, id int64) (*Workout, error) {
+	query := `SELECT ` + workoutColumns + `
 			  FROM workouts
-			  WHERE id = $1`
+			  WHERE id = $1 AND deleted_at IS NULL`
+	return getWorkout(q, query, id)
+}
 
-	/*
-		- When scanning db query results, the Scan method must receive pointers to the destination variables.
-	*/
-	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned)
+func (pg *PostgresWorkoutStore) GetWorkoutByUUID(id string) (*Workout, error) {
+	return getWorkoutByUUID(pg.db, id)
+}
+
+func getWorkoutByUUID(q queryer, id string) (*Workout, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil // Not a UUID, so no workout can have it
+	}
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE uuid = $1 AND deleted_at IS NULL`
+	return getWorkout(q, query, id)
+}
+
+// getWorkout runs a query returning a single workout row, then fetches its entries
+func getWorkout(q queryer, query string, args ...interface{}) (*Workout, error) {
+	workout := &Workout{}
+	err := scanWorkout(q.QueryRow(query, args...), workout)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // No workout found with the given ID
@@ -120,13 +331,22 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 	}
 
 	// Fetch workout entries
-	entriesQuery := `SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
+	workout.Entries, err = getWorkoutEntries(q, int64(workout.ID))
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+// getWorkoutEntries returns the entries of a workout, in order
+func getWorkoutEntries(q queryer, workoutID int64) ([]WorkoutEntry, error) {
+	entriesQuery := `SELECT ` + entryColumns + `
 					 FROM workout_entries
 					 WHERE workout_id = $1
-					 ORDER BY order_index ASC`
+					 ORDER BY order_index ASC, id ASC`
 
 	// rows, because we can have multiple entries per workout:
-	rows, err := pg.db.Query(entriesQuery, id)
+	rows, err := q.Query(entriesQuery, workoutID)
 	if err != nil {
 		return nil, err
 	}
@@ -134,28 +354,18 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 
 	/*
 		Iterate over the rows and scan each entry into a WorkoutEntry struct,
-		then append it to the Entries slice of the Workout struct.
+		then append it to the entries slice.
 	*/
+	entries := []WorkoutEntry{} // No entries is an empty list, not null
 	for rows.Next() {
 		var entry WorkoutEntry
-		err = rows.Scan(
-			&entry.ID,
-			&entry.ExerciseName,
-			&entry.Sets,
-			&entry.Reps,
-			&entry.DurationSeconds,
-			&entry.Weight,
-			&entry.Notes,
-			&entry.OrderIndex,
-		)
+		err = scanEntry(rows, &entry)
 		if err != nil {
 			return nil, err
 		}
-		workout.Entries = append(workout.Entries, entry)
+		entries = append(entries, entry)
 	}
-
-	return workout, nil
-	// Implementation for retrieving a workout by ID from PostgreSQL
+	return entries, rows.Err()
 }
 
 func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
@@ -167,95 +377,156 @@ func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
 	}
 	defer tx.Rollback()
 
+	err = updateWorkout(tx, workout)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+	updateWorkout saves a workout and its entries inside an existing transaction (shared by UpdateWorkout and WithTransaction).
+	workout.Entries is the full list of entries the workout should end up with; see saveEntries for how it's applied.
+
+	Optimistic concurrency: workout.Version must be the version that was read. The UPDATE only matches the row if nobody
+	bumped the version in between, so two devices saving the same workout can't silently overwrite each other: the second
+	one gets ErrVersionConflict and nothing is changed. On success, workout.Version is the new version.
+*/
+
+func updateWorkout(tx *sql.Tx, workout *Workout) error {
+	if workout.Status == "" {
+		workout.Status = defaultWorkoutStatus(workout)
+	}
+
 	query := `UPDATE workouts
-			  SET user_id = $1, title = $2, description = $3, duration_minutes = $4, calories_burned = $5
-			  WHERE id = $6`
+			  SET user_id = $1, title = $2, description = $3, duration_minutes = $4, calories_burned = $5, planned_for = $6, status = $7, updated_at = COALESCE($8, NOW()), version = version + 1
+			  WHERE id = $9 AND version = $10 AND deleted_at IS NULL
+			  RETURNING updated_at, version`
 
-	res, err := tx.Exec(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	err := tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.PlannedFor, workout.Status, nullTime(workout.UpdatedAt), workout.ID, workout.Version).Scan(&workout.UpdatedAt, &workout.Version)
+	if err == sql.ErrNoRows {
+		return missingOrConflict(tx, int64(workout.ID))
+	}
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	// Weights before the save, so only entries with a new weight are checked for records
+	previous, err := getWorkoutEntries(tx, int64(workout.ID))
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no workout found with id %d", workout.ID)
+	err = saveEntries(tx, workout)
+	if err != nil {
+		return fmt.Errorf("save entries: %w", err)
 	}
 
-	// Debug: Log workout details
-	fmt.Printf("Updating workout ID: %d, UserID: %d, Entries count: %d\n", workout.ID, workout.UserID, len(workout.Entries))
-
-	// First, delete all existing entries for this workout
-	deleteQuery := `DELETE FROM workout_entries WHERE workout_id = $1`
-	deleteResult, err := tx.Exec(deleteQuery, workout.ID)
+	err = writeEvent(tx, events.WorkoutUpdated{WorkoutID: workout.ID, UUID: workout.UUID, UserID: workout.UserID, Version: workout.Version})
 	if err != nil {
-		fmt.Printf("Error deleting entries: %v\n", err)
 		return err
 	}
+	return writeRecords(tx, workout, entriesWithNewWeight(previous, workout.Entries))
+}
+
+// entriesWithNewWeight returns the entries whose weight is new: added entries, and existing ones whose weight changed
+func entriesWithNewWeight(previous []WorkoutEntry, entries []WorkoutEntry) []WorkoutEntry {
+	weights := make(map[int]*float64, len(previous))
+	for _, entry := range previous {
+		weights[entry.ID] = entry.Weight
+	}
 
-	deletedRows, _ := deleteResult.RowsAffected()
-	fmt.Printf("Deleted %d existing entries for workout %d\n", deletedRows, workout.ID)
-
-	// Then insert all entries as new ones
-	for i, entry := range workout.Entries {
-		// fmt.Printf("Inserting entry %d: ExerciseName=%s, Sets=%d, Reps=%v, Duration=%v, Weight=%v\n",
-		// 	i, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight)
-
-		entryQuery := `INSERT INTO workout_entries (user_id, workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-					   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-		_, err := tx.Exec(
-			entryQuery,
-			workout.UserID,
-			workout.ID,
-			entry.ExerciseName,
-			entry.Sets,
-			entry.Reps,
-			entry.DurationSeconds,
-			entry.Weight,
-			entry.Notes,
-			entry.OrderIndex)
+	var changed []WorkoutEntry
+	for _, entry := range entries {
+		weight, existed := weights[entry.ID]
+		if !existed || !sameValue(weight, entry.Weight) {
+			changed = append(changed, entry)
+		}
+	}
+	return changed
+}
+
+/*
+	writeRecords writes a RecordAchieved event for each of the given entries of a workout that beats the heaviest weight
+	the user ever logged for the same exercise (names compared case-insensitively) in their other entries.
+	Only entries whose weight was just set should be given, so saving a workout again doesn't announce the same record twice.
+	The first time an exercise is logged isn't a record: there is nothing to beat yet.
+*/
+
+func writeRecords(tx *sql.Tx, workout *Workout, entries []WorkoutEntry) error {
+	query := `SELECT MAX(e.weight)
+			  FROM workout_entries e
+			  JOIN workouts w ON w.id = e.workout_id
+			  WHERE e.user_id = $1 AND LOWER(e.exercise_name) = LOWER($2) AND e.id <> $3 AND w.deleted_at IS NULL`
+	for _, entry := range entries {
+		if entry.Weight == nil {
+			continue
+		}
+		var previous sql.NullFloat64
+		err := tx.QueryRow(query, workout.UserID, entry.ExerciseName, entry.ID).Scan(&previous)
+		if err != nil {
+			return err
+		}
+		if !previous.Valid || *entry.Weight <= previous.Float64 {
+			continue
+		}
+		err = writeEvent(tx, events.RecordAchieved{
+			WorkoutID:      workout.ID,
+			EntryID:        entry.ID,
+			UserID:         workout.UserID,
+			ExerciseName:   entry.ExerciseName,
+			Weight:         *entry.Weight,
+			PreviousWeight: previous.Float64,
+		})
 		if err != nil {
-			fmt.Printf("Error inserting entry %d: %v\n", i, err)
 			return err
 		}
-
-		// insertedRows, _ := insertResult.RowsAffected()
-		// fmt.Printf("Inserted entry %d: %d rows affected\n", i, insertedRows)
 	}
+	return nil
+}
 
-	// fmt.Printf("Attempting to commit transaction...\n")
-	err = tx.Commit()
+func (pg *PostgresWorkoutStore) DeleteWorkout(id int64, version int) error {
+	// A transaction, so the event is only saved along with the deletion
+	tx, err := pg.db.Begin()
 	if err != nil {
-		fmt.Printf("Error committing transaction: %v\n", err)
 		return err
 	}
+	defer tx.Rollback()
 
-	// fmt.Printf("Transaction committed successfully!\n")
-	return nil
-}
-
-func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
-	query := `DELETE FROM workouts WHERE id = $1`
-	res, err := pg.db.Exec(query, id)
+	err = deleteWorkout(tx, id, version)
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := res.RowsAffected()
+	return tx.Commit()
+}
+
+/*
+	deleteWorkout puts a workout in the trash, from where it can be restored until it's purged.
+	version is the version that was read, like for updateWorkout: a workout saved by someone else in the meantime isn't
+	deleted, ErrVersionConflict is returned instead.
+*/
+
+func deleteWorkout(tx *sql.Tx, id int64, version int) error {
+	deleted := &Workout{ID: int(id)}
+	query := `UPDATE workouts SET deleted_at = NOW() WHERE id = $1 AND version = $2 AND deleted_at IS NULL RETURNING uuid, user_id`
+	err := tx.QueryRow(query, id, version).Scan(&deleted.UUID, &deleted.UserID)
+	if err == sql.ErrNoRows {
+		return missingOrConflict(tx, id)
+	}
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no workout found with id %d", id)
-	}
-	return nil
+
+	return writeEvent(tx, events.WorkoutDeleted{WorkoutID: deleted.ID, UUID: deleted.UUID, UserID: deleted.UserID})
 }
 
 func (pg *PostgresWorkoutStore) GetWorkoutOwner(id int64) (int, error) {
+	return getWorkoutOwner(pg.db, id)
+}
+
+func getWorkoutOwner(q queryer, id int64) (int, error) {
 	var userID int
-	query := `SELECT user_id FROM workouts WHERE id = $1`
-	err := pg.db.QueryRow(query, id).Scan(&userID)
+	query := `SELECT user_id FROM workouts WHERE id = $1 AND deleted_at IS NULL`
+	err := q.QueryRow(query, id).Scan(&userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, fmt.Errorf("no workout found with id %d", id)
@@ -264,3 +535,392 @@ func (pg *PostgresWorkoutStore) GetWorkoutOwner(id int64) (int, error) {
 	}
 	return userID, nil
 }
+
+// Scheduling:
+
+// GetUpcomingWorkouts returns the user's planned workouts that are still ahead of them, soonest first.
+func (pg *PostgresWorkoutStore) GetUpcomingWorkouts(userID int) ([]Workout, error) {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = $1 AND status = 'planned' AND planned_for >= NOW() AND deleted_at IS NULL
+			  ORDER BY planned_for ASC`
+	return pg.queryWorkouts(query, userID)
+}
+
+// GetOverdueWorkouts returns the user's planned workouts whose date has passed without being completed or skipped, oldest first.
+func (pg *PostgresWorkoutStore) GetOverdueWorkouts(userID int) ([]Workout, error) {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = $1 AND status = 'planned' AND planned_for < NOW() AND deleted_at IS NULL
+			  ORDER BY planned_for ASC`
+	return pg.queryWorkouts(query, userID)
+}
+
+// GetScheduledWorkouts returns every workout of the user that has a date attached, whatever its status. Used for the calendar feed.
+func (pg *PostgresWorkoutStore) GetScheduledWorkouts(userID int) ([]Workout, error) {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = $1 AND planned_for IS NOT NULL AND deleted_at IS NULL
+			  ORDER BY planned_for ASC`
+	return pg.queryWorkouts(query, userID)
+}
+
+// queryWorkouts runs a query selecting workoutColumns and loads the entries of every workout found.
+func (pg *PostgresWorkoutStore) queryWorkouts(query string, args ...interface{}) ([]Workout, error) {
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []Workout{}
+	for rows.Next() {
+		var workout Workout
+		err = scanWorkout(rows, &workout)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = pg.loadEntries(workouts)
+	if err != nil {
+		return nil, err
+	}
+	return workouts, nil
+}
+
+// loadEntries fetches the entries of several workouts in a single query (instead of one query per workout) and attaches them.
+func (pg *PostgresWorkoutStore) loadEntries(workouts []Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(workouts))
+	for i := range workouts {
+		ids[i] = int64(workouts[i].ID)
+	}
+	entries, err := pg.GetEntriesForWorkouts(ids)
+	if err != nil {
+		return err
+	}
+	for i := range workouts {
+		workouts[i].Entries = entries[int64(workouts[i].ID)]
+		if workouts[i].Entries == nil {
+			workouts[i].Entries = []WorkoutEntry{}
+		}
+	}
+	return nil
+}
+
+// GetEntriesForWorkouts returns the entries of several workouts, in order, keyed by workout ID. Workouts without entries have no key.
+func (pg *PostgresWorkoutStore) GetEntriesForWorkouts(workoutIDs []int64) (map[int64][]WorkoutEntry, error) {
+	entries := make(map[int64][]WorkoutEntry, len(workoutIDs))
+	if len(workoutIDs) == 0 {
+		return entries, nil
+	}
+
+	entriesQuery := `SELECT workout_id, ` + entryColumns + `
+					 FROM workout_entries
+					 WHERE workout_id = ANY($1)
+					 ORDER BY workout_id, order_index ASC, id ASC`
+	rows, err := pg.db.Query(entriesQuery, workoutIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int64
+		var entry WorkoutEntry
+		err = scanEntry(rows, &entry, &workoutID)
+		if err != nil {
+			return nil, err
+		}
+		entries[workoutID] = append(entries[workoutID], entry)
+	}
+	return entries, rows.Err()
+}
+
+// GetRecentWorkouts returns the user's latest workouts, most recently changed first, WITHOUT their entries:
+// callers that need them fetch them for all the workouts at once with GetEntriesForWorkouts.
+func (pg *PostgresWorkoutStore) GetRecentWorkouts(userID int, limit int) ([]Workout, error) {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = $1 AND deleted_at IS NULL
+			  ORDER BY updated_at DESC, id DESC
+			  LIMIT $2`
+	rows, err := pg.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []Workout{}
+	for rows.Next() {
+		var workout Workout
+		err = scanWorkout(rows, &workout)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, workout)
+	}
+	return workouts, rows.Err()
+}
+
+// PersonalRecord is the heaviest weight a user logged for an exercise
+type PersonalRecord struct {
+	ExerciseName string    `json:"exercise_name"`
+	Weight       float64   `json:"weight"`
+	WorkoutID    int       `json:"workout_id"` // Where it was first done
+	EntryID      int       `json:"entry_id"`
+	AchievedAt   time.Time `json:"achieved_at"` // When that workout was last saved
+}
+
+// GetPersonalRecords returns the user's record for each exercise they logged a weight for, by exercise name.
+// Names are compared case-insensitively, like for record.achieved webhooks.
+func (pg *PostgresWorkoutStore) GetPersonalRecords(userID int) ([]PersonalRecord, error) {
+	// DISTINCT ON keeps the first row of each exercise in the ORDER BY: the heaviest, and the earliest of equally heavy ones
+	query := `SELECT DISTINCT ON (LOWER(e.exercise_name)) e.exercise_name, e.weight, w.id, e.id, w.updated_at
+			  FROM workout_entries e
+			  JOIN workouts w ON w.id = e.workout_id
+			  WHERE e.user_id = $1 AND e.weight IS NOT NULL AND w.deleted_at IS NULL
+			  ORDER BY LOWER(e.exercise_name), e.weight DESC, w.updated_at ASC, e.id ASC`
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []PersonalRecord{}
+	for rows.Next() {
+		var record PersonalRecord
+		err = rows.Scan(&record.ExerciseName, &record.Weight, &record.WorkoutID, &record.EntryID, &record.AchievedAt)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// Exporting:
+
+// How many rows are pulled from the export cursor per round trip
+const exportBatchSize = 500
+
+/*
+	StreamWorkouts calls fn once per workout of the user (with its entries), ordered by ID.
+	Instead of loading every workout in memory, it reads them through a server-side cursor: Postgres keeps the result set
+	on its side and we FETCH it in batches, so memory use stays flat no matter how much history the user has.
+	If fn returns an error, streaming stops and that error is returned.
+*/
+
+func (pg *PostgresWorkoutStore) StreamWorkouts(userID int, fn func(*Workout) error) error {
+	// Cursors only live inside a transaction
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// LEFT JOIN so that workouts without entries are exported too
+	declareQuery := `DECLARE workout_export NO SCROLL CURSOR FOR
+			  SELECT w.id, w.uuid, w.user_id, w.title, w.description, w.duration_minutes, w.calories_burned, w.planned_for, w.status, w.external_id, w.updated_at, w.version, w.deleted_at,
+			         e.id, e.uuid, e.exercise_name, e.sets, e.reps, e.duration_seconds, e.weight, e.notes, e.order_index
+			  FROM workouts w
+			  LEFT JOIN workout_entries e ON e.workout_id = w.id
+			  WHERE w.user_id = $1 AND w.deleted_at IS NULL
+			  ORDER BY w.id, e.order_index, e.id`
+	_, err = tx.Exec(declareQuery, userID)
+	if err != nil {
+		return err
+	}
+
+	// Rows come in as one row per entry, so we group consecutive rows of the same workout together.
+	// A workout is only handed to fn once we've seen a row of the next one (or reached the end).
+	var current *Workout
+	for {
+		fetched, err := pg.fetchExportBatch(tx, &current, fn)
+		if err != nil {
+			return err
+		}
+		if fetched == 0 {
+			break
+		}
+	}
+	if current != nil {
+		err = fn(current)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`CLOSE workout_export`)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// fetchExportBatch reads the next batch of rows from the export cursor and returns how many rows it got.
+func (pg *PostgresWorkoutStore) fetchExportBatch(tx *sql.Tx, current **Workout, fn func(*Workout) error) (int, error) {
+	rows, err := tx.Query(fmt.Sprintf(`FETCH %d FROM workout_export`, exportBatchSize))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	fetched := 0
+	for rows.Next() {
+		fetched++
+
+		var workout Workout
+		// Entry columns are nullable because of the LEFT JOIN
+		var entryID, sets, orderIndex sql.NullInt64
+		var entryUUID, exerciseName, notes sql.NullString
+		var entry WorkoutEntry
+		err = rows.Scan(
+			&workout.ID, &workout.UUID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.PlannedFor, &workout.Status, &workout.ExternalID, &workout.UpdatedAt, &workout.Version, &workout.DeletedAt,
+			&entryID, &entryUUID, &exerciseName, &sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &notes, &orderIndex,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		if *current == nil || (*current).ID != workout.ID {
+			if *current != nil {
+				err = fn(*current)
+				if err != nil {
+					return 0, err
+				}
+			}
+			workout.Entries = []WorkoutEntry{}
+			*current = &workout
+		}
+
+		if entryID.Valid {
+			entry.ID = int(entryID.Int64)
+			entry.UUID = entryUUID.String
+			entry.ExerciseName = exerciseName.String
+			entry.Sets = int(sets.Int64)
+			entry.Notes = notes.String
+			entry.OrderIndex = int(orderIndex.Int64)
+			(*current).Entries = append((*current).Entries, entry)
+		}
+	}
+	return fetched, rows.Err()
+}
+
+// Importing:
+
+// How many workouts are inserted per transaction during an import
+const importBatchSize = 100
+
+/*
+	ImportWorkouts inserts many workouts at once and returns how many were created.
+	Inserts are grouped in transactions of importBatchSize workouts: a single huge transaction would hold locks for the whole import,
+	while one transaction per workout would be slow. If a batch fails, it's rolled back and the batches before it stay committed;
+	since duplicates (by ExternalID) are skipped, the import can then simply be run again.
+	Skipped workouts keep an ID of 0, so callers can tell them apart from the created ones.
+*/
+
+func (pg *PostgresWorkoutStore) ImportWorkouts(workouts []*Workout) (int, error) {
+	created := 0
+	for start := 0; start < len(workouts); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(workouts) {
+			end = len(workouts)
+		}
+
+		batchCreated, err := pg.importBatch(workouts[start:end])
+		if err != nil {
+			return created, err
+		}
+		created += batchCreated
+	}
+	return created, nil
+}
+
+func (pg *PostgresWorkoutStore) importBatch(workouts []*Workout) (int, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	created := 0
+	for _, workout := range workouts {
+		inserted, err := insertWorkout(tx, workout)
+		if err != nil {
+			return 0, err
+		}
+		if inserted {
+			created++
+		} else {
+			workout.ID = 0
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return created, nil
+}
+
+// Transactions:
+
+/*
+	WithTransaction runs fn inside a single database transaction: either everything fn does is saved, or nothing is.
+	The transaction is committed if fn returns nil, and rolled back if it returns an error (which is then returned as is).
+*/
+
+func (pg *PostgresWorkoutStore) WithTransaction(fn func(tx WorkoutTx) error) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(&postgresWorkoutTx{tx: tx})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// postgresWorkoutTx implements WorkoutTx on top of an open transaction
+type postgresWorkoutTx struct {
+	tx *sql.Tx
+}
+
+func (t *postgresWorkoutTx) CreateWorkout(workout *Workout) (*Workout, error) {
+	inserted, err := insertWorkout(t.tx, workout)
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		return nil, ErrDuplicateExternalID
+	}
+	return workout, nil
+}
+
+func (t *postgresWorkoutTx) GetWorkoutByID(id int64) (*Workout, error) {
+	return getWorkoutByID(t.tx, id)
+}
+
+func (t *postgresWorkoutTx) UpdateWorkout(workout *Workout) error {
+	return updateWorkout(t.tx, workout)
+}
+
+func (t *postgresWorkoutTx) DeleteWorkout(id int64, version int) error {
+	return deleteWorkout(t.tx, id, version)
+}
+
+func (t *postgresWorkoutTx) GetWorkoutOwner(id int64) (int, error) {
+	return getWorkoutOwner(t.tx, id)
+}
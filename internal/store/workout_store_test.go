@@ -2,38 +2,23 @@ package store
 
 import (
 	"database/sql"
+	"os"
 	"testing" // provides testing framework
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/OlivierCoq/go_api_template/internal/testdb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// setupTestDB returns a migrated Postgres database of the test's own, dropped when it ends (see the testdb package).
+// Tests don't share rows, so they can run with t.Parallel(). Without a Postgres server the test is skipped.
 func setupTestDB(t *testing.T) *sql.DB {
-	db, err := sql.Open("pgx", "host=localhost port=5433 user=postgres password=postgres dbname=postgres sslmode=disable")
-	if err != nil {
-		t.Fatalf("Failed to open test database: %v", err)
-	}
-	// return db
-	err = Migrate(db, "../../migrations")
-	if err != nil {
-		t.Fatalf("Failed to run migrations: %v", err)
-	}
-
-	/*
-		- The purpose of truncating the tables before each test is to ensure that the database is in a clean state.
-		- This prevents data from previous tests from interfering with the current test, which could lead to false positives or negatives.
-		- By truncating the tables, we ensure that each test starts with an empty database, allowing for accurate and reliable test results.
-		- The CASCADE option is used to automatically remove any dependent records in related tables, maintaining referential integrity.
-		- This is especially important in a relational database where foreign key constraints may exist between tables.
-		- Overall, truncating the tables helps maintain isolation between tests and ensures that each test is executed in a controlled environment.
-	*/
-	_, err = db.Exec(`TRUNCATE workouts, workout_entries CASCADE`)
-	if err != nil {
-		t.Fatalf("Failed to truncate tables: %v", err)
-	}
+	return testdb.Postgres(t)
+}
 
-	return db
+// TestMain stops the Postgres server testdb may have started for the tests of this package
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m))
 }
 
 /*
@@ -44,6 +29,7 @@ func setupTestDB(t *testing.T) *sql.DB {
 
 // Tests in Go are named starting with "Test" and take a pointer to testing.T as a parameter:
 func TestCreateWorkout(t *testing.T) {
+	t.Parallel()
 	db := setupTestDB(t)
 	defer db.Close()
 
@@ -167,3 +153,57 @@ func ptrInt(i int) *int {
 func FloatPtr(f float64) *float64 {
 	return &f
 }
+
+/*
+	Sync cursors on Postgres: ids of sync_changes are handed out before transactions commit, so a transaction that
+	recorded its change first can commit last. A client pulling in between mustn't move past that change.
+	Not parallel: an open transaction holds back the sync changes of every database of the server, those of other tests too.
+*/
+
+func TestSyncChangesOfSlowTransactions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	stores := NewStores(DriverPostgres, db)
+	workouts := stores.Workouts
+	user := createTestUser(t, stores)
+
+	slow, err := workouts.CreateWorkout(newTestWorkout(user.ID, "Slow"))
+	require.NoError(t, err)
+	fast, err := workouts.CreateWorkout(newTestWorkout(user.ID, "Fast"))
+	require.NoError(t, err)
+
+	// Each workout was created with its two entries in a transaction of its own, which pages don't split
+	page, err := workouts.GetChangesSince(user.ID, 0, 2)
+	require.NoError(t, err)
+	assert.Len(t, page.Changes, 3)
+	assert.True(t, page.HasMore)
+	page, err = workouts.GetChangesSince(user.ID, page.Cursor, 100)
+	require.NoError(t, err)
+	assert.Len(t, page.Changes, 3)
+	cursor := page.Cursor
+
+	// The slow transaction records its change first, and a faster one commits after it
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.Exec(`UPDATE workouts SET title = 'Slower' WHERE id = $1`, slow.ID)
+	require.NoError(t, err)
+	fast.Title = "Faster"
+	require.NoError(t, workouts.UpdateWorkout(fast))
+
+	page, err = workouts.GetChangesSince(user.ID, cursor, 100)
+	require.NoError(t, err)
+	assert.Empty(t, page.Changes, "nothing is sent while an older transaction is in flight")
+	assert.Equal(t, cursor, page.Cursor)
+
+	require.NoError(t, tx.Commit())
+	page, err = workouts.GetChangesSince(user.ID, page.Cursor, 100)
+	require.NoError(t, err)
+	var titles []string
+	for _, change := range page.Changes {
+		if change.Workout != nil {
+			titles = append(titles, change.Workout.Title)
+		}
+	}
+	assert.ElementsMatch(t, []string{"Slower", "Faster"}, titles)
+}
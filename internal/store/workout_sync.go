@@ -0,0 +1,277 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/*
+	Offline sync.
+	Every insert, update and delete on workouts and workout_entries is recorded in the sync_changes table by a database trigger
+	(see migrations/00007_sync_changes.sql). Changes come with an ever-increasing cursor: a client remembers the last cursor
+	it saw, and asks for everything that happened after it. Deletions show up as "delete" changes (tombstones), so clients know
+	what to remove locally even though the rows themselves are gone.
+	Changes superseded by a later change of the same entity are pruned once they're old enough (see PruneSyncChanges).
+*/
+
+// Kinds of entities and operations found in the change feed
+const (
+	SyncEntityWorkout = "workout"
+	SyncEntityEntry   = "entry"
+
+	SyncOpUpsert = "upsert"
+	SyncOpDelete = "delete"
+)
+
+// SyncChange is one entry of the change feed. For upserts, the current state of the workout or entry is attached.
+type SyncChange struct {
+	Cursor      int64         `json:"cursor"`
+	Entity      string        `json:"type"` // workout or entry
+	Op          string        `json:"op"`   // upsert or delete
+	UUID        string        `json:"uuid"`
+	ChangedAt   time.Time     `json:"changed_at"`
+	Workout     *Workout      `json:"workout,omitempty"`      // Workout upserts only
+	Entry       *WorkoutEntry `json:"entry,omitempty"`        // Entry upserts only
+	WorkoutUUID string        `json:"workout_uuid,omitempty"` // Entry upserts only: the workout the entry belongs to
+}
+
+// SyncPage is a page of the change feed. Cursor is where the next page starts, HasMore tells if there is one.
+type SyncPage struct {
+	Changes []SyncChange
+	Cursor  int64
+	HasMore bool
+}
+
+/*
+	GetChangesSince returns up to limit changes of the user that happened after cursor, oldest first.
+	Within a page, an entity changed several times only appears once, with its latest operation:
+	clients only care about where things ended up, not every intermediate step.
+
+	On Postgres, the cursor is a transaction (xact_id), not the id of a change. Ids are handed out as rows are inserted,
+	not as they're committed: a slow transaction can commit a change with a smaller id than one a client already pulled,
+	and that client would never see it. So changes are read in transaction order, and only those of transactions older than
+	every write transaction still in flight on the server, which no change can be added to anymore. Pages end with a whole transaction,
+	so that the next one can start right after it (a single transaction of more than limit changes comes whole).
+*/
+
+func (pg *PostgresWorkoutStore) GetChangesSince(userID int, cursor int64, limit int) (*SyncPage, error) {
+	// One more than the limit, to tell if the last transaction of the page goes on past it
+	query := `SELECT xact_id, entity, entity_uuid, op, changed_at
+			  FROM sync_changes
+			  WHERE user_id = $1 AND xact_id > $2 AND xact_id < txid_snapshot_xmin(txid_current_snapshot())
+			  ORDER BY xact_id, id
+			  LIMIT $3`
+	all, err := pg.queryChanges(query, userID, cursor, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SyncPage{Cursor: cursor}
+	if len(all) > limit {
+		page.HasMore = true
+		cut := all[limit].Cursor
+		all = all[:limit]
+		for len(all) > 0 && all[len(all)-1].Cursor == cut {
+			all = all[:len(all)-1]
+		}
+		if len(all) == 0 {
+			all, err = pg.queryChanges(`SELECT xact_id, entity, entity_uuid, op, changed_at
+			  FROM sync_changes
+			  WHERE user_id = $1 AND xact_id = $2
+			  ORDER BY id`, userID, cut)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(all) > 0 {
+		page.Cursor = all[len(all)-1].Cursor
+	}
+
+	compacted, workoutUUIDs, entryUUIDs := compactChanges(all)
+
+	// Attach the current state of everything that was upserted.
+	// The UUIDs are sent as text[] and cast server side, which pgx encodes from a []string without any extra type.
+	workoutsByUUID := map[string]*Workout{}
+	if len(workoutUUIDs) > 0 {
+		workouts, err := pg.queryWorkouts(`SELECT `+workoutColumns+`
+			  FROM workouts
+			  WHERE user_id = $1 AND uuid = ANY($2::text[]::uuid[]) AND deleted_at IS NULL`, userID, workoutUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range workouts {
+			workoutsByUUID[workouts[i].UUID] = &workouts[i]
+		}
+	}
+
+	entriesByUUID, workoutOfEntry, err := pg.entriesByUUID(userID, entryUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	page.Changes = attachChanges(compacted, workoutsByUUID, entriesByUUID, workoutOfEntry)
+	return page, nil
+}
+
+/*
+	PruneSyncChanges deletes the changes made before changedBefore that a later change of the same entity supersedes,
+	and returns how many it deleted. GetChangesSince only ever sends the latest change of an entity, and whatever the cursor
+	of a client, the later change comes after it: pruning changes nothing to what clients get, so pulling from 0 still
+	brings every workout. The latest change of each entity is kept, tombstones included: the feed grows with the number
+	of workouts and entries ever created, not with the number of times they're changed.
+*/
+
+func (pg *PostgresWorkoutStore) PruneSyncChanges(changedBefore time.Time) (int64, error) {
+	query := `DELETE FROM sync_changes c
+			  WHERE c.changed_at < $1 AND EXISTS (
+			      SELECT 1 FROM sync_changes later
+			      WHERE later.entity_uuid = c.entity_uuid AND later.entity = c.entity AND (later.xact_id, later.id) > (c.xact_id, c.id)
+			  )`
+	res, err := pg.db.Exec(query, changedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// queryChanges runs a query of sync_changes, whose changes get the transaction that recorded them as cursor
+func (pg *PostgresWorkoutStore) queryChanges(query string, args ...interface{}) ([]SyncChange, error) {
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []SyncChange
+	for rows.Next() {
+		var change SyncChange
+		err = rows.Scan(&change.Cursor, &change.Entity, &change.UUID, &change.Op, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// compactChanges keeps the latest change of each entity, and lists the UUIDs of the workouts and entries that were upserted
+func compactChanges(all []SyncChange) ([]SyncChange, []string, []string) {
+	// The changes are ordered, so later ones overwrite earlier ones
+	latest := make(map[string]int, len(all))
+	for i, change := range all {
+		latest[change.Entity+":"+change.UUID] = i
+	}
+	var workoutUUIDs, entryUUIDs []string
+	var compacted []SyncChange
+	for i, change := range all {
+		if latest[change.Entity+":"+change.UUID] != i {
+			continue
+		}
+		compacted = append(compacted, change)
+		if change.Op == SyncOpUpsert && change.Entity == SyncEntityWorkout {
+			workoutUUIDs = append(workoutUUIDs, change.UUID)
+		}
+		if change.Op == SyncOpUpsert && change.Entity == SyncEntityEntry {
+			entryUUIDs = append(entryUUIDs, change.UUID)
+		}
+	}
+	return compacted, workoutUUIDs, entryUUIDs
+}
+
+// attachChanges attaches the current state of everything that was upserted to the changes
+func attachChanges(compacted []SyncChange, workoutsByUUID map[string]*Workout, entriesByUUID map[string]*WorkoutEntry, workoutOfEntry map[string]string) []SyncChange {
+	changes := []SyncChange{}
+	for _, change := range compacted {
+		if change.Op == SyncOpUpsert {
+			// An upserted entity that can't be found anymore was deleted since, so it's sent as deleted.
+			// Its delete change usually comes in a later page, but on Postgres it can come first: transactions are in the
+			// order they started in, and one that started earlier may have changed the entity after a later one deleted it.
+			switch change.Entity {
+			case SyncEntityWorkout:
+				change.Workout = workoutsByUUID[change.UUID]
+				if change.Workout == nil {
+					change.Op = SyncOpDelete
+				}
+			case SyncEntityEntry:
+				change.Entry = entriesByUUID[change.UUID]
+				if change.Entry == nil {
+					change.Op = SyncOpDelete
+				} else {
+					change.WorkoutUUID = workoutOfEntry[change.UUID]
+				}
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// entriesByUUID fetches entries of the user by UUID, along with the UUID of the workout each one belongs to
+func (pg *PostgresWorkoutStore) entriesByUUID(userID int, uuids []string) (map[string]*WorkoutEntry, map[string]string, error) {
+	entries := map[string]*WorkoutEntry{}
+	workoutOfEntry := map[string]string{}
+	if len(uuids) == 0 {
+		return entries, workoutOfEntry, nil
+	}
+
+	// Entries of workouts in the trash are left out, like their workout
+	query := `SELECT (SELECT w.uuid FROM workouts w WHERE w.id = workout_entries.workout_id) AS workout_uuid, ` + entryColumns + `
+			  FROM workout_entries
+			  WHERE user_id = $1 AND uuid = ANY($2::text[]::uuid[])
+			  AND workout_id IN (SELECT id FROM workouts WHERE user_id = $1 AND deleted_at IS NULL)`
+	rows, err := pg.db.Query(query, userID, uuids)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutUUID string
+		entry := &WorkoutEntry{}
+		err = scanEntry(rows, entry, &workoutUUID)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries[entry.UUID] = entry
+		workoutOfEntry[entry.UUID] = workoutUUID
+	}
+	return entries, workoutOfEntry, rows.Err()
+}
+
+// GetWorkoutDeletedAt returns when the user's workout with this UUID was deleted, or nil if it never was.
+// Used to keep an old offline edit from resurrecting a workout that was deleted after it.
+func (pg *PostgresWorkoutStore) GetWorkoutDeletedAt(userID int, workoutUUID string) (*time.Time, error) {
+	return getWorkoutDeletedAt(pg.db, userID, workoutUUID)
+}
+
+func getWorkoutDeletedAt(q queryer, userID int, workoutUUID string) (*time.Time, error) {
+	if _, err := uuid.Parse(workoutUUID); err != nil {
+		return nil, nil
+	}
+
+	query := `SELECT changed_at
+			  FROM sync_changes
+			  WHERE user_id = $1 AND entity = 'workout' AND entity_uuid = $2 AND op = 'delete'
+			  ORDER BY id DESC
+			  LIMIT 1`
+	var deletedAt time.Time
+	err := q.QueryRow(query, userID, workoutUUID).Scan(&deletedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &deletedAt, nil
+}
+
+func (t *postgresWorkoutTx) GetWorkoutByUUID(id string) (*Workout, error) {
+	return getWorkoutByUUID(t.tx, id)
+}
+
+func (t *postgresWorkoutTx) GetWorkoutDeletedAt(userID int, workoutUUID string) (*time.Time, error) {
+	return getWorkoutDeletedAt(t.tx, userID, workoutUUID)
+}
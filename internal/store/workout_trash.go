@@ -0,0 +1,107 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+	"github.com/google/uuid"
+)
+
+/*
+	Trash.
+	DeleteWorkout doesn't remove anything: it sets deleted_at, and every read of the store ignores workouts that have one.
+	Deleted workouts (and their entries, which are left untouched) can be listed and restored until PurgeDeletedWorkouts
+	removes them for good once they've been in the trash long enough.
+*/
+
+// GetDeletedWorkouts returns the workouts of the user that are in the trash, most recently deleted first
+func (pg *PostgresWorkoutStore) GetDeletedWorkouts(userID int) ([]Workout, error) {
+	query := `SELECT ` + workoutColumns + `
+			  FROM workouts
+			  WHERE user_id = $1 AND deleted_at IS NOT NULL
+			  ORDER BY deleted_at DESC`
+	return pg.queryWorkouts(query, userID)
+}
+
+/*
+	RestoreWorkout takes a workout of the user out of the trash and returns it.
+	It returns nil if the user has no such workout in the trash (never existed, not theirs, not deleted, or already purged).
+	Restoring counts as a change: the version goes up, sync clients get the workout back in their change feed, and webhooks
+	get a workout.updated event.
+*/
+
+func (pg *PostgresWorkoutStore) RestoreWorkout(userID int, id int64) (*Workout, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	workout, err := restoreWorkout(tx, userID, id)
+	if err != nil || workout == nil {
+		return nil, err
+	}
+	return workout, tx.Commit()
+}
+
+// RestoreWorkoutByUUID is RestoreWorkout for the user's workout with this UUID.
+// Sync uses it, in a transaction, when an upsert wins over the delete of a workout that's still in the trash.
+func (pg *PostgresWorkoutStore) RestoreWorkoutByUUID(userID int, workoutUUID string) (workout *Workout, err error) {
+	err = pg.WithTransaction(func(tx WorkoutTx) error {
+		workout, err = tx.RestoreWorkoutByUUID(userID, workoutUUID)
+		return err
+	})
+	return workout, err
+}
+
+func (t *postgresWorkoutTx) RestoreWorkoutByUUID(userID int, workoutUUID string) (*Workout, error) {
+	if _, err := uuid.Parse(workoutUUID); err != nil {
+		return nil, nil
+	}
+
+	var id int64
+	query := `SELECT id FROM workouts WHERE user_id = $1 AND uuid = $2 AND deleted_at IS NOT NULL`
+	err := t.tx.QueryRow(query, userID, workoutUUID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return restoreWorkout(t.tx, userID, id)
+}
+
+func restoreWorkout(tx *sql.Tx, userID int, id int64) (*Workout, error) {
+	query := `UPDATE workouts
+			  SET deleted_at = NULL, updated_at = NOW(), version = version + 1
+			  WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+			  RETURNING id`
+	err := tx.QueryRow(query, id, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	workout, err := getWorkoutByID(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = writeEvent(tx, events.WorkoutRestored{WorkoutID: workout.ID, UUID: workout.UUID, UserID: workout.UserID, Version: workout.Version})
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+// PurgeDeletedWorkouts permanently deletes the workouts that were put in the trash before deletedBefore,
+// along with their entries (ON DELETE CASCADE), and returns how many workouts were removed.
+func (pg *PostgresWorkoutStore) PurgeDeletedWorkouts(deletedBefore time.Time) (int64, error) {
+	res, err := pg.db.Exec(`DELETE FROM workouts WHERE deleted_at IS NOT NULL AND deleted_at < $1`, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
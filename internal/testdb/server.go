@@ -0,0 +1,107 @@
+package testdb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+/*
+	A throwaway Postgres server, for machines with Postgres installed but no server for tests (e.g. CI without docker).
+	The binaries are looked up in TEST_POSTGRES_BIN (e.g. /usr/lib/postgresql/16/bin), then in the PATH.
+	The cluster lives in a temporary directory and only listens on a unix socket in it, so it can't clash with another
+	server. It's trusted and runs with fsync off: the data is thrown away anyway. Main stops it.
+*/
+
+var (
+	localMu sync.Mutex
+	local   *server // The server started by startLocal, for Main to stop
+)
+
+func startLocal() (*server, error) {
+	initdb, err := findBinary("initdb")
+	if err != nil {
+		return nil, err
+	}
+	pgCtl, err := findBinary("pg_ctl")
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "testdb")
+	if err != nil {
+		return nil, err
+	}
+	data := filepath.Join(dir, "data")
+	cleanup := func() { os.RemoveAll(dir) }
+
+	// Postgres refuses to run as root, which is the usual case in containers: this is reported as the reason for skipping
+	err = run(initdb, "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync")
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	options := fmt.Sprintf("-c listen_addresses='' -k %s -c fsync=off -c synchronous_commit=off -c full_page_writes=off", dir)
+	err = run(pgCtl, "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-o", options, "-w", "start")
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	stop := func() {
+		run(pgCtl, "-D", data, "-m", "immediate", "stop")
+		cleanup()
+	}
+
+	srv, err := connect(fmt.Sprintf("host=%s user=postgres dbname=postgres sslmode=disable", dir))
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("started a Postgres server but can't connect to it: %w", err)
+	}
+	srv.stop = stop
+	localMu.Lock()
+	local = srv
+	localMu.Unlock()
+	return srv, nil
+}
+
+// stopLocal stops the server of startLocal, if it was started
+func stopLocal() {
+	localMu.Lock()
+	defer localMu.Unlock()
+	if local != nil {
+		local.admin.Close()
+		local.stop()
+		local = nil
+	}
+}
+
+func findBinary(name string) (string, error) {
+	if dir := os.Getenv("TEST_POSTGRES_BIN"); dir != "" {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("no %s in TEST_POSTGRES_BIN: %w", name, err)
+		}
+		return path, nil
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("no local Postgres (%s isn't in the PATH, see TEST_POSTGRES_BIN)", name)
+	}
+	return path, nil
+}
+
+// run runs a command, with its output as the error when it fails
+func run(name string, args ...string) error {
+	var output bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", filepath.Base(name), err, bytes.TrimSpace(output.Bytes()))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package testdb
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(Main(m))
+}
+
+// Parallel tests each get a database of their own, migrated and empty
+func TestPostgresIsolation(t *testing.T) {
+	for _, name := range []string{"first", "second", "third"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			db := Postgres(t)
+
+			_, err := db.Exec(`INSERT INTO users (username, email, password_hash) VALUES ($1, $1 || '@example.com', 'x')`, name)
+			require.NoError(t, err)
+			var count int
+			require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count))
+			assert.Equal(t, 1, count)
+		})
+	}
+}
+
+func TestMigrationsHash(t *testing.T) {
+	first, err := migrationsHash()
+	require.NoError(t, err)
+	second, err := migrationsHash()
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	// It ends up in a database name, which isn't quoted
+	assert.Regexp(t, regexp.MustCompile(`^[a-f0-9]{12}$`), first)
+}
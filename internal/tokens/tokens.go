@@ -9,7 +9,9 @@ import (
 
 // Scope
 const (
-	ScopeAuth = "authentication"
+	ScopeAuth     = "authentication"
+	ScopeCalendar = "calendar" // Read-only access to a user's calendar feed, embedded in the feed URL
+	ScopeRealtime = "realtime" // Opens a live update connection, from browsers that can only pass it in the URL. Short-lived.
 )
 
 type Token struct {
@@ -0,0 +1,90 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*
+	Webhook URLs come from users, so the worker must not become a way to reach what only the server can: its loopback
+	interface, the private network, or link-local addresses (where cloud metadata services are, e.g. 169.254.169.254).
+	Addresses are checked when connecting, once the host name is resolved, so a name that resolves to a public address
+	when the webhook is created and to a private one later (DNS rebinding) is refused too.
+	Redirects aren't followed, since they could point anywhere: a 3xx is a failed attempt like any other non-2xx.
+*/
+
+// ErrBlockedAddress is returned when connecting to an address webhooks can't be sent to
+var ErrBlockedAddress = errors.New("webhooks can only be sent to public addresses")
+
+// Ranges that aren't private, loopback or link-local, but aren't the public internet either
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // Reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which can map to any IPv4 address
+}
+
+// IsPublicAddress tells whether webhooks can be sent to ip: not loopback, private (including fd00:ec2::254, the
+// IPv6 metadata service), link-local, multicast, unspecified or otherwise reserved.
+func IsPublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPublicHost tells whether host (of a URL, without the port) may be public. Names other than localhost can't be
+// told apart until they're resolved, which is when IsPublicAddress catches them.
+func IsPublicHost(host string) bool {
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return IsPublicAddress(ip)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return host != "localhost" && !strings.HasSuffix(host, ".localhost")
+}
+
+// newClient returns the client webhooks are sent with, which only connects to addresses allow accepts
+func newClient(allow func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+		// Called with the resolved address, right before connecting
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !allow(addrPort.Addr()) {
+				return fmt.Errorf("%w, not %s", ErrBlockedAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Proxy:               nil, // Through a proxy, the address checked would be the proxy's
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
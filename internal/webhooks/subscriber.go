@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"strconv"
+
+	"github.com/OlivierCoq/go_api_template/internal/events"
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/google/uuid"
+)
+
+/*
+	Webhook events come from the domain events: there is a single outbox, event_outbox, and Subscribe turns the events
+	webhooks can be subscribed to into deliveries for the subscriptions of the user they're about.
+	A domain event can be dispatched more than once, so the ID of the webhook event is derived from its own, and
+	EnqueueWebhookEvent skips events a subscription already has.
+*/
+
+// eventNamespace is the namespace of the (version 5) UUIDs of webhook events, made from the IDs of domain events
+var eventNamespace = uuid.MustParse("3b0f3c1e-6a5d-4f1e-9d0a-2f7c8e4b9a61")
+
+// Subscribe makes the dispatcher enqueue webhook deliveries. A restored workout is sent as updated, like before it was deleted.
+func Subscribe(dispatcher *events.Dispatcher, webhookStore store.WebhookStore, workoutStore store.WorkoutStore) {
+	s := &subscriber{webhooks: webhookStore, workouts: workoutStore}
+	events.OnEnvelope(dispatcher, func(envelope events.Envelope, e events.WorkoutCreated) error {
+		return s.enqueueWorkout(envelope, store.WebhookWorkoutCreated, e.WorkoutID)
+	})
+	events.OnEnvelope(dispatcher, func(envelope events.Envelope, e events.WorkoutUpdated) error {
+		return s.enqueueWorkout(envelope, store.WebhookWorkoutUpdated, e.WorkoutID)
+	})
+	events.OnEnvelope(dispatcher, func(envelope events.Envelope, e events.WorkoutRestored) error {
+		return s.enqueueWorkout(envelope, store.WebhookWorkoutUpdated, e.WorkoutID)
+	})
+	events.OnEnvelope(dispatcher, func(envelope events.Envelope, e events.WorkoutDeleted) error {
+		// The workout is gone from the receiver's point of view, so only what identifies it is sent
+		return s.enqueue(envelope, e.UserID, store.WebhookWorkoutDeleted, map[string]interface{}{
+			"id":         e.WorkoutID,
+			"uuid":       e.UUID,
+			"deleted_at": envelope.OccurredAt,
+		})
+	})
+	events.OnEnvelope(dispatcher, func(envelope events.Envelope, e events.RecordAchieved) error {
+		return s.enqueue(envelope, e.UserID, store.WebhookRecordAchieved, e)
+	})
+}
+
+type subscriber struct {
+	webhooks store.WebhookStore
+	workouts store.WorkoutStore
+}
+
+// enqueueWorkout sends the workout as it is when the event is dispatched. Nothing is sent if it was deleted since:
+// receivers get a workout.deleted event instead.
+func (s *subscriber) enqueueWorkout(envelope events.Envelope, eventType string, workoutID int) error {
+	workout, err := s.workouts.GetWorkoutByID(int64(workoutID))
+	if err != nil || workout == nil {
+		return err
+	}
+	return s.enqueue(envelope, workout.UserID, eventType, workout)
+}
+
+func (s *subscriber) enqueue(envelope events.Envelope, userID int, eventType string, data interface{}) error {
+	return s.webhooks.EnqueueWebhookEvent(userID, store.WebhookEvent{
+		ID:         uuid.NewSHA1(eventNamespace, []byte(strconv.FormatInt(envelope.ID, 10))).String(),
+		Type:       eventType,
+		OccurredAt: envelope.OccurredAt.UTC(),
+		Data:       data,
+	})
+}
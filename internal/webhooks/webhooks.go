@@ -0,0 +1,202 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+)
+
+/*
+	Webhook delivery.
+	Deliveries are added to webhook_deliveries by the subscriber of the domain events (see subscriber.go), so events
+	are only sent for changes that were committed. The Worker polls that table and POSTs each event to its subscription's URL. A 2xx response means delivered; anything
+	else is retried with exponential backoff, until MaxAttempts is reached and the delivery becomes a dead letter.
+	Only public addresses are sent to, and redirects aren't followed (see client.go).
+
+	Every request is signed so receivers can check it comes from us and wasn't replayed:
+		Webhook-Signature: t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>" with the subscription's secret>
+	along with Webhook-Id (the event ID, the same across retries) and Webhook-Event (the event type).
+*/
+
+const (
+	SignatureHeader = "Webhook-Signature"
+	EventIDHeader   = "Webhook-Id"
+	EventTypeHeader = "Webhook-Event"
+
+	// How many times a delivery is attempted before giving up on it
+	MaxAttempts = 10
+
+	firstRetryDelay = 30 * time.Second
+	maxRetryDelay   = 6 * time.Hour
+
+	// How long a claimed delivery is kept from other workers. Longer than a request can take.
+	claimLease = 2 * time.Minute
+	batchSize  = 50
+)
+
+// GenerateSecret returns a random secret to sign the payloads of a new subscription with
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// Sign returns the value of the signature header for a body sent at timestamp
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), signature(secret, timestamp.Unix(), body))
+}
+
+func signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header the way receivers should: the HMAC must match, and the timestamp must be within
+// tolerance of now, so an intercepted request can't be replayed later.
+func Verify(secret string, header string, body []byte, tolerance time.Duration, now time.Time) bool {
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || now.Sub(time.Unix(timestamp, 0)).Abs() > tolerance {
+		return false
+	}
+
+	expected := signature(secret, timestamp, body)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns how long to wait before the next attempt, after attempts failed ones: 30s, 1m, 2m, 4m... up to 6h
+func Backoff(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
+
+type Worker struct {
+	store  store.WebhookStore
+	client *http.Client
+	logger *log.Logger
+}
+
+func NewWorker(webhookStore store.WebhookStore, logger *log.Logger) *Worker {
+	return &Worker{
+		store:  webhookStore,
+		client: newClient(IsPublicAddress),
+		logger: logger,
+	}
+}
+
+// Run polls the outbox every interval until ctx is cancelled. Deliveries already claimed are attempted before it returns.
+func (wk *Worker) Run(ctx context.Context, interval time.Duration) {
+	for ctx.Err() == nil {
+		// Keep going while there is a backlog, otherwise wait for new events
+		delivered, err := wk.RunOnce()
+		if err != nil {
+			wk.logger.Printf("Failed to deliver webhooks: %v", err)
+		}
+		if delivered < batchSize {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+	}
+}
+
+// RunOnce claims the deliveries that are due, attempts each of them, and returns how many were attempted
+func (wk *Worker) RunOnce() (int, error) {
+	deliveries, err := wk.store.ClaimWebhookDeliveries(batchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range deliveries {
+		statusCode, err := wk.send(&delivery)
+		if err == nil {
+			err = wk.store.MarkWebhookDelivered(delivery.ID, statusCode)
+			if err != nil {
+				wk.logger.Printf("Failed to mark webhook delivery %d as delivered: %v", delivery.ID, err)
+			}
+			continue
+		}
+
+		// delivery.Attempts doesn't include this one yet
+		var retryAt *time.Time
+		if delivery.Attempts+1 < MaxAttempts {
+			next := time.Now().Add(Backoff(delivery.Attempts + 1))
+			retryAt = &next
+		} else {
+			wk.logger.Printf("Giving up on webhook delivery %d to %s after %d attempts: %v", delivery.ID, delivery.URL, MaxAttempts, err)
+		}
+		err = wk.store.MarkWebhookFailed(delivery.ID, statusCode, err.Error(), retryAt)
+		if err != nil {
+			wk.logger.Printf("Failed to record failed webhook delivery %d: %v", delivery.ID, err)
+		}
+	}
+	return len(deliveries), nil
+}
+
+// send POSTs a delivery and returns the status code of the response (0 if there was none).
+// It returns an error unless the receiver answered with a 2xx.
+func (wk *Worker) send(delivery *store.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-api-template-webhooks")
+	req.Header.Set(EventIDHeader, delivery.EventID)
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, time.Now(), delivery.Payload))
+
+	resp, err := wk.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain (a bit of) the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
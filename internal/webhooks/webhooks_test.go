@@ -0,0 +1,172 @@
+package webhooks
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/OlivierCoq/go_api_template/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"e1","type":"workout.created"}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign("s3cret", now, body)
+
+	assert.True(t, Verify("s3cret", header, body, 5*time.Minute, now.Add(time.Minute)))
+	assert.False(t, Verify("other", header, body, 5*time.Minute, now), "wrong secret")
+	assert.False(t, Verify("s3cret", header, []byte(`{}`), 5*time.Minute, now), "tampered body")
+	assert.False(t, Verify("s3cret", header, body, 5*time.Minute, now.Add(time.Hour)), "replayed too late")
+	assert.False(t, Verify("s3cret", "garbage", body, 5*time.Minute, now))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(1))
+	assert.Equal(t, time.Minute, Backoff(2))
+	assert.Equal(t, 4*time.Minute, Backoff(4))
+	assert.Equal(t, 6*time.Hour, Backoff(20), "capped")
+}
+
+// fakeStore hands out deliveries once and records what the worker reports about them
+type fakeStore struct {
+	store.WebhookStore
+	deliveries []store.WebhookDelivery
+	delivered  map[int64]int
+	failed     map[int64]*time.Time
+	errors     map[int64]string // Why the failed ones failed
+}
+
+func (f *fakeStore) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]store.WebhookDelivery, error) {
+	deliveries := f.deliveries
+	f.deliveries = nil
+	return deliveries, nil
+}
+
+func (f *fakeStore) MarkWebhookDelivered(id int64, statusCode int) error {
+	f.delivered[id] = statusCode
+	return nil
+}
+
+func (f *fakeStore) MarkWebhookFailed(id int64, statusCode int, deliveryErr string, retryAt *time.Time) error {
+	f.failed[id] = retryAt
+	if f.errors != nil {
+		f.errors[id] = fmt.Sprintf("%d %s", statusCode, deliveryErr)
+	}
+	return nil
+}
+
+func TestWorkerRunOnce(t *testing.T) {
+	payload := []byte(`{"id":"e1","type":"workout.created","data":{}}`)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "workout.created", r.Header.Get(EventTypeHeader))
+		assert.True(t, Verify("s3cret", r.Header.Get(SignatureHeader), body, time.Minute, time.Now()))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	fake := &fakeStore{
+		deliveries: []store.WebhookDelivery{
+			{ID: 1, URL: receiver.URL + "/ok", Secret: "s3cret", EventID: "e1", EventType: "workout.created", Payload: payload},
+			{ID: 2, URL: receiver.URL + "/down", Secret: "s3cret", EventID: "e1", EventType: "workout.created", Payload: payload, Attempts: 2},
+			{ID: 3, URL: receiver.URL + "/down", Secret: "s3cret", EventID: "e1", EventType: "workout.created", Payload: payload, Attempts: MaxAttempts - 1},
+		},
+		delivered: map[int64]int{},
+		failed:    map[int64]*time.Time{},
+	}
+	worker := NewWorker(fake, log.New(io.Discard, "", 0))
+	worker.client = newClient(func(netip.Addr) bool { return true }) // The receiver listens on the loopback interface
+
+	attempted, err := worker.RunOnce()
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempted)
+	assert.Equal(t, map[int64]int{1: http.StatusNoContent}, fake.delivered)
+
+	require.Contains(t, fake.failed, int64(2))
+	require.NotNil(t, fake.failed[2], "retried later")
+	assert.WithinDuration(t, time.Now().Add(Backoff(3)), *fake.failed[2], 5*time.Second)
+	require.Contains(t, fake.failed, int64(3))
+	assert.Nil(t, fake.failed[3], "dead letter")
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.216.34":        true,
+		"2606:4700::1111":      true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false, // Cloud metadata
+		"fd00:ec2::254":        false, // Cloud metadata, over IPv6
+		"fe80::1":              false,
+		"0.0.0.0":              false,
+		"::":                   false,
+		"100.64.0.1":           false,
+		"224.0.0.1":            false,
+		"255.255.255.255":      false,
+		"::ffff:127.0.0.1":     false, // IPv4 in IPv6
+		"64:ff9b::a00:1":       false, // 10.0.0.1 through NAT64
+		"::ffff:93.184.216.34": true,
+	} {
+		assert.Equal(t, public, IsPublicAddress(netip.MustParseAddr(address)), address)
+	}
+
+	assert.True(t, IsPublicHost("coach.example.com"))
+	assert.False(t, IsPublicHost("localhost"))
+	assert.False(t, IsPublicHost("api.LOCALHOST."))
+	assert.False(t, IsPublicHost("[::1]"))
+	assert.False(t, IsPublicHost("169.254.169.254"))
+}
+
+// Receivers on private addresses are never reached, and redirects aren't followed to wherever they point
+func TestWorkerOnlySendsToPublicAddresses(t *testing.T) {
+	reached := map[string]bool{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached[r.URL.Path] = true
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	delivery := func(id int64, path string) store.WebhookDelivery {
+		return store.WebhookDelivery{ID: id, URL: receiver.URL + path, Secret: "s3cret", EventID: "e1", EventType: "workout.created", Payload: []byte(`{}`)}
+	}
+
+	fake := &fakeStore{
+		deliveries: []store.WebhookDelivery{delivery(1, "/private")},
+		delivered:  map[int64]int{},
+		failed:     map[int64]*time.Time{},
+		errors:     map[int64]string{},
+	}
+	worker := NewWorker(fake, log.New(io.Discard, "", 0))
+	_, err := worker.RunOnce()
+	require.NoError(t, err)
+	assert.Empty(t, fake.delivered)
+	assert.Contains(t, fake.errors[1], ErrBlockedAddress.Error())
+	assert.False(t, reached["/private"])
+
+	// Even where the receiver is allowed, what it redirects to isn't
+	fake.deliveries = []store.WebhookDelivery{delivery(2, "/redirect")}
+	worker.client = newClient(func(netip.Addr) bool { return true })
+	_, err = worker.RunOnce()
+	require.NoError(t, err)
+	assert.Empty(t, fake.delivered)
+	assert.Contains(t, fake.errors[2], "307")
+	assert.True(t, reached["/redirect"])
+	assert.False(t, reached["/internal"])
+}
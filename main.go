@@ -1,13 +1,9 @@
 package main
 
 import (
-	"flag"
-	"fmt"
-	"net/http"
-	"time"
+	"os"
 
-	"github.com/OlivierCoq/go_api_template/internal/app"
-	"github.com/OlivierCoq/go_api_template/internal/routes"
+	"github.com/OlivierCoq/go_api_template/internal/cli"
 )
 
 /*
@@ -17,66 +13,8 @@ Note: in Go, constructors typically return a pointer to a struct and an error.
 - The point of using a structure is to group related data and methods together, making the code more organized and easier to manage.
 */
 func main() {
-
-	var port int // port number for the server to listen on
-	/*
-	  - the flag package in Go provides a way to define and parse command-line flags.
-	  - In this case, we are defining an integer flag named "port" with a default value of 8080 and a description "Port to run the server on".
-	  - The &port is a pointer to the variable where the parsed value will be stored.
-	*/
-	flag.IntVar(&port, "port", 8080, "Port to run the server on")
-	flag.Parse() // Parse command-line flags. Does heavy lifting of parsing flags
-
-	// Initialize the application (taken from internal/app/app.go):
-	app, err := app.NewApplication()
-	if err != nil {
-		// Worst case scenario, we panic here with the error. Will crash the app
-		panic(err)
-	}
-
-	// Ensure the database connection is closed when the application exits
-	// In a real-world application, you might want to handle this more gracefully
-	defer app.DB.Close()
-
-	app.Logger.Println("Application started. Werk it! 🚀")
-
-	// Set up routes and handlers
-
-	/*
-		Here, we would set up our routes and handlers e.g., http.HandleFunc("/some-endpoint", someHandlerFunction)
-		Routes have 2 arguments: path (where the function is), and the handler function itself:
-			(In Go, functions are first-class citizens, meaning they can be passed around as values
-			- This allows us to pass the function name without parentheses, which would call the function immediately)
-	*/
-	// Here, we are passing the HealthCheck function as a value to the HandleFunc method (Methods are defined below)
-	// http.HandleFunc("/health", HealthCheck)
-
-	// Using chi router instead of default http package router ^
-	r := routes.SetupRoutes(app)
-
-	// Use the chi router as the main handler for incoming requests
-	http.Handle("/", r)
-
-	// Note: In a real-world application, you would likely have more complex routing and middleware setup here.
-
-	// Set up server:
-
-	// declare a new server with specific configurations
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", port), // returns variable port as a string with a colon in front of it
-		IdleTimeout:  time.Minute,              // how long to wait before closing idle connections
-		ReadTimeout:  10 * time.Second,         // max duration for reading the entire request, including the body
-		WriteTimeout: 30 * time.Second,         // max duration before timing out writes of the response
-	}
-	app.Logger.Printf("Starting server on port %d\n", port)
-
-	// Start the server
-	err = server.ListenAndServe()
-	// Wait for crashes or shutdown. Always fail first.
-	if err != nil {
-		app.Logger.Println(err)
-	}
-	app.Logger.Println("Application stopped. Bye! 👋")
+	// Commands, e.g. `go run main.go export -user 42 -format csv` (see internal/cli). Without one, we start the server.
+	os.Exit(cli.Run(os.Args[1:]))
 }
 
 // Methods
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+    ADD COLUMN IF NOT EXISTS planned_for TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'completed';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts
+    ADD CONSTRAINT valid_workout_status CHECK (status IN ('planned', 'completed', 'skipped'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_workouts_user_planned_for ON workouts (user_id, planned_for) WHERE planned_for IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_user_planned_for;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts
+    DROP CONSTRAINT IF EXISTS valid_workout_status,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS planned_for;
+-- +goose StatementEnd
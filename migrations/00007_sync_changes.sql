@@ -0,0 +1,84 @@
+-- +goose Up
+-- Client-generated UUIDs. Existing rows get a random one (md5 of random data, so no extension is needed on Postgres 12).
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL DEFAULT (md5(random()::text || clock_timestamp()::text)::uuid);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_entries ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL DEFAULT (md5(random()::text || clock_timestamp()::text)::uuid);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workouts_uuid ON workouts (uuid);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workout_entries_uuid ON workout_entries (uuid);
+-- +goose StatementEnd
+
+-- Change feed. Every insert, update and delete of a workout or entry adds a row here; the id is the sync cursor.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sync_changes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT,
+    entity VARCHAR(20) NOT NULL, -- workout or entry
+    entity_uuid UUID NOT NULL,
+    op VARCHAR(10) NOT NULL, -- upsert or delete
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_sync_changes_user_id ON sync_changes (user_id, id);
+-- +goose StatementEnd
+
+-- Triggers record the changes, so every code path that touches workouts (API, imports, batches...) is tracked without having to remember it.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_sync_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (OLD.user_id, TG_ARGV[0], OLD.uuid, 'delete');
+        RETURN OLD;
+    END IF;
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, TG_ARGV[0], NEW.uuid, 'upsert');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workouts_sync_changes
+    AFTER INSERT OR UPDATE OR DELETE ON workouts
+    FOR EACH ROW EXECUTE FUNCTION record_sync_change('workout');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workout_entries_sync_changes
+    AFTER INSERT OR UPDATE OR DELETE ON workout_entries
+    FOR EACH ROW EXECUTE FUNCTION record_sync_change('entry');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workout_entries_sync_changes ON workout_entries;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workouts_sync_changes ON workouts;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS record_sync_change();
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sync_changes;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP COLUMN IF EXISTS uuid;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN IF EXISTS uuid;
+-- +goose StatementEnd
@@ -0,0 +1,55 @@
+-- +goose Up
+-- Soft deletes: deleted workouts stay in the table, with deleted_at set, until they're purged from the trash.
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_workouts_deleted_at ON workouts (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- Putting a workout in the trash is a delete as far as sync clients are concerned, and restoring it an upsert.
+-- Entries don't have deleted_at, so the check only runs for workouts (PL/pgSQL would fail on a missing field otherwise).
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_sync_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (OLD.user_id, TG_ARGV[0], OLD.uuid, 'delete');
+        RETURN OLD;
+    END IF;
+    IF TG_ARGV[0] = 'workout' THEN
+        IF NEW.deleted_at IS NOT NULL THEN
+            -- Only the move to the trash is recorded, not later changes to a trashed workout
+            IF TG_OP = 'UPDATE' AND OLD.deleted_at IS NULL THEN
+                INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, TG_ARGV[0], NEW.uuid, 'delete');
+            END IF;
+            RETURN NEW;
+        END IF;
+    END IF;
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, TG_ARGV[0], NEW.uuid, 'upsert');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_sync_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (OLD.user_id, TG_ARGV[0], OLD.uuid, 'delete');
+        RETURN OLD;
+    END IF;
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, TG_ARGV[0], NEW.uuid, 'upsert');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_deleted_at;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
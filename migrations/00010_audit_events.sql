@@ -0,0 +1,65 @@
+-- +goose Up
+-- Admins can read the audit log
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- Audit log: who did what, and when. actor_id has no foreign key on purpose, so the history of a deleted user is kept.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    actor_id BIGINT, -- NULL when nobody is logged in, e.g. a failed login
+    action VARCHAR(100) NOT NULL, -- e.g. login.failed, workout.updated
+    resource VARCHAR(50) NOT NULL, -- e.g. user, token, workout
+    resource_id VARCHAR(100),
+    ip VARCHAR(100),
+    user_agent TEXT,
+    before JSONB, -- State before the change
+    after JSONB, -- State after the change
+    changes JSONB, -- Fields that changed, {"field": {"from": ..., "to": ...}}
+    metadata JSONB
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id, id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_audit_events_resource ON audit_events (resource, resource_id, id);
+-- +goose StatementEnd
+
+-- Append-only: rows can be inserted, never changed or removed
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION prevent_audit_event_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION prevent_audit_event_change();
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION prevent_audit_event_change();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS audit_events;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS prevent_audit_event_change();
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+-- +goose StatementEnd
@@ -0,0 +1,65 @@
+-- +goose Up
+-- Webhook subscriptions: where to send which events of a user, and the secret their payloads are signed with
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    event_types TEXT[] NOT NULL, -- e.g. {workout.created,record.achieved}
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_user_id ON webhook_subscriptions (user_id);
+-- +goose StatementEnd
+
+-- Outbox: one row per event and subscription, written in the same transaction as the change it's about,
+-- so an event is never lost (or sent for a change that was rolled back). The delivery worker sends pending rows
+-- whose next_attempt_at has passed, and gives up on them (status failed) after too many attempts.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL, -- Same for every subscription the event is sent to, so receivers can deduplicate
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_attempt_at TIMESTAMP WITH TIME ZONE,
+    last_status_code INTEGER, -- HTTP status of the last attempt, NULL if the request itself failed
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP WITH TIME ZONE
+);
+-- +goose StatementEnd
+
+-- Only pending deliveries are polled, so only they need indexing
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+-- +goose StatementEnd
+
+-- Dead letters: deliveries the worker gave up on, along with who they were for
+-- +goose StatementBegin
+CREATE OR REPLACE VIEW webhook_dead_letters AS
+    SELECT d.id, d.subscription_id, s.user_id, s.url, d.event_id, d.event_type, d.payload, d.attempts,
+           d.last_attempt_at, d.last_status_code, d.last_error, d.created_at
+    FROM webhook_deliveries d
+    JOIN webhook_subscriptions s ON s.id = d.subscription_id
+    WHERE d.status = 'failed';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP VIEW IF EXISTS webhook_dead_letters;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS webhook_deliveries;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS webhook_subscriptions;
+-- +goose StatementEnd
@@ -0,0 +1,61 @@
+-- +goose Up
+-- Live workout sessions: a workout being done right now, set by set, until it's finished and saved as a workout
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_sessions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    template_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL, -- The workout the session was started from, if any
+    title VARCHAR(100) NOT NULL, -- Same as workouts, since the session becomes one
+    description TEXT,
+    plan JSONB, -- Entries of the template when the session started, for the client to follow
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused', 'finished', 'expired')),
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    paused_at TIMESTAMP WITH TIME ZONE, -- Set while paused
+    paused_seconds INTEGER NOT NULL DEFAULT 0, -- Time spent paused before the current pause, if any
+    rest_started_at TIMESTAMP WITH TIME ZONE,
+    rest_ends_at TIMESTAMP WITH TIME ZONE,
+    last_activity_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Sessions left alone for too long expire
+    finished_at TIMESTAMP WITH TIME ZONE,
+    workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL -- The workout the session was saved as
+);
+-- +goose StatementEnd
+
+-- A user has at most one session going on
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workout_sessions_one_open ON workout_sessions (user_id) WHERE status IN ('active', 'paused');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_workout_sessions_last_activity ON workout_sessions (last_activity_at) WHERE status IN ('active', 'paused');
+-- +goose StatementEnd
+
+-- Sets logged during a session, timestamped by the server
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS session_sets (
+    id BIGSERIAL PRIMARY KEY,
+    session_id BIGINT NOT NULL REFERENCES workout_sessions(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    reps INTEGER,
+    duration_seconds INTEGER,
+    weight DECIMAL(5, 2),
+    notes TEXT,
+    logged_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_session_set CHECK (
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+        (reps IS NULL OR duration_seconds IS NULL)
+    )
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_session_sets_session_id ON session_sets (session_id, logged_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS session_sets;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workout_sessions;
+-- +goose StatementEnd
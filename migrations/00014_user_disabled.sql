@@ -0,0 +1,10 @@
+-- +goose Up
+-- Disabled users can't log in, and their tokens stop working. Set and cleared from the command line (user disable/enable).
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
+-- +goose StatementEnd
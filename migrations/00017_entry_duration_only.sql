@@ -0,0 +1,12 @@
+-- +goose Up
+-- Timed exercises (a plank, a run...) have a duration and no reps. valid_workout_entry already requires exactly one of
+-- the two, but reps was also NOT NULL, which refused every duration-only entry.
+-- +goose StatementBegin
+ALTER TABLE workout_entries ALTER COLUMN reps DROP NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- Fails while duration-only entries exist
+-- +goose StatementBegin
+ALTER TABLE workout_entries ALTER COLUMN reps SET NOT NULL;
+-- +goose StatementEnd
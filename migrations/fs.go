@@ -4,5 +4,7 @@ import (
 	"embed"
 )
 
-//go:embed *.sql
+// Postgres migrations are at the root, their SQLite versions in sqlite/ (see store.Migrate)
+//
+//go:embed *.sql sqlite/*.sql
 var FS embed.FS
@@ -0,0 +1,19 @@
+-- +goose Up
+-- SQLite version of ../00001_users.sql. Each migration here mirrors the Postgres one with the same version.
+-- Timestamps are text in UTC ("2025-03-14 10:00:00.000+00:00"), the format the Go driver writes, so they sort and compare as times.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT, -- AUTOINCREMENT, so IDs are never reused, like BIGSERIAL
+    username VARCHAR(50) UNIQUE NOT NULL,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    password_hash BLOB NOT NULL,
+    bio TEXT,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
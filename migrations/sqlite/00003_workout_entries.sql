@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    sets INT NOT NULL,
+    reps INT NOT NULL,
+    duration_seconds INT,
+    weight DECIMAL(5,2),
+    notes TEXT,
+    order_index INT NOT NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    CONSTRAINT valid_workout_entry CHECK (
+      (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+      (reps IS NULL OR duration_seconds IS NULL)
+    )
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workout_entries;
+-- +goose StatementEnd
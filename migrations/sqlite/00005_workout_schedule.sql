@@ -0,0 +1,27 @@
+-- +goose Up
+-- SQLite adds one column per statement, and can't add a constraint to an existing table: the check goes with the column
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN planned_for TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'completed'
+    CONSTRAINT valid_workout_status CHECK (status IN ('planned', 'completed', 'skipped'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_workouts_user_planned_for ON workouts (user_id, planned_for) WHERE planned_for IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_user_planned_for;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN status;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN planned_for;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN external_id VARCHAR(255);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- Partial index: workouts without an external ID are never considered duplicates of each other
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workouts_user_external_id ON workouts (user_id, external_id) WHERE external_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_user_external_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN external_id;
+-- +goose StatementEnd
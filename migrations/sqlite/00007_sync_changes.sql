@@ -0,0 +1,132 @@
+-- +goose Up
+-- Client-generated UUIDs, as text. SQLite can't add a column with a random default, so existing rows get theirs afterwards
+-- (random version 4 UUIDs); new rows always come with one from the store.
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN uuid TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_entries ADD COLUMN uuid TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE workouts SET uuid = lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+    substr('89ab', abs(random()) % 4 + 1, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE workout_entries SET uuid = lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+    substr('89ab', abs(random()) % 4 + 1, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workouts_uuid ON workouts (uuid);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workout_entries_uuid ON workout_entries (uuid);
+-- +goose StatementEnd
+
+-- Change feed. Every insert, update and delete of a workout or entry adds a row here; the id is the sync cursor.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sync_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT,
+    entity VARCHAR(20) NOT NULL, -- workout or entry
+    entity_uuid TEXT NOT NULL,
+    op VARCHAR(10) NOT NULL, -- upsert or delete
+    changed_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_sync_changes_user_id ON sync_changes (user_id, id);
+-- +goose StatementEnd
+
+-- Triggers record the changes, like on Postgres. SQLite triggers have no arguments or TG_OP, so there is one per table and operation.
+-- +goose StatementBegin
+CREATE TRIGGER workouts_sync_insert AFTER INSERT ON workouts
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'workout', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workouts_sync_update AFTER UPDATE ON workouts
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'workout', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workouts_sync_delete AFTER DELETE ON workouts
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (OLD.user_id, 'workout', OLD.uuid, 'delete');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workout_entries_sync_insert AFTER INSERT ON workout_entries
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'entry', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workout_entries_sync_update AFTER UPDATE ON workout_entries
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'entry', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workout_entries_sync_delete AFTER DELETE ON workout_entries
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (OLD.user_id, 'entry', OLD.uuid, 'delete');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workout_entries_sync_delete;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workout_entries_sync_update;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workout_entries_sync_insert;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workouts_sync_delete;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workouts_sync_update;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workouts_sync_insert;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sync_changes;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workout_entries_uuid;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_uuid;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP COLUMN uuid;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN uuid;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Version of each workout, incremented on every update. Used for optimistic concurrency (ETag / If-Match on the API).
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN version INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN version;
+-- +goose StatementEnd
@@ -0,0 +1,75 @@
+-- +goose Up
+-- Soft deletes: deleted workouts stay in the table, with deleted_at set, until they're purged from the trash.
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN deleted_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_workouts_deleted_at ON workouts (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- Putting a workout in the trash is a delete as far as sync clients are concerned, and restoring it an upsert.
+-- Only the move to the trash is recorded, not later changes to a trashed workout.
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workouts_sync_insert;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workouts_sync_update;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workouts_sync_insert AFTER INSERT ON workouts WHEN NEW.deleted_at IS NULL
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'workout', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workouts_sync_update AFTER UPDATE ON workouts WHEN NEW.deleted_at IS NULL
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'workout', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workouts_sync_trash AFTER UPDATE ON workouts WHEN NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'workout', NEW.uuid, 'delete');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workouts_sync_trash;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workouts_sync_update;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS workouts_sync_insert;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workouts_sync_insert AFTER INSERT ON workouts
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'workout', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workouts_sync_update AFTER UPDATE ON workouts
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'workout', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_deleted_at;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,56 @@
+-- +goose Up
+-- Admins can read the audit log
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- Audit log: who did what, and when. actor_id has no foreign key on purpose, so the history of a deleted user is kept.
+-- The JSON columns hold JSON text.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS audit_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    occurred_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    actor_id BIGINT, -- NULL when nobody is logged in, e.g. a failed login
+    action VARCHAR(100) NOT NULL, -- e.g. login.failed, workout.updated
+    resource VARCHAR(50) NOT NULL, -- e.g. user, token, workout
+    resource_id VARCHAR(100),
+    ip VARCHAR(100),
+    user_agent TEXT,
+    before TEXT, -- State before the change
+    after TEXT, -- State after the change
+    changes TEXT, -- Fields that changed, {"field": {"from": ..., "to": ...}}
+    metadata TEXT
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id, id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_audit_events_resource ON audit_events (resource, resource_id, id);
+-- +goose StatementEnd
+
+-- Append-only: rows can be inserted, never changed or removed (SQLite has no TRUNCATE, a DELETE without WHERE is caught too)
+-- +goose StatementBegin
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS audit_events;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN is_admin;
+-- +goose StatementEnd
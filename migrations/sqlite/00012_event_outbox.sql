@@ -0,0 +1,26 @@
+-- +goose Up
+-- Outbox of domain events (see the events package), written in the same transaction as the change they describe
+-- and handed to in-process subscribers by the dispatcher.
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_type VARCHAR(100) NOT NULL, -- e.g. workout.created
+    payload TEXT NOT NULL,
+    occurred_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    available_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')), -- Not dispatched before then, pushed back after a failure
+    attempts INTEGER NOT NULL DEFAULT 0, -- Failed dispatches
+    last_error TEXT,
+    dispatched_at TIMESTAMP,
+    failed_at TIMESTAMP -- Set when the dispatcher gave up on the event
+);
+-- +goose StatementEnd
+
+-- Only pending events are polled
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_event_outbox_pending ON event_outbox (id) WHERE dispatched_at IS NULL AND failed_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS event_outbox;
+-- +goose StatementEnd
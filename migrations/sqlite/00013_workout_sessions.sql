@@ -0,0 +1,61 @@
+-- +goose Up
+-- Live workout sessions: a workout being done right now, set by set, until it's finished and saved as a workout
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    template_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL, -- The workout the session was started from, if any
+    title VARCHAR(100) NOT NULL, -- Same as workouts, since the session becomes one
+    description TEXT,
+    plan TEXT, -- Entries of the template when the session started (JSON), for the client to follow
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused', 'finished', 'expired')),
+    started_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    paused_at TIMESTAMP, -- Set while paused
+    paused_seconds INTEGER NOT NULL DEFAULT 0, -- Time spent paused before the current pause, if any
+    rest_started_at TIMESTAMP,
+    rest_ends_at TIMESTAMP,
+    last_activity_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')), -- Sessions left alone for too long expire
+    finished_at TIMESTAMP,
+    workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL -- The workout the session was saved as
+);
+-- +goose StatementEnd
+
+-- A user has at most one session going on
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workout_sessions_one_open ON workout_sessions (user_id) WHERE status IN ('active', 'paused');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_workout_sessions_last_activity ON workout_sessions (last_activity_at) WHERE status IN ('active', 'paused');
+-- +goose StatementEnd
+
+-- Sets logged during a session, timestamped by the server
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS session_sets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id BIGINT NOT NULL REFERENCES workout_sessions(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    reps INTEGER,
+    duration_seconds INTEGER,
+    weight DECIMAL(5, 2),
+    notes TEXT,
+    logged_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    CONSTRAINT valid_session_set CHECK (
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+        (reps IS NULL OR duration_seconds IS NULL)
+    )
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_session_sets_session_id ON session_sets (session_id, logged_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS session_sets;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workout_sessions;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Disabled users can't log in, and their tokens stop working. Set and cleared from the command line (user disable/enable).
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN disabled_at;
+-- +goose StatementEnd
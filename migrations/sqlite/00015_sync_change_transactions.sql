@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQLite commits one transaction at a time, so ids already follow the order changes become visible in: only the index
+-- used to prune superseded changes is needed here.
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_sync_changes_entity ON sync_changes (entity_uuid, entity);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_sync_changes_entity;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Deliveries are enqueued by a subscriber of the domain events, which can see the same event twice: an event is only
+-- delivered once to each subscription. Event IDs were random until now, so existing rows are already unique.
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries (subscription_id, event_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_webhook_deliveries_event;
+-- +goose StatementEnd
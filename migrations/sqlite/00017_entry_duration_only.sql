@@ -0,0 +1,125 @@
+-- +goose Up
+-- Timed exercises (a plank, a run...) have a duration and no reps: see the Postgres migration. SQLite can't drop NOT NULL
+-- from a column, so the table is rebuilt without it, along with its index and the sync triggers, which go with the old table.
+-- Nothing references workout_entries, and dropping a table doesn't run its triggers, so the copy leaves sync_changes alone.
+-- +goose StatementBegin
+CREATE TABLE workout_entries_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    sets INT NOT NULL,
+    reps INT,
+    duration_seconds INT,
+    weight DECIMAL(5,2),
+    notes TEXT,
+    order_index INT NOT NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    uuid TEXT NOT NULL DEFAULT '',
+    CONSTRAINT valid_workout_entry CHECK (
+      (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+      (reps IS NULL OR duration_seconds IS NULL)
+    )
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO workout_entries_new (id, user_id, workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index, created_at, uuid)
+    SELECT id, user_id, workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index, created_at, uuid
+    FROM workout_entries;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE workout_entries;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_entries_new RENAME TO workout_entries;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workout_entries_uuid ON workout_entries (uuid);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workout_entries_sync_insert AFTER INSERT ON workout_entries
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'entry', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workout_entries_sync_update AFTER UPDATE ON workout_entries
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'entry', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workout_entries_sync_delete AFTER DELETE ON workout_entries
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (OLD.user_id, 'entry', OLD.uuid, 'delete');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- Fails while duration-only entries exist
+-- +goose StatementBegin
+CREATE TABLE workout_entries_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    sets INT NOT NULL,
+    reps INT NOT NULL,
+    duration_seconds INT,
+    weight DECIMAL(5,2),
+    notes TEXT,
+    order_index INT NOT NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    uuid TEXT NOT NULL DEFAULT '',
+    CONSTRAINT valid_workout_entry CHECK (
+      (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+      (reps IS NULL OR duration_seconds IS NULL)
+    )
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO workout_entries_new (id, user_id, workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index, created_at, uuid)
+    SELECT id, user_id, workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index, created_at, uuid
+    FROM workout_entries;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE workout_entries;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_entries_new RENAME TO workout_entries;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workout_entries_uuid ON workout_entries (uuid);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workout_entries_sync_insert AFTER INSERT ON workout_entries
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'entry', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workout_entries_sync_update AFTER UPDATE ON workout_entries
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (NEW.user_id, 'entry', NEW.uuid, 'upsert');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER workout_entries_sync_delete AFTER DELETE ON workout_entries
+BEGIN
+    INSERT INTO sync_changes (user_id, entity, entity_uuid, op) VALUES (OLD.user_id, 'entry', OLD.uuid, 'delete');
+END;
+-- +goose StatementEnd